@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 
+	"github.com/praetordev/praetor/pkg/content"
 	"github.com/praetordev/praetor/pkg/db"
+	natsTransport "github.com/praetordev/praetor/pkg/transport/nats"
 	"github.com/praetordev/praetor/services/api"
+	"github.com/praetordev/praetor/services/api/handlers"
 )
 
 func main() {
@@ -22,7 +26,34 @@ func main() {
 		log.Println("Starting in NO-DB mode (endpoints will fail)")
 	}
 
-	router := api.NewRouter(database)
+	// Bulk operations are applied in the background; those of an API
+	// instance that stopped will never finish
+	if database != nil {
+		if n, err := handlers.NewBulkResource(database).FailInterrupted(context.Background()); err != nil {
+			log.Printf("Warning: Failed to fail interrupted bulk operations: %v", err)
+		} else if n > 0 {
+			log.Printf("Marked %d interrupted bulk operations failed", n)
+		}
+	}
+
+	// Artifact archives are served from the object store when NATS is up
+	var artifacts content.Store
+	natsURL := os.Getenv("NATS_URL")
+	if natsURL == "" {
+		natsURL = "nats://127.0.0.1:4222"
+	}
+	if bus, err := natsTransport.NewNatsBus(natsURL); err != nil {
+		log.Printf("Warning: Failed to connect to NATS, artifact archives unavailable: %v", err)
+	} else {
+		defer bus.Close()
+		if store, err := bus.EnsureObjectStore(context.Background(), natsTransport.BucketJobArtifacts); err != nil {
+			log.Printf("Warning: Job artifact store unavailable: %v", err)
+		} else {
+			artifacts = store
+		}
+	}
+
+	router := api.NewRouter(database, artifacts)
 
 	fmt.Printf("Praetor API Service starting on port %s...\n", port)
 	if err := http.ListenAndServe(":"+port, router); err != nil {
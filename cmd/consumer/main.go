@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
@@ -41,8 +42,26 @@ func main() {
 
 	// 3. Create Consumer
 	writer := core.NewDBWriter(database)
+	if results, err := bus.EnsureObjectStore(context.Background(), natsTransport.BucketInventoryUpdates); err != nil {
+		log.Printf("Inventory update store unavailable, large inventories cannot be ingested: %v", err)
+	} else {
+		writer.Results = results
+	}
+	if artifacts, err := bus.EnsureObjectStore(context.Background(), natsTransport.BucketJobArtifacts); err != nil {
+		log.Printf("Job artifact store unavailable, replaced artifact archives are kept: %v", err)
+	} else {
+		writer.Artifacts = artifacts
+	}
 	consumer := core.NewConsumer(bus, writer)
 
+	// Executors register themselves through the consumer, which owns the DB
+	err = bus.ServeInstanceRegistrations(func(reg events.InstanceRegistration) (events.InstanceRegistrationReply, error) {
+		return writer.RegisterInstance(context.Background(), reg)
+	})
+	if err != nil {
+		log.Fatalf("Failed to serve instance registrations: %v", err)
+	}
+
 	// 4. Start
 	if err := consumer.Start(); err != nil {
 		log.Fatalf("Consumer failed: %v", err)
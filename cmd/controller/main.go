@@ -1,22 +1,52 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/praetordev/praetor/pkg/db"
+	"github.com/praetordev/praetor/pkg/models"
+	natsTransport "github.com/praetordev/praetor/pkg/transport/nats"
 	"github.com/praetordev/praetor/services/controller/core"
+	"github.com/praetordev/praetor/services/controller/k8s"
 )
 
 func main() {
+	log.Println("Starting Controller Service...")
+
+	database, err := db.InitDB()
+	if err != nil {
+		log.Fatalf("Failed to connect to DB: %v", err)
+	}
+
 	natsURL := os.Getenv("NATS_URL")
 	if natsURL == "" {
 		natsURL = "nats://127.0.0.1:4222"
 	}
+	bus, err := natsTransport.NewNatsBus(natsURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer bus.Close()
+
+	// Pull the requests of jobs on the kubernetes backend, such as those of
+	// container groups
+	if err := bus.EnsureExecutionQueue(context.Background()); err != nil {
+		log.Fatalf("Failed to set up execution queue: %v", err)
+	}
+	bus.ServeBackends(models.BackendKubernetes)
 
-	controller, err := core.NewController(natsURL)
+	client, err := k8s.NewClient()
 	if err != nil {
-		log.Fatalf("Failed to initialize controller: %v", err)
+		log.Fatalf("Failed to initialize Kubernetes client: %v", err)
 	}
 
-	controller.Start()
+	controller := core.NewController(client, bus, core.NewDBRunStore(database), core.ConfigFromEnv())
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	controller.Start(ctx)
 }
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/praetordev/praetor/pkg/content"
 	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/models"
 	natsTransport "github.com/praetordev/praetor/pkg/transport/nats"
 	"github.com/praetordev/praetor/services/executor/core"
 )
@@ -27,6 +35,57 @@ func main() {
 	// runner := &core.MockRunner{}
 	runner := core.NewAnsibleRunner()
 
+	// Serve projects from synced archives; without the object store, only
+	// projects synced by this executor are cached.
+	cacheDir := os.Getenv("PROJECT_CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = "/tmp/praetor_project_cache"
+	}
+	cacheMB := int64(2048)
+	if val := os.Getenv("PROJECT_CACHE_MAX_MB"); val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n > 0 {
+			cacheMB = n
+		} else {
+			log.Printf("Invalid PROJECT_CACHE_MAX_MB %q, using %d", val, cacheMB)
+		}
+	}
+	var store content.Store
+	if objects, err := bus.EnsureObjectStore(context.Background(), natsTransport.BucketProjectArchives); err != nil {
+		log.Printf("Project archive store unavailable, caching locally only: %v", err)
+	} else {
+		store = objects
+	}
+	if cache, err := core.NewProjectCache(cacheDir, cacheMB<<20, store); err != nil {
+		log.Printf("Project cache disabled: %v", err)
+	} else {
+		runner.Cache = cache
+	}
+
+	if results, err := bus.EnsureObjectStore(context.Background(), natsTransport.BucketInventoryUpdates); err != nil {
+		log.Printf("Inventory update store unavailable, large inventories will fail: %v", err)
+	} else {
+		runner.Results = results
+	}
+
+	if facts, err := bus.EnsureObjectStore(context.Background(), natsTransport.BucketFactCaches); err != nil {
+		log.Printf("Fact cache store unavailable, jobs will run without stored facts: %v", err)
+	} else {
+		runner.Facts = facts
+	}
+
+	// Tarballs of run artifacts are only kept when asked for
+	if val := os.Getenv("EXECUTOR_ARCHIVE_ARTIFACTS"); val != "" {
+		if archive, err := strconv.ParseBool(val); err != nil {
+			log.Printf("Invalid EXECUTOR_ARCHIVE_ARTIFACTS %q, not archiving artifacts", val)
+		} else if archive {
+			if artifacts, err := bus.EnsureObjectStore(context.Background(), natsTransport.BucketJobArtifacts); err != nil {
+				log.Printf("Job artifact store unavailable, not archiving artifacts: %v", err)
+			} else {
+				runner.Artifacts = artifacts
+			}
+		}
+	}
+
 	// Check for One-Shot Mode
 	if os.Getenv("PRAETOR_MODE") == "oneshot" {
 		log.Println("Starting in ONE-SHOT mode")
@@ -61,10 +120,23 @@ func main() {
 			doneChan <- true
 		}()
 
+		// Cancel the run on SIGINT/SIGTERM so the pod reports it instead of vanishing
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
 		// Run job
-		if err := runner.Run(&req, eventChan); err != nil {
+		if err := runner.Run(ctx, &req, eventChan); err != nil {
 			log.Printf("Job execution failed: %v", err)
-			// TODO: Publish failure event?
+			msg := fmt.Sprintf("Job execution failed: %v", err)
+			eventChan <- events.JobEvent{
+				ExecutionRunID: req.ExecutionRunID,
+				UnifiedJobID:   req.UnifiedJobID,
+				EventType:      "JOB_FAILED",
+				Timestamp:      time.Now(),
+				StdoutSnippet:  &msg,
+			}
+			close(eventChan)
+			<-doneChan
 			os.Exit(1)
 		}
 
@@ -74,11 +146,61 @@ func main() {
 		return
 	}
 
-	// 2. Create Agent (Daemon Mode)
+	// 2. Create Agent (Daemon Mode), pulling the jobs of the process backend
+	// from the work queue, and those of its container runtime if one is set
+	if err := bus.EnsureExecutionQueue(context.Background()); err != nil {
+		log.Fatalf("Failed to set up execution queue: %v", err)
+	}
 	agent := core.NewAgent(bus, bus, runner)
+	agent.Registrar = bus
+
+	// Jobs of instance groups on the docker or podman backend run in
+	// containers of the executor image
+	if runtime := os.Getenv("EXECUTOR_CONTAINER_RUNTIME"); runtime != "" {
+		if runtime != models.BackendDocker && runtime != models.BackendPodman {
+			log.Fatalf("Unsupported EXECUTOR_CONTAINER_RUNTIME %q, use docker or podman", runtime)
+		}
+		image := os.Getenv("EXECUTOR_IMAGE")
+		if image == "" {
+			image = "praetor-executor:latest"
+		}
+		runDir := os.Getenv("EXECUTOR_CONTAINER_RUN_DIR")
+		if runDir == "" {
+			runDir = "/tmp/praetor_containers"
+		}
+		containers := core.NewContainerBackend(runtime, image, natsURL, runDir)
+		containers.Network = os.Getenv("EXECUTOR_CONTAINER_NETWORK")
+		agent.Backends.Backends[runtime] = containers
+		log.Printf("Running %s backend jobs in %s containers of %s", runtime, runtime, image)
+		bus.ServeBackends(models.BackendProcess, runtime)
+	}
+
+	// 3. Drain on SIGINT/SIGTERM
+	drainTimeout := 30 * time.Second
+	if val := os.Getenv("EXECUTOR_DRAIN_TIMEOUT"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			drainTimeout = d
+		} else {
+			log.Printf("Invalid EXECUTOR_DRAIN_TIMEOUT %q, using %s", val, drainTimeout)
+		}
+	}
+
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-sigs
+		log.Printf("Received %s, draining (timeout %s)...", sig, drainTimeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		if err := agent.Stop(ctx); err != nil {
+			log.Printf("Drain incomplete: %v", err)
+		}
+	}()
 
-	// 3. Start
+	// 4. Start (returns once drained)
 	if err := agent.Start(); err != nil {
 		log.Fatalf("Agent failed: %v", err)
 	}
+	log.Println("Executor shut down.")
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -33,9 +34,22 @@ func main() {
 	}
 	defer bus.Close()
 
+	// Queue requests in JetStream so executors pull them when they have capacity
+	if err := bus.EnsureExecutionQueue(context.Background()); err != nil {
+		log.Fatalf("Failed to set up execution queue: %v", err)
+	}
+
 	// 3. Init Scheduler
 	// Poll every 5 seconds
 	sched := core.NewScheduler(database, 5*time.Second, bus)
+	// Generated inventories are only logged when debugging
+	sched.Debug = os.Getenv("SCHEDULER_DEBUG") == "true"
+	// Seeded facts travel through the object store, not the request
+	if facts, err := bus.EnsureObjectStore(context.Background(), natsTransport.BucketFactCaches); err != nil {
+		log.Printf("Fact cache store unavailable, jobs will run without stored facts: %v", err)
+	} else {
+		sched.Facts = facts
+	}
 
 	// 3. Start loop in background
 	go sched.Start()
@@ -0,0 +1,6 @@
+-- Rollback: Remove project update tracking
+ALTER TABLE projects DROP COLUMN IF EXISTS last_update_job_id;
+ALTER TABLE projects DROP COLUMN IF EXISTS last_synced_at;
+ALTER TABLE projects DROP COLUMN IF EXISTS scm_revision;
+DROP INDEX IF EXISTS idx_unified_jobs_kind_template;
+ALTER TABLE unified_jobs DROP COLUMN IF EXISTS kind;
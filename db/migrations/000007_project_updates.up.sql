@@ -0,0 +1,9 @@
+-- Project updates run as unified jobs. For kind = 'project_update' the
+-- unified_job_template_id refers to projects(id) instead of job_templates(id).
+ALTER TABLE unified_jobs ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'job'; -- job, project_update
+CREATE INDEX IF NOT EXISTS idx_unified_jobs_kind_template ON unified_jobs (kind, unified_job_template_id);
+
+-- Commit SHA of the last successful sync; jobs are pinned to this revision
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS scm_revision TEXT;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS last_synced_at TIMESTAMPTZ;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS last_update_job_id BIGINT REFERENCES unified_jobs(id) ON DELETE SET NULL;
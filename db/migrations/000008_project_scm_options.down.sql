@@ -0,0 +1,8 @@
+-- Rollback: Remove project source control options
+ALTER TABLE projects DROP COLUMN IF EXISTS scm_checksum;
+ALTER TABLE projects DROP COLUMN IF EXISTS scm_lfs;
+ALTER TABLE projects DROP COLUMN IF EXISTS scm_submodules;
+ALTER TABLE projects DROP COLUMN IF EXISTS credential_id;
+DELETE FROM credential_types ct
+WHERE ct.name = 'Source Control'
+  AND NOT EXISTS (SELECT 1 FROM credentials c WHERE c.credential_type_id = ct.id);
@@ -0,0 +1,22 @@
+-- Source control options for project syncs. For scm_type = 'archive' the
+-- scm_url points at a tar/zip download; for 'manual' it is a directory under
+-- the executor's projects root.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS credential_id BIGINT REFERENCES credentials(id) ON DELETE SET NULL;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS scm_submodules BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS scm_lfs BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS scm_checksum TEXT; -- archive: expected sha256:<hex> digest
+
+-- Built-in credential type used by projects
+INSERT INTO credential_types (name, description, inputs)
+VALUES (
+    'Source Control',
+    'Username/password or token for HTTPS, or an SSH private key, for project syncs',
+    '{"fields": [
+        {"id": "username", "label": "Username", "type": "string"},
+        {"id": "password", "label": "Password or Token", "type": "string", "secret": true},
+        {"id": "ssh_key_data", "label": "SCM Private Key", "type": "string", "secret": true, "multiline": true},
+        {"id": "ssh_key_unlock", "label": "Private Key Passphrase", "type": "string", "secret": true},
+        {"id": "known_hosts", "label": "Known Hosts", "type": "string", "multiline": true}
+    ]}'::jsonb
+)
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,5 @@
+-- Rollback: Remove organization Galaxy servers
+DROP TABLE IF EXISTS organization_galaxy_credentials;
+DELETE FROM credential_types ct
+WHERE ct.name = 'Ansible Galaxy/Automation Hub API Token'
+  AND NOT EXISTS (SELECT 1 FROM credentials c WHERE c.credential_type_id = ct.id);
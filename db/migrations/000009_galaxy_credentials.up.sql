@@ -0,0 +1,20 @@
+-- Galaxy / Automation Hub servers an organization's project syncs may install
+-- collections and roles from, in the order ansible-galaxy tries them.
+CREATE TABLE IF NOT EXISTS organization_galaxy_credentials (
+    organization_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    credential_id BIGINT NOT NULL REFERENCES credentials(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    PRIMARY KEY (organization_id, credential_id)
+);
+
+INSERT INTO credential_types (name, description, inputs)
+VALUES (
+    'Ansible Galaxy/Automation Hub API Token',
+    'Galaxy or Automation Hub server used to install project requirements',
+    '{"fields": [
+        {"id": "url", "label": "Galaxy Server URL", "type": "string"},
+        {"id": "auth_url", "label": "Auth Server URL", "type": "string"},
+        {"id": "token", "label": "API Token", "type": "string", "secret": true}
+    ]}'::jsonb
+)
+ON CONFLICT (name) DO NOTHING;
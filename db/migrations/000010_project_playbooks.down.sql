@@ -0,0 +1,2 @@
+-- Rollback: Remove detected playbooks
+ALTER TABLE projects DROP COLUMN IF EXISTS playbooks;
@@ -0,0 +1,2 @@
+-- Playbooks detected in the project at scm_revision, as a JSON array of paths
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS playbooks JSONB;
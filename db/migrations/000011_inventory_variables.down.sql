@@ -0,0 +1,2 @@
+-- Rollback: Remove inventory-level variables
+ALTER TABLE inventories DROP COLUMN IF EXISTS variables;
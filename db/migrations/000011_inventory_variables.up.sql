@@ -0,0 +1,2 @@
+-- Inventory-level variables, rendered as the "all" group's vars
+ALTER TABLE inventories ADD COLUMN IF NOT EXISTS variables JSONB DEFAULT '{}'::jsonb;
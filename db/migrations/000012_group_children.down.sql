@@ -0,0 +1,3 @@
+-- Rollback: Remove group-to-group mapping table
+DROP INDEX IF EXISTS idx_group_children_child;
+DROP TABLE IF EXISTS group_children;
@@ -0,0 +1,9 @@
+-- Group-to-group parent/child mapping for nested group hierarchies
+CREATE TABLE IF NOT EXISTS group_children (
+    parent_id BIGINT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    child_id BIGINT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    PRIMARY KEY (parent_id, child_id),
+    CHECK (parent_id <> child_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_children_child ON group_children(child_id);
@@ -0,0 +1,8 @@
+-- Rollback: Remove inventory sources and schedules
+DROP INDEX IF EXISTS idx_schedules_due;
+DROP TABLE IF EXISTS schedules;
+DROP INDEX IF EXISTS idx_groups_inventory_source;
+DROP INDEX IF EXISTS idx_hosts_inventory_source;
+ALTER TABLE groups DROP COLUMN IF EXISTS inventory_source_id;
+ALTER TABLE hosts DROP COLUMN IF EXISTS inventory_source_id;
+DROP TABLE IF EXISTS inventory_sources;
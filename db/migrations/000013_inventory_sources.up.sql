@@ -0,0 +1,45 @@
+-- Dynamic inventory sources. An inventory update (unified_jobs.kind =
+-- 'inventory_update', unified_job_template_id = inventory_sources.id) runs
+-- ansible-inventory --list against the source and ingests the result.
+CREATE TABLE IF NOT EXISTS inventory_sources (
+    id BIGSERIAL PRIMARY KEY,
+    inventory_id BIGINT NOT NULL REFERENCES inventories(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT,
+    source TEXT NOT NULL, -- script, scm, plugin
+    source_project_id BIGINT REFERENCES projects(id) ON DELETE SET NULL, -- scm: project holding the inventory file
+    source_path TEXT, -- scm: inventory file or directory relative to the project root
+    source_script TEXT, -- script: executable inventory script
+    source_vars JSONB, -- plugin: plugin configuration, including the "plugin" key
+    overwrite BOOLEAN NOT NULL DEFAULT FALSE, -- remove owned hosts and groups the source no longer reports
+    overwrite_vars BOOLEAN NOT NULL DEFAULT FALSE, -- replace variables instead of merging into them
+    last_update_job_id BIGINT REFERENCES unified_jobs(id) ON DELETE SET NULL,
+    last_updated_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    modified_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (inventory_id, name)
+);
+
+-- The source that last reported each host or group; NULL for manual entries
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS inventory_source_id BIGINT REFERENCES inventory_sources(id) ON DELETE SET NULL;
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS inventory_source_id BIGINT REFERENCES inventory_sources(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_hosts_inventory_source ON hosts(inventory_source_id);
+CREATE INDEX IF NOT EXISTS idx_groups_inventory_source ON groups(inventory_source_id);
+
+-- Interval schedules that launch job templates, project updates and
+-- inventory updates. unified_job_template_id refers to the table for kind.
+CREATE TABLE IF NOT EXISTS schedules (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL, -- job, project_update, inventory_update
+    unified_job_template_id BIGINT NOT NULL,
+    interval_seconds INTEGER NOT NULL CHECK (interval_seconds > 0),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_run_at TIMESTAMPTZ,
+    last_job_id BIGINT REFERENCES unified_jobs(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    modified_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedules_due ON schedules(next_run_at) WHERE enabled;
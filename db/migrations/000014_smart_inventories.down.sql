@@ -0,0 +1,3 @@
+-- Rollback: Remove smart inventory host filters
+ALTER TABLE inventories ALTER COLUMN kind SET DEFAULT 'smart';
+ALTER TABLE inventories DROP COLUMN IF EXISTS host_filter;
@@ -0,0 +1,7 @@
+-- Smart inventories select hosts from the organization's other inventories
+-- with a host filter, evaluated each time a job launches
+ALTER TABLE inventories ADD COLUMN IF NOT EXISTS host_filter TEXT;
+
+-- Inventories created with the old default were never smart
+UPDATE inventories SET kind = 'static' WHERE kind = 'smart' AND host_filter IS NULL;
+ALTER TABLE inventories ALTER COLUMN kind SET DEFAULT 'static'; -- static, smart
@@ -0,0 +1,3 @@
+-- Rollback: Remove constructed inventories
+DROP TABLE IF EXISTS inventory_inputs;
+ALTER TABLE inventories DROP COLUMN IF EXISTS constructed_rules;
@@ -0,0 +1,13 @@
+-- Constructed inventories combine the hosts of several input inventories and
+-- group them with constructed plugin rules when a job launches
+ALTER TABLE inventories ADD COLUMN IF NOT EXISTS constructed_rules JSONB;
+
+CREATE TABLE IF NOT EXISTS inventory_inputs (
+    inventory_id BIGINT NOT NULL REFERENCES inventories(id) ON DELETE CASCADE,
+    input_inventory_id BIGINT NOT NULL REFERENCES inventories(id) ON DELETE CASCADE,
+    position INT NOT NULL, -- Later inputs override host variables of earlier ones
+    PRIMARY KEY (inventory_id, input_inventory_id),
+    CHECK (inventory_id <> input_inventory_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_inputs_input ON inventory_inputs(input_inventory_id);
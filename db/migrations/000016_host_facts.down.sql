@@ -0,0 +1,4 @@
+-- Rollback: Remove the host fact cache
+ALTER TABLE job_templates DROP COLUMN IF EXISTS use_fact_cache;
+DROP TABLE IF EXISTS job_hosts;
+DROP TABLE IF EXISTS host_facts;
@@ -0,0 +1,22 @@
+-- Facts from ansible-runner's fact cache, kept per host from the last job
+-- that reported them, and optionally seeded into later runs
+CREATE TABLE IF NOT EXISTS host_facts (
+    host_id BIGINT PRIMARY KEY REFERENCES hosts(id) ON DELETE CASCADE,
+    facts JSONB NOT NULL,
+    unified_job_id BIGINT REFERENCES unified_jobs(id) ON DELETE SET NULL,
+    modified_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- The hosts a job ran against, by the name Ansible knew them by. Smart and
+-- constructed inventories draw hosts from other inventories, so a name may
+-- stand for several hosts.
+CREATE TABLE IF NOT EXISTS job_hosts (
+    unified_job_id BIGINT NOT NULL REFERENCES unified_jobs(id) ON DELETE CASCADE,
+    host_id BIGINT NOT NULL REFERENCES hosts(id) ON DELETE CASCADE,
+    host_name TEXT NOT NULL,
+    PRIMARY KEY (unified_job_id, host_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_hosts_host ON job_hosts(host_id);
+
+ALTER TABLE job_templates ADD COLUMN IF NOT EXISTS use_fact_cache BOOLEAN NOT NULL DEFAULT false;
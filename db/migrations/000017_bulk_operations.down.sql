@@ -0,0 +1,2 @@
+-- Rollback: Remove bulk operations
+DROP TABLE IF EXISTS bulk_operations;
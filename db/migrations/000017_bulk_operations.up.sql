@@ -0,0 +1,13 @@
+-- Bulk host and group membership changes. Large requests run in the
+-- background and report their outcome here.
+CREATE TABLE IF NOT EXISTS bulk_operations (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL, -- host_create, host_delete, group_membership_add, group_membership_remove
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, running, successful, failed
+    item_count INT NOT NULL,
+    result JSONB,
+    errors JSONB, -- Per-item validation errors; nothing was applied
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
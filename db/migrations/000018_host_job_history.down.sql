@@ -0,0 +1,5 @@
+-- Rollback: Remove per-host job history
+DROP INDEX IF EXISTS idx_job_host_summaries_host;
+ALTER TABLE hosts DROP COLUMN IF EXISTS has_active_failures;
+ALTER TABLE hosts DROP COLUMN IF EXISTS last_job_host_summary_id;
+ALTER TABLE hosts DROP COLUMN IF EXISTS last_job_id;
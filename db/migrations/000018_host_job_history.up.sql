@@ -0,0 +1,7 @@
+-- Per-host job history: each host points at the last job that ran against it
+-- and its summary there, and flags hosts whose last job failed on them.
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS last_job_id BIGINT REFERENCES unified_jobs(id) ON DELETE SET NULL;
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS last_job_host_summary_id BIGINT REFERENCES job_host_summaries(id) ON DELETE SET NULL;
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS has_active_failures BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS idx_job_host_summaries_host ON job_host_summaries (host_id);
@@ -0,0 +1,2 @@
+-- Rollback: Remove sensitive variable key policy
+ALTER TABLE organizations DROP COLUMN IF EXISTS sensitive_variable_keys;
@@ -0,0 +1,4 @@
+-- Per-organization policy of variable keys treated as sensitive: patterns
+-- such as '*password*' whose values are masked in API responses and logs.
+-- NULL selects the built-in defaults; an empty array masks nothing.
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS sensitive_variable_keys TEXT[];
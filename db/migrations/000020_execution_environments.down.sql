@@ -0,0 +1,11 @@
+-- Rollback: Remove execution environment defaults and registry credentials
+ALTER TABLE organizations DROP COLUMN IF EXISTS default_environment_id;
+ALTER TABLE projects DROP COLUMN IF EXISTS default_environment_id;
+DROP INDEX IF EXISTS idx_execution_environments_default;
+ALTER TABLE execution_environments
+    DROP COLUMN IF EXISTS is_default,
+    DROP COLUMN IF EXISTS pull,
+    DROP COLUMN IF EXISTS credential_id;
+DELETE FROM credential_types ct
+WHERE ct.name = 'Container Registry'
+  AND NOT EXISTS (SELECT 1 FROM credentials c WHERE c.credential_type_id = ct.id);
@@ -0,0 +1,29 @@
+-- Execution environments: the container image a job runs in, with how to pull
+-- it. Jobs use their template's environment, else the project's default, else
+-- the organization's default, else the global default environment.
+ALTER TABLE execution_environments
+    ADD COLUMN IF NOT EXISTS credential_id BIGINT REFERENCES credentials(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS pull TEXT NOT NULL DEFAULT '', -- '' (backend default), always, missing or never
+    ADD COLUMN IF NOT EXISTS is_default BOOLEAN NOT NULL DEFAULT false; -- Global default, organization_id IS NULL
+
+-- At most one global default
+CREATE UNIQUE INDEX IF NOT EXISTS idx_execution_environments_default
+    ON execution_environments ((true)) WHERE is_default;
+
+ALTER TABLE projects
+    ADD COLUMN IF NOT EXISTS default_environment_id BIGINT REFERENCES execution_environments(id) ON DELETE SET NULL;
+
+ALTER TABLE organizations
+    ADD COLUMN IF NOT EXISTS default_environment_id BIGINT REFERENCES execution_environments(id) ON DELETE SET NULL;
+
+INSERT INTO credential_types (name, description, inputs)
+VALUES (
+    'Container Registry',
+    'Registry login used to pull execution environment images',
+    '{"fields": [
+        {"id": "host", "label": "Authentication URL", "type": "string"},
+        {"id": "username", "label": "Username", "type": "string"},
+        {"id": "password", "label": "Password or Token", "type": "string", "secret": true}
+    ]}'::jsonb
+)
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,8 @@
+-- Rollback: Remove container groups and template resource classes
+ALTER TABLE job_templates
+    DROP COLUMN IF EXISTS resource_class,
+    DROP COLUMN IF EXISTS instance_group_id;
+ALTER TABLE instance_groups
+    DROP COLUMN IF EXISTS resource_classes,
+    DROP COLUMN IF EXISTS pod_spec_override,
+    DROP COLUMN IF EXISTS is_container_group;
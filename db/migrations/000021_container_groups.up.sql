@@ -0,0 +1,10 @@
+-- Container groups: instance groups whose jobs run as Kubernetes pods shaped
+-- by a pod spec override, with named resource classes templates pick from.
+ALTER TABLE instance_groups
+    ADD COLUMN IF NOT EXISTS is_container_group BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS pod_spec_override JSONB,
+    ADD COLUMN IF NOT EXISTS resource_classes JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+ALTER TABLE job_templates
+    ADD COLUMN IF NOT EXISTS instance_group_id BIGINT REFERENCES instance_groups(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS resource_class TEXT;
@@ -0,0 +1,3 @@
+-- Rollback: Remove instance group execution backends
+ALTER TABLE instance_groups
+    DROP COLUMN IF EXISTS backend;
@@ -0,0 +1,7 @@
+-- Execution backends: the instance group of a job picks whether it runs in an
+-- executor process, a docker or podman container, or a Kubernetes Job.
+-- Empty leaves it to the executor that picks the job up.
+ALTER TABLE instance_groups
+    ADD COLUMN IF NOT EXISTS backend TEXT NOT NULL DEFAULT '';
+
+UPDATE instance_groups SET backend = 'kubernetes' WHERE is_container_group AND backend = '';
@@ -0,0 +1,2 @@
+-- Rollback: Remove job artifacts
+DROP TABLE IF EXISTS job_artifacts;
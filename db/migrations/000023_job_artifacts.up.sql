@@ -0,0 +1,13 @@
+-- Job artifacts: what the last run of a playbook job left in its
+-- ansible-runner artifacts directory. artifact_data holds the data the
+-- playbook set with set_stats; archive is the object store key of a tarball
+-- of the whole directory, when the executor uploads one.
+CREATE TABLE IF NOT EXISTS job_artifacts (
+    unified_job_id BIGINT PRIMARY KEY REFERENCES unified_jobs(id) ON DELETE CASCADE,
+    execution_run_id UUID NOT NULL REFERENCES execution_runs(id) ON DELETE CASCADE,
+    artifact_data JSONB NOT NULL DEFAULT '{}'::jsonb,
+    rc INTEGER,
+    status TEXT NOT NULL DEFAULT '',
+    archive TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,166 @@
+// Package backend defines the execution backends runs are launched on: an
+// executor process, docker or podman containers, or Kubernetes Jobs. The
+// instance group of a job selects its backend; a Router dispatches each
+// execution request to it.
+//
+// Backends only launch and look after runs. Runs report their progress and
+// outcome through job events either way, so the state a backend reports is
+// what it observes of the run's process, container or Job, not the
+// execution run recorded in the database.
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+// States of a run as seen by its backend.
+const (
+	StatePending    = "pending"
+	StateRunning    = "running"
+	StateSuccessful = "successful"
+	StateFailed     = "failed"
+	StateCanceled   = "canceled"
+)
+
+// ErrUnknownRun is returned for runs a backend has not launched or has
+// already cleaned up.
+var ErrUnknownRun = errors.New("unknown execution run")
+
+// Status is the state of a run on its backend and, for failed runs, why.
+type Status struct {
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Finished reports whether the run is no longer pending or running.
+func (s Status) Finished() bool {
+	return s.State != StatePending && s.State != StateRunning
+}
+
+// ExecutionBackend launches execution runs and looks after them.
+type ExecutionBackend interface {
+	// Launch starts a run. Launching a run again, e.g. for a redelivered
+	// request, leaves the run already launched as it is.
+	Launch(ctx context.Context, req *events.ExecutionRequest) error
+
+	// Cancel stops a run; its status becomes canceled unless it finished
+	// first. Cancelling a finished run does nothing.
+	Cancel(ctx context.Context, runID uuid.UUID) error
+
+	// Status returns the state of a run, or ErrUnknownRun.
+	Status(ctx context.Context, runID uuid.UUID) (Status, error)
+
+	// Cleanup stops a run if it is still going and removes everything the
+	// backend keeps of it. Afterwards its status is ErrUnknownRun. Cleaning
+	// up an unknown run does nothing.
+	Cleanup(ctx context.Context, runID uuid.UUID) error
+}
+
+// Waiter is implemented by backends that can tell when a run finished
+// without being polled for its status.
+type Waiter interface {
+	// Done returns a channel closed once the run finished, or ErrUnknownRun.
+	Done(runID uuid.UUID) (<-chan struct{}, error)
+}
+
+// Router is an ExecutionBackend that launches each run on the backend its
+// request names, or Default if it names none, and remembers which one that
+// was for the run's later calls.
+type Router struct {
+	Backends map[string]ExecutionBackend
+	Default  string
+
+	mu   sync.Mutex
+	runs map[uuid.UUID]ExecutionBackend
+}
+
+// NewRouter creates a router over backends by name.
+func NewRouter(backends map[string]ExecutionBackend, def string) *Router {
+	return &Router{Backends: backends, Default: def, runs: map[uuid.UUID]ExecutionBackend{}}
+}
+
+// Select returns the backend a request runs on.
+func (r *Router) Select(req *events.ExecutionRequest) (ExecutionBackend, error) {
+	name := req.JobManifest.Backend
+	if name == "" {
+		name = r.Default
+	}
+	b, ok := r.Backends[name]
+	if !ok {
+		return nil, fmt.Errorf("no %q execution backend available", name)
+	}
+	return b, nil
+}
+
+func (r *Router) Launch(ctx context.Context, req *events.ExecutionRequest) error {
+	b, err := r.Select(req)
+	if err != nil {
+		return err
+	}
+	if err := b.Launch(ctx, req); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.runs[req.ExecutionRunID] = b
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Router) backend(runID uuid.UUID) (ExecutionBackend, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.runs[runID]
+	if !ok {
+		return nil, ErrUnknownRun
+	}
+	return b, nil
+}
+
+func (r *Router) Cancel(ctx context.Context, runID uuid.UUID) error {
+	b, err := r.backend(runID)
+	if err != nil {
+		return err
+	}
+	return b.Cancel(ctx, runID)
+}
+
+func (r *Router) Status(ctx context.Context, runID uuid.UUID) (Status, error) {
+	b, err := r.backend(runID)
+	if err != nil {
+		return Status{}, err
+	}
+	return b.Status(ctx, runID)
+}
+
+// Done returns the channel of the run's backend if it is a Waiter, otherwise
+// a nil channel, which never becomes ready.
+func (r *Router) Done(runID uuid.UUID) (<-chan struct{}, error) {
+	b, err := r.backend(runID)
+	if err != nil {
+		return nil, err
+	}
+	if w, ok := b.(Waiter); ok {
+		return w.Done(runID)
+	}
+	return nil, nil
+}
+
+func (r *Router) Cleanup(ctx context.Context, runID uuid.UUID) error {
+	b, err := r.backend(runID)
+	if errors.Is(err, ErrUnknownRun) {
+		return nil
+	}
+	if err := b.Cleanup(ctx, runID); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	delete(r.runs, runID)
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,178 @@
+// Package backendtest holds the conformance tests every execution backend
+// must pass.
+package backendtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/backend"
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+// Harness is a backend under test and a way to end its runs the way the
+// executor running them would.
+type Harness struct {
+	Backend backend.ExecutionBackend
+
+	// Finish ends a launched run, successfully or not.
+	Finish func(t *testing.T, runID uuid.UUID, succeed bool)
+}
+
+// Run runs the conformance tests against fresh harnesses from newHarness.
+func Run(t *testing.T, newHarness func(t *testing.T) *Harness) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, h *Harness)
+	}{
+		{"UnknownRun", testUnknownRun},
+		{"LaunchIsIdempotent", testLaunchIsIdempotent},
+		{"Succeeds", testFinish(true, backend.StateSuccessful)},
+		{"Fails", testFinish(false, backend.StateFailed)},
+		{"Cancel", testCancel},
+		{"CancelFinished", testCancelFinished},
+		{"Cleanup", testCleanup},
+		{"CleanupActive", testCleanupActive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newHarness(t))
+		})
+	}
+}
+
+func newRequest() *events.ExecutionRequest {
+	return &events.ExecutionRequest{
+		ExecutionRunID: uuid.New(),
+		UnifiedJobID:   42,
+		JobManifest:    events.JobManifest{Playbook: "site.yml"},
+		CreatedAt:      time.Now(),
+	}
+}
+
+func launch(t *testing.T, h *Harness) *events.ExecutionRequest {
+	t.Helper()
+	req := newRequest()
+	if err := h.Backend.Launch(context.Background(), req); err != nil {
+		t.Fatalf("Launch failed: %v", err)
+	}
+	return req
+}
+
+// waitFor polls the status of a run until it is in state.
+func waitFor(t *testing.T, h *Harness, runID uuid.UUID, state string) backend.Status {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := h.Backend.Status(context.Background(), runID)
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		if status.State == state {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %s is %s, want %s", runID, status.State, state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testUnknownRun(t *testing.T, h *Harness) {
+	ctx := context.Background()
+	runID := uuid.New()
+	if _, err := h.Backend.Status(ctx, runID); !errors.Is(err, backend.ErrUnknownRun) {
+		t.Errorf("Status of an unknown run returned %v, want ErrUnknownRun", err)
+	}
+	if err := h.Backend.Cancel(ctx, runID); !errors.Is(err, backend.ErrUnknownRun) {
+		t.Errorf("Cancel of an unknown run returned %v, want ErrUnknownRun", err)
+	}
+	if err := h.Backend.Cleanup(ctx, runID); err != nil {
+		t.Errorf("Cleanup of an unknown run failed: %v", err)
+	}
+}
+
+func testLaunchIsIdempotent(t *testing.T, h *Harness) {
+	req := launch(t, h)
+	if err := h.Backend.Launch(context.Background(), req); err != nil {
+		t.Fatalf("second Launch failed: %v", err)
+	}
+	status, err := h.Backend.Status(context.Background(), req.ExecutionRunID)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Finished() {
+		t.Errorf("launched run is already %s", status.State)
+	}
+
+	h.Finish(t, req.ExecutionRunID, true)
+	waitFor(t, h, req.ExecutionRunID, backend.StateSuccessful)
+}
+
+func testFinish(succeed bool, state string) func(t *testing.T, h *Harness) {
+	return func(t *testing.T, h *Harness) {
+		req := launch(t, h)
+		h.Finish(t, req.ExecutionRunID, succeed)
+		status := waitFor(t, h, req.ExecutionRunID, state)
+		if !status.Finished() {
+			t.Errorf("%s run is not finished", status.State)
+		}
+		if !succeed && status.Reason == "" {
+			t.Error("failed run has no reason")
+		}
+	}
+}
+
+func testCancel(t *testing.T, h *Harness) {
+	req := launch(t, h)
+	ctx := context.Background()
+	if err := h.Backend.Cancel(ctx, req.ExecutionRunID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	waitFor(t, h, req.ExecutionRunID, backend.StateCanceled)
+	if err := h.Backend.Cancel(ctx, req.ExecutionRunID); err != nil {
+		t.Errorf("second Cancel failed: %v", err)
+	}
+}
+
+func testCancelFinished(t *testing.T, h *Harness) {
+	req := launch(t, h)
+	h.Finish(t, req.ExecutionRunID, true)
+	waitFor(t, h, req.ExecutionRunID, backend.StateSuccessful)
+
+	if err := h.Backend.Cancel(context.Background(), req.ExecutionRunID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	waitFor(t, h, req.ExecutionRunID, backend.StateSuccessful)
+}
+
+func testCleanup(t *testing.T, h *Harness) {
+	req := launch(t, h)
+	h.Finish(t, req.ExecutionRunID, false)
+	waitFor(t, h, req.ExecutionRunID, backend.StateFailed)
+
+	ctx := context.Background()
+	if err := h.Backend.Cleanup(ctx, req.ExecutionRunID); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if _, err := h.Backend.Status(ctx, req.ExecutionRunID); !errors.Is(err, backend.ErrUnknownRun) {
+		t.Errorf("Status after Cleanup returned %v, want ErrUnknownRun", err)
+	}
+	if err := h.Backend.Cleanup(ctx, req.ExecutionRunID); err != nil {
+		t.Errorf("second Cleanup failed: %v", err)
+	}
+}
+
+func testCleanupActive(t *testing.T, h *Harness) {
+	req := launch(t, h)
+	ctx := context.Background()
+	if err := h.Backend.Cleanup(ctx, req.ExecutionRunID); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if _, err := h.Backend.Status(ctx, req.ExecutionRunID); !errors.Is(err, backend.ErrUnknownRun) {
+		t.Errorf("Status after Cleanup returned %v, want ErrUnknownRun", err)
+	}
+}
@@ -0,0 +1,336 @@
+package content
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// ErrNotFound is returned by a Store when no object exists for a key.
+var ErrNotFound = errors.New("object not found")
+
+// ErrTooLarge is returned by extraction once the files of an archive add up
+// to more than the limit it was given.
+var ErrTooLarge = errors.New("archive contents exceed the size limit")
+
+// Store is the object store holding project archives.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object of a key; deleting a missing object is not
+	// an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// ArchiveKey returns the content-addressed storage key for a project checked
+// out from url at the given commit SHA.
+func ArchiveKey(url, revision string) string {
+	sum := sha256.Sum256([]byte(url))
+	return fmt.Sprintf("projects/%s/%s.tar.gz", hex.EncodeToString(sum[:8]), revision)
+}
+
+// PackDir writes dir as a gzipped tarball to w, skipping the .git directory.
+func PackDir(dir string, w io.Writer) error {
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		// Skip root
+		if rel == "." {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+// Extract unpacks a gzipped tarball produced by PackDir into dir. Entries that
+// would escape dir are rejected.
+func Extract(r io.Reader, dir string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	return ExtractTar(gr, dir, 0)
+}
+
+// ExtractTar unpacks an uncompressed tarball into dir. Symlinks must point
+// inside dir, and no entry is written through a symlink. Extraction stops
+// with ErrTooLarge once the files written pass maxBytes, unless it is 0.
+func ExtractTar(r io.Reader, dir string, maxBytes int64) error {
+	budget := newBudget(maxBytes)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		targetPath, err := entryPath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := mkdirAll(dir, targetPath); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := checkLink(dir, targetPath, header.Linkname); err != nil {
+				return err
+			}
+			if err := mkdirAll(dir, filepath.Dir(targetPath)); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, targetPath); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(dir, targetPath, tr, os.FileMode(header.Mode), budget); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ExtractZip unpacks a zip archive into dir, with the limit of ExtractTar.
+func ExtractZip(r io.ReaderAt, size int64, dir string, maxBytes int64) error {
+	budget := newBudget(maxBytes)
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		targetPath, err := entryPath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			if err := mkdirAll(dir, targetPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(dir, targetPath, rc, f.Mode(), budget)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DirDigest returns a sha256 digest of the files under dir (paths, modes and
+// contents), skipping the .git directory. Unlike a tarball of dir, it does
+// not change when only timestamps do.
+func DirDigest(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%o\x00", filepath.ToSlash(rel), info.Mode())
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			io.WriteString(h, link)
+		case info.Mode().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+		}
+		h.Write([]byte{0})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// entryPath resolves an archive entry name inside dir, rejecting entries that
+// would escape it.
+func entryPath(dir, name string) (string, error) {
+	targetPath := filepath.Join(dir, name)
+	if !within(dir, targetPath) {
+		return "", fmt.Errorf("archive entry %q escapes target directory", name)
+	}
+	return targetPath, nil
+}
+
+func within(dir, path string) bool {
+	dir = filepath.Clean(dir)
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+// checkLink rejects a symlink at path whose target is absolute or resolves
+// outside dir.
+func checkLink(dir, path, link string) error {
+	if filepath.IsAbs(link) || !within(dir, filepath.Join(filepath.Dir(path), link)) {
+		return fmt.Errorf("archive symlink %q -> %q points outside target directory", path, link)
+	}
+	return nil
+}
+
+// checkNoSymlinks rejects path if it, or any directory between dir and it,
+// is a symlink, so nothing is written through a link an earlier entry made.
+func checkNoSymlinks(dir, path string) error {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." {
+		return err
+	}
+	cur := filepath.Clean(dir)
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		cur = filepath.Join(cur, part)
+		info, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry %q would be written through symlink %q", path, cur)
+		}
+	}
+	return nil
+}
+
+func mkdirAll(dir, path string) error {
+	if err := checkNoSymlinks(dir, path); err != nil {
+		return err
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+// newBudget returns the bytes extraction may write, or nil for no limit.
+func newBudget(maxBytes int64) *int64 {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &maxBytes
+}
+
+// writeFile writes r to path, taking what it wrote from budget unless it is
+// nil. Entry sizes in headers are not trusted, so the copy itself is bounded.
+func writeFile(dir, path string, r io.Reader, mode os.FileMode, budget *int64) error {
+	// Ensure parent directory exists
+	if err := mkdirAll(dir, filepath.Dir(path)); err != nil {
+		return err
+	}
+	if err := checkNoSymlinks(dir, path); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|syscall.O_NOFOLLOW, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if budget == nil {
+		_, err = io.Copy(out, r)
+	} else {
+		var n int64
+		n, err = io.CopyN(out, r, *budget+1)
+		*budget -= n
+		switch {
+		case err == io.EOF:
+			err = nil
+		case err == nil:
+			err = ErrTooLarge
+		}
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,197 @@
+package content_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/praetordev/praetor/pkg/content"
+)
+
+func TestPackDirRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "site.yml"), "- hosts: all\n")
+	writeFile(t, filepath.Join(src, "roles", "web", "tasks", "main.yml"), "- ping:\n")
+	writeFile(t, filepath.Join(src, ".git", "HEAD"), "ref: refs/heads/main\n")
+	if err := os.Symlink("site.yml", filepath.Join(src, "main.yml")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := content.PackDir(src, &buf); err != nil {
+		t.Fatalf("PackDir failed: %v", err)
+	}
+
+	dst := t.TempDir()
+	if err := content.Extract(&buf, dst); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	for path, want := range map[string]string{
+		"site.yml":                 "- hosts: all\n",
+		"roles/web/tasks/main.yml": "- ping:\n",
+		"main.yml":                 "- hosts: all\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(dst, path))
+		if err != nil {
+			t.Errorf("missing %s: %v", path, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, ".git")); !os.IsNotExist(err) {
+		t.Errorf("expected .git to be excluded from the archive")
+	}
+}
+
+func TestExtractRejectsPathTraversal(t *testing.T) {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	body := []byte("owned")
+	if err := tw.WriteHeader(&tar.Header{Name: "../escape.txt", Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write(body)
+	tw.Close()
+	gzw.Close()
+
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "project")
+	if err := content.Extract(&buf, dst); err == nil {
+		t.Fatal("expected an error for an entry escaping the target directory")
+	}
+	if _, err := os.Stat(filepath.Join(parent, "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("entry was written outside the target directory")
+	}
+}
+
+func TestExtractRejectsEscapingSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	cases := map[string][]tar.Header{
+		"absolute target": {
+			{Name: "link", Linkname: outside, Typeflag: tar.TypeSymlink},
+			{Name: "link/pwn", Mode: 0644, Size: 5, Typeflag: tar.TypeReg},
+		},
+		"relative target": {
+			{Name: "sub/link", Linkname: "../../" + filepath.Base(outside), Typeflag: tar.TypeSymlink},
+			{Name: "sub/link/pwn", Mode: 0644, Size: 5, Typeflag: tar.TypeReg},
+		},
+		// A link inside the directory is fine, but nothing may be written through it
+		"write through link": {
+			{Name: "roles", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "link", Linkname: "roles", Typeflag: tar.TypeSymlink},
+			{Name: "link/pwn", Mode: 0644, Size: 5, Typeflag: tar.TypeReg},
+		},
+	}
+	for name, headers := range cases {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, h := range headers {
+			if err := tw.WriteHeader(&h); err != nil {
+				t.Fatal(err)
+			}
+			if h.Size > 0 {
+				tw.Write([]byte("owned"))
+			}
+		}
+		tw.Close()
+
+		dst := filepath.Join(t.TempDir(), "project")
+		if err := content.ExtractTar(&buf, dst, 0); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if _, err := os.Stat(filepath.Join(outside, "pwn")); !os.IsNotExist(err) {
+			t.Errorf("%s: entry was written outside the target directory", name)
+		}
+		if _, err := os.Stat(filepath.Join(dst, "roles", "pwn")); !os.IsNotExist(err) {
+			t.Errorf("%s: entry was written through a symlink", name)
+		}
+	}
+}
+
+func TestExtractRejectsLinkToTmp(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "link", Linkname: "/tmp", Typeflag: tar.TypeSymlink})
+	name := "praetor-pwn-" + filepath.Base(t.TempDir())
+	tw.WriteHeader(&tar.Header{Name: "link/" + name, Mode: 0644, Size: 5, Typeflag: tar.TypeReg})
+	tw.Write([]byte("owned"))
+	tw.Close()
+
+	if err := content.ExtractTar(&buf, t.TempDir(), 0); err == nil {
+		t.Fatal("expected an error for a symlink to /tmp")
+	}
+	if _, err := os.Stat(filepath.Join("/tmp", name)); !os.IsNotExist(err) {
+		os.Remove(filepath.Join("/tmp", name))
+		t.Error("entry was written to /tmp through the symlink")
+	}
+}
+
+func TestExtractStopsAtSizeLimit(t *testing.T) {
+	data := strings.Repeat("x", 600)
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for _, name := range []string{"a.yml", "b.yml"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(data))
+		w, _ := zw.Create(name)
+		w.Write([]byte(data))
+	}
+	tw.Close()
+	zw.Close()
+
+	extract := map[string]func(dir string, maxBytes int64) error{
+		"tar": func(dir string, maxBytes int64) error {
+			return content.ExtractTar(bytes.NewReader(tarBuf.Bytes()), dir, maxBytes)
+		},
+		"zip": func(dir string, maxBytes int64) error {
+			return content.ExtractZip(bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()), dir, maxBytes)
+		},
+	}
+	for name, fn := range extract {
+		dir := t.TempDir()
+		if err := fn(dir, 1000); !errors.Is(err, content.ErrTooLarge) {
+			t.Errorf("%s: expected ErrTooLarge for 1200 bytes over a limit of 1000, got %v", name, err)
+		}
+		if info, err := os.Stat(filepath.Join(dir, "b.yml")); err == nil && info.Size() == int64(len(data)) {
+			t.Errorf("%s: wrote the whole entry past the limit", name)
+		}
+		if err := fn(t.TempDir(), 1200); err != nil {
+			t.Errorf("%s: expected 1200 bytes to fit a limit of 1200, got %v", name, err)
+		}
+	}
+}
+
+func TestArchiveKeyIsContentAddressed(t *testing.T) {
+	a := content.ArchiveKey("https://example.com/a.git", "abc123")
+	if a != content.ArchiveKey("https://example.com/a.git", "abc123") {
+		t.Errorf("key is not stable")
+	}
+	if a == content.ArchiveKey("https://example.com/b.git", "abc123") {
+		t.Errorf("different repositories share a key")
+	}
+	if a == content.ArchiveKey("https://example.com/a.git", "def456") {
+		t.Errorf("different revisions share a key")
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,43 @@
+package events
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DockerConfig returns the credential as a Docker config.json, the format of
+// Kubernetes image pull Secrets and of the docker and podman auth files, for
+// pulling image.
+func (c *RegistryCredential) DockerConfig(image string) ([]byte, error) {
+	host := c.Host
+	if host == "" {
+		host = registryHost(image)
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+	config, err := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			host: map[string]string{
+				"username": c.Username,
+				"password": c.Password,
+				"auth":     auth,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode registry credential: %w", err)
+	}
+	return config, nil
+}
+
+// registryHost returns the registry an image reference pulls from, the way
+// the container runtime reads it: the first path component if it looks like
+// a host, else Docker Hub.
+func registryHost(image string) string {
+	first, _, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first
+	}
+	return "https://index.docker.io/v1/"
+}
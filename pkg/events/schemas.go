@@ -21,16 +21,120 @@ type ExecutionRequest struct {
 	CreatedAt      time.Time   `json:"created_at"`
 }
 
+// Manifest job types. An empty JobType runs a playbook.
+const (
+	JobTypePlaybook        = "playbook"
+	JobTypeProjectUpdate   = "project_update"
+	JobTypeInventoryUpdate = "inventory_update"
+)
+
 // JobManifest contains all resolved configuration for the job execution.
 type JobManifest struct {
+	JobType string `json:"job_type,omitempty"` // playbook (default), project_update or inventory_update
+
 	// For now, minimal fields as per vision doc example
-	Inventory       string                 `json:"inventory"`        // Raw inventory INI content
-	ProjectURL      string                 `json:"project_url"`      // Git URL for project
-	ProjectRef      string                 `json:"project_ref"`      // Git branch/tag/commit (optional)
-	Playbook        string                 `json:"playbook"`         // Playbook file path within project
-	PlaybookContent string                 `json:"playbook_content"` // Inline playbook content (optional)
+	Inventory       string                 `json:"inventory"`                 // Inventory as JSON in the YAML inventory structure (INI accepted)
+	ProjectURL      string                 `json:"project_url"`               // Git URL for project
+	ProjectRef      string                 `json:"project_ref"`               // Git commit SHA for jobs, branch/tag for project updates (optional)
+	ProjectArchive  string                 `json:"project_archive,omitempty"` // Content-addressed archive key of the synced project (optional)
+	ProjectSource   *ProjectSource         `json:"project_source,omitempty"`  // How to fetch the project; nil means anonymous git
+	Playbook        string                 `json:"playbook"`                  // Playbook file path within project
+	PlaybookContent string                 `json:"playbook_content"`          // Inline playbook content (optional)
 	ExtraVars       map[string]interface{} `json:"extra_vars"`
 	EnvironmentRefs []string               `json:"environment_refs"`
+
+	// Inventory updates only. For scm sources the project fields above
+	// locate the project holding the inventory file.
+	InventorySource *InventorySource `json:"inventory_source,omitempty"`
+
+	// Stored facts by inventory host name, seeded into ansible-runner's fact
+	// cache when the template uses it. The scheduler puts them in the fact
+	// cache object store and only sends FactCacheObject, the key of a JSON
+	// object of them, as facts quickly outgrow a message.
+	FactCache       map[string]CachedFacts `json:"fact_cache,omitempty"`
+	FactCacheObject string                 `json:"fact_cache_object,omitempty"`
+
+	// Container image to run the job in; nil means the backend's default
+	ExecutionEnvironment *ExecutionEnvironment `json:"execution_environment,omitempty"`
+
+	// Container group shaping the job's pod; nil outside container groups
+	ContainerGroup *ContainerGroup `json:"container_group,omitempty"`
+
+	// Execution backend of the job's instance group; empty for the default
+	Backend string `json:"backend,omitempty"`
+}
+
+// ContainerGroup is the container group a job runs in, with the resources
+// of the resource class its template selected.
+type ContainerGroup struct {
+	Name            string          `json:"name"`
+	PodSpecOverride json.RawMessage `json:"pod_spec_override,omitempty"` // Partial corev1.PodSpec
+	ResourceClass   string          `json:"resource_class,omitempty"`
+	Resources       json.RawMessage `json:"resources,omitempty"` // corev1.ResourceRequirements of ResourceClass
+}
+
+// ExecutionEnvironment is the resolved execution environment of a job.
+type ExecutionEnvironment struct {
+	Name       string              `json:"name"`
+	Image      string              `json:"image"`
+	Pull       string              `json:"pull,omitempty"` // always, missing or never; empty for the backend default
+	Credential *RegistryCredential `json:"credential,omitempty"`
+}
+
+// RegistryCredential holds the resolved inputs of a Container Registry
+// credential. Host defaults to the registry of the image.
+type RegistryCredential struct {
+	Host     string `json:"host,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// CachedFacts are a host's facts as of ModifiedAt.
+type CachedFacts struct {
+	Facts      json.RawMessage `json:"ansible_facts"`
+	ModifiedAt time.Time       `json:"modified_at"`
+}
+
+// InventorySource is what an inventory update runs ansible-inventory against.
+type InventorySource struct {
+	Type         string          `json:"type"`                    // script, scm or plugin
+	Script       string          `json:"script,omitempty"`        // script: executable inventory script
+	Path         string          `json:"path,omitempty"`          // scm: inventory file or directory within the project
+	PluginConfig json.RawMessage `json:"plugin_config,omitempty"` // plugin: configuration naming the plugin
+}
+
+// ProjectSource describes how the executor fetches a project. For "archive"
+// projects ProjectURL is a tar/zip download and ProjectRef its sha256 digest;
+// for "manual" projects ProjectURL is a directory under the executor's
+// projects root.
+type ProjectSource struct {
+	Type       string         `json:"type"`                 // git (default), archive or manual
+	Submodules bool           `json:"submodules,omitempty"` // git: check out submodules recursively
+	LFS        bool           `json:"lfs,omitempty"`        // git: fetch Git LFS objects
+	Checksum   string         `json:"checksum,omitempty"`   // archive: expected "sha256:<hex>" digest
+	Credential *SCMCredential `json:"credential,omitempty"`
+
+	// Servers ansible-galaxy installs requirements from, in order. Empty means
+	// the ansible-galaxy default (galaxy.ansible.com).
+	GalaxyServers []GalaxyServer `json:"galaxy_servers,omitempty"`
+}
+
+// GalaxyServer is a Galaxy or Automation Hub server from the organization's
+// Galaxy credentials.
+type GalaxyServer struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	AuthURL string `json:"auth_url,omitempty"`
+	Token   string `json:"token,omitempty"`
+}
+
+// SCMCredential holds the resolved inputs of a Source Control credential.
+type SCMCredential struct {
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	SSHKeyData   string `json:"ssh_key_data,omitempty"`
+	SSHKeyUnlock string `json:"ssh_key_unlock,omitempty"`
+	KnownHosts   string `json:"known_hosts,omitempty"`
 }
 
 // JobEvent represents a single event emitted by the executor during execution.
@@ -50,6 +154,25 @@ type JobEvent struct {
 	EventData     json.RawMessage `json:"event_data,omitempty"`
 }
 
+// HostFacts is the event data of a HOST_FACTS event, which reports the fact
+// cache a run left for the event's host. Facts the run cleared are reported
+// with Cleared set.
+type HostFacts struct {
+	Facts   json.RawMessage `json:"ansible_facts,omitempty"`
+	Cleared bool            `json:"cleared,omitempty"`
+}
+
+// JobArtifacts is the event data of a JOB_ARTIFACTS event, which reports what
+// a playbook run left in its ansible-runner artifacts directory: the data
+// set with set_stats, ansible-runner's exit code and status, and the object
+// store key of the directory's tarball when one was uploaded.
+type JobArtifacts struct {
+	ArtifactData json.RawMessage `json:"artifact_data,omitempty"`
+	RC           *int            `json:"rc,omitempty"`
+	Status       string          `json:"status,omitempty"`
+	Archive      string          `json:"archive,omitempty"`
+}
+
 // LogChunk represents a chunk of log output uploaded to object storage.
 // It corresponds to the 'job_output_chunk' table.
 type LogChunk struct {
@@ -60,3 +183,20 @@ type LogChunk struct {
 	ByteLength     int       `json:"byte_length"`
 	Timestamp      time.Time `json:"timestamp"`
 }
+
+// InstanceRegistration is sent by an executor on startup to register itself
+// (or refresh its record) in the 'instances' table.
+type InstanceRegistration struct {
+	Hostname string `json:"hostname"`
+	Version  string `json:"version,omitempty"`
+	Capacity int    `json:"capacity"` // Capacity requested for a newly registered instance
+}
+
+// InstanceRegistrationReply carries the registered instance's settings back to
+// the executor. Capacity is the maximum number of jobs it may run at once.
+type InstanceRegistrationReply struct {
+	InstanceID int64  `json:"instance_id"`
+	Capacity   int    `json:"capacity"`
+	Enabled    bool   `json:"enabled"`
+	Error      string `json:"error,omitempty"`
+}
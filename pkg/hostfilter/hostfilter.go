@@ -0,0 +1,258 @@
+// Package hostfilter parses host filter expressions, such as
+//
+//	name__icontains=web and variables__os=linux and groups__name=prod
+//
+// and compiles them to SQL conditions over the hosts table.
+//
+// A filter is a boolean expression of field=value terms joined with and, or,
+// not and parentheses. Fields are name, description, enabled, inventory_id,
+// groups__name (groups the host is in, directly or through a child group)
+// and variables__<key>[__<key>...] (the host's variables, following nested
+// objects). A field may end in a lookup: exact (the default), iexact,
+// contains, icontains, startswith, istartswith, endswith, iendswith, regex,
+// iregex, gt, gte, lt, lte, in (comma separated values) and isnull. Values
+// containing spaces or parentheses are quoted with " or '.
+package hostfilter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Filter is a parsed host filter.
+type Filter struct {
+	src  string
+	root node
+}
+
+// Parse reads a host filter expression.
+func Parse(s string) (*Filter, error) {
+	toks, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("empty host filter")
+	}
+	p := &parser{toks: toks}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(toks) {
+		return nil, fmt.Errorf("unexpected %q in host filter", toks[p.pos].text)
+	}
+	return &Filter{src: s, root: root}, nil
+}
+
+// String returns the expression the filter was parsed from.
+func (f *Filter) String() string {
+	return f.src
+}
+
+// SQL returns the filter as a boolean condition over the hosts table aliased
+// h, with placeholders numbered from first, and the arguments they bind.
+func (f *Filter) SQL(first int) (string, []interface{}) {
+	c := &compiler{next: first}
+	return f.root.sql(c), c.args
+}
+
+type tokenKind int
+
+const (
+	tokTerm tokenKind = iota
+	tokAnd
+	tokOr
+	tokNot
+	tokOpen
+	tokClose
+)
+
+type token struct {
+	kind       tokenKind
+	text       string
+	key, value string // tokTerm only
+}
+
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			toks = append(toks, token{kind: tokOpen, text: "("})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokClose, text: ")"})
+			i++
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\n\r()=", rune(s[i])) {
+				i++
+			}
+			word := s[start:i]
+			if i < len(s) && s[i] == '=' {
+				value, end, err := readValue(s, i+1)
+				if err != nil {
+					return nil, err
+				}
+				toks = append(toks, token{kind: tokTerm, text: s[start:end], key: word, value: value})
+				i = end
+				continue
+			}
+			switch strings.ToLower(word) {
+			case "and":
+				toks = append(toks, token{kind: tokAnd, text: word})
+			case "or":
+				toks = append(toks, token{kind: tokOr, text: word})
+			case "not":
+				toks = append(toks, token{kind: tokNot, text: word})
+			default:
+				return nil, fmt.Errorf("expected field=value, got %q", word)
+			}
+		}
+	}
+	return toks, nil
+}
+
+// readValue reads a quoted or bare value starting at i.
+func readValue(s string, i int) (string, int, error) {
+	if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+		quote := s[i]
+		var b strings.Builder
+		for j := i + 1; j < len(s); j++ {
+			switch {
+			case s[j] == '\\' && j+1 < len(s):
+				j++
+				b.WriteByte(s[j])
+			case s[j] == quote:
+				return b.String(), j + 1, nil
+			default:
+				b.WriteByte(s[j])
+			}
+		}
+		return "", 0, fmt.Errorf("unterminated quote in host filter")
+	}
+	start := i
+	for i < len(s) && !strings.ContainsRune(" \t\n\r()", rune(s[i])) {
+		i++
+	}
+	return s[start:i], i, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek(kind tokenKind) bool {
+	return p.pos < len(p.toks) && p.toks[p.pos].kind == kind
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(tokOr) {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(tokAnd) {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("host filter ends unexpectedly")
+	}
+	tok := p.toks[p.pos]
+	p.pos++
+	switch tok.kind {
+	case tokNot:
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not{inner}, nil
+	case tokOpen:
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(tokClose) {
+			return nil, fmt.Errorf("missing ) in host filter")
+		}
+		p.pos++
+		return inner, nil
+	case tokTerm:
+		return parseTerm(tok.key, tok.value)
+	default:
+		return nil, fmt.Errorf("unexpected %q in host filter", tok.text)
+	}
+}
+
+// lookups are the comparisons a field may end in.
+var lookups = map[string]bool{
+	"exact": true, "iexact": true,
+	"contains": true, "icontains": true,
+	"startswith": true, "istartswith": true,
+	"endswith": true, "iendswith": true,
+	"regex": true, "iregex": true,
+	"gt": true, "gte": true, "lt": true, "lte": true,
+	"in": true, "isnull": true,
+}
+
+func parseTerm(key, value string) (node, error) {
+	parts := strings.Split(key, "__")
+	lookup := "exact"
+	if n := len(parts); n > 1 && lookups[parts[n-1]] {
+		lookup, parts = parts[n-1], parts[:n-1]
+	}
+
+	t := term{lookup: lookup, value: value}
+	switch {
+	case len(parts) == 1 && (parts[0] == "name" || parts[0] == "description"):
+		t.kind, t.column = textField, "h."+parts[0]
+	case len(parts) == 1 && parts[0] == "enabled":
+		t.kind, t.column = boolField, "h.enabled"
+	case len(parts) == 1 && (parts[0] == "inventory_id" || parts[0] == "inventory"):
+		t.kind, t.column = numberField, "h.inventory_id"
+	case parts[0] == "groups" && (len(parts) == 1 || (len(parts) == 2 && parts[1] == "name")):
+		t.kind, t.column = groupField, "g.name"
+	case parts[0] == "variables" && len(parts) > 1:
+		t.kind, t.path = varField, parts[1:]
+		for _, p := range t.path {
+			if p == "" {
+				return nil, fmt.Errorf("empty variable name in %q", key)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown host filter field %q", key)
+	}
+	if err := t.check(); err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,53 @@
+package hostfilter_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/praetordev/praetor/pkg/hostfilter"
+)
+
+func TestSQL(t *testing.T) {
+	f, err := hostfilter.Parse(`name__icontains=web_1 and (variables__os=linux or not groups__name="prod eu")`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	query, args := f.SQL(2)
+
+	want := `(COALESCE(h.name ILIKE $2, false) AND ` +
+		`(COALESCE((h.variables #> $3::text[]) = $4::jsonb OR (h.variables #>> $3::text[]) = $5, false) OR ` +
+		`(NOT EXISTS (WITH RECURSIVE hg(id) AS (SELECT m.group_id FROM host_group_mapping m WHERE m.host_id = h.id ` +
+		`UNION SELECT gc.parent_id FROM group_children gc JOIN hg ON gc.child_id = hg.id) ` +
+		`SELECT 1 FROM hg JOIN groups g ON g.id = hg.id WHERE COALESCE(g.name = $6, false)))))`
+	if query != want {
+		t.Errorf("SQL =\n%s\nwant\n%s", query, want)
+	}
+	wantArgs := []interface{}{`%web\_1%`, pq.Array([]string{"os"}), `"linux"`, "linux", "prod eu"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %#v, want %#v", args, wantArgs)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"name",
+		"name=web and",
+		"(name=web",
+		"name=web)",
+		"hostname=web",
+		"enabled=maybe",
+		"enabled__icontains=true",
+		"inventory_id__gt=abc",
+		"variables__port__gt=high",
+		"variables__=x",
+		`name="unterminated`,
+		"name__regex=web[",
+		"groups__iregex=(prod",
+	} {
+		if _, err := hostfilter.Parse(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
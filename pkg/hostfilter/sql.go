@@ -0,0 +1,229 @@
+package hostfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type node interface {
+	sql(c *compiler) string
+}
+
+type compiler struct {
+	next int
+	args []interface{}
+}
+
+// arg binds v and returns its placeholder.
+func (c *compiler) arg(v interface{}) string {
+	c.args = append(c.args, v)
+	c.next++
+	return "$" + strconv.Itoa(c.next-1)
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (b binary) sql(c *compiler) string {
+	return "(" + b.left.sql(c) + " " + b.op + " " + b.right.sql(c) + ")"
+}
+
+type not struct {
+	inner node
+}
+
+func (n not) sql(c *compiler) string {
+	return "(NOT " + n.inner.sql(c) + ")"
+}
+
+type fieldKind int
+
+const (
+	textField fieldKind = iota
+	boolField
+	numberField
+	groupField
+	varField
+)
+
+type term struct {
+	kind   fieldKind
+	column string   // text, bool, number and group fields
+	path   []string // variables
+	lookup string
+	value  string
+}
+
+// check rejects lookups and values that do not fit the field.
+func (t term) check() error {
+	switch t.lookup {
+	case "isnull":
+		if _, err := strconv.ParseBool(t.value); err != nil {
+			return fmt.Errorf("isnull expects true or false, got %q", t.value)
+		}
+		return nil
+	case "in":
+		if t.value == "" {
+			return fmt.Errorf("in expects a comma separated list")
+		}
+	case "regex", "iregex":
+		// Caught here rather than by Postgres in the middle of a query
+		if _, err := regexp.Compile(t.value); err != nil {
+			return fmt.Errorf("invalid regular expression %q: %w", t.value, err)
+		}
+	}
+
+	switch t.kind {
+	case boolField:
+		if t.lookup != "exact" {
+			return fmt.Errorf("enabled only supports exact matches")
+		}
+		if _, err := strconv.ParseBool(t.value); err != nil {
+			return fmt.Errorf("enabled expects true or false, got %q", t.value)
+		}
+	case numberField:
+		switch t.lookup {
+		case "exact", "gt", "gte", "lt", "lte", "in":
+		default:
+			return fmt.Errorf("inventory_id does not support %s", t.lookup)
+		}
+		for _, v := range strings.Split(t.value, ",") {
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				return fmt.Errorf("inventory_id expects integers, got %q", v)
+			}
+		}
+	case varField:
+		switch t.lookup {
+		case "gt", "gte", "lt", "lte":
+			if _, err := strconv.ParseFloat(t.value, 64); err != nil {
+				return fmt.Errorf("%s on variables expects a number, got %q", t.lookup, t.value)
+			}
+		}
+	}
+	return nil
+}
+
+func (t term) sql(c *compiler) string {
+	switch t.kind {
+	case boolField:
+		b, _ := strconv.ParseBool(t.value)
+		return fmt.Sprintf("(%s = %s)", t.column, c.arg(b))
+
+	case numberField:
+		if t.lookup == "in" {
+			var ids []int64
+			for _, v := range strings.Split(t.value, ",") {
+				id, _ := strconv.ParseInt(v, 10, 64)
+				ids = append(ids, id)
+			}
+			return fmt.Sprintf("(%s = ANY(%s::bigint[]))", t.column, c.arg(pq.Array(ids)))
+		}
+		id, _ := strconv.ParseInt(t.value, 10, 64)
+		return fmt.Sprintf("(%s %s %s)", t.column, comparisons[t.lookup], c.arg(id))
+
+	case groupField:
+		// Groups the host is in directly, and their ancestors
+		groups := "WITH RECURSIVE hg(id) AS (" +
+			"SELECT m.group_id FROM host_group_mapping m WHERE m.host_id = h.id " +
+			"UNION SELECT gc.parent_id FROM group_children gc JOIN hg ON gc.child_id = hg.id)"
+		if t.lookup == "isnull" {
+			inNone, _ := strconv.ParseBool(t.value)
+			exists := "NOT EXISTS"
+			if !inNone {
+				exists = "EXISTS"
+			}
+			return fmt.Sprintf("(%s (SELECT 1 FROM host_group_mapping m WHERE m.host_id = h.id))", exists)
+		}
+		return fmt.Sprintf("EXISTS (%s SELECT 1 FROM hg JOIN groups g ON g.id = hg.id WHERE %s)", groups, textSQL(c, t.column, t.lookup, t.value))
+
+	case varField:
+		path := c.arg(pq.Array(t.path))
+		value := fmt.Sprintf("(h.variables #> %s::text[])", path)
+		text := fmt.Sprintf("(h.variables #>> %s::text[])", path)
+		switch t.lookup {
+		case "exact":
+			// Typed JSON matches numbers and booleans; text matches strings
+			return fmt.Sprintf("COALESCE(%s = %s::jsonb OR %s = %s, false)", value, c.arg(jsonLiteral(t.value)), text, c.arg(t.value))
+		case "isnull":
+			missing, _ := strconv.ParseBool(t.value)
+			cond := fmt.Sprintf("(%s IS NULL OR %s = 'null'::jsonb)", value, value)
+			if !missing {
+				cond = "(NOT " + cond + ")"
+			}
+			return cond
+		case "gt", "gte", "lt", "lte":
+			return fmt.Sprintf("(CASE WHEN jsonb_typeof(%s) = 'number' THEN %s::numeric %s %s::numeric ELSE false END)",
+				value, text, comparisons[t.lookup], c.arg(t.value))
+		default:
+			return textSQL(c, text, t.lookup, t.value)
+		}
+
+	default:
+		return textSQL(c, t.column, t.lookup, t.value)
+	}
+}
+
+var comparisons = map[string]string{"exact": "=", "gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+
+// textSQL compares the text expression col to value.
+func textSQL(c *compiler, col, lookup, value string) string {
+	var cond string
+	switch lookup {
+	case "exact", "gt", "gte", "lt", "lte":
+		cond = fmt.Sprintf("%s %s %s", col, comparisons[lookup], c.arg(value))
+	case "iexact":
+		cond = fmt.Sprintf("lower(%s) = lower(%s)", col, c.arg(value))
+	case "contains", "icontains":
+		cond = like(c, col, lookup[0] == 'i', "%"+escapeLike(value)+"%")
+	case "startswith", "istartswith":
+		cond = like(c, col, lookup[0] == 'i', escapeLike(value)+"%")
+	case "endswith", "iendswith":
+		cond = like(c, col, lookup[0] == 'i', "%"+escapeLike(value))
+	case "regex":
+		cond = fmt.Sprintf("%s ~ %s", col, c.arg(value))
+	case "iregex":
+		cond = fmt.Sprintf("%s ~* %s", col, c.arg(value))
+	case "in":
+		cond = fmt.Sprintf("%s = ANY(%s::text[])", col, c.arg(pq.Array(strings.Split(value, ","))))
+	case "isnull":
+		if isNull, _ := strconv.ParseBool(value); isNull {
+			return fmt.Sprintf("(%s IS NULL)", col)
+		}
+		return fmt.Sprintf("(%s IS NOT NULL)", col)
+	}
+	// A NULL comparison is false, also under not
+	return "COALESCE(" + cond + ", false)"
+}
+
+func like(c *compiler, col string, insensitive bool, pattern string) string {
+	op := "LIKE"
+	if insensitive {
+		op = "ILIKE"
+	}
+	return fmt.Sprintf("%s %s %s", col, op, c.arg(pattern))
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// jsonLiteral returns value as JSON, typed when it reads as a number,
+// boolean or null, and as a string otherwise.
+func jsonLiteral(value string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err == nil {
+		switch v.(type) {
+		case float64, bool, nil:
+			return value
+		}
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
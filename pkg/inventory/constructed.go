@@ -0,0 +1,332 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// ConstructedConfig holds the rules of a constructed inventory, with the
+// options of Ansible's constructed inventory plugin. Each rule is a Jinja
+// expression over a host's variables, which include inventory_hostname and
+// group_names.
+type ConstructedConfig struct {
+	// Strict fails the inventory when a rule cannot be evaluated for a
+	// host, instead of skipping the rule for that host.
+	Strict bool `json:"strict,omitempty"`
+	// Compose sets host variables to the value of an expression.
+	Compose map[string]string `json:"compose,omitempty"`
+	// Groups adds hosts to a group when the condition is true.
+	Groups map[string]string `json:"groups,omitempty"`
+	// KeyedGroups adds hosts to groups named after the value of a key.
+	KeyedGroups []KeyedGroup `json:"keyed_groups,omitempty"`
+	// LeadingSeparator keeps the separator before key values when a keyed
+	// group has no prefix. It defaults to true.
+	LeadingSeparator *bool `json:"leading_separator,omitempty"`
+}
+
+// KeyedGroup names groups prefix, separator and the key value. A key that
+// evaluates to a list adds the host to a group per item; a dictionary, to a
+// group per key_value pair.
+type KeyedGroup struct {
+	Key               string  `json:"key"`
+	Prefix            string  `json:"prefix,omitempty"`
+	Separator         *string `json:"separator,omitempty"` // Defaults to "_"
+	ParentGroup       string  `json:"parent_group,omitempty"`
+	DefaultValue      *string `json:"default_value,omitempty"`      // Used when the key is empty
+	TrailingSeparator *bool   `json:"trailing_separator,omitempty"` // Defaults to true
+}
+
+// ParseConstructed decodes and checks constructed inventory rules. NULL and
+// empty values decode to no rules.
+func ParseConstructed(raw json.RawMessage) (*ConstructedConfig, error) {
+	cfg := &ConstructedConfig{}
+	if len(raw) == 0 || string(raw) == "null" {
+		return cfg, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("constructed rules: %w", err)
+	}
+	if _, err := cfg.compile(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+type compiledRules struct {
+	compose map[string]expr
+	groups  map[string]expr
+	keyed   []expr
+}
+
+func (cfg *ConstructedConfig) compile() (*compiledRules, error) {
+	rules := &compiledRules{compose: map[string]expr{}, groups: map[string]expr{}}
+	for name, src := range cfg.Compose {
+		e, err := compileExpr(src)
+		if err != nil {
+			return nil, fmt.Errorf("compose %s: %w", name, err)
+		}
+		rules.compose[name] = e
+	}
+	for name, src := range cfg.Groups {
+		if name == "" || name == "all" {
+			return nil, fmt.Errorf("groups: invalid group name %q", name)
+		}
+		e, err := compileExpr(src)
+		if err != nil {
+			return nil, fmt.Errorf("groups %s: %w", name, err)
+		}
+		rules.groups[name] = e
+	}
+	for i, kg := range cfg.KeyedGroups {
+		e, err := compileExpr(kg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("keyed_groups[%d]: %w", i, err)
+		}
+		rules.keyed = append(rules.keyed, e)
+	}
+	return rules, nil
+}
+
+// Construct combines the input inventories and applies the rules. Hosts keep
+// the variables they resolve to in their inputs, with later inputs
+// overriding earlier ones, and belong to the union of their input groups.
+// vars are the constructed inventory's own "all" variables.
+func Construct(inputs []*Inventory, vars map[string]interface{}, cfg *ConstructedConfig) (*Inventory, error) {
+	rules, err := cfg.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	out := New()
+	out.Vars = copyVars(vars)
+	for _, in := range inputs {
+		for _, name := range sortedStrings(hostNames(in)) {
+			h := out.AddHost(name, in.HostVars(name))
+			h.IDs = append(h.IDs, in.Hosts[name].IDs...)
+		}
+		// Group variables are already part of the host variables
+		for _, g := range in.sortedGroups() {
+			if g.Name == "all" {
+				continue
+			}
+			og := out.Group(g.Name)
+			for _, h := range g.Hosts {
+				og.AddHost(h)
+			}
+			for _, c := range g.Children {
+				og.AddChild(c)
+			}
+		}
+	}
+	if err := out.Validate(); err != nil {
+		return nil, fmt.Errorf("combining inputs: %w", err)
+	}
+
+	for _, name := range sortedStrings(hostNames(out)) {
+		if err := rules.apply(out, out.Hosts[name], cfg); err != nil {
+			return nil, fmt.Errorf("host %s: %w", name, err)
+		}
+	}
+	if err := out.Validate(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// apply evaluates the rules for a host. Like Ansible, compose expressions
+// see the host's variables before composition, and group rules see the
+// composed variables.
+func (rules *compiledRules) apply(inv *Inventory, h *Host, cfg *ConstructedConfig) error {
+	hostVars := func() map[string]interface{} {
+		vars := copyVars(inv.Vars)
+		mergeVars(vars, h.Vars)
+		groups := []interface{}{}
+		for _, g := range sortedStrings(inv.HostGroups(h.Name)) {
+			if g != "ungrouped" {
+				groups = append(groups, g)
+			}
+		}
+		vars["inventory_hostname"] = h.Name
+		vars["group_names"] = groups
+		return vars
+	}
+	// skip returns err in strict mode and drops it otherwise
+	skip := func(err error) error {
+		if cfg.Strict {
+			return err
+		}
+		return nil
+	}
+
+	vars := hostVars()
+	composed := map[string]interface{}{}
+	for _, name := range sortedKeys(rules.compose) {
+		v, err := rules.compose[name](vars)
+		if err == nil {
+			if u, ok := v.(undefined); ok {
+				err = fmt.Errorf("%s is undefined", u.name)
+			}
+		}
+		if err != nil {
+			if err := skip(fmt.Errorf("compose %s: %w", name, err)); err != nil {
+				return err
+			}
+			continue
+		}
+		composed[name] = v
+	}
+	mergeVars(h.Vars, composed)
+
+	vars = hostVars()
+	for _, name := range sortedKeys(rules.groups) {
+		v, err := rules.groups[name](vars)
+		var ok bool
+		if err == nil {
+			ok, err = truthy(v)
+		}
+		if err != nil {
+			if err := skip(fmt.Errorf("groups %s: %w", name, err)); err != nil {
+				return err
+			}
+			continue
+		}
+		if ok {
+			inv.Group(name).AddHost(h.Name)
+		}
+	}
+
+	for i, kg := range cfg.KeyedGroups {
+		v, err := evalDefined(rules.keyed[i], vars)
+		var names []string
+		if err == nil {
+			names, err = keyedGroupNames(kg, v, cfg.LeadingSeparator == nil || *cfg.LeadingSeparator)
+		}
+		if err != nil {
+			if err := skip(fmt.Errorf("keyed_groups[%d]: %w", i, err)); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, name := range names {
+			inv.Group(name).AddHost(h.Name)
+			if kg.ParentGroup != "" {
+				inv.Group(kg.ParentGroup).AddChild(name)
+			}
+		}
+	}
+	return nil
+}
+
+var invalidGroupChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// keyedGroupNames returns the groups a keyed group rule puts a host in for
+// the key value v.
+func keyedGroupNames(kg KeyedGroup, v interface{}, leadingSeparator bool) ([]string, error) {
+	sep := "_"
+	if kg.Separator != nil {
+		sep = *kg.Separator
+	}
+
+	var values []string
+	switch t := v.(type) {
+	case []interface{}:
+		for _, item := range t {
+			values = append(values, toString(item))
+		}
+	case map[string]interface{}:
+		for _, k := range sortedKeys(t) {
+			values = append(values, k+sep+toString(t[k]))
+		}
+	case nil:
+		values = []string{""}
+	default:
+		values = []string{toString(v)}
+	}
+
+	var names []string
+	for _, value := range values {
+		s := sep
+		if value == "" {
+			if kg.DefaultValue != nil {
+				value = *kg.DefaultValue
+			} else if kg.TrailingSeparator != nil && !*kg.TrailingSeparator {
+				s = ""
+			}
+		}
+		if kg.Prefix == "" && !leadingSeparator {
+			s = ""
+		}
+		name := invalidGroupChars.ReplaceAllString(kg.Prefix+s+value, "_")
+		if name == "" || name == "all" {
+			return nil, fmt.Errorf("invalid group name %q", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func hostNames(inv *Inventory) []string {
+	names := make([]string, 0, len(inv.Hosts))
+	for name := range inv.Hosts {
+		names = append(names, name)
+	}
+	return names
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// LoadConstructed reads a constructed inventory's inputs, in order, and
+// applies its rules. Inputs may be static or smart inventories.
+func LoadConstructed(ctx context.Context, q sqlx.QueryerContext, inv models.Inventory) (*Inventory, error) {
+	cfg, err := ParseConstructed(inv.ConstructedRules)
+	if err != nil {
+		return nil, fmt.Errorf("constructed inventory %d: %w", inv.ID, err)
+	}
+	vars, err := DecodeVars(inv.Variables)
+	if err != nil {
+		return nil, fmt.Errorf("inventory variables: %w", err)
+	}
+
+	var sources []models.Inventory
+	err = sqlx.SelectContext(ctx, q, &sources, `
+		SELECT i.* FROM inventory_inputs ii JOIN inventories i ON i.id = ii.input_inventory_id
+		WHERE ii.inventory_id = $1
+		ORDER BY ii.position`, inv.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch input inventories: %w", err)
+	}
+
+	var inputs []*Inventory
+	for _, src := range sources {
+		var in *Inventory
+		switch src.Kind {
+		case models.InventoryKindSmart:
+			in, err = LoadSmart(ctx, q, src)
+		case models.InventoryKindConstructed:
+			err = fmt.Errorf("input inventory %d is itself constructed", src.ID)
+		default:
+			in, err = Load(ctx, q, src.ID, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, in)
+	}
+	return Construct(inputs, vars, cfg)
+}
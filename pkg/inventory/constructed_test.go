@@ -0,0 +1,116 @@
+package inventory_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/praetordev/praetor/pkg/inventory"
+)
+
+func constructedInputs() []*inventory.Inventory {
+	linux := inventory.New()
+	linux.Vars["os"] = "linux"
+	linux.AddHost("web1", map[string]interface{}{"os_version": "8.2", "roles": []interface{}{"web", "cache"}})
+	linux.AddHost("db1", map[string]interface{}{"os_version": 7.0, "tags": map[string]interface{}{"env": "prod"}})
+	linux.Group("prod").AddHost("db1")
+	linux.Group("prod").Vars["env"] = "prod"
+
+	cloud := inventory.New()
+	cloud.AddHost("web1", map[string]interface{}{"region": "eu-west-1", "os": "linux"})
+	cloud.AddHost("win1", map[string]interface{}{"region": "us-east-1", "os": "windows"})
+	cloud.Group("prod").AddHost("web1")
+	return []*inventory.Inventory{linux, cloud}
+}
+
+func TestConstruct(t *testing.T) {
+	cfg, err := inventory.ParseConstructed(json.RawMessage(`{
+		"compose": {
+			"major": "os_version | int",
+			"label": "inventory_hostname ~ '-' ~ (region | default('local'))"
+		},
+		"groups": {
+			"modern": "major is defined and major >= 8",
+			"prod_linux": "'prod' in group_names and os == 'linux'",
+			"cached": "'cache' in roles"
+		},
+		"keyed_groups": [
+			{"key": "region", "prefix": "region"},
+			{"key": "roles", "parent_group": "roles"},
+			{"key": "tags", "prefix": "tag"}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("ParseConstructed failed: %v", err)
+	}
+	inv, err := inventory.Construct(constructedInputs(), map[string]interface{}{"site": "hq"}, cfg)
+	if err != nil {
+		t.Fatalf("Construct failed: %v", err)
+	}
+
+	hosts := func(group string) []string {
+		g, ok := inv.Groups[group]
+		if !ok {
+			return nil
+		}
+		names := append([]string{}, g.Hosts...)
+		sort.Strings(names)
+		return names
+	}
+	wantGroups := map[string][]string{
+		"prod":             {"db1", "web1"},
+		"modern":           {"web1"},
+		"prod_linux":       {"db1", "web1"},
+		"cached":           {"web1"},
+		"region_eu_west_1": {"web1"},
+		"region_us_east_1": {"win1"},
+		"_web":             {"web1"},
+		"_cache":           {"web1"},
+		"tag_env_prod":     {"db1"},
+	}
+	for group, want := range wantGroups {
+		if got := hosts(group); !reflect.DeepEqual(got, want) {
+			t.Errorf("group %s: got %v, want %v", group, got, want)
+		}
+	}
+	if got := inv.Groups["roles"].Children; !reflect.DeepEqual(got, []string{"_web", "_cache"}) {
+		t.Errorf("roles children: got %v", got)
+	}
+
+	// Input variables are flattened, later inputs winning
+	web1 := inv.HostVars("web1")
+	for key, want := range map[string]interface{}{
+		"site": "hq", "os": "linux", "os_version": "8.2", "region": "eu-west-1",
+		"major": 8.0, "label": "web1-eu-west-1",
+	} {
+		if !reflect.DeepEqual(web1[key], want) {
+			t.Errorf("web1 %s: got %#v, want %#v", key, web1[key], want)
+		}
+	}
+	if got := inv.HostVars("db1"); got["env"] != "prod" || got["label"] != "db1-local" {
+		t.Errorf("db1 vars: got %v", got)
+	}
+	// Rules that fail for a host, like cached for hosts without roles, are
+	// skipped unless strict
+	cfg.Strict = true
+	if _, err := inventory.Construct(constructedInputs(), nil, cfg); err == nil || !strings.Contains(err.Error(), "roles is undefined") {
+		t.Errorf("strict Construct: got %v, want an undefined variable error", err)
+	}
+}
+
+func TestParseConstructedErrors(t *testing.T) {
+	for _, rules := range []string{
+		`{"compose": {"x": "a +"}}`,
+		`{"groups": {"g": "a | nosuchfilter"}}`,
+		`{"groups": {"g": "(a"}}`,
+		`{"keyed_groups": [{"key": "'unterminated"}]}`,
+		`{"groups": {"all": "true"}}`,
+		`{"unknown": true}`,
+	} {
+		if _, err := inventory.ParseConstructed(json.RawMessage(rules)); err == nil {
+			t.Errorf("ParseConstructed(%s): expected an error", rules)
+		}
+	}
+}
@@ -0,0 +1,1032 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Constructed inventory rules are Jinja expressions, as in Ansible. This file
+// evaluates the subset of Jinja they commonly use: literals, variables with
+// attribute and index access, arithmetic, ~ concatenation, comparisons, in,
+// and/or/not, inline if/else, the filters in exprFilters and the tests in
+// exprTests. Using an undefined variable is an error, except through the
+// default filter and the defined and undefined tests.
+
+// undefined is the value of a variable or attribute that does not exist.
+type undefined struct {
+	name string
+}
+
+// expr is a compiled expression, evaluated against a host's variables.
+type expr func(vars map[string]interface{}) (interface{}, error)
+
+// compileExpr parses a Jinja expression.
+func compileExpr(src string) (expr, error) {
+	toks, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	p := &exprParser{toks: toks}
+	e, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(toks) {
+		return nil, fmt.Errorf("unexpected %q", toks[p.pos].text)
+	}
+	return e, nil
+}
+
+type exprTokenKind int
+
+const (
+	exprNumber exprTokenKind = iota
+	exprString
+	exprName
+	exprOp
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	num  float64
+	str  string
+}
+
+var exprOps = []string{"==", "!=", "<=", ">=", "//", "<", ">", "+", "-", "*", "/", "%", "~", "|", ".", ",", "(", ")", "[", "]"}
+
+func lexExpr(s string) ([]exprToken, error) {
+	var toks []exprToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' && j+1 < len(s) && s[j+1] >= '0' && s[j+1] <= '9') {
+				j++
+			}
+			n, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", s[i:j])
+			}
+			toks = append(toks, exprToken{kind: exprNumber, text: s[i:j], num: n})
+			i = j
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+					switch s[j] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(s[j])
+					}
+					continue
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			toks = append(toks, exprToken{kind: exprString, text: s[i : j+1], str: b.String()})
+			i = j + 1
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			toks = append(toks, exprToken{kind: exprName, text: s[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, o := range exprOps {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			toks = append(toks, exprToken{kind: exprOp, text: op})
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+type exprParser struct {
+	toks []exprToken
+	pos  int
+}
+
+// accept consumes the next token if it is the operator or keyword text.
+func (p *exprParser) accept(text string) bool {
+	if p.pos < len(p.toks) && (p.toks[p.pos].kind == exprOp || p.toks[p.pos].kind == exprName) && p.toks[p.pos].text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.accept(text) {
+		if p.pos < len(p.toks) {
+			return fmt.Errorf("expected %q, got %q", text, p.toks[p.pos].text)
+		}
+		return fmt.Errorf("expected %q at end of expression", text)
+	}
+	return nil
+}
+
+func (p *exprParser) name() (string, error) {
+	if p.pos >= len(p.toks) || p.toks[p.pos].kind != exprName {
+		return "", fmt.Errorf("expected a name")
+	}
+	p.pos++
+	return p.toks[p.pos-1].text, nil
+}
+
+func (p *exprParser) ternary() (expr, error) {
+	value, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("if") {
+		return value, nil
+	}
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	otherwise := expr(func(map[string]interface{}) (interface{}, error) { return nil, nil })
+	if p.accept("else") {
+		if otherwise, err = p.ternary(); err != nil {
+			return nil, err
+		}
+	}
+	return func(vars map[string]interface{}) (interface{}, error) {
+		c, err := cond(vars)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := truthy(c)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return value(vars)
+		}
+		return otherwise(vars)
+	}, nil
+}
+
+func (p *exprParser) or() (expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = logical(left, right, true)
+	}
+	return left, nil
+}
+
+func (p *exprParser) and() (expr, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = logical(left, right, false)
+	}
+	return left, nil
+}
+
+// logical short-circuits like Python: or returns the first truthy operand,
+// and the first falsy one.
+func logical(left, right expr, or bool) expr {
+	return func(vars map[string]interface{}) (interface{}, error) {
+		l, err := left(vars)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := truthy(l)
+		if err != nil {
+			return nil, err
+		}
+		if ok == or {
+			return l, nil
+		}
+		return right(vars)
+	}
+}
+
+func (p *exprParser) not() (expr, error) {
+	if p.accept("not") {
+		inner, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(vars map[string]interface{}) (interface{}, error) {
+			v, err := inner(vars)
+			if err != nil {
+				return nil, err
+			}
+			ok, err := truthy(v)
+			return !ok, err
+		}, nil
+	}
+	return p.compare()
+}
+
+func (p *exprParser) compare() (expr, error) {
+	left, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		switch {
+		case p.accept("=="), p.accept("!="), p.accept("<="), p.accept(">="), p.accept("<"), p.accept(">"), p.accept("in"):
+			op = p.toks[p.pos-1].text
+		case p.pos+1 < len(p.toks) && p.toks[p.pos].text == "not" && p.toks[p.pos+1].text == "in":
+			p.pos += 2
+			op = "not in"
+		default:
+			return left, nil
+		}
+		right, err := p.binary(0)
+		if err != nil {
+			return nil, err
+		}
+		left = comparison(left, right, op)
+	}
+}
+
+func comparison(left, right expr, op string) expr {
+	return func(vars map[string]interface{}) (interface{}, error) {
+		l, err := evalDefined(left, vars)
+		if err != nil {
+			return nil, err
+		}
+		r, err := evalDefined(right, vars)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "==":
+			return valuesEqual(l, r), nil
+		case "!=":
+			return !valuesEqual(l, r), nil
+		case "in":
+			return contains(r, l)
+		case "not in":
+			in, err := contains(r, l)
+			return !in, err
+		}
+		c, err := order(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}
+}
+
+// binaryLevels are the arithmetic operators by increasing precedence, as in
+// Jinja: + and - bind looser than ~, which binds looser than * and /.
+var binaryLevels = [][]string{{"+", "-"}, {"~"}, {"*", "/", "//", "%"}}
+
+func (p *exprParser) binary(level int) (expr, error) {
+	if level == len(binaryLevels) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, o := range binaryLevels[level] {
+			if p.accept(o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic(left, right, op)
+	}
+}
+
+func arithmetic(left, right expr, op string) expr {
+	return func(vars map[string]interface{}) (interface{}, error) {
+		l, err := evalDefined(left, vars)
+		if err != nil {
+			return nil, err
+		}
+		r, err := evalDefined(right, vars)
+		if err != nil {
+			return nil, err
+		}
+		if op == "~" {
+			return toString(l) + toString(r), nil
+		}
+		if op == "+" {
+			switch lv := l.(type) {
+			case string:
+				if rv, ok := r.(string); ok {
+					return lv + rv, nil
+				}
+			case []interface{}:
+				if rv, ok := r.([]interface{}); ok {
+					return append(append([]interface{}{}, lv...), rv...), nil
+				}
+			}
+		}
+		a, aok := toNumber(l)
+		b, bok := toNumber(r)
+		if !aok || !bok {
+			return nil, fmt.Errorf("unsupported operands for %s: %s and %s", op, typeName(l), typeName(r))
+		}
+		switch op {
+		case "+":
+			return a + b, nil
+		case "-":
+			return a - b, nil
+		case "*":
+			return a * b, nil
+		}
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		switch op {
+		case "/":
+			return a / b, nil
+		case "//":
+			return math.Floor(a / b), nil
+		default:
+			return a - b*math.Floor(a/b), nil
+		}
+	}
+}
+
+func (p *exprParser) unary() (expr, error) {
+	if p.accept("-") {
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(vars map[string]interface{}) (interface{}, error) {
+			v, err := evalDefined(inner, vars)
+			if err != nil {
+				return nil, err
+			}
+			n, ok := toNumber(v)
+			if !ok {
+				return nil, fmt.Errorf("cannot negate %s", typeName(v))
+			}
+			return -n, nil
+		}, nil
+	}
+	return p.filtered()
+}
+
+// filtered parses a primary expression followed by filters and tests.
+func (p *exprParser) filtered() (expr, error) {
+	e, err := p.postfix()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("|"):
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			f, ok := exprFilters[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown filter %q", name)
+			}
+			args, err := p.args()
+			if err != nil {
+				return nil, err
+			}
+			e = applyFilter(e, f, args, name)
+		case p.accept("is"):
+			negate := p.accept("not")
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			t, ok := exprTests[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown test %q", name)
+			}
+			e = applyTest(e, t, negate)
+		default:
+			return e, nil
+		}
+	}
+}
+
+// args parses an optional parenthesized argument list.
+func (p *exprParser) args() ([]expr, error) {
+	if !p.accept("(") {
+		return nil, nil
+	}
+	var args []expr
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		a, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+	}
+	return args, nil
+}
+
+func applyFilter(e expr, f exprFilter, args []expr, name string) expr {
+	return func(vars map[string]interface{}) (interface{}, error) {
+		v, err := e(vars)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(args))
+		for i, a := range args {
+			if values[i], err = evalDefined(a, vars); err != nil {
+				return nil, err
+			}
+		}
+		if u, ok := v.(undefined); ok && name != "default" && name != "d" {
+			return nil, fmt.Errorf("%s is undefined", u.name)
+		}
+		out, err := f(v, values)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return out, nil
+	}
+}
+
+func applyTest(e expr, t func(interface{}) bool, negate bool) expr {
+	return func(vars map[string]interface{}) (interface{}, error) {
+		v, err := e(vars)
+		if err != nil {
+			return nil, err
+		}
+		return t(v) != negate, nil
+	}
+}
+
+// postfix parses a primary expression followed by attribute and index
+// lookups. Looking up a missing key gives undefined.
+func (p *exprParser) postfix() (expr, error) {
+	e, path, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			if p.pos >= len(p.toks) || p.toks[p.pos].kind == exprOp || p.toks[p.pos].kind == exprString {
+				return nil, fmt.Errorf("expected an attribute after .")
+			}
+			tok := p.toks[p.pos]
+			p.pos++
+			var key interface{} = tok.text
+			if tok.kind == exprNumber {
+				key = tok.num
+			}
+			path += "." + tok.text
+			e = lookup(e, constant(key), path)
+		case p.accept("["):
+			index, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			path += "[...]"
+			e = lookup(e, index, path)
+		default:
+			return e, nil
+		}
+	}
+}
+
+func constant(v interface{}) expr {
+	return func(map[string]interface{}) (interface{}, error) { return v, nil }
+}
+
+func lookup(e, key expr, path string) expr {
+	return func(vars map[string]interface{}) (interface{}, error) {
+		v, err := e(vars)
+		if err != nil {
+			return nil, err
+		}
+		k, err := evalDefined(key, vars)
+		if err != nil {
+			return nil, err
+		}
+		switch c := v.(type) {
+		case map[string]interface{}:
+			if s, ok := k.(string); ok {
+				if out, ok := c[s]; ok {
+					return out, nil
+				}
+			}
+		case []interface{}:
+			if n, ok := toNumber(k); ok && n == math.Trunc(n) {
+				i := int(n)
+				if i < 0 {
+					i += len(c)
+				}
+				if i >= 0 && i < len(c) {
+					return c[i], nil
+				}
+			}
+		}
+		return undefined{name: path}, nil
+	}
+}
+
+func (p *exprParser) primary() (expr, string, error) {
+	if p.pos >= len(p.toks) {
+		return nil, "", fmt.Errorf("expression ends unexpectedly")
+	}
+	tok := p.toks[p.pos]
+	p.pos++
+	switch tok.kind {
+	case exprNumber:
+		return constant(tok.num), tok.text, nil
+	case exprString:
+		s := tok.str
+		// Adjacent string literals are concatenated
+		for p.pos < len(p.toks) && p.toks[p.pos].kind == exprString {
+			s += p.toks[p.pos].str
+			p.pos++
+		}
+		return constant(s), tok.text, nil
+	case exprName:
+		switch tok.text {
+		case "true", "True":
+			return constant(true), tok.text, nil
+		case "false", "False":
+			return constant(false), tok.text, nil
+		case "none", "None":
+			return constant(nil), tok.text, nil
+		case "and", "or", "not", "in", "is", "if", "else":
+			return nil, "", fmt.Errorf("unexpected %q", tok.text)
+		}
+		name := tok.text
+		return func(vars map[string]interface{}) (interface{}, error) {
+			if v, ok := vars[name]; ok {
+				return v, nil
+			}
+			return undefined{name: name}, nil
+		}, name, nil
+	}
+
+	switch tok.text {
+	case "(":
+		e, err := p.ternary()
+		if err != nil {
+			return nil, "", err
+		}
+		return e, "(...)", p.expect(")")
+	case "[":
+		var items []expr
+		for !p.accept("]") {
+			if len(items) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, "", err
+				}
+			}
+			item, err := p.ternary()
+			if err != nil {
+				return nil, "", err
+			}
+			items = append(items, item)
+		}
+		return func(vars map[string]interface{}) (interface{}, error) {
+			list := make([]interface{}, len(items))
+			for i, item := range items {
+				v, err := evalDefined(item, vars)
+				if err != nil {
+					return nil, err
+				}
+				list[i] = v
+			}
+			return list, nil
+		}, "[...]", nil
+	}
+	return nil, "", fmt.Errorf("unexpected %q", tok.text)
+}
+
+// evalDefined evaluates e, failing if the result is undefined.
+func evalDefined(e expr, vars map[string]interface{}) (interface{}, error) {
+	v, err := e(vars)
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := v.(undefined); ok {
+		return nil, fmt.Errorf("%s is undefined", u.name)
+	}
+	return v, nil
+}
+
+// truthy reports whether v is true in Python's sense.
+func truthy(v interface{}) (bool, error) {
+	switch t := v.(type) {
+	case undefined:
+		return false, fmt.Errorf("%s is undefined", t.name)
+	case nil:
+		return false, nil
+	case bool:
+		return t, nil
+	case string:
+		return t != "", nil
+	case []interface{}:
+		return len(t) > 0, nil
+	case map[string]interface{}:
+		return len(t) > 0, nil
+	}
+	if n, ok := toNumber(v); ok {
+		return n != 0, nil
+	}
+	return true, nil
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// toString formats v as Jinja prints it.
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "None"
+	case string:
+		return t
+	case bool:
+		if t {
+			return "True"
+		}
+		return "False"
+	}
+	if n, ok := toNumber(v); ok {
+		if n == math.Trunc(n) && math.Abs(n) < 1e15 {
+			return strconv.FormatInt(int64(n), 10)
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "none"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "dict"
+	}
+	if _, ok := toNumber(v); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !valuesEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			if w, ok := y[k]; !ok || !valuesEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// order compares two numbers or two strings.
+func order(a, b interface{}) (int, error) {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s and %s", typeName(a), typeName(b))
+}
+
+// contains implements needle in container.
+func contains(container, needle interface{}) (bool, error) {
+	switch c := container.(type) {
+	case string:
+		s, ok := needle.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot look for %s in a string", typeName(needle))
+		}
+		return strings.Contains(c, s), nil
+	case []interface{}:
+		for _, item := range c {
+			if valuesEqual(item, needle) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		s, ok := needle.(string)
+		if !ok {
+			return false, nil
+		}
+		_, found := c[s]
+		return found, nil
+	}
+	return false, fmt.Errorf("%s is not a container", typeName(container))
+}
+
+type exprFilter func(v interface{}, args []interface{}) (interface{}, error)
+
+// exprFilters are the supported Jinja and Ansible filters.
+var exprFilters = map[string]exprFilter{
+	"default": defaultFilter,
+	"d":       defaultFilter,
+	"lower": func(v interface{}, _ []interface{}) (interface{}, error) {
+		return strings.ToLower(toString(v)), nil
+	},
+	"upper": func(v interface{}, _ []interface{}) (interface{}, error) {
+		return strings.ToUpper(toString(v)), nil
+	},
+	"trim": func(v interface{}, _ []interface{}) (interface{}, error) {
+		return strings.TrimSpace(toString(v)), nil
+	},
+	"string": func(v interface{}, _ []interface{}) (interface{}, error) {
+		return toString(v), nil
+	},
+	// int and float give 0 for values that are not numbers, as in Jinja
+	"int": func(v interface{}, _ []interface{}) (interface{}, error) {
+		n, _ := parseNumber(v)
+		return math.Trunc(n), nil
+	},
+	"float": func(v interface{}, _ []interface{}) (interface{}, error) {
+		n, _ := parseNumber(v)
+		return n, nil
+	},
+	"bool": func(v interface{}, _ []interface{}) (interface{}, error) {
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		switch strings.ToLower(toString(v)) {
+		case "yes", "on", "1", "true":
+			return true, nil
+		}
+		return false, nil
+	},
+	"length": lengthFilter,
+	"count":  lengthFilter,
+	"first": func(v interface{}, _ []interface{}) (interface{}, error) {
+		return element(v, 0)
+	},
+	"last": func(v interface{}, _ []interface{}) (interface{}, error) {
+		return element(v, -1)
+	},
+	"join": func(v interface{}, args []interface{}) (interface{}, error) {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected a list, got %s", typeName(v))
+		}
+		sep := ""
+		if len(args) > 0 {
+			sep = toString(args[0])
+		}
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = toString(item)
+		}
+		return strings.Join(parts, sep), nil
+	},
+	"replace": func(v interface{}, args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("expects old and new strings")
+		}
+		return strings.ReplaceAll(toString(v), toString(args[0]), toString(args[1])), nil
+	},
+	"regex_replace": func(v interface{}, args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("expects a pattern and a replacement")
+		}
+		re, err := regexp.Compile(toString(args[0]))
+		if err != nil {
+			return nil, err
+		}
+		// Python writes group references as \1
+		repl := regexp.MustCompile(`\\(\d+)`).ReplaceAllString(toString(args[1]), "$${$1}")
+		return re.ReplaceAllString(toString(v), repl), nil
+	},
+	"sort": func(v interface{}, _ []interface{}) (interface{}, error) {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected a list, got %s", typeName(v))
+		}
+		out := append([]interface{}{}, list...)
+		var err error
+		sort.SliceStable(out, func(i, j int) bool {
+			c, cerr := order(out[i], out[j])
+			if cerr != nil {
+				err = cerr
+			}
+			return c < 0
+		})
+		return out, err
+	},
+}
+
+// defaultFilter replaces an undefined value, or with a true second argument
+// any false value.
+func defaultFilter(v interface{}, args []interface{}) (interface{}, error) {
+	var fallback interface{} = ""
+	if len(args) > 0 {
+		fallback = args[0]
+	}
+	if _, ok := v.(undefined); ok {
+		return fallback, nil
+	}
+	if len(args) > 1 {
+		if orFalse, _ := truthy(args[1]); orFalse {
+			if ok, _ := truthy(v); !ok {
+				return fallback, nil
+			}
+		}
+	}
+	return v, nil
+}
+
+func lengthFilter(v interface{}, _ []interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		return float64(len([]rune(t))), nil
+	case []interface{}:
+		return float64(len(t)), nil
+	case map[string]interface{}:
+		return float64(len(t)), nil
+	}
+	return nil, fmt.Errorf("%s has no length", typeName(v))
+}
+
+func element(v interface{}, i int) (interface{}, error) {
+	var items []interface{}
+	switch t := v.(type) {
+	case []interface{}:
+		items = t
+	case string:
+		for _, r := range t {
+			items = append(items, string(r))
+		}
+	default:
+		return nil, fmt.Errorf("expected a list, got %s", typeName(v))
+	}
+	if len(items) == 0 {
+		return undefined{name: "element of empty " + typeName(v)}, nil
+	}
+	if i < 0 {
+		i += len(items)
+	}
+	return items[i], nil
+}
+
+func parseNumber(v interface{}) (float64, bool) {
+	if n, ok := toNumber(v); ok {
+		return n, true
+	}
+	switch t := v.(type) {
+	case bool:
+		if t {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// exprTests are the supported Jinja tests.
+var exprTests = map[string]func(interface{}) bool{
+	"defined": func(v interface{}) bool {
+		_, ok := v.(undefined)
+		return !ok
+	},
+	"undefined": func(v interface{}) bool {
+		_, ok := v.(undefined)
+		return ok
+	},
+	"none": func(v interface{}) bool {
+		return v == nil
+	},
+	"string": func(v interface{}) bool {
+		_, ok := v.(string)
+		return ok
+	},
+	"number": func(v interface{}) bool {
+		_, ok := toNumber(v)
+		return ok
+	},
+	"mapping": func(v interface{}) bool {
+		_, ok := v.(map[string]interface{})
+		return ok
+	},
+}
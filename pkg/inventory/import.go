@@ -0,0 +1,270 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source formats accepted by Parse.
+const (
+	FormatAuto = "auto"
+	FormatINI  = "ini"
+	FormatYAML = "yaml"
+	FormatJSON = "json" // ansible-inventory --list output
+)
+
+// Parse reads an inventory in the given format. FormatAuto detects the
+// format: JSON with _meta or host lists is list output, other mappings are
+// YAML inventories and anything else is INI.
+func Parse(data []byte, format string) (*Inventory, error) {
+	switch format {
+	case FormatINI:
+		return ParseINI(data)
+	case FormatYAML:
+		return ParseYAML(data)
+	case FormatJSON:
+		return ParseList(data)
+	case FormatAuto, "":
+		return Parse(data, DetectFormat(data))
+	default:
+		return nil, fmt.Errorf("unknown inventory format %q", format)
+	}
+}
+
+// DetectFormat guesses the format of an inventory source.
+func DetectFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var top map[string]json.RawMessage
+		if json.Unmarshal(trimmed, &top) == nil {
+			if _, ok := top["_meta"]; ok {
+				return FormatJSON
+			}
+			for _, raw := range top {
+				var node struct {
+					Hosts json.RawMessage `json:"hosts"`
+				}
+				if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) ||
+					(json.Unmarshal(raw, &node) == nil && bytes.HasPrefix(bytes.TrimSpace(node.Hosts), []byte("["))) {
+					return FormatJSON
+				}
+			}
+		}
+		return FormatYAML
+	}
+
+	var top map[string]interface{}
+	if yaml.Unmarshal(trimmed, &top) == nil && len(top) > 0 {
+		for _, node := range top {
+			if _, ok := node.(map[string]interface{}); !ok && node != nil {
+				return FormatINI
+			}
+		}
+		return FormatYAML
+	}
+	return FormatINI
+}
+
+// Import modes.
+const (
+	// ImportMerge adds and updates hosts, groups, membership and variables,
+	// with imported variables winning, and never removes anything.
+	ImportMerge = "merge"
+	// ImportOverwrite makes the inventory match the source exactly.
+	ImportOverwrite = "overwrite"
+)
+
+// Link is a group membership: a host or a child group in a group.
+type Link struct {
+	Group  string `json:"group"`
+	Member string `json:"member"`
+}
+
+// Changes describes what an import changes, by name.
+type Changes struct {
+	VariablesChanged bool     `json:"variables_changed"`
+	HostsCreated     []string `json:"hosts_created"`
+	HostsUpdated     []string `json:"hosts_updated"`
+	HostsDeleted     []string `json:"hosts_deleted"`
+	GroupsCreated    []string `json:"groups_created"`
+	GroupsUpdated    []string `json:"groups_updated"`
+	GroupsDeleted    []string `json:"groups_deleted"`
+	HostsAdded       []Link   `json:"group_hosts_added"`
+	HostsRemoved     []Link   `json:"group_hosts_removed"`
+	ChildrenAdded    []Link   `json:"group_children_added"`
+	ChildrenRemoved  []Link   `json:"group_children_removed"`
+}
+
+// Plan returns the inventory that importing src into current produces in
+// the given mode, and the changes from current to it.
+func Plan(current, src *Inventory, mode string) (*Inventory, *Changes, error) {
+	if mode != ImportMerge && mode != ImportOverwrite {
+		return nil, nil, fmt.Errorf("unknown import mode %q", mode)
+	}
+	src, err := normalized(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	cur, err := normalized(current)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	target := src
+	if mode == ImportMerge {
+		target, _ = normalized(cur)
+		mergeVars(target.Vars, src.Vars)
+		for name, h := range src.Hosts {
+			target.AddHost(name, h.Vars)
+		}
+		for name, g := range src.Groups {
+			tg := target.Group(name)
+			mergeVars(tg.Vars, g.Vars)
+			for _, h := range g.Hosts {
+				tg.AddHost(h)
+			}
+			for _, c := range g.Children {
+				tg.AddChild(c)
+			}
+		}
+	}
+	if err := target.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return target, diff(cur, target), nil
+}
+
+func diff(cur, target *Inventory) *Changes {
+	c := &Changes{VariablesChanged: !varsEqual(cur.Vars, target.Vars)}
+
+	c.HostsCreated, c.HostsUpdated, c.HostsDeleted = []string{}, []string{}, []string{}
+	for name, h := range target.Hosts {
+		if old, ok := cur.Hosts[name]; !ok {
+			c.HostsCreated = append(c.HostsCreated, name)
+		} else if !varsEqual(old.Vars, h.Vars) {
+			c.HostsUpdated = append(c.HostsUpdated, name)
+		}
+	}
+	for name := range cur.Hosts {
+		if _, ok := target.Hosts[name]; !ok {
+			c.HostsDeleted = append(c.HostsDeleted, name)
+		}
+	}
+
+	c.GroupsCreated, c.GroupsUpdated, c.GroupsDeleted = []string{}, []string{}, []string{}
+	for name, g := range target.Groups {
+		if old, ok := cur.Groups[name]; !ok {
+			c.GroupsCreated = append(c.GroupsCreated, name)
+		} else if !varsEqual(old.Vars, g.Vars) {
+			c.GroupsUpdated = append(c.GroupsUpdated, name)
+		}
+	}
+	for name := range cur.Groups {
+		if _, ok := target.Groups[name]; !ok {
+			c.GroupsDeleted = append(c.GroupsDeleted, name)
+		}
+	}
+
+	c.HostsAdded, c.HostsRemoved = linkDiff(cur, target, func(g *Group) []string { return g.Hosts })
+	c.ChildrenAdded, c.ChildrenRemoved = linkDiff(cur, target, func(g *Group) []string { return g.Children })
+
+	for _, s := range [][]string{c.HostsCreated, c.HostsUpdated, c.HostsDeleted, c.GroupsCreated, c.GroupsUpdated, c.GroupsDeleted} {
+		sort.Strings(s)
+	}
+	return c
+}
+
+// linkDiff compares the membership lists selected by members.
+func linkDiff(cur, target *Inventory, members func(*Group) []string) (added, removed []Link) {
+	links := func(inv *Inventory) map[Link]bool {
+		out := map[Link]bool{}
+		for _, g := range inv.Groups {
+			for _, m := range members(g) {
+				out[Link{Group: g.Name, Member: m}] = true
+			}
+		}
+		return out
+	}
+	before, after := links(cur), links(target)
+
+	added, removed = []Link{}, []Link{}
+	for l := range after {
+		if !before[l] {
+			added = append(added, l)
+		}
+	}
+	for l := range before {
+		if !after[l] {
+			removed = append(removed, l)
+		}
+	}
+	sortLinks(added)
+	sortLinks(removed)
+	return added, removed
+}
+
+func sortLinks(links []Link) {
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Group != links[j].Group {
+			return links[i].Group < links[j].Group
+		}
+		return links[i].Member < links[j].Member
+	})
+}
+
+// normalized returns a deep copy of inv with variables round-tripped through
+// JSON, so values parsed from YAML or INI compare equal to stored ones.
+func normalized(inv *Inventory) (*Inventory, error) {
+	out := New()
+	var err error
+	if out.Vars, err = jsonVars(inv.Vars); err != nil {
+		return nil, fmt.Errorf("inventory variables: %w", err)
+	}
+	for name, h := range inv.Hosts {
+		vars, err := jsonVars(h.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %w", name, err)
+		}
+		out.Hosts[name] = &Host{Name: name, Vars: vars}
+	}
+	for name, g := range inv.Groups {
+		vars, err := jsonVars(g.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: %w", name, err)
+		}
+		out.Groups[name] = &Group{
+			Name:     name,
+			Vars:     vars,
+			Hosts:    append([]string(nil), g.Hosts...),
+			Children: append([]string(nil), g.Children...),
+		}
+	}
+	return out, nil
+}
+
+func jsonVars(vars map[string]interface{}) (map[string]interface{}, error) {
+	out := map[string]interface{}{}
+	if len(vars) == 0 {
+		return out, nil
+	}
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return nil, fmt.Errorf("variables cannot be stored as JSON: %w", err)
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func varsEqual(a, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
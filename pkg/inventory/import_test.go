@@ -0,0 +1,203 @@
+package inventory_test
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/praetordev/praetor/pkg/inventory"
+)
+
+// TestParseFormats parses the same inventory written as INI, YAML and
+// ansible-inventory JSON and checks each against the --list fixture.
+func TestParseFormats(t *testing.T) {
+	want, err := os.ReadFile("testdata/import.list.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, format := range map[string]string{
+		"testdata/import.ini":       inventory.FormatINI,
+		"testdata/import.yml":       inventory.FormatYAML,
+		"testdata/import.list.json": inventory.FormatJSON,
+	} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := inventory.DetectFormat(data); got != format {
+			t.Errorf("%s: detected format %s, want %s", file, got, format)
+		}
+
+		inv, err := inventory.Parse(data, inventory.FormatAuto)
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", file, err)
+		}
+		got, err := inv.RenderList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSameList(t, file, got, want)
+	}
+}
+
+func TestParseINIHostPatterns(t *testing.T) {
+	inv, err := inventory.ParseINI([]byte("[app]\napp-[a:c]:2222\nnode[8:12:2]\nfe80::1\n[fe80::2]:22\n"))
+	if err != nil {
+		t.Fatalf("ParseINI failed: %v", err)
+	}
+
+	var hosts []string
+	for name := range inv.Hosts {
+		hosts = append(hosts, name)
+	}
+	for _, name := range []string{"app-a", "app-b", "app-c", "node8", "node10", "node12", "fe80::1", "fe80::2"} {
+		if _, ok := inv.Hosts[name]; !ok {
+			t.Errorf("host %s missing, got %v", name, hosts)
+		}
+	}
+	if len(inv.Hosts) != 8 {
+		t.Errorf("expected 8 hosts, got %v", hosts)
+	}
+	if port := inv.Hosts["app-b"].Vars["ansible_port"]; port != 2222 {
+		t.Errorf("app-b ansible_port = %v, want 2222", port)
+	}
+	if port := inv.Hosts["fe80::2"].Vars["ansible_port"]; port != 22 {
+		t.Errorf("fe80::2 ansible_port = %v, want 22", port)
+	}
+}
+
+func TestParseINIErrors(t *testing.T) {
+	for _, src := range []string{
+		"[web\nweb1\n",
+		"[web:foo]\nweb1\n",
+		"[web]\nweb1 novalue\n",
+		"[web]\nweb1 motd='unterminated\n",
+		"[a:children]\nb\n[b:children]\na\n",
+	} {
+		if _, err := inventory.ParseINI([]byte(src)); err == nil {
+			t.Errorf("expected an error for %q", src)
+		}
+	}
+}
+
+func TestPlanModes(t *testing.T) {
+	current, err := inventory.ParseINI([]byte("old ansible_host=10.0.0.1\n[web]\nweb1 a=1 b=1\n[web:vars]\nx=1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := inventory.ParseINI([]byte("[web]\nweb1 a=2\nweb2\n[prod:children]\nweb\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, changes, err := inventory.Plan(current, src, inventory.ImportMerge)
+	if err != nil {
+		t.Fatalf("merge plan failed: %v", err)
+	}
+	assertChanges(t, "merge", changes, `{
+		"variables_changed": false,
+		"hosts_created": ["web2"], "hosts_updated": ["web1"], "hosts_deleted": [],
+		"groups_created": ["prod"], "groups_updated": [], "groups_deleted": [],
+		"group_hosts_added": [{"group": "web", "member": "web2"}], "group_hosts_removed": [],
+		"group_children_added": [{"group": "prod", "member": "web"}], "group_children_removed": []
+	}`)
+	if vars := target.Hosts["web1"].Vars; !reflect.DeepEqual(vars, map[string]interface{}{"a": float64(2), "b": float64(1)}) {
+		t.Errorf("merged web1 vars = %v", vars)
+	}
+
+	target, changes, err = inventory.Plan(current, src, inventory.ImportOverwrite)
+	if err != nil {
+		t.Fatalf("overwrite plan failed: %v", err)
+	}
+	assertChanges(t, "overwrite", changes, `{
+		"variables_changed": false,
+		"hosts_created": ["web2"], "hosts_updated": ["web1"], "hosts_deleted": ["old"],
+		"groups_created": ["prod"], "groups_updated": ["web"], "groups_deleted": [],
+		"group_hosts_added": [{"group": "web", "member": "web2"}], "group_hosts_removed": [],
+		"group_children_added": [{"group": "prod", "member": "web"}], "group_children_removed": []
+	}`)
+	if vars := target.Hosts["web1"].Vars; !reflect.DeepEqual(vars, map[string]interface{}{"a": float64(2)}) {
+		t.Errorf("overwritten web1 vars = %v", vars)
+	}
+
+	// Importing the result again changes nothing
+	_, changes, err = inventory.Plan(target, src, inventory.ImportOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertChanges(t, "repeat", changes, `{
+		"variables_changed": false,
+		"hosts_created": [], "hosts_updated": [], "hosts_deleted": [],
+		"groups_created": [], "groups_updated": [], "groups_deleted": [],
+		"group_hosts_added": [], "group_hosts_removed": [],
+		"group_children_added": [], "group_children_removed": []
+	}`)
+}
+
+func assertChanges(t *testing.T, name string, got *inventory.Changes, want string) {
+	t.Helper()
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g, w interface{}
+	if err := json.Unmarshal(data, &g); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid expectation: %v", err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("%s: changes = %s", name, data)
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	current, err := inventory.ParseINI([]byte("manual\n[web]\nmanual\na x=1 y=1\nb\n[old]\nb\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := inventory.ParseINI([]byte("[web]\na x=2\nc\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := inventory.SyncOptions{
+		OwnedHosts:  map[string]bool{"a": true, "b": true},
+		OwnedGroups: map[string]bool{"web": true, "old": true},
+	}
+
+	target, changes, err := inventory.PlanSync(current, src, opts)
+	if err != nil {
+		t.Fatalf("merge sync failed: %v", err)
+	}
+	assertChanges(t, "merge", changes, `{
+		"variables_changed": false,
+		"hosts_created": ["c"], "hosts_updated": ["a"], "hosts_deleted": [],
+		"groups_created": [], "groups_updated": [], "groups_deleted": [],
+		"group_hosts_added": [{"group": "web", "member": "c"}], "group_hosts_removed": [],
+		"group_children_added": [], "group_children_removed": []
+	}`)
+	if vars := target.Hosts["a"].Vars; !reflect.DeepEqual(vars, map[string]interface{}{"x": float64(2), "y": float64(1)}) {
+		t.Errorf("merged a vars = %v", vars)
+	}
+
+	opts.Overwrite, opts.OverwriteVars = true, true
+	target, changes, err = inventory.PlanSync(current, src, opts)
+	if err != nil {
+		t.Fatalf("overwrite sync failed: %v", err)
+	}
+	// The manual host stays, and stays in the source's group
+	assertChanges(t, "overwrite", changes, `{
+		"variables_changed": false,
+		"hosts_created": ["c"], "hosts_updated": ["a"], "hosts_deleted": ["b"],
+		"groups_created": [], "groups_updated": [], "groups_deleted": ["old"],
+		"group_hosts_added": [{"group": "web", "member": "c"}],
+		"group_hosts_removed": [{"group": "old", "member": "b"}, {"group": "web", "member": "b"}],
+		"group_children_added": [], "group_children_removed": []
+	}`)
+	if vars := target.Hosts["a"].Vars; !reflect.DeepEqual(vars, map[string]interface{}{"x": float64(2)}) {
+		t.Errorf("overwritten a vars = %v", vars)
+	}
+}
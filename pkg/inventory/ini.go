@@ -0,0 +1,195 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// iniSection matches section headers the way Ansible's INI plugin does.
+var iniSection = regexp.MustCompile(`^\[([^:\]\s]+)(?::(\w+))?\]\s*(?:[#;].*)?$`)
+
+// ParseINI reads an inventory in Ansible's INI format: [group] sections of
+// host lines with key=value variables, [group:vars] and [group:children].
+// Values are parsed as literals where possible, like Ansible does.
+func ParseINI(data []byte) (*Inventory, error) {
+	inv := New()
+	section, kind := "ungrouped", "hosts"
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		// Other lines starting with [ are host patterns, like [fe80::1]:22
+		if m := iniSection.FindStringSubmatch(line); m != nil {
+			section, kind = m[1], m[2]
+			if kind == "" {
+				kind = "hosts"
+			}
+			if kind != "hosts" && kind != "vars" && kind != "children" {
+				return nil, fmt.Errorf("line %d: unknown section type %q", lineno, kind)
+			}
+			if section != "all" && section != "ungrouped" {
+				inv.Group(section)
+			}
+			continue
+		} else if line[0] == '[' && strings.HasSuffix(line, "]") {
+			return nil, fmt.Errorf("line %d: invalid section header %q", lineno, line)
+		}
+
+		var err error
+		switch kind {
+		case "hosts":
+			err = inv.parseINIHosts(section, line)
+		case "vars":
+			err = inv.parseINIVar(section, line)
+		case "children":
+			if section == "all" {
+				inv.Group(line)
+			} else {
+				inv.Group(section).AddChild(line)
+				inv.Group(line)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineno, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return inv, inv.Validate()
+}
+
+func (inv *Inventory) parseINIHosts(group, line string) error {
+	tokens, err := shellSplit(line)
+	if err != nil || len(tokens) == 0 {
+		return err
+	}
+
+	vars := map[string]interface{}{}
+	for _, tok := range tokens[1:] {
+		k, v, ok := strings.Cut(tok, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("expected key=value host variable, got %q", tok)
+		}
+		vars[k] = parseValue(v)
+	}
+
+	names, port, err := expandHostPattern(tokens[0])
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		h := inv.AddHost(name, vars)
+		if port != 0 {
+			h.Vars["ansible_port"] = port
+		}
+		if group != "all" && group != "ungrouped" {
+			inv.Group(group).AddHost(name)
+		}
+	}
+	return nil
+}
+
+func (inv *Inventory) parseINIVar(group, line string) error {
+	k, v, ok := strings.Cut(line, "=")
+	k = strings.TrimSpace(k)
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value group variable, got %q", line)
+	}
+	if group == "all" {
+		inv.Vars[k] = parseValue(strings.TrimSpace(v))
+		return nil
+	}
+	inv.Group(group).Vars[k] = parseValue(strings.TrimSpace(v))
+	return nil
+}
+
+// parseValue converts an INI value the way Ansible's literal evaluation
+// does: numbers, True/False/None, quoted strings and JSON lists or dicts.
+// Anything else is kept as a string.
+func parseValue(v string) interface{} {
+	switch v {
+	case "True":
+		return true
+	case "False":
+		return false
+	case "None":
+		return nil
+	}
+	// Python rejects integers with leading zeros, such as file modes
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil && !(len(v) > 1 && v[0] == '0') {
+		return i
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil && strings.ContainsAny(v, ".eE") {
+		return f
+	}
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	if len(v) >= 2 && (v[0] == '[' || v[0] == '{') {
+		var out interface{}
+		if err := json.Unmarshal([]byte(v), &out); err == nil {
+			return out
+		}
+	}
+	return v
+}
+
+// shellSplit splits a line into words like Python's shlex with comments
+// enabled: quotes group words and are removed, and # starts a comment.
+func shellSplit(line string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+				i++
+				cur.WriteByte(line[i])
+			} else {
+				cur.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == '\\' && i+1 < len(line):
+			i++
+			cur.WriteByte(line[i])
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		case c == '#' && !inWord:
+			i = len(line)
+		default:
+			cur.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
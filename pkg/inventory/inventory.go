@@ -0,0 +1,258 @@
+// Package inventory models Ansible inventories and converts them to and from
+// the formats Ansible reads and writes.
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Inventory is a resolved Ansible inventory: hosts with their variables, and
+// groups with variables, member hosts and child groups. Vars are the "all"
+// group variables.
+type Inventory struct {
+	Vars   map[string]interface{}
+	Hosts  map[string]*Host
+	Groups map[string]*Group
+}
+
+type Host struct {
+	Name string
+	Vars map[string]interface{}
+	IDs  []int64 // Rows the host was loaded from, if any
+}
+
+type Group struct {
+	Name     string
+	Vars     map[string]interface{}
+	Hosts    []string
+	Children []string
+}
+
+func New() *Inventory {
+	return &Inventory{
+		Vars:   map[string]interface{}{},
+		Hosts:  map[string]*Host{},
+		Groups: map[string]*Group{},
+	}
+}
+
+// AddHost adds a host, merging vars into those of an existing host.
+func (inv *Inventory) AddHost(name string, vars map[string]interface{}) *Host {
+	h, ok := inv.Hosts[name]
+	if !ok {
+		h = &Host{Name: name, Vars: map[string]interface{}{}}
+		inv.Hosts[name] = h
+	}
+	for k, v := range vars {
+		h.Vars[k] = v
+	}
+	return h
+}
+
+// Group returns the named group, creating it if needed.
+func (inv *Inventory) Group(name string) *Group {
+	g, ok := inv.Groups[name]
+	if !ok {
+		g = &Group{Name: name, Vars: map[string]interface{}{}}
+		inv.Groups[name] = g
+	}
+	return g
+}
+
+// AddHost adds a member host to the group.
+func (g *Group) AddHost(name string) {
+	for _, h := range g.Hosts {
+		if h == name {
+			return
+		}
+	}
+	g.Hosts = append(g.Hosts, name)
+}
+
+// AddChild adds a child group to the group.
+func (g *Group) AddChild(name string) {
+	for _, c := range g.Children {
+		if c == name {
+			return
+		}
+	}
+	g.Children = append(g.Children, name)
+}
+
+// Validate checks that every group member and child exists and that the
+// group hierarchy has no cycles.
+func (inv *Inventory) Validate() error {
+	for _, g := range inv.sortedGroups() {
+		for _, h := range g.Hosts {
+			if _, ok := inv.Hosts[h]; !ok {
+				return fmt.Errorf("group %s references unknown host %s", g.Name, h)
+			}
+		}
+		for _, c := range g.Children {
+			if _, ok := inv.Groups[c]; !ok {
+				return fmt.Errorf("group %s references unknown child group %s", g.Name, c)
+			}
+		}
+	}
+
+	// Depth-first search for a path back to a group already on the stack
+	state := map[string]int{} // 0 unvisited, 1 on stack, 2 done
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("group cycle: %v", append(path, name))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, c := range inv.Groups[name].Children {
+			if err := visit(c, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	for _, g := range inv.sortedGroups() {
+		if err := visit(g.Name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderJSON renders the inventory in Ansible's YAML inventory structure,
+// encoded as JSON. The yaml inventory plugin reads it from a .json file.
+func (inv *Inventory) RenderJSON() ([]byte, error) {
+	tree, err := inv.tree()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(tree, "", "  ")
+}
+
+// RenderYAML renders the inventory in Ansible's YAML inventory format.
+func (inv *Inventory) RenderYAML() ([]byte, error) {
+	tree, err := inv.tree()
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(tree)
+}
+
+// tree builds the YAML inventory structure. Every host is defined with its
+// vars under all.hosts; groups only list their members, so Ansible derives
+// "ungrouped" exactly as for the source inventory. A group reachable through
+// several parents is defined once and referenced elsewhere.
+func (inv *Inventory) tree() (map[string]interface{}, error) {
+	if err := inv.Validate(); err != nil {
+		return nil, err
+	}
+
+	all := map[string]interface{}{}
+	allVars := copyVars(inv.Vars)
+	if g, ok := inv.Groups["all"]; ok {
+		for k, v := range g.Vars {
+			allVars[k] = v
+		}
+	}
+	if len(allVars) > 0 {
+		all["vars"] = allVars
+	}
+
+	if len(inv.Hosts) > 0 {
+		hosts := map[string]interface{}{}
+		for name, h := range inv.Hosts {
+			if len(h.Vars) > 0 {
+				hosts[name] = h.Vars
+			} else {
+				hosts[name] = nil
+			}
+		}
+		all["hosts"] = hosts
+	}
+
+	defined := map[string]bool{}
+	var render func(g *Group) map[string]interface{}
+	render = func(g *Group) map[string]interface{} {
+		node := map[string]interface{}{}
+		if defined[g.Name] {
+			return node
+		}
+		defined[g.Name] = true
+		if len(g.Vars) > 0 {
+			node["vars"] = g.Vars
+		}
+		if len(g.Hosts) > 0 {
+			hosts := map[string]interface{}{}
+			for _, h := range g.Hosts {
+				hosts[h] = nil
+			}
+			node["hosts"] = hosts
+		}
+		if len(g.Children) > 0 {
+			children := map[string]interface{}{}
+			for _, c := range sortedStrings(g.Children) {
+				children[c] = render(inv.Groups[c])
+			}
+			node["children"] = children
+		}
+		return node
+	}
+
+	children := map[string]interface{}{}
+	for _, g := range inv.topGroups() {
+		children[g.Name] = render(g)
+	}
+	if len(children) > 0 {
+		all["children"] = children
+	}
+
+	return map[string]interface{}{"all": all}, nil
+}
+
+// topGroups returns the groups that are not a child of another group,
+// excluding "all" itself.
+func (inv *Inventory) topGroups() []*Group {
+	isChild := map[string]bool{}
+	for _, g := range inv.Groups {
+		for _, c := range g.Children {
+			isChild[c] = true
+		}
+	}
+	var top []*Group
+	for _, g := range inv.sortedGroups() {
+		if g.Name != "all" && !isChild[g.Name] {
+			top = append(top, g)
+		}
+	}
+	return top
+}
+
+func (inv *Inventory) sortedGroups() []*Group {
+	groups := make([]*Group, 0, len(inv.Groups))
+	for _, g := range inv.Groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+func sortedStrings(s []string) []string {
+	out := append([]string(nil), s...)
+	sort.Strings(out)
+	return out
+}
+
+func copyVars(vars map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		out[k] = v
+	}
+	return out
+}
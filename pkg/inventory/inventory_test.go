@@ -0,0 +1,190 @@
+package inventory_test
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/praetordev/praetor/pkg/inventory"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+func flatInventory(t *testing.T) *inventory.Inventory {
+	t.Helper()
+	inv, err := inventory.FromModels(
+		models.Inventory{Name: "flat", Variables: json.RawMessage(`{"ntp_server":"ntp.example.com","proxy":{"http":"http://proxy:3128","no_proxy":["localhost","10.0.0.0/8"]}}`)},
+		[]models.Host{
+			{ID: 1, Name: "web1", Variables: json.RawMessage(`{"ansible_host":"10.0.0.11","http_port":8080}`)},
+			{ID: 2, Name: "web2", Variables: json.RawMessage(`{"ansible_host":"10.0.0.12","tags":["a b","c"]}`)},
+			{ID: 3, Name: "db1", Variables: json.RawMessage(`{"ansible_user":"postgres","motd":"it's \"quoted\" = yes"}`)},
+			{ID: 4, Name: "bastion"},
+		},
+		[]models.Group{
+			{ID: 10, Name: "web", Variables: json.RawMessage(`{"nginx":{"workers":4,"sites":["a","b"]}}`)},
+			{ID: 11, Name: "db", Variables: json.RawMessage(`{}`)},
+		},
+		// Host 5 is disabled and so was not loaded
+		inventory.Membership{GroupHosts: map[int64][]int64{10: {1, 2}, 11: {3, 5}}},
+	)
+	if err != nil {
+		t.Fatalf("FromModels failed: %v", err)
+	}
+	return inv
+}
+
+func nestedInventory() *inventory.Inventory {
+	inv := inventory.New()
+	for _, h := range []string{"a1", "a2", "b1", "lone"} {
+		inv.AddHost(h, nil)
+	}
+	inv.Group("prod").AddChild("east")
+	inv.Group("prod").AddChild("west")
+	inv.Group("east").AddHost("a1")
+	inv.Group("east").AddChild("shared")
+	inv.Group("west").AddHost("b1")
+	inv.Group("west").AddChild("shared")
+	inv.Group("shared").AddHost("a2")
+	inv.Group("shared").Vars["x"] = 1
+	return inv
+}
+
+// TestRenderRoundTrip renders inventories, reads them back as Ansible's yaml
+// plugin would and compares the result with `ansible-inventory --list
+// --export` output. When ansible-inventory is installed, it is run on the
+// rendered file as well.
+func TestRenderRoundTrip(t *testing.T) {
+	cases := []struct {
+		name    string
+		inv     *inventory.Inventory
+		fixture string
+	}{
+		{"flat", flatInventory(t), "testdata/flat.list.json"},
+		{"nested", nestedInventory(), "testdata/nested.list.json"},
+	}
+
+	for _, tc := range cases {
+		want, err := os.ReadFile(tc.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rendered := map[string]func() ([]byte, error){
+			"hosts.json": tc.inv.RenderJSON,
+			"hosts.yml":  tc.inv.RenderYAML,
+		}
+		for file, render := range rendered {
+			data, err := render()
+			if err != nil {
+				t.Fatalf("%s: rendering %s failed: %v", tc.name, file, err)
+			}
+
+			parsed, err := inventory.ParseYAML(data)
+			if err != nil {
+				t.Fatalf("%s: parsing %s failed: %v\n%s", tc.name, file, err, data)
+			}
+			got, err := parsed.RenderList()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertSameList(t, tc.name+"/"+file, got, want)
+
+			if _, err := exec.LookPath("ansible-inventory"); err == nil {
+				path := filepath.Join(t.TempDir(), file)
+				if err := os.WriteFile(path, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+				out, err := exec.Command("ansible-inventory", "-i", path, "--list", "--export").Output()
+				if err != nil {
+					t.Fatalf("%s: ansible-inventory failed on %s: %v", tc.name, file, err)
+				}
+				assertSameList(t, tc.name+"/"+file+" (ansible-inventory)", out, want)
+			}
+		}
+	}
+}
+
+func TestRenderRejectsCycles(t *testing.T) {
+	inv := inventory.New()
+	inv.Group("a").AddChild("b")
+	inv.Group("b").AddChild("c")
+	inv.Group("c").AddChild("a")
+
+	_, err := inv.RenderJSON()
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+}
+
+func TestFromModelsRejectsNonObjectVars(t *testing.T) {
+	_, err := inventory.FromModels(models.Inventory{Name: "bad"},
+		[]models.Host{{ID: 1, Name: "web1", Variables: json.RawMessage(`["not", "a", "dict"]`)}},
+		nil, inventory.Membership{})
+	if err == nil || !strings.Contains(err.Error(), "web1") {
+		t.Fatalf("expected an error naming the host, got %v", err)
+	}
+}
+
+func TestHostVarsPrecedence(t *testing.T) {
+	inv, err := inventory.FromModels(
+		models.Inventory{Name: "nested", Variables: json.RawMessage(`{"env":"all","a":1,"b":"all"}`)},
+		[]models.Host{{ID: 1, Name: "h1", Variables: json.RawMessage(`{"a":2}`)}},
+		[]models.Group{
+			{ID: 1, Name: "prod", Variables: json.RawMessage(`{"env":"prod","tier":"prod"}`)},
+			{ID: 2, Name: "east", Variables: json.RawMessage(`{"env":"east"}`)},
+			{ID: 3, Name: "zone", Variables: json.RawMessage(`{"env":"zone","tier":"zone"}`)},
+		},
+		inventory.Membership{
+			GroupHosts:    map[int64][]int64{2: {1}, 3: {1}},
+			GroupChildren: map[int64][]int64{1: {2}},
+		},
+	)
+	if err != nil {
+		t.Fatalf("FromModels failed: %v", err)
+	}
+
+	// prod and zone are top-level; east is deeper, so it wins over both
+	if got, want := inv.HostGroups("h1"), []string{"prod", "zone", "east"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("HostGroups = %v, want %v", got, want)
+	}
+	want := map[string]interface{}{"env": "east", "tier": "zone", "a": float64(2), "b": "all"}
+	if got := inv.HostVars("h1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("HostVars = %v, want %v", got, want)
+	}
+}
+
+// assertSameList compares two --list documents, ignoring the order of group
+// hosts and children, which ansible-inventory does not sort.
+func assertSameList(t *testing.T, name string, got, want []byte) {
+	t.Helper()
+	var g, w map[string]interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("%s: invalid JSON: %v\n%s", name, err, got)
+	}
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatalf("%s: invalid fixture: %v", name, err)
+	}
+	sortMembers(g)
+	sortMembers(w)
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("%s: inventory mismatch\ngot:  %s\nwant: %s", name, got, want)
+	}
+}
+
+func sortMembers(list map[string]interface{}) {
+	for name, node := range list {
+		group, ok := node.(map[string]interface{})
+		if !ok || name == "_meta" {
+			continue
+		}
+		for _, key := range []string{"hosts", "children"} {
+			if members, ok := group[key].([]interface{}); ok {
+				sort.Slice(members, func(i, j int) bool { return members[i].(string) < members[j].(string) })
+			}
+		}
+	}
+}
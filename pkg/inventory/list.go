@@ -0,0 +1,155 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// RenderList renders the inventory as `ansible-inventory --list --export`
+// does, which is also the format of dynamic inventory scripts. Hosts that
+// belong to no group are listed under "ungrouped".
+func (inv *Inventory) RenderList() ([]byte, error) {
+	if err := inv.Validate(); err != nil {
+		return nil, err
+	}
+
+	hostvars := map[string]interface{}{}
+	for name, h := range inv.Hosts {
+		if len(h.Vars) > 0 {
+			hostvars[name] = h.Vars
+		}
+	}
+	out := map[string]interface{}{
+		"_meta": map[string]interface{}{"hostvars": hostvars},
+	}
+
+	grouped := map[string]bool{}
+	for _, g := range inv.Groups {
+		if g.Name == "all" || g.Name == "ungrouped" {
+			continue
+		}
+		for _, h := range g.Hosts {
+			grouped[h] = true
+		}
+	}
+
+	all := map[string]interface{}{}
+	allChildren := []string{"ungrouped"}
+	for _, g := range inv.topGroups() {
+		if g.Name != "ungrouped" {
+			allChildren = append(allChildren, g.Name)
+		}
+	}
+	all["children"] = allChildren
+	allVars := copyVars(inv.Vars)
+	if g, ok := inv.Groups["all"]; ok {
+		mergeVars(allVars, g.Vars)
+	}
+	if len(allVars) > 0 {
+		all["vars"] = allVars
+	}
+	out["all"] = all
+
+	// Like Ansible, a host is ungrouped only if no other group contains it
+	var ungrouped []string
+	for name := range inv.Hosts {
+		if !grouped[name] {
+			ungrouped = append(ungrouped, name)
+		}
+	}
+	if len(ungrouped) > 0 {
+		sort.Strings(ungrouped)
+		out["ungrouped"] = map[string]interface{}{"hosts": ungrouped}
+	}
+
+	for _, g := range inv.sortedGroups() {
+		if g.Name == "all" || g.Name == "ungrouped" {
+			continue
+		}
+		node := map[string]interface{}{}
+		if len(g.Hosts) > 0 {
+			node["hosts"] = sortedStrings(g.Hosts)
+		}
+		if len(g.Children) > 0 {
+			node["children"] = sortedStrings(g.Children)
+		}
+		if len(g.Vars) > 0 {
+			node["vars"] = g.Vars
+		}
+		// ansible-inventory omits groups with nothing to show
+		if len(node) > 0 {
+			out[g.Name] = node
+		}
+	}
+
+	return json.MarshalIndent(out, "", "    ")
+}
+
+// ParseList reads `ansible-inventory --list` output or dynamic inventory
+// script output. Groups may be objects with hosts, children and vars, or
+// plain lists of hosts.
+func ParseList(data []byte) (*Inventory, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return nil, fmt.Errorf("invalid inventory JSON: %w", err)
+	}
+
+	inv := New()
+	if raw, ok := top["_meta"]; ok {
+		var meta struct {
+			Hostvars map[string]map[string]interface{} `json:"hostvars"`
+		}
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, fmt.Errorf("invalid _meta: %w", err)
+		}
+		for host, vars := range meta.Hostvars {
+			inv.AddHost(host, vars)
+		}
+	}
+
+	for name, raw := range top {
+		if name == "_meta" {
+			continue
+		}
+		var node struct {
+			Hosts    []string               `json:"hosts"`
+			Children []string               `json:"children"`
+			Vars     map[string]interface{} `json:"vars"`
+		}
+		if err := json.Unmarshal(raw, &node.Hosts); err != nil {
+			node.Hosts = nil
+			if err := json.Unmarshal(raw, &node); err != nil {
+				return nil, fmt.Errorf("group %s: %w", name, err)
+			}
+		}
+
+		for _, h := range node.Hosts {
+			inv.AddHost(h, nil)
+		}
+		switch name {
+		case "all":
+			mergeVars(inv.Vars, node.Vars)
+			for _, c := range node.Children {
+				if c != "ungrouped" {
+					inv.Group(c)
+				}
+			}
+		case "ungrouped":
+			if len(node.Vars) > 0 {
+				mergeVars(inv.Group(name).Vars, node.Vars)
+			}
+		default:
+			g := inv.Group(name)
+			mergeVars(g.Vars, node.Vars)
+			for _, h := range node.Hosts {
+				g.AddHost(h)
+			}
+			for _, c := range node.Children {
+				g.AddChild(c)
+				inv.Group(c)
+			}
+		}
+	}
+	return inv, inv.Validate()
+}
@@ -0,0 +1,74 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// DecodeVars decodes a JSONB variables column. NULL and empty values decode
+// to an empty map.
+func DecodeVars(raw json.RawMessage) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	if len(raw) == 0 || string(raw) == "null" {
+		return vars, nil
+	}
+	if err := json.Unmarshal(raw, &vars); err != nil {
+		return nil, fmt.Errorf("variables must be a JSON object: %w", err)
+	}
+	return vars, nil
+}
+
+// Membership holds an inventory's group relationships by ID.
+type Membership struct {
+	GroupHosts    map[int64][]int64 // Group ID to member host IDs
+	GroupChildren map[int64][]int64 // Group ID to child group IDs
+}
+
+// FromModels builds the inventory for inv from its hosts, groups and group
+// membership. Members missing from hosts, such as disabled hosts, are left
+// out.
+func FromModels(inv models.Inventory, hosts []models.Host, groups []models.Group, m Membership) (*Inventory, error) {
+	out := New()
+	vars, err := DecodeVars(inv.Variables)
+	if err != nil {
+		return nil, fmt.Errorf("inventory %s: %w", inv.Name, err)
+	}
+	out.Vars = vars
+
+	hostNames := make(map[int64]string, len(hosts))
+	for _, h := range hosts {
+		vars, err := DecodeVars(h.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %w", h.Name, err)
+		}
+		host := out.AddHost(h.Name, vars)
+		host.IDs = append(host.IDs, h.ID)
+		hostNames[h.ID] = h.Name
+	}
+
+	groupNames := make(map[int64]string, len(groups))
+	for _, g := range groups {
+		groupNames[g.ID] = g.Name
+	}
+	for _, g := range groups {
+		vars, err := DecodeVars(g.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: %w", g.Name, err)
+		}
+		group := out.Group(g.Name)
+		mergeVars(group.Vars, vars)
+		for _, id := range m.GroupHosts[g.ID] {
+			if name, ok := hostNames[id]; ok {
+				group.AddHost(name)
+			}
+		}
+		for _, id := range m.GroupChildren[g.ID] {
+			if name, ok := groupNames[id]; ok {
+				group.AddChild(name)
+			}
+		}
+	}
+	return out, out.Validate()
+}
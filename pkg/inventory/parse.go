@@ -0,0 +1,123 @@
+package inventory
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseYAML reads an inventory in Ansible's YAML inventory format, as the
+// yaml inventory plugin does. JSON in the same structure is accepted too.
+func ParseYAML(data []byte) (*Inventory, error) {
+	var top map[string]interface{}
+	if err := yaml.Unmarshal(data, &top); err != nil {
+		return nil, fmt.Errorf("invalid YAML inventory: %w", err)
+	}
+
+	inv := New()
+	for name, node := range top {
+		if err := inv.parseGroup(name, node); err != nil {
+			return nil, err
+		}
+	}
+	return inv, inv.Validate()
+}
+
+func (inv *Inventory) parseGroup(name string, node interface{}) error {
+	if node == nil {
+		if name != "all" && name != "ungrouped" {
+			inv.Group(name)
+		}
+		return nil
+	}
+	data, ok := node.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("group %s: expected a mapping, got %T", name, node)
+	}
+
+	// Members of "all" and "ungrouped" are hosts without a group
+	var g *Group
+	if name != "all" && name != "ungrouped" {
+		g = inv.Group(name)
+	}
+	for key, value := range data {
+		switch key {
+		case "vars":
+			vars, err := varsOf(value)
+			if err != nil {
+				return fmt.Errorf("group %s vars: %w", name, err)
+			}
+			switch {
+			case g != nil:
+				mergeVars(g.Vars, vars)
+			case name == "all":
+				mergeVars(inv.Vars, vars)
+			case len(vars) > 0:
+				mergeVars(inv.Group(name).Vars, vars)
+			}
+		case "hosts":
+			if value == nil {
+				continue
+			}
+			hosts, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("group %s hosts: expected a mapping, got %T", name, value)
+			}
+			for pattern, hv := range hosts {
+				vars, err := varsOf(hv)
+				if err != nil {
+					return fmt.Errorf("host %s vars: %w", pattern, err)
+				}
+				names, port, err := expandHostPattern(pattern)
+				if err != nil {
+					return err
+				}
+				for _, host := range names {
+					h := inv.AddHost(host, vars)
+					if port != 0 {
+						h.Vars["ansible_port"] = port
+					}
+					if g != nil {
+						g.AddHost(host)
+					}
+				}
+			}
+		case "children":
+			if value == nil {
+				continue
+			}
+			children, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("group %s children: expected a mapping, got %T", name, value)
+			}
+			for child, cv := range children {
+				if g != nil {
+					g.AddChild(child)
+				}
+				if err := inv.parseGroup(child, cv); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("group %s: unexpected key %q", name, key)
+		}
+	}
+	return nil
+}
+
+func varsOf(value interface{}) (map[string]interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	vars, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a mapping, got %T", value)
+	}
+	return vars, nil
+}
+
+func mergeVars(dst, src map[string]interface{}) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
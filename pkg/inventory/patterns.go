@@ -0,0 +1,139 @@
+package inventory
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// expandHostPattern expands Ansible host ranges such as web[01:10].example.com
+// or db-[a:c] into host names, and splits off a trailing :port.
+func expandHostPattern(pattern string) ([]string, int, error) {
+	pattern, port, err := splitPort(pattern)
+	if err != nil {
+		return nil, 0, err
+	}
+	// A bracketed IPv6 address, written that way to carry a port
+	if strings.HasPrefix(pattern, "[") && strings.HasSuffix(pattern, "]") && net.ParseIP(pattern[1:len(pattern)-1]) != nil {
+		return []string{pattern[1 : len(pattern)-1]}, port, nil
+	}
+	names, err := expandRanges(pattern)
+	return names, port, err
+}
+
+// splitPort separates host:port. Addresses with more than one colon outside
+// brackets are IPv6 addresses without a port.
+func splitPort(pattern string) (string, int, error) {
+	depth, last, colons := 0, -1, 0
+	for i, c := range pattern {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				colons++
+				last = i
+			}
+		}
+	}
+	if colons != 1 {
+		return pattern, 0, nil
+	}
+	port, err := strconv.Atoi(pattern[last+1:])
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in host pattern %q", pattern)
+	}
+	return pattern[:last], port, nil
+}
+
+func expandRanges(pattern string) ([]string, error) {
+	open := strings.IndexByte(pattern, '[')
+	if open < 0 {
+		return []string{pattern}, nil
+	}
+	end := strings.IndexByte(pattern[open:], ']')
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated range in host pattern %q", pattern)
+	}
+	end += open
+	head, spec, tail := pattern[:open], pattern[open+1:end], pattern[end+1:]
+
+	// Brackets without a range, as around IPv6 addresses, are literal
+	if !strings.Contains(spec, ":") || strings.Count(spec, ":") > 2 {
+		rest, err := expandRanges(tail)
+		if err != nil {
+			return nil, err
+		}
+		var out []string
+		for _, r := range rest {
+			out = append(out, pattern[:end+1]+r)
+		}
+		return out, nil
+	}
+
+	values, err := rangeValues(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid range in host pattern %q: %w", pattern, err)
+	}
+	rest, err := expandRanges(tail)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, v := range values {
+		for _, r := range rest {
+			out = append(out, head+v+r)
+		}
+	}
+	return out, nil
+}
+
+// rangeValues expands start:end[:stride], numeric with the start's zero
+// padding or a single letter.
+func rangeValues(spec string) ([]string, error) {
+	parts := strings.Split(spec, ":")
+	start, end := parts[0], parts[1]
+	stride := 1
+	if len(parts) == 3 {
+		s, err := strconv.Atoi(parts[2])
+		if err != nil || s <= 0 {
+			return nil, fmt.Errorf("invalid stride %q", parts[2])
+		}
+		stride = s
+	}
+	if start == "" {
+		start = "0"
+	}
+
+	if lo, err := strconv.Atoi(start); err == nil {
+		hi, err := strconv.Atoi(end)
+		if err != nil || hi < lo {
+			return nil, fmt.Errorf("invalid bounds %s:%s", start, end)
+		}
+		width := 0
+		if len(start) > 1 && start[0] == '0' {
+			width = len(start)
+		}
+		var out []string
+		for i := lo; i <= hi; i += stride {
+			out = append(out, fmt.Sprintf("%0*d", width, i))
+		}
+		return out, nil
+	}
+
+	if len(start) == 1 && len(end) == 1 && isLetter(start[0]) && isLetter(end[0]) && start[0] <= end[0] {
+		var out []string
+		for c := int(start[0]); c <= int(end[0]); c += stride {
+			out = append(out, string(rune(c)))
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("invalid bounds %s:%s", start, end)
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
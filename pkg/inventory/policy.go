@@ -0,0 +1,239 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"gopkg.in/yaml.v3"
+)
+
+// MaskedValue replaces the values of sensitive variables in API responses
+// and logs. Sending it back in an update keeps the stored value.
+const MaskedValue = "$encrypted$"
+
+// DefaultSensitiveKeys are the variable key patterns treated as sensitive in
+// organizations that set no policy of their own.
+var DefaultSensitiveKeys = []string{
+	"*password*",
+	"*passwd*",
+	"*_pass",
+	"*secret*",
+	"*token*",
+	"*private_key*",
+	"*api_key*",
+}
+
+// VariablePolicy decides which variables are sensitive. Keys are matched
+// case-insensitively against shell patterns such as "*password*", at any
+// depth of nested mappings.
+type VariablePolicy struct {
+	SensitiveKeys []string
+}
+
+// NewVariablePolicy builds a policy from an organization's key patterns. A
+// nil list selects DefaultSensitiveKeys; an empty one masks nothing.
+func NewVariablePolicy(keys []string) (*VariablePolicy, error) {
+	if keys == nil {
+		keys = DefaultSensitiveKeys
+	}
+	p := &VariablePolicy{SensitiveKeys: make([]string, len(keys))}
+	for i, key := range keys {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			return nil, fmt.Errorf("sensitive key pattern %d is empty", i)
+		}
+		if _, err := path.Match(key, ""); err != nil {
+			return nil, fmt.Errorf("sensitive key pattern %q: %w", keys[i], err)
+		}
+		p.SensitiveKeys[i] = key
+	}
+	return p, nil
+}
+
+// LoadVariablePolicy reads the policy of an organization.
+func LoadVariablePolicy(ctx context.Context, q sqlx.QueryerContext, orgID int64) (*VariablePolicy, error) {
+	var keys pq.StringArray
+	if err := sqlx.GetContext(ctx, q, &keys, "SELECT sensitive_variable_keys FROM organizations WHERE id = $1", orgID); err != nil {
+		return nil, fmt.Errorf("failed to fetch variable policy of organization %d: %w", orgID, err)
+	}
+	return NewVariablePolicy(keys)
+}
+
+// Sensitive reports whether variables named key are sensitive.
+func (p *VariablePolicy) Sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range p.SensitiveKeys {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Mask returns a copy of vars with the values of sensitive variables
+// replaced by MaskedValue.
+func (p *VariablePolicy) Mask(vars map[string]interface{}) map[string]interface{} {
+	if vars == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		if p.Sensitive(k) {
+			out[k] = MaskedValue
+		} else {
+			out[k] = p.maskValue(v)
+		}
+	}
+	return out
+}
+
+func (p *VariablePolicy) maskValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return p.Mask(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = p.maskValue(item)
+		}
+		return out
+	}
+	return v
+}
+
+// MaskJSON masks a JSON variables object. Values that are not objects are
+// returned as they are.
+func (p *VariablePolicy) MaskJSON(raw json.RawMessage) json.RawMessage {
+	var vars map[string]interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &vars) != nil || vars == nil {
+		return raw
+	}
+	out, err := json.Marshal(p.Mask(vars))
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+// Unmask puts the stored values back in place of sensitive variables that
+// were sent as MaskedValue, so masked variables survive a round trip
+// through the API. List items are matched with stored ones by position.
+func (p *VariablePolicy) Unmask(vars, stored map[string]interface{}) {
+	for k, v := range vars {
+		old, ok := stored[k]
+		if !ok {
+			continue
+		}
+		if p.Sensitive(k) && v == MaskedValue {
+			vars[k] = old
+			continue
+		}
+		p.unmaskValue(v, old)
+	}
+}
+
+func (p *VariablePolicy) unmaskValue(v, old interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if oldMap, ok := old.(map[string]interface{}); ok {
+			p.Unmask(v, oldMap)
+		}
+	case []interface{}:
+		oldList, ok := old.([]interface{})
+		if !ok {
+			return
+		}
+		for i := range v {
+			if i < len(oldList) {
+				p.unmaskValue(v[i], oldList[i])
+			}
+		}
+	}
+}
+
+// UnmaskJSON is Unmask for JSON variables objects.
+func (p *VariablePolicy) UnmaskJSON(raw, stored json.RawMessage) (json.RawMessage, error) {
+	if !bytes.Contains(raw, []byte(MaskedValue)) {
+		return raw, nil
+	}
+	vars, err := DecodeVars(raw)
+	if err != nil {
+		return nil, err
+	}
+	old, err := DecodeVars(stored)
+	if err != nil {
+		return nil, err
+	}
+	p.Unmask(vars, old)
+	return json.Marshal(vars)
+}
+
+// MaskInventory returns a copy of inv with sensitive variables masked, for
+// logging.
+func (p *VariablePolicy) MaskInventory(inv *Inventory) *Inventory {
+	out := &Inventory{
+		Vars:   p.Mask(inv.Vars),
+		Hosts:  make(map[string]*Host, len(inv.Hosts)),
+		Groups: make(map[string]*Group, len(inv.Groups)),
+	}
+	for name, h := range inv.Hosts {
+		out.Hosts[name] = &Host{Name: h.Name, Vars: p.Mask(h.Vars), IDs: h.IDs}
+	}
+	for name, g := range inv.Groups {
+		out.Groups[name] = &Group{Name: g.Name, Vars: p.Mask(g.Vars), Hosts: g.Hosts, Children: g.Children}
+	}
+	return out
+}
+
+// ParseVariables normalizes variables sent to the API into a JSON object.
+// They may be given as an object, or as a string of YAML or JSON text that
+// holds a mapping. Missing, null and blank variables are an empty object.
+func ParseVariables(raw json.RawMessage) (json.RawMessage, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return json.RawMessage("{}"), nil
+	}
+
+	var value interface{}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, fmt.Errorf("invalid variables: %w", err)
+		}
+		if strings.TrimSpace(text) == "" {
+			return json.RawMessage("{}"), nil
+		}
+		if err := yaml.Unmarshal([]byte(text), &value); err != nil {
+			return nil, fmt.Errorf("variables are not valid YAML or JSON: %w", err)
+		}
+	} else if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, fmt.Errorf("invalid variables: %w", err)
+	}
+
+	vars, ok := value.(map[string]interface{})
+	if !ok {
+		if value == nil {
+			return json.RawMessage("{}"), nil
+		}
+		return nil, fmt.Errorf("variables must be a mapping, got %s", typeName(value))
+	}
+	if raw[0] == '{' {
+		// Keep JSON as sent, so large numbers are not rounded
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			return nil, err
+		}
+		return compact.Bytes(), nil
+	}
+	out, err := json.Marshal(vars)
+	if err != nil {
+		return nil, fmt.Errorf("variables cannot be stored as JSON: %w", err)
+	}
+	return out, nil
+}
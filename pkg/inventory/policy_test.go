@@ -0,0 +1,84 @@
+package inventory_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/praetordev/praetor/pkg/inventory"
+)
+
+func TestParseVariables(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{``, `{}`},
+		{`null`, `{}`},
+		{`""`, `{}`},
+		{`{"a": 1, "big": 12345678901234567890}`, `{"a":1,"big":12345678901234567890}`},
+		{`"a: 1\nb: [x, y]\n"`, `{"a":1,"b":["x","y"]}`},
+		{`"{\"a\": true}"`, `{"a":true}`},
+	}
+	for _, tt := range tests {
+		got, err := inventory.ParseVariables(json.RawMessage(tt.in))
+		if err != nil {
+			t.Errorf("ParseVariables(%s): %v", tt.in, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("ParseVariables(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{`[1, 2]`, `42`, `"- a\n- b"`, `"just text"`, `"a: [unclosed"`} {
+		if _, err := inventory.ParseVariables(json.RawMessage(in)); err == nil {
+			t.Errorf("ParseVariables(%s) should fail", in)
+		}
+	}
+}
+
+func TestVariablePolicy(t *testing.T) {
+	p, err := inventory.NewVariablePolicy(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := json.RawMessage(`{"ansible_password":"hunter2","user":"admin","cloud":{"API_TOKEN":"t0k","region":"eu"},"keys":[{"db_secret":"s"}]}`)
+
+	masked := p.MaskJSON(stored)
+	want := `{"ansible_password":"$encrypted$","cloud":{"API_TOKEN":"$encrypted$","region":"eu"},"keys":[{"db_secret":"$encrypted$"}],"user":"admin"}`
+	if string(masked) != want {
+		t.Fatalf("MaskJSON = %s, want %s", masked, want)
+	}
+
+	// Masked values sent back keep what is stored; new values replace it
+	update := json.RawMessage(`{"ansible_password":"$encrypted$","user":"root","cloud":{"API_TOKEN":"new","region":"eu"}}`)
+	got, err := p.UnmaskJSON(update, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{"ansible_password":"hunter2","cloud":{"API_TOKEN":"new","region":"eu"},"user":"root"}`
+	if string(got) != want {
+		t.Errorf("UnmaskJSON = %s, want %s", got, want)
+	}
+
+	// Secrets in lists survive a GET and PUT round trip too
+	stored = json.RawMessage(`{"users":[{"name":"a","password":"s3cret"},{"name":"b","password":"pw"}]}`)
+	got, err = p.UnmaskJSON(p.MaskJSON(stored), stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{"users":[{"name":"a","password":"s3cret"},{"name":"b","password":"pw"}]}`
+	if string(got) != want {
+		t.Errorf("UnmaskJSON of masked list = %s, want %s", got, want)
+	}
+
+	none, err := inventory.NewVariablePolicy([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if none.Sensitive("ansible_password") {
+		t.Error("an empty policy should mask nothing")
+	}
+	if _, err := inventory.NewVariablePolicy([]string{"[bad"}); err == nil {
+		t.Error("malformed patterns should be rejected")
+	}
+}
@@ -0,0 +1,82 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/hostfilter"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// MatchHosts returns the hosts in the organization's inventories that match
+// the filter, ordered by inventory and name, and how many match in all. A
+// limit of 0 returns every match.
+func MatchHosts(ctx context.Context, q sqlx.QueryerContext, orgID int64, f *hostfilter.Filter, includeDisabled bool, limit, offset int) ([]models.Host, int64, error) {
+	cond, args := f.SQL(2)
+	args = append([]interface{}{orgID}, args...)
+	from := `
+		FROM hosts h JOIN inventories i ON i.id = h.inventory_id
+		WHERE i.organization_id = $1 AND i.kind <> 'smart' AND ` + cond
+	if !includeDisabled {
+		from += " AND h.enabled"
+	}
+
+	var total int64
+	if err := sqlx.GetContext(ctx, q, &total, "SELECT count(*)"+from, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to evaluate host filter: %w", err)
+	}
+
+	query := "SELECT h.*" + from + " ORDER BY h.inventory_id, h.name"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	}
+	var hosts []models.Host
+	if err := sqlx.SelectContext(ctx, q, &hosts, query, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to evaluate host filter: %w", err)
+	}
+	return hosts, total, nil
+}
+
+// LoadSmart evaluates a smart inventory's host filter. Each enabled matching
+// host carries the variables it resolves to in its own inventory, under the
+// smart inventory's variables. A host name found in several inventories is
+// taken from the first.
+func LoadSmart(ctx context.Context, q sqlx.QueryerContext, inv models.Inventory) (*Inventory, error) {
+	if inv.HostFilter == nil {
+		return nil, fmt.Errorf("smart inventory %d has no host filter", inv.ID)
+	}
+	f, err := hostfilter.Parse(*inv.HostFilter)
+	if err != nil {
+		return nil, fmt.Errorf("smart inventory %d: %w", inv.ID, err)
+	}
+	vars, err := DecodeVars(inv.Variables)
+	if err != nil {
+		return nil, fmt.Errorf("inventory variables: %w", err)
+	}
+
+	hosts, _, err := MatchHosts(ctx, q, inv.OrganizationID, f, false, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	out := New()
+	out.Vars = vars
+	sources := map[int64]*Inventory{}
+	for _, h := range hosts {
+		if _, dup := out.Hosts[h.Name]; dup {
+			log.Printf("Smart inventory %d: host %s from inventory %d shadowed by an earlier inventory", inv.ID, h.Name, h.InventoryID)
+			continue
+		}
+		src, ok := sources[h.InventoryID]
+		if !ok {
+			if src, err = Load(ctx, q, h.InventoryID, false); err != nil {
+				return nil, err
+			}
+			sources[h.InventoryID] = src
+		}
+		out.AddHost(h.Name, src.HostVars(h.Name)).IDs = []int64{h.ID}
+	}
+	return out, nil
+}
@@ -0,0 +1,194 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// Load reads an inventory with its variables, groups and group membership.
+// Disabled hosts are left out unless includeDisabled is set.
+func Load(ctx context.Context, q sqlx.QueryerContext, id int64, includeDisabled bool) (*Inventory, error) {
+	var inv models.Inventory
+	if err := sqlx.GetContext(ctx, q, &inv, "SELECT * FROM inventories WHERE id = $1", id); err != nil {
+		return nil, fmt.Errorf("failed to fetch inventory %d: %w", id, err)
+	}
+
+	var hosts []models.Host
+	query := "SELECT * FROM hosts WHERE inventory_id = $1 AND enabled = true"
+	if includeDisabled {
+		query = "SELECT * FROM hosts WHERE inventory_id = $1"
+	}
+	if err := sqlx.SelectContext(ctx, q, &hosts, query, id); err != nil {
+		return nil, fmt.Errorf("failed to fetch hosts: %w", err)
+	}
+
+	var groups []models.Group
+	if err := sqlx.SelectContext(ctx, q, &groups, "SELECT * FROM groups WHERE inventory_id = $1", id); err != nil {
+		return nil, fmt.Errorf("failed to fetch groups: %w", err)
+	}
+
+	var pairs []struct {
+		Kind   string `db:"kind"`
+		Parent int64  `db:"parent"`
+		Member int64  `db:"member"`
+	}
+	err := sqlx.SelectContext(ctx, q, &pairs, `
+		SELECT 'host' AS kind, m.group_id AS parent, m.host_id AS member
+		FROM host_group_mapping m JOIN groups g ON g.id = m.group_id
+		WHERE g.inventory_id = $1
+		UNION ALL
+		SELECT 'group', c.parent_id, c.child_id
+		FROM group_children c JOIN groups g ON g.id = c.parent_id
+		WHERE g.inventory_id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch group membership: %w", err)
+	}
+	m := Membership{GroupHosts: map[int64][]int64{}, GroupChildren: map[int64][]int64{}}
+	for _, p := range pairs {
+		if p.Kind == "host" {
+			m.GroupHosts[p.Parent] = append(m.GroupHosts[p.Parent], p.Member)
+		} else {
+			m.GroupChildren[p.Parent] = append(m.GroupChildren[p.Parent], p.Member)
+		}
+	}
+
+	return FromModels(inv, hosts, groups, m)
+}
+
+// Apply writes the changes planned for target to the inventory's rows. Run
+// it in the transaction the current inventory was loaded in.
+func Apply(ctx context.Context, tx *sqlx.Tx, id int64, target *Inventory, c *Changes) error {
+	if c.VariablesChanged {
+		vars, err := json.Marshal(target.Vars)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE inventories SET variables = $2, modified_at = now() WHERE id = $1", id, vars); err != nil {
+			return fmt.Errorf("failed to update inventory variables: %w", err)
+		}
+	}
+
+	for _, table := range []struct {
+		name                      string
+		created, updated, deleted []string
+		vars                      func(name string) map[string]interface{}
+	}{
+		{"hosts", c.HostsCreated, c.HostsUpdated, c.HostsDeleted, func(n string) map[string]interface{} { return target.Hosts[n].Vars }},
+		{"groups", c.GroupsCreated, c.GroupsUpdated, c.GroupsDeleted, func(n string) map[string]interface{} { return target.Groups[n].Vars }},
+	} {
+		for _, name := range table.deleted {
+			query := fmt.Sprintf("DELETE FROM %s WHERE inventory_id = $1 AND name = $2", table.name)
+			if _, err := tx.ExecContext(ctx, query, id, name); err != nil {
+				return fmt.Errorf("failed to delete %s %s: %w", table.name, name, err)
+			}
+		}
+		for _, name := range table.created {
+			vars, err := json.Marshal(table.vars(name))
+			if err != nil {
+				return err
+			}
+			query := fmt.Sprintf("INSERT INTO %s (inventory_id, name, variables) VALUES ($1, $2, $3)", table.name)
+			if _, err := tx.ExecContext(ctx, query, id, name, vars); err != nil {
+				return fmt.Errorf("failed to create %s %s: %w", table.name, name, err)
+			}
+		}
+		for _, name := range table.updated {
+			vars, err := json.Marshal(table.vars(name))
+			if err != nil {
+				return err
+			}
+			query := fmt.Sprintf("UPDATE %s SET variables = $3, modified_at = now() WHERE inventory_id = $1 AND name = $2", table.name)
+			if _, err := tx.ExecContext(ctx, query, id, name, vars); err != nil {
+				return fmt.Errorf("failed to update %s %s: %w", table.name, name, err)
+			}
+		}
+	}
+
+	hostIDs, err := idsByName(ctx, tx, "hosts", id)
+	if err != nil {
+		return err
+	}
+	groupIDs, err := idsByName(ctx, tx, "groups", id)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range c.HostsRemoved {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM host_group_mapping WHERE group_id = $1 AND host_id = $2", groupIDs[l.Group], hostIDs[l.Member]); err != nil {
+			return fmt.Errorf("failed to remove host %s from group %s: %w", l.Member, l.Group, err)
+		}
+	}
+	for _, l := range c.ChildrenRemoved {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM group_children WHERE parent_id = $1 AND child_id = $2", groupIDs[l.Group], groupIDs[l.Member]); err != nil {
+			return fmt.Errorf("failed to remove group %s from group %s: %w", l.Member, l.Group, err)
+		}
+	}
+	for _, l := range c.HostsAdded {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO host_group_mapping (host_id, group_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", hostIDs[l.Member], groupIDs[l.Group]); err != nil {
+			return fmt.Errorf("failed to add host %s to group %s: %w", l.Member, l.Group, err)
+		}
+	}
+	for _, l := range c.ChildrenAdded {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO group_children (parent_id, child_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", groupIDs[l.Group], groupIDs[l.Member]); err != nil {
+			return fmt.Errorf("failed to add group %s to group %s: %w", l.Member, l.Group, err)
+		}
+	}
+	return nil
+}
+
+// Owned returns the names of the hosts and groups an inventory source owns.
+func Owned(ctx context.Context, q sqlx.QueryerContext, sourceID int64) (hosts, groups map[string]bool, err error) {
+	hosts, groups = map[string]bool{}, map[string]bool{}
+	for table, names := range map[string]map[string]bool{"hosts": hosts, "groups": groups} {
+		var rows []string
+		query := fmt.Sprintf("SELECT name FROM %s WHERE inventory_source_id = $1", table)
+		if err := sqlx.SelectContext(ctx, q, &rows, query, sourceID); err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch %s owned by source %d: %w", table, sourceID, err)
+		}
+		for _, name := range rows {
+			names[name] = true
+		}
+	}
+	return hosts, groups, nil
+}
+
+// Claim marks the hosts and groups in src as owned by an inventory source.
+// Run it after Apply has created them.
+func Claim(ctx context.Context, tx *sqlx.Tx, inventoryID, sourceID int64, src *Inventory) error {
+	hosts := make([]string, 0, len(src.Hosts))
+	for name := range src.Hosts {
+		hosts = append(hosts, name)
+	}
+	groups := make([]string, 0, len(src.Groups))
+	for name := range src.Groups {
+		groups = append(groups, name)
+	}
+	for table, names := range map[string][]string{"hosts": hosts, "groups": groups} {
+		query := fmt.Sprintf("UPDATE %s SET inventory_source_id = $2 WHERE inventory_id = $1 AND name = ANY($3)", table)
+		if _, err := tx.ExecContext(ctx, query, inventoryID, sourceID, pq.Array(names)); err != nil {
+			return fmt.Errorf("failed to claim %s for source %d: %w", table, sourceID, err)
+		}
+	}
+	return nil
+}
+
+func idsByName(ctx context.Context, tx *sqlx.Tx, table string, inventoryID int64) (map[string]int64, error) {
+	var rows []struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+	query := fmt.Sprintf("SELECT id, name FROM %s WHERE inventory_id = $1", table)
+	if err := tx.SelectContext(ctx, &rows, query, inventoryID); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", table, err)
+	}
+	ids := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		ids[r.Name] = r.ID
+	}
+	return ids, nil
+}
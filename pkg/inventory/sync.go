@@ -0,0 +1,107 @@
+package inventory
+
+// SyncOptions controls how an inventory update applies what its source
+// reports. Hosts and groups added by hand are never removed.
+type SyncOptions struct {
+	// Overwrite removes hosts and groups the source owns but no longer
+	// reports, and memberships of its groups it no longer reports.
+	Overwrite bool
+	// OverwriteVars replaces the variables of the inventory and of the
+	// reported hosts and groups instead of merging into them.
+	OverwriteVars bool
+	// OwnedHosts and OwnedGroups are the names the source owns from earlier
+	// updates.
+	OwnedHosts, OwnedGroups map[string]bool
+}
+
+// PlanSync returns the inventory that an update reporting src produces from
+// current, and the changes from current to it.
+func PlanSync(current, src *Inventory, opts SyncOptions) (*Inventory, *Changes, error) {
+	src, err := normalized(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	cur, err := normalized(current)
+	if err != nil {
+		return nil, nil, err
+	}
+	target, _ := normalized(cur)
+
+	if opts.OverwriteVars {
+		target.Vars = src.Vars
+	} else {
+		mergeVars(target.Vars, src.Vars)
+	}
+	for name, h := range src.Hosts {
+		if t, ok := target.Hosts[name]; ok && opts.OverwriteVars {
+			t.Vars = h.Vars
+		} else {
+			target.AddHost(name, h.Vars)
+		}
+	}
+
+	// Members the source manages: what it owns and what it reports now
+	ownedHost := func(name string) bool { return opts.OwnedHosts[name] || src.Hosts[name] != nil }
+	ownedGroup := func(name string) bool { return opts.OwnedGroups[name] || src.Groups[name] != nil }
+
+	for name, g := range src.Groups {
+		tg := target.Group(name)
+		if opts.OverwriteVars {
+			tg.Vars = g.Vars
+		} else {
+			mergeVars(tg.Vars, g.Vars)
+		}
+		if opts.Overwrite {
+			tg.Hosts = keep(tg.Hosts, func(h string) bool { return !ownedHost(h) })
+			tg.Children = keep(tg.Children, func(c string) bool { return !ownedGroup(c) })
+		}
+		for _, h := range g.Hosts {
+			tg.AddHost(h)
+		}
+		for _, c := range g.Children {
+			tg.AddChild(c)
+		}
+	}
+
+	if opts.Overwrite {
+		for name := range opts.OwnedHosts {
+			if src.Hosts[name] == nil {
+				target.removeHost(name)
+			}
+		}
+		for name := range opts.OwnedGroups {
+			if src.Groups[name] == nil {
+				target.removeGroup(name)
+			}
+		}
+	}
+
+	if err := target.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return target, diff(cur, target), nil
+}
+
+func (inv *Inventory) removeHost(name string) {
+	delete(inv.Hosts, name)
+	for _, g := range inv.Groups {
+		g.Hosts = keep(g.Hosts, func(h string) bool { return h != name })
+	}
+}
+
+func (inv *Inventory) removeGroup(name string) {
+	delete(inv.Groups, name)
+	for _, g := range inv.Groups {
+		g.Children = keep(g.Children, func(c string) bool { return c != name })
+	}
+}
+
+func keep(names []string, ok func(string) bool) []string {
+	out := names[:0]
+	for _, n := range names {
+		if ok(n) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
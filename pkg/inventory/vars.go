@@ -0,0 +1,87 @@
+package inventory
+
+import "sort"
+
+// HostGroups returns the groups containing host, directly or through a child
+// group, in the order Ansible applies their variables: by depth below "all",
+// then by name.
+func (inv *Inventory) HostGroups(host string) []string {
+	parents := map[string][]string{}
+	for _, g := range inv.Groups {
+		for _, c := range g.Children {
+			parents[c] = append(parents[c], g.Name)
+		}
+	}
+
+	// Ansible's group depth is the longest path from "all"
+	depths := map[string]int{}
+	var depth func(name string) int
+	depth = func(name string) int {
+		if d, ok := depths[name]; ok {
+			return d
+		}
+		d := 1
+		for _, p := range parents[name] {
+			if pd := depth(p) + 1; pd > d {
+				d = pd
+			}
+		}
+		depths[name] = d
+		return d
+	}
+
+	member := map[string]bool{}
+	var addWithAncestors func(name string)
+	addWithAncestors = func(name string) {
+		if member[name] {
+			return
+		}
+		member[name] = true
+		for _, p := range parents[name] {
+			addWithAncestors(p)
+		}
+	}
+	for _, g := range inv.Groups {
+		if g.Name == "all" {
+			continue
+		}
+		for _, h := range g.Hosts {
+			if h == host {
+				addWithAncestors(g.Name)
+				break
+			}
+		}
+	}
+
+	groups := make([]string, 0, len(member))
+	for name := range member {
+		groups = append(groups, name)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		di, dj := depth(groups[i]), depth(groups[j])
+		if di != dj {
+			return di < dj
+		}
+		return groups[i] < groups[j]
+	})
+	return groups
+}
+
+// HostVars returns the variables Ansible resolves for host from the
+// inventory: "all" vars, overridden by the vars of each of its groups in
+// HostGroups order, overridden by the host's own vars. Variables are merged
+// key by key; dictionaries are replaced, not combined. The inventory must be
+// valid.
+func (inv *Inventory) HostVars(host string) map[string]interface{} {
+	vars := copyVars(inv.Vars)
+	if g, ok := inv.Groups["all"]; ok {
+		mergeVars(vars, g.Vars)
+	}
+	for _, name := range inv.HostGroups(host) {
+		mergeVars(vars, inv.Groups[name].Vars)
+	}
+	if h, ok := inv.Hosts[host]; ok {
+		mergeVars(vars, h.Vars)
+	}
+	return vars
+}
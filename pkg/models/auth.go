@@ -3,14 +3,18 @@ package models
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Organization struct {
-	ID          int64     `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	Description *string   `json:"description,omitempty" db:"description"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	ModifiedAt  time.Time `json:"modified_at" db:"modified_at"`
+	ID                    int64          `json:"id" db:"id"`
+	Name                  string         `json:"name" db:"name"`
+	Description           *string        `json:"description,omitempty" db:"description"`
+	SensitiveVariableKeys pq.StringArray `json:"sensitive_variable_keys" db:"sensitive_variable_keys"` // Nil for the default policy
+	DefaultEnvironmentID  *int64         `json:"default_environment_id,omitempty" db:"default_environment_id"`
+	CreatedAt             time.Time      `json:"created_at" db:"created_at"`
+	ModifiedAt            time.Time      `json:"modified_at" db:"modified_at"`
 }
 
 type User struct {
@@ -7,9 +7,26 @@ import (
 	"github.com/google/uuid"
 )
 
+// Unified job kinds. For project updates UnifiedJobTemplateID is the project
+// ID, for inventory updates the inventory source ID.
+const (
+	UnifiedJobKindJob             = "job"
+	UnifiedJobKindProjectUpdate   = "project_update"
+	UnifiedJobKindInventoryUpdate = "inventory_update"
+)
+
+// UnifiedJobTemplateTables maps unified job kinds to the table their
+// unified_job_template_id refers to.
+var UnifiedJobTemplateTables = map[string]string{
+	UnifiedJobKindJob:             "job_templates",
+	UnifiedJobKindProjectUpdate:   "projects",
+	UnifiedJobKindInventoryUpdate: "inventory_sources",
+}
+
 type UnifiedJob struct {
 	ID                   int64           `json:"id" db:"id"`
 	UnifiedJobTemplateID *int64          `json:"unified_job_template_id,omitempty" db:"unified_job_template_id"`
+	Kind                 string          `json:"kind" db:"kind"`
 	Name                 string          `json:"name" db:"name"`
 	Status               string          `json:"status" db:"status"`
 	CurrentRunID         *uuid.UUID      `json:"current_run_id,omitempty" db:"current_run_id"`
@@ -20,6 +37,36 @@ type UnifiedJob struct {
 	JobArgs              json.RawMessage `json:"job_args,omitempty" db:"job_args"`
 }
 
+// Schedule launches a unified job of Kind for UnifiedJobTemplateID every
+// IntervalSeconds.
+type Schedule struct {
+	ID                   int64      `json:"id" db:"id"`
+	Name                 string     `json:"name" db:"name"`
+	Kind                 string     `json:"kind" db:"kind"`
+	UnifiedJobTemplateID int64      `json:"unified_job_template_id" db:"unified_job_template_id"`
+	IntervalSeconds      int        `json:"interval_seconds" db:"interval_seconds"`
+	Enabled              bool       `json:"enabled" db:"enabled"`
+	NextRunAt            time.Time  `json:"next_run_at" db:"next_run_at"`
+	LastRunAt            *time.Time `json:"last_run_at,omitempty" db:"last_run_at"`
+	LastJobID            *int64     `json:"last_job_id,omitempty" db:"last_job_id"`
+	CreatedAt            time.Time  `json:"created_at" db:"created_at"`
+	ModifiedAt           time.Time  `json:"modified_at" db:"modified_at"`
+}
+
+// BulkOperation tracks a bulk request run in the background. Errors lists
+// per-item validation failures, in which case nothing was applied.
+type BulkOperation struct {
+	ID         int64           `json:"id" db:"id"`
+	Kind       string          `json:"kind" db:"kind"`
+	Status     string          `json:"status" db:"status"`
+	ItemCount  int             `json:"item_count" db:"item_count"`
+	Result     json.RawMessage `json:"result,omitempty" db:"result"`
+	Errors     json.RawMessage `json:"errors,omitempty" db:"errors"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty" db:"finished_at"`
+}
+
 type ExecutionRun struct {
 	ID                 uuid.UUID  `json:"id" db:"id"`
 	UnifiedJobID       int64      `json:"unified_job_id" db:"unified_job_id"`
@@ -60,6 +107,19 @@ type JobHostSummary struct {
 	LastEventAt  *time.Time `json:"last_event_at,omitempty" db:"last_event_at"`
 }
 
+// JobArtifacts is what the last run of a unified job left in its
+// ansible-runner artifacts directory. Archive is the object store key of the
+// directory's tarball, if the executor uploaded one.
+type JobArtifacts struct {
+	UnifiedJobID   int64           `json:"unified_job_id" db:"unified_job_id"`
+	ExecutionRunID uuid.UUID       `json:"execution_run_id" db:"execution_run_id"`
+	ArtifactData   json.RawMessage `json:"artifact_data" db:"artifact_data"`
+	RC             *int            `json:"rc,omitempty" db:"rc"`
+	Status         string          `json:"status" db:"status"`
+	Archive        *string         `json:"archive,omitempty" db:"archive"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+}
+
 type JobOutputChunk struct {
 	ID             int64     `json:"id" db:"id"`
 	ExecutionRunID uuid.UUID `json:"execution_run_id" db:"execution_run_id"`
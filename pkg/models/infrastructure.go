@@ -1,14 +1,30 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
+// Execution backends instance groups run their jobs on. Container groups
+// always use the Kubernetes backend.
+const (
+	BackendProcess    = "process"
+	BackendDocker     = "docker"
+	BackendPodman     = "podman"
+	BackendKubernetes = "kubernetes"
+)
+
+// InstanceGroup is a set of capacity jobs can be sent to. Jobs of container
+// groups run as Kubernetes pods built from the group's pod spec override.
 type InstanceGroup struct {
-	ID         int64     `json:"id" db:"id"`
-	Name       string    `json:"name" db:"name"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	ModifiedAt time.Time `json:"modified_at" db:"modified_at"`
+	ID               int64           `json:"id" db:"id"`
+	Name             string          `json:"name" db:"name"`
+	Backend          string          `json:"backend" db:"backend"` // Empty for the executor's default
+	IsContainerGroup bool            `json:"is_container_group" db:"is_container_group"`
+	PodSpecOverride  json.RawMessage `json:"pod_spec_override,omitempty" db:"pod_spec_override"` // Partial corev1.PodSpec
+	ResourceClasses  json.RawMessage `json:"resource_classes" db:"resource_classes"`             // Class name to corev1.ResourceRequirements
+	CreatedAt        time.Time       `json:"created_at" db:"created_at"`
+	ModifiedAt       time.Time       `json:"modified_at" db:"modified_at"`
 }
 
 type Instance struct {
@@ -5,48 +5,122 @@ import (
 	"time"
 )
 
+// Project source control types
+const (
+	SCMTypeGit     = "git"
+	SCMTypeArchive = "archive"
+	SCMTypeManual  = "manual"
+)
+
+// Built-in credential types
+const (
+	CredentialTypeSourceControl = "Source Control"
+	CredentialTypeGalaxy        = "Ansible Galaxy/Automation Hub API Token"
+	CredentialTypeRegistry      = "Container Registry"
+)
+
 type Project struct {
-	ID             int64     `json:"id" db:"id"`
-	OrganizationID int64     `json:"organization_id" db:"organization_id"`
-	Name           string    `json:"name" db:"name"`
-	Description    *string   `json:"description,omitempty" db:"description"`
-	SCMType        string    `json:"scm_type" db:"scm_type"`
-	SCMURL         string    `json:"scm_url" db:"scm_url"`
-	SCMBranch      *string   `json:"scm_branch,omitempty" db:"scm_branch"`
-	CreatedAt      time.Time `json:"created_at" db:"created_at"`
-	ModifiedAt     time.Time `json:"modified_at" db:"modified_at"`
+	ID                   int64           `json:"id" db:"id"`
+	OrganizationID       int64           `json:"organization_id" db:"organization_id"`
+	Name                 string          `json:"name" db:"name"`
+	Description          *string         `json:"description,omitempty" db:"description"`
+	SCMType              string          `json:"scm_type" db:"scm_type"`
+	SCMURL               string          `json:"scm_url" db:"scm_url"`
+	SCMBranch            *string         `json:"scm_branch,omitempty" db:"scm_branch"`
+	SCMSubmodules        bool            `json:"scm_submodules" db:"scm_submodules"`
+	SCMLFS               bool            `json:"scm_lfs" db:"scm_lfs"`
+	SCMChecksum          *string         `json:"scm_checksum,omitempty" db:"scm_checksum"`
+	CredentialID         *int64          `json:"credential_id,omitempty" db:"credential_id"`
+	SCMRevision          *string         `json:"scm_revision,omitempty" db:"scm_revision"`
+	LastSyncedAt         *time.Time      `json:"last_synced_at,omitempty" db:"last_synced_at"`
+	LastUpdateJobID      *int64          `json:"last_update_job_id,omitempty" db:"last_update_job_id"`
+	DefaultEnvironmentID *int64          `json:"default_environment_id,omitempty" db:"default_environment_id"`
+	Playbooks            json.RawMessage `json:"-" db:"playbooks"` // Detected at scm_revision; see GET /projects/{id}/playbooks
+	CreatedAt            time.Time       `json:"created_at" db:"created_at"`
+	ModifiedAt           time.Time       `json:"modified_at" db:"modified_at"`
 }
 
+// Inventory kinds
+const (
+	InventoryKindStatic      = "static"
+	InventoryKindSmart       = "smart"       // Hosts matching HostFilter across the organization
+	InventoryKindConstructed = "constructed" // Hosts of the input inventories, grouped by ConstructedRules
+)
+
 type Inventory struct {
-	ID             int64     `json:"id" db:"id"`
-	OrganizationID int64     `json:"organization_id" db:"organization_id"`
-	Name           string    `json:"name" db:"name"`
-	Description    *string   `json:"description,omitempty" db:"description"`
-	Kind           string    `json:"kind" db:"kind"`
-	Content        *string   `json:"content,omitempty" db:"content"`
-	CreatedAt      time.Time `json:"created_at" db:"created_at"`
-	ModifiedAt     time.Time `json:"modified_at" db:"modified_at"`
+	ID               int64           `json:"id" db:"id"`
+	OrganizationID   int64           `json:"organization_id" db:"organization_id"`
+	Name             string          `json:"name" db:"name"`
+	Description      *string         `json:"description,omitempty" db:"description"`
+	Kind             string          `json:"kind" db:"kind"`
+	Content          *string         `json:"content,omitempty" db:"content"`
+	Variables        json.RawMessage `json:"variables,omitempty" db:"variables"`
+	HostFilter       *string         `json:"host_filter,omitempty" db:"host_filter"`             // Smart inventories only
+	ConstructedRules json.RawMessage `json:"constructed_rules,omitempty" db:"constructed_rules"` // Constructed inventories only
+	CreatedAt        time.Time       `json:"created_at" db:"created_at"`
+	ModifiedAt       time.Time       `json:"modified_at" db:"modified_at"`
 }
 
 type Host struct {
-	ID          int64           `json:"id" db:"id"`
-	InventoryID int64           `json:"inventory_id" db:"inventory_id"`
-	Name        string          `json:"name" db:"name"`
-	Description *string         `json:"description,omitempty" db:"description"`
-	Variables   json.RawMessage `json:"variables,omitempty" db:"variables"`
-	Enabled     bool            `json:"enabled" db:"enabled"`
-	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
-	ModifiedAt  time.Time       `json:"modified_at" db:"modified_at"`
+	ID                int64           `json:"id" db:"id"`
+	InventoryID       int64           `json:"inventory_id" db:"inventory_id"`
+	Name              string          `json:"name" db:"name"`
+	Description       *string         `json:"description,omitempty" db:"description"`
+	Variables         json.RawMessage `json:"variables,omitempty" db:"variables"`
+	Enabled           bool            `json:"enabled" db:"enabled"`
+	InventorySourceID *int64          `json:"inventory_source_id,omitempty" db:"inventory_source_id"` // Source that reported the host; nil if added by hand
+	LastJobID         *int64          `json:"last_job_id,omitempty" db:"last_job_id"`
+	LastJobSummaryID  *int64          `json:"last_job_host_summary_id,omitempty" db:"last_job_host_summary_id"`
+	HasActiveFailures bool            `json:"has_active_failures" db:"has_active_failures"` // The last job failed or could not reach the host
+	CreatedAt         time.Time       `json:"created_at" db:"created_at"`
+	ModifiedAt        time.Time       `json:"modified_at" db:"modified_at"`
+}
+
+// HostFacts are the Ansible facts last gathered for a host and the job that
+// gathered them.
+type HostFacts struct {
+	HostID       int64           `json:"host_id" db:"host_id"`
+	Facts        json.RawMessage `json:"ansible_facts" db:"facts"`
+	UnifiedJobID *int64          `json:"unified_job_id,omitempty" db:"unified_job_id"`
+	ModifiedAt   time.Time       `json:"modified_at" db:"modified_at"`
+}
+
+// Inventory source types
+const (
+	InventorySourceScript = "script"
+	InventorySourceSCM    = "scm"
+	InventorySourcePlugin = "plugin"
+)
+
+// InventorySource feeds hosts and groups into an inventory through inventory
+// updates. Which fields apply depends on Source.
+type InventorySource struct {
+	ID              int64           `json:"id" db:"id"`
+	InventoryID     int64           `json:"inventory_id" db:"inventory_id"`
+	Name            string          `json:"name" db:"name"`
+	Description     *string         `json:"description,omitempty" db:"description"`
+	Source          string          `json:"source" db:"source"`
+	SourceProjectID *int64          `json:"source_project_id,omitempty" db:"source_project_id"` // scm
+	SourcePath      *string         `json:"source_path,omitempty" db:"source_path"`             // scm
+	SourceScript    *string         `json:"source_script,omitempty" db:"source_script"`         // script
+	SourceVars      json.RawMessage `json:"source_vars,omitempty" db:"source_vars"`             // plugin configuration
+	Overwrite       bool            `json:"overwrite" db:"overwrite"`
+	OverwriteVars   bool            `json:"overwrite_vars" db:"overwrite_vars"`
+	LastUpdateJobID *int64          `json:"last_update_job_id,omitempty" db:"last_update_job_id"`
+	LastUpdatedAt   *time.Time      `json:"last_updated_at,omitempty" db:"last_updated_at"`
+	CreatedAt       time.Time       `json:"created_at" db:"created_at"`
+	ModifiedAt      time.Time       `json:"modified_at" db:"modified_at"`
 }
 
 type Group struct {
-	ID          int64           `json:"id" db:"id"`
-	InventoryID int64           `json:"inventory_id" db:"inventory_id"`
-	Name        string          `json:"name" db:"name"`
-	Description *string         `json:"description,omitempty" db:"description"`
-	Variables   json.RawMessage `json:"variables,omitempty" db:"variables"`
-	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
-	ModifiedAt  time.Time       `json:"modified_at" db:"modified_at"`
+	ID                int64           `json:"id" db:"id"`
+	InventoryID       int64           `json:"inventory_id" db:"inventory_id"`
+	Name              string          `json:"name" db:"name"`
+	Description       *string         `json:"description,omitempty" db:"description"`
+	Variables         json.RawMessage `json:"variables,omitempty" db:"variables"`
+	InventorySourceID *int64          `json:"inventory_source_id,omitempty" db:"inventory_source_id"`
+	CreatedAt         time.Time       `json:"created_at" db:"created_at"`
+	ModifiedAt        time.Time       `json:"modified_at" db:"modified_at"`
 }
 
 type CredentialType struct {
@@ -70,12 +144,23 @@ type Credential struct {
 	ModifiedAt       time.Time       `json:"modified_at" db:"modified_at"`
 }
 
+// Execution environment pull policies. An empty policy leaves it to the
+// execution backend.
+const (
+	PullAlways  = "always"
+	PullMissing = "missing"
+	PullNever   = "never"
+)
+
 type ExecutionEnvironment struct {
 	ID             int64     `json:"id" db:"id"`
-	OrganizationID *int64    `json:"organization_id,omitempty" db:"organization_id"`
+	OrganizationID *int64    `json:"organization_id,omitempty" db:"organization_id"` // Nil for global environments
 	Name           string    `json:"name" db:"name"`
 	Image          string    `json:"image" db:"image"`
 	Description    *string   `json:"description,omitempty" db:"description"`
+	CredentialID   *int64    `json:"credential_id,omitempty" db:"credential_id"` // Container Registry credential to pull the image with
+	Pull           string    `json:"pull" db:"pull"`
+	IsDefault      bool      `json:"is_default" db:"is_default"` // The global default; global environments only
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 	ModifiedAt     time.Time `json:"modified_at" db:"modified_at"`
 }
@@ -94,6 +179,9 @@ type JobTemplate struct {
 	JobType                string          `json:"job_type" db:"job_type"`
 	Verbosity              int             `json:"verbosity" db:"verbosity"`
 	ExtraVars              json.RawMessage `json:"extra_vars,omitempty" db:"extra_vars"`
+	UseFactCache           bool            `json:"use_fact_cache" db:"use_fact_cache"` // Seed runs with the hosts' stored facts
+	InstanceGroupID        *int64          `json:"instance_group_id,omitempty" db:"instance_group_id"`
+	ResourceClass          *string         `json:"resource_class,omitempty" db:"resource_class"` // One of the container group's resource classes
 	CreatedAt              time.Time       `json:"created_at" db:"created_at"`
 	ModifiedAt             time.Time       `json:"modified_at" db:"modified_at"`
 }
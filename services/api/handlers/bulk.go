@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/praetordev/praetor/pkg/inventory"
+	"github.com/praetordev/praetor/pkg/models"
+	"github.com/praetordev/praetor/services/api/render"
+)
+
+// Limits on bulk requests. Requests above bulkMaxItems must be made async,
+// which runs them in the background and reports through a bulk operation.
+const (
+	bulkMaxItems      = 1000
+	bulkMaxAsyncItems = 100000
+	bulkMaxBodyBytes  = 64 << 20
+)
+
+// Bulk operation kinds and statuses
+const (
+	BulkHostCreate            = "host_create"
+	BulkHostDelete            = "host_delete"
+	BulkGroupMembershipAdd    = "group_membership_add"
+	BulkGroupMembershipRemove = "group_membership_remove"
+
+	BulkStatusPending    = "pending"
+	BulkStatusRunning    = "running"
+	BulkStatusSuccessful = "successful"
+	BulkStatusFailed     = "failed"
+)
+
+// bulkItemError reports why the item at Index of a bulk request is invalid.
+type bulkItemError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// bulkOp applies a bulk request within tx. If any item is invalid it returns
+// the item errors and the transaction is rolled back.
+type bulkOp func(ctx context.Context, tx *sqlx.Tx) (interface{}, []bulkItemError, error)
+
+// BulkResource applies host and group membership changes in bulk. Each
+// request is applied in one transaction: either every item is applied or,
+// if any is invalid, none is.
+type BulkResource struct {
+	DB *sqlx.DB
+}
+
+// NewBulkResource creates a new bulk resource handler
+func NewBulkResource(db *sqlx.DB) *BulkResource {
+	return &BulkResource{DB: db}
+}
+
+// Routes creates a REST router for bulk operations
+func (rs *BulkResource) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/host_create", rs.HostCreate)
+	r.Post("/host_delete", rs.HostDelete)
+	r.Post("/group_membership_add", rs.GroupMembershipAdd)
+	r.Post("/group_membership_remove", rs.GroupMembershipRemove)
+	r.Get("/operations/{id}", rs.GetOperation)
+	return r
+}
+
+type bulkHost struct {
+	Name        string          `json:"name"`
+	Description *string         `json:"description"`
+	Variables   json.RawMessage `json:"variables"`
+	Enabled     *bool           `json:"enabled"`
+}
+
+type bulkMembership struct {
+	GroupID int64 `json:"group_id"`
+	HostID  int64 `json:"host_id"`
+}
+
+// HostCreate POST /api/v1/bulk/host_create
+// Adds hosts to a static inventory.
+func (rs *BulkResource) HostCreate(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		InventoryID int64      `json:"inventory_id"`
+		Hosts       []bulkHost `json:"hosts"`
+		Async       bool       `json:"async"`
+	}
+	if err := decodeBulk(w, r, &input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var kind string
+	if err := rs.DB.GetContext(r.Context(), &kind, "SELECT kind FROM inventories WHERE id = $1", input.InventoryID); err != nil {
+		render.ErrInvalidRequest(fmt.Errorf("inventory %d does not exist", input.InventoryID)).Render(w, r)
+		return
+	}
+	if kind != models.InventoryKindStatic {
+		render.ErrInvalidRequest(fmt.Errorf("%s inventories do not hold their own hosts", kind)).Render(w, r)
+		return
+	}
+
+	op := func(ctx context.Context, tx *sqlx.Tx) (interface{}, []bulkItemError, error) {
+		// Lock the inventory so concurrent imports and edits apply in order
+		if err := tx.GetContext(ctx, &kind, "SELECT kind FROM inventories WHERE id = $1 FOR UPDATE", input.InventoryID); err != nil {
+			return nil, nil, err
+		}
+		if kind != models.InventoryKindStatic {
+			return nil, nil, fmt.Errorf("inventory %d became a %s inventory", input.InventoryID, kind)
+		}
+
+		names := make([]string, len(input.Hosts))
+		for i, h := range input.Hosts {
+			names[i] = strings.TrimSpace(h.Name)
+		}
+		var existing []string
+		if err := tx.SelectContext(ctx, &existing, "SELECT name FROM hosts WHERE inventory_id = $1 AND name = ANY($2)", input.InventoryID, pq.Array(names)); err != nil {
+			return nil, nil, err
+		}
+		taken := map[string]bool{}
+		for _, name := range existing {
+			taken[name] = true
+		}
+
+		var itemErrs []bulkItemError
+		seen := map[string]int{}
+		for i, h := range input.Hosts {
+			name := names[i]
+			switch {
+			case name == "":
+				itemErrs = append(itemErrs, bulkItemError{i, "name is required"})
+			case taken[name]:
+				itemErrs = append(itemErrs, bulkItemError{i, fmt.Sprintf("host %q already exists in the inventory", name)})
+			default:
+				if first, ok := seen[name]; ok {
+					itemErrs = append(itemErrs, bulkItemError{i, fmt.Sprintf("host %q is also listed at index %d", name, first)})
+				}
+				seen[name] = i
+			}
+			variables, err := inventory.ParseVariables(h.Variables)
+			if err != nil {
+				itemErrs = append(itemErrs, bulkItemError{i, err.Error()})
+			}
+			input.Hosts[i].Variables = variables
+		}
+		if len(itemErrs) > 0 {
+			return nil, itemErrs, nil
+		}
+
+		created := make([]models.Host, 0, len(input.Hosts))
+		for i, h := range input.Hosts {
+			enabled := h.Enabled == nil || *h.Enabled
+			var host models.Host
+			err := tx.QueryRowxContext(ctx, `
+				INSERT INTO hosts (inventory_id, name, description, variables, enabled)
+				VALUES ($1, $2, $3, $4, $5)
+				RETURNING *`,
+				input.InventoryID, names[i], h.Description, h.Variables, enabled,
+			).StructScan(&host)
+			if err != nil {
+				return nil, nil, err
+			}
+			created = append(created, host)
+		}
+		policy, err := variablePolicy(ctx, tx, input.InventoryID)
+		if err != nil {
+			return nil, nil, err
+		}
+		maskHosts(policy, created)
+		return map[string]interface{}{"hosts": created}, nil, nil
+	}
+
+	rs.run(w, r, BulkHostCreate, len(input.Hosts), input.Async, op, render.Created)
+}
+
+// HostDelete POST /api/v1/bulk/host_delete
+// Deletes hosts of static inventories that were not reported by a source.
+func (rs *BulkResource) HostDelete(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		HostIDs []int64 `json:"host_ids"`
+		Async   bool    `json:"async"`
+	}
+	if err := decodeBulk(w, r, &input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	op := func(ctx context.Context, tx *sqlx.Tx) (interface{}, []bulkItemError, error) {
+		var owners []hostOwner
+		if err := tx.SelectContext(ctx, &owners, hostOwnerQuery+" WHERE h.id = ANY($1) FOR UPDATE OF h", pq.Array(input.HostIDs)); err != nil {
+			return nil, nil, err
+		}
+		byID := map[int64]hostOwner{}
+		for _, o := range owners {
+			byID[o.ID] = o
+		}
+
+		var itemErrs []bulkItemError
+		seen := map[int64]int{}
+		for i, id := range input.HostIDs {
+			owner, ok := byID[id]
+			if !ok {
+				itemErrs = append(itemErrs, bulkItemError{i, fmt.Sprintf("host %d does not exist", id)})
+				continue
+			}
+			if err := owner.checkDelete(); err != nil {
+				itemErrs = append(itemErrs, bulkItemError{i, err.Error()})
+				continue
+			}
+			if first, ok := seen[id]; ok {
+				itemErrs = append(itemErrs, bulkItemError{i, fmt.Sprintf("host %d is also listed at index %d", id, first)})
+			}
+			seen[id] = i
+		}
+		if len(itemErrs) > 0 {
+			return nil, itemErrs, nil
+		}
+
+		res, err := tx.ExecContext(ctx, "DELETE FROM hosts WHERE id = ANY($1)", pq.Array(input.HostIDs))
+		if err != nil {
+			return nil, nil, err
+		}
+		deleted, _ := res.RowsAffected()
+		return map[string]int64{"deleted": deleted}, nil, nil
+	}
+
+	rs.run(w, r, BulkHostDelete, len(input.HostIDs), input.Async, op, render.JSON)
+}
+
+// GroupMembershipAdd POST /api/v1/bulk/group_membership_add
+// Adds hosts to groups of the same inventory. Existing memberships are left
+// as they are and not counted as added.
+func (rs *BulkResource) GroupMembershipAdd(w http.ResponseWriter, r *http.Request) {
+	rs.changeMemberships(w, r, BulkGroupMembershipAdd, "added",
+		`INSERT INTO host_group_mapping (host_id, group_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`)
+}
+
+// GroupMembershipRemove POST /api/v1/bulk/group_membership_remove
+// Removes hosts from groups. Missing memberships are not counted as removed.
+func (rs *BulkResource) GroupMembershipRemove(w http.ResponseWriter, r *http.Request) {
+	rs.changeMemberships(w, r, BulkGroupMembershipRemove, "removed",
+		`DELETE FROM host_group_mapping WHERE host_id = $1 AND group_id = $2`)
+}
+
+// changeMemberships runs query with the host and group ID of each membership
+// in the request, reporting the number of rows changed under counter.
+func (rs *BulkResource) changeMemberships(w http.ResponseWriter, r *http.Request, kind, counter, query string) {
+	var input struct {
+		Memberships []bulkMembership `json:"memberships"`
+		Async       bool             `json:"async"`
+	}
+	if err := decodeBulk(w, r, &input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	op := func(ctx context.Context, tx *sqlx.Tx) (interface{}, []bulkItemError, error) {
+		groupIDs := make([]int64, len(input.Memberships))
+		hostIDs := make([]int64, len(input.Memberships))
+		for i, m := range input.Memberships {
+			groupIDs[i], hostIDs[i] = m.GroupID, m.HostID
+		}
+		groups, err := inventoryOf(ctx, tx, "groups", groupIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		hosts, err := inventoryOf(ctx, tx, "hosts", hostIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var itemErrs []bulkItemError
+		seen := map[bulkMembership]int{}
+		for i, m := range input.Memberships {
+			groupInv, groupOK := groups[m.GroupID]
+			hostInv, hostOK := hosts[m.HostID]
+			switch {
+			case !groupOK:
+				itemErrs = append(itemErrs, bulkItemError{i, fmt.Sprintf("group %d does not exist", m.GroupID)})
+			case !hostOK:
+				itemErrs = append(itemErrs, bulkItemError{i, fmt.Sprintf("host %d does not exist", m.HostID)})
+			case groupInv != hostInv:
+				itemErrs = append(itemErrs, bulkItemError{i, fmt.Sprintf("host %d and group %d belong to different inventories", m.HostID, m.GroupID)})
+			default:
+				if first, ok := seen[m]; ok {
+					itemErrs = append(itemErrs, bulkItemError{i, fmt.Sprintf("membership is also listed at index %d", first)})
+				}
+				seen[m] = i
+			}
+		}
+		if len(itemErrs) > 0 {
+			return nil, itemErrs, nil
+		}
+
+		var changed int64
+		for _, m := range input.Memberships {
+			res, err := tx.ExecContext(ctx, query, m.HostID, m.GroupID)
+			if err != nil {
+				return nil, nil, err
+			}
+			n, _ := res.RowsAffected()
+			changed += n
+		}
+		return map[string]int64{counter: changed}, nil, nil
+	}
+
+	rs.run(w, r, kind, len(input.Memberships), input.Async, op, render.JSON)
+}
+
+// GetOperation GET /api/v1/bulk/operations/{id}
+func (rs *BulkResource) GetOperation(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var op models.BulkOperation
+	if err := rs.DB.GetContext(r.Context(), &op, "SELECT * FROM bulk_operations WHERE id = $1", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, op)
+}
+
+// run checks the size of a bulk request of count items and applies it. A
+// synchronous request responds with its result through respond; an async one
+// is recorded as a bulk operation and applied in the background.
+func (rs *BulkResource) run(w http.ResponseWriter, r *http.Request, kind string, count int, async bool, op bulkOp, respond func(http.ResponseWriter, *http.Request, interface{})) {
+	limit := bulkMaxItems
+	if async {
+		limit = bulkMaxAsyncItems
+	}
+	switch {
+	case count == 0:
+		render.ErrInvalidRequest(fmt.Errorf("no items given")).Render(w, r)
+		return
+	case count > limit && !async:
+		render.ErrInvalidRequest(fmt.Errorf("%d items exceed the limit of %d; set async to apply up to %d in the background", count, limit, bulkMaxAsyncItems)).Render(w, r)
+		return
+	case count > limit:
+		render.ErrInvalidRequest(fmt.Errorf("%d items exceed the limit of %d", count, limit)).Render(w, r)
+		return
+	}
+
+	if async {
+		queued, conn, err := rs.queue(r.Context(), kind, count)
+		if err != nil {
+			render.ErrInternal(err).Render(w, r)
+			return
+		}
+		go rs.runAsync(conn, queued.ID, op)
+		render.Accepted(w, r, queued)
+		return
+	}
+
+	result, itemErrs, err := rs.apply(r.Context(), op)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if len(itemErrs) > 0 {
+		render.ErrInvalidItems(fmt.Errorf("%d of %d items are invalid; nothing was applied", len(itemErrs), count), itemErrs).Render(w, r)
+		return
+	}
+	respond(w, r, result)
+}
+
+// apply runs op in a transaction, committing only if every item was valid.
+func (rs *BulkResource) apply(ctx context.Context, op bulkOp) (interface{}, []bulkItemError, error) {
+	tx, err := rs.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	result, itemErrs, err := op(ctx, tx)
+	if err != nil || len(itemErrs) > 0 {
+		return nil, itemErrs, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return result, nil, nil
+}
+
+// queue records a pending bulk operation. The returned connection holds the
+// operation's advisory lock, taken before the operation is visible, which
+// tells FailInterrupted the operation is still being applied.
+func (rs *BulkResource) queue(ctx context.Context, kind string, count int) (*models.BulkOperation, *sqlx.Conn, error) {
+	conn, err := rs.DB.Connx(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var queued models.BulkOperation
+	err = tx.QueryRowxContext(ctx, `
+		INSERT INTO bulk_operations (kind, status, item_count)
+		VALUES ($1, $2, $3)
+		RETURNING *`, kind, BulkStatusPending, count,
+	).StructScan(&queued)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, "SELECT pg_advisory_lock($1)", queued.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return &queued, conn, nil
+}
+
+// FailInterrupted marks the pending and running bulk operations that no API
+// instance is applying anymore, having been stopped or restarted, as failed.
+func (rs *BulkResource) FailInterrupted(ctx context.Context) (int64, error) {
+	errs := marshalJSON([]bulkItemError{{Index: -1, Error: "interrupted by an API restart; nothing was applied"}})
+	res, err := rs.DB.ExecContext(ctx, `
+		UPDATE bulk_operations SET status = $1, errors = $2, finished_at = $3
+		WHERE status IN ($4, $5) AND pg_try_advisory_xact_lock(id)`,
+		BulkStatusFailed, errs, time.Now(), BulkStatusPending, BulkStatusRunning)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// runAsync applies a queued bulk operation and records its outcome, then
+// releases the operation's lock held by conn. It does not use the request
+// context, which ends once the request is answered.
+func (rs *BulkResource) runAsync(conn *sqlx.Conn, id int64, op bulkOp) {
+	ctx := context.Background()
+	defer func() {
+		// Returning conn to the pool would keep the session lock
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", id); err != nil {
+			log.Printf("Failed to unlock bulk operation %d: %v", id, err)
+		}
+		conn.Close()
+	}()
+	if _, err := rs.DB.ExecContext(ctx, "UPDATE bulk_operations SET status = $2, started_at = $3 WHERE id = $1", id, BulkStatusRunning, time.Now()); err != nil {
+		log.Printf("Failed to start bulk operation %d: %v", id, err)
+	}
+
+	status := BulkStatusSuccessful
+	var result, errs interface{}
+	res, itemErrs, err := rs.apply(ctx, op)
+	switch {
+	case err != nil:
+		log.Printf("Bulk operation %d failed: %v", id, err)
+		status = BulkStatusFailed
+		errs = marshalJSON([]bulkItemError{{Index: -1, Error: err.Error()}})
+	case len(itemErrs) > 0:
+		status = BulkStatusFailed
+		errs = marshalJSON(itemErrs)
+	default:
+		result = marshalJSON(res)
+	}
+
+	_, err = rs.DB.ExecContext(ctx, `
+		UPDATE bulk_operations SET status = $2, result = $3, errors = $4, finished_at = $5
+		WHERE id = $1`, id, status, result, errs, time.Now())
+	if err != nil {
+		log.Printf("Failed to record outcome of bulk operation %d: %v", id, err)
+	}
+}
+
+// inventoryOf maps each of ids that exists in table (hosts or groups) to its
+// inventory, locking the rows for the rest of tx.
+func inventoryOf(ctx context.Context, tx *sqlx.Tx, table string, ids []int64) (map[int64]int64, error) {
+	var rows []struct {
+		ID          int64 `db:"id"`
+		InventoryID int64 `db:"inventory_id"`
+	}
+	query := fmt.Sprintf("SELECT id, inventory_id FROM %s WHERE id = ANY($1) FOR SHARE", table)
+	if err := tx.SelectContext(ctx, &rows, query, pq.Array(ids)); err != nil {
+		return nil, err
+	}
+	out := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		out[row.ID] = row.InventoryID
+	}
+	return out, nil
+}
+
+// decodeBulk decodes a bulk request body of at most bulkMaxBodyBytes.
+func decodeBulk(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, bulkMaxBodyBytes)
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+// marshalJSON encodes v for a JSONB column.
+func marshalJSON(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/models"
+	"github.com/praetordev/praetor/services/api/render"
+)
+
+// secretPlaceholder replaces secret credential inputs in API responses.
+const secretPlaceholder = "$encrypted$"
+
+// CredentialsResource handles credential operations
+type CredentialsResource struct {
+	DB *sqlx.DB
+}
+
+// NewCredentialsResource creates a new credentials resource handler
+func NewCredentialsResource(db *sqlx.DB) *CredentialsResource {
+	return &CredentialsResource{DB: db}
+}
+
+// Routes creates a REST router for the Credentials resource
+func (rs *CredentialsResource) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", rs.ListCredentials)
+	r.Post("/", rs.CreateCredential)
+	r.Get("/{id}", rs.GetCredential)
+	r.Delete("/{id}", rs.DeleteCredential)
+	return r
+}
+
+// credentialTypeFields is the "fields" list of a credential type's inputs schema.
+type credentialTypeFields struct {
+	Fields []struct {
+		ID     string `json:"id"`
+		Secret bool   `json:"secret"`
+	} `json:"fields"`
+}
+
+// ListCredentialTypes GET /api/v1/credential-types
+func (rs *CredentialsResource) ListCredentialTypes(w http.ResponseWriter, r *http.Request) {
+	var types []models.CredentialType
+	if err := rs.DB.SelectContext(r.Context(), &types, "SELECT * FROM credential_types ORDER BY id"); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if types == nil {
+		types = []models.CredentialType{}
+	}
+	render.JSON(w, r, &render.PaginatedResponse{
+		Items: types,
+		Total: int64(len(types)),
+		Limit: len(types),
+	})
+}
+
+// ListCredentials GET /api/v1/credentials
+func (rs *CredentialsResource) ListCredentials(w http.ResponseWriter, r *http.Request) {
+	pg := render.ParsePagination(r)
+
+	var creds []models.Credential
+	query := `SELECT * FROM credentials ORDER BY id LIMIT $1 OFFSET $2`
+	if err := rs.DB.SelectContext(r.Context(), &creds, query, pg.Limit, pg.Offset); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	var total int64
+	_ = rs.DB.Get(&total, "SELECT count(*) FROM credentials")
+
+	if creds == nil {
+		creds = []models.Credential{}
+	}
+	for i := range creds {
+		if err := rs.maskSecrets(r, &creds[i]); err != nil {
+			render.ErrInternal(err).Render(w, r)
+			return
+		}
+	}
+
+	render.JSON(w, r, &render.PaginatedResponse{
+		Items:  creds,
+		Total:  total,
+		Limit:  pg.Limit,
+		Offset: pg.Offset,
+	})
+}
+
+// CreateCredential POST /api/v1/credentials
+func (rs *CredentialsResource) CreateCredential(w http.ResponseWriter, r *http.Request) {
+	var input models.Credential
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	if input.Name == "" || input.CredentialTypeID == 0 {
+		render.ErrInvalidRequest(nil).Render(w, r)
+		return
+	}
+	if input.OrganizationID == 0 {
+		input.OrganizationID = 1
+	}
+	if len(input.Inputs) == 0 {
+		input.Inputs = json.RawMessage(`{}`)
+	}
+
+	fields, err := rs.typeFields(r, input.CredentialTypeID)
+	if err == sql.ErrNoRows {
+		render.ErrInvalidRequest(fmt.Errorf("credential type %d not found", input.CredentialTypeID)).Render(w, r)
+		return
+	}
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	var inputs map[string]interface{}
+	if err := json.Unmarshal(input.Inputs, &inputs); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	for key, value := range inputs {
+		if _, ok := fields[key]; !ok {
+			render.ErrInvalidRequest(fmt.Errorf("unknown input %q for this credential type", key)).Render(w, r)
+			return
+		}
+		if _, ok := value.(string); !ok {
+			render.ErrInvalidRequest(fmt.Errorf("input %q must be a string", key)).Render(w, r)
+			return
+		}
+	}
+
+	query := `
+		INSERT INTO credentials (organization_id, credential_type_id, name, description, inputs)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING *`
+
+	var created models.Credential
+	err = rs.DB.QueryRowxContext(r.Context(), query,
+		input.OrganizationID, input.CredentialTypeID, input.Name, input.Description, input.Inputs,
+	).StructScan(&created)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	if err := rs.maskSecrets(r, &created); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	render.Created(w, r, created)
+}
+
+// GetCredential GET /api/v1/credentials/{id}
+func (rs *CredentialsResource) GetCredential(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var cred models.Credential
+	if err := rs.DB.GetContext(r.Context(), &cred, "SELECT * FROM credentials WHERE id = $1", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	if err := rs.maskSecrets(r, &cred); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	render.JSON(w, r, cred)
+}
+
+// DeleteCredential DELETE /api/v1/credentials/{id}
+func (rs *CredentialsResource) DeleteCredential(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	result, err := rs.DB.ExecContext(r.Context(), "DELETE FROM credentials WHERE id = $1", id)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// typeFields returns the input fields of a credential type, keyed by id, with
+// whether each one is secret.
+func (rs *CredentialsResource) typeFields(r *http.Request, typeID int64) (map[string]bool, error) {
+	var raw json.RawMessage
+	if err := rs.DB.GetContext(r.Context(), &raw, "SELECT inputs FROM credential_types WHERE id = $1", typeID); err != nil {
+		return nil, err
+	}
+	var schema credentialTypeFields
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("invalid inputs schema for credential type %d: %w", typeID, err)
+	}
+	fields := make(map[string]bool, len(schema.Fields))
+	for _, f := range schema.Fields {
+		fields[f.ID] = f.Secret
+	}
+	return fields, nil
+}
+
+// maskSecrets replaces the non-empty secret inputs of cred with a placeholder
+// so secrets are never returned by the API.
+func (rs *CredentialsResource) maskSecrets(r *http.Request, cred *models.Credential) error {
+	fields, err := rs.typeFields(r, cred.CredentialTypeID)
+	if err != nil {
+		return err
+	}
+	var inputs map[string]interface{}
+	if err := json.Unmarshal(cred.Inputs, &inputs); err != nil {
+		return err
+	}
+	for key, value := range inputs {
+		if fields[key] && value != "" {
+			inputs[key] = secretPlaceholder
+		}
+	}
+	masked, err := json.Marshal(inputs)
+	if err != nil {
+		return err
+	}
+	cred.Inputs = masked
+	return nil
+}
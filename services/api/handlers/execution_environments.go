@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/models"
+	"github.com/praetordev/praetor/services/api/render"
+)
+
+// ExecutionEnvironmentsResource handles the container images jobs run in
+type ExecutionEnvironmentsResource struct {
+	DB *sqlx.DB
+}
+
+// NewExecutionEnvironmentsResource creates a new execution environments resource handler
+func NewExecutionEnvironmentsResource(db *sqlx.DB) *ExecutionEnvironmentsResource {
+	return &ExecutionEnvironmentsResource{DB: db}
+}
+
+// Routes creates a REST router for execution environments
+func (rs *ExecutionEnvironmentsResource) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", rs.ListExecutionEnvironments)
+	r.Post("/", rs.CreateExecutionEnvironment)
+	r.Get("/{id}", rs.GetExecutionEnvironment)
+	r.Put("/{id}", rs.UpdateExecutionEnvironment)
+	r.Delete("/{id}", rs.DeleteExecutionEnvironment)
+	return r
+}
+
+// ListExecutionEnvironments GET /api/v1/execution_environments
+// Supports ?organization_id= to list an organization's environments along
+// with the global ones it may use.
+func (rs *ExecutionEnvironmentsResource) ListExecutionEnvironments(w http.ResponseWriter, r *http.Request) {
+	pg := render.ParsePagination(r)
+
+	var orgID *int64
+	if orgIdStr := r.URL.Query().Get("organization_id"); orgIdStr != "" {
+		v, err := strconv.ParseInt(orgIdStr, 10, 64)
+		if err != nil {
+			render.ErrInvalidRequest(err).Render(w, r)
+			return
+		}
+		orgID = &v
+	}
+
+	var envs []models.ExecutionEnvironment
+	query := `
+		SELECT * FROM execution_environments
+		WHERE $1::bigint IS NULL OR organization_id = $1 OR organization_id IS NULL
+		ORDER BY id LIMIT $2 OFFSET $3`
+	if err := rs.DB.SelectContext(r.Context(), &envs, query, orgID, pg.Limit, pg.Offset); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	var total int64
+	_ = rs.DB.Get(&total, `
+		SELECT count(*) FROM execution_environments
+		WHERE $1::bigint IS NULL OR organization_id = $1 OR organization_id IS NULL`, orgID)
+
+	if envs == nil {
+		envs = []models.ExecutionEnvironment{}
+	}
+
+	render.JSON(w, r, &render.PaginatedResponse{
+		Items:  envs,
+		Total:  total,
+		Limit:  pg.Limit,
+		Offset: pg.Offset,
+	})
+}
+
+// decodeExecutionEnvironment reads and validates an execution environment
+// create or update.
+func (rs *ExecutionEnvironmentsResource) decodeExecutionEnvironment(r *http.Request) (*models.ExecutionEnvironment, error) {
+	var input models.ExecutionEnvironment
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, err
+	}
+	if input.Name == "" || input.Image == "" {
+		return nil, fmt.Errorf("name and image are required")
+	}
+	switch input.Pull {
+	case "", models.PullAlways, models.PullMissing, models.PullNever:
+	default:
+		return nil, fmt.Errorf("pull must be %s, %s or %s", models.PullAlways, models.PullMissing, models.PullNever)
+	}
+	if input.IsDefault && input.OrganizationID != nil {
+		return nil, fmt.Errorf("only global execution environments can be the default")
+	}
+
+	if input.OrganizationID != nil {
+		var exists bool
+		if err := rs.DB.GetContext(r.Context(), &exists, "SELECT EXISTS (SELECT 1 FROM organizations WHERE id = $1)", *input.OrganizationID); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("organization %d not found", *input.OrganizationID)
+		}
+	}
+	if input.CredentialID != nil {
+		var typeName string
+		err := rs.DB.GetContext(r.Context(), &typeName, `
+			SELECT ct.name FROM credentials c JOIN credential_types ct ON ct.id = c.credential_type_id
+			WHERE c.id = $1`, *input.CredentialID)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("credential %d not found", *input.CredentialID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if typeName != models.CredentialTypeRegistry {
+			return nil, fmt.Errorf("credential %d is a %s credential, not %s", *input.CredentialID, typeName, models.CredentialTypeRegistry)
+		}
+	}
+	return &input, nil
+}
+
+// CreateExecutionEnvironment POST /api/v1/execution_environments
+// A new global default replaces the previous one.
+func (rs *ExecutionEnvironmentsResource) CreateExecutionEnvironment(w http.ResponseWriter, r *http.Request) {
+	input, err := rs.decodeExecutionEnvironment(r)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	tx, err := rs.DB.BeginTxx(r.Context(), nil)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	if input.IsDefault {
+		if _, err := tx.ExecContext(r.Context(), "UPDATE execution_environments SET is_default = false WHERE is_default"); err != nil {
+			render.ErrInternal(err).Render(w, r)
+			return
+		}
+	}
+
+	query := `
+		INSERT INTO execution_environments (organization_id, name, image, description, credential_id, pull, is_default)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING *`
+
+	var created models.ExecutionEnvironment
+	err = tx.QueryRowxContext(r.Context(), query,
+		input.OrganizationID, input.Name, input.Image, input.Description, input.CredentialID, input.Pull, input.IsDefault,
+	).StructScan(&created)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	render.Created(w, r, created)
+}
+
+// GetExecutionEnvironment GET /api/v1/execution_environments/{id}
+func (rs *ExecutionEnvironmentsResource) GetExecutionEnvironment(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var env models.ExecutionEnvironment
+	if err := rs.DB.GetContext(r.Context(), &env, "SELECT * FROM execution_environments WHERE id = $1", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, env)
+}
+
+// UpdateExecutionEnvironment PUT /api/v1/execution_environments/{id}
+func (rs *ExecutionEnvironmentsResource) UpdateExecutionEnvironment(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	input, err := rs.decodeExecutionEnvironment(r)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	tx, err := rs.DB.BeginTxx(r.Context(), nil)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	if input.IsDefault {
+		if _, err := tx.ExecContext(r.Context(), "UPDATE execution_environments SET is_default = false WHERE is_default AND id <> $1", id); err != nil {
+			render.ErrInternal(err).Render(w, r)
+			return
+		}
+	}
+
+	query := `
+		UPDATE execution_environments
+		SET organization_id = $2, name = $3, image = $4, description = $5, credential_id = $6,
+		    pull = $7, is_default = $8, modified_at = now()
+		WHERE id = $1
+		RETURNING *`
+
+	var updated models.ExecutionEnvironment
+	err = tx.QueryRowxContext(r.Context(), query,
+		id, input.OrganizationID, input.Name, input.Image, input.Description, input.CredentialID, input.Pull, input.IsDefault,
+	).StructScan(&updated)
+	if err == sql.ErrNoRows {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	} else if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, updated)
+}
+
+// DeleteExecutionEnvironment DELETE /api/v1/execution_environments/{id}
+// Templates, projects and organizations using it fall back to the next
+// default.
+func (rs *ExecutionEnvironmentsResource) DeleteExecutionEnvironment(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	if _, err := rs.DB.ExecContext(r.Context(), "DELETE FROM execution_environments WHERE id = $1", id); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkExecutionEnvironment makes sure an execution environment exists and
+// is usable in the organization, i.e. global or the organization's own.
+func checkExecutionEnvironment(ctx context.Context, q sqlx.QueryerContext, id int64, orgID int64) error {
+	var envOrgID sql.NullInt64
+	err := sqlx.GetContext(ctx, q, &envOrgID, "SELECT organization_id FROM execution_environments WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("execution environment %d not found", id)
+	}
+	if err != nil {
+		return err
+	}
+	if envOrgID.Valid && envOrgID.Int64 != orgID {
+		return fmt.Errorf("execution environment %d belongs to another organization", id)
+	}
+	return nil
+}
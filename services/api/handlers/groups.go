@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/inventory"
 	"github.com/praetordev/praetor/pkg/models"
 	"github.com/praetordev/praetor/services/api/render"
 )
@@ -38,6 +40,10 @@ func (rs *GroupsResource) GroupRoutes() chi.Router {
 	r.Post("/{groupId}/hosts", rs.AddHostToGroup)
 	r.Delete("/{groupId}/hosts/{hostId}", rs.RemoveHostFromGroup)
 	r.Get("/{groupId}/hosts", rs.ListGroupHosts)
+	r.Get("/{groupId}/all_hosts", rs.ListAllGroupHosts)
+	r.Get("/{groupId}/children", rs.ListChildGroups)
+	r.Post("/{groupId}/children", rs.AddChildGroup)
+	r.Delete("/{groupId}/children/{childId}", rs.RemoveChildGroup)
 	return r
 }
 
@@ -57,10 +63,16 @@ func (rs *GroupsResource) ListGroups(w http.ResponseWriter, r *http.Request) {
 		render.ErrInternal(err).Render(w, r)
 		return
 	}
+	policy, err := variablePolicy(r.Context(), rs.DB, inventoryId)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
 
 	if groups == nil {
 		groups = []models.Group{}
 	}
+	maskGroups(policy, groups)
 
 	render.JSON(w, r, groups)
 }
@@ -87,8 +99,15 @@ func (rs *GroupsResource) CreateGroup(w http.ResponseWriter, r *http.Request) {
 
 	input.InventoryID = inventoryId
 
-	if input.Variables == nil {
-		input.Variables = json.RawMessage("{}")
+	input.Variables, err = inventory.ParseVariables(input.Variables)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	policy, err := variablePolicy(r.Context(), rs.DB, inventoryId)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
 	}
 
 	query := `
@@ -106,6 +125,7 @@ func (rs *GroupsResource) CreateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	created.Variables = policy.MaskJSON(created.Variables)
 	render.Created(w, r, created)
 }
 
@@ -125,7 +145,13 @@ func (rs *GroupsResource) GetGroup(w http.ResponseWriter, r *http.Request) {
 		render.ErrNotFound(nil).Render(w, r)
 		return
 	}
+	policy, err := variablePolicy(r.Context(), rs.DB, group.InventoryID)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
 
+	group.Variables = policy.MaskJSON(group.Variables)
 	render.JSON(w, r, group)
 }
 
@@ -144,6 +170,22 @@ func (rs *GroupsResource) UpdateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var stored models.Group
+	if err := rs.DB.GetContext(r.Context(), &stored, "SELECT * FROM groups WHERE id = $1", groupId); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+	policy, err := variablePolicy(r.Context(), rs.DB, stored.InventoryID)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	input.Variables, err = updatedVariables(policy, input.Variables, stored.Variables)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
 	query := `
 		UPDATE groups 
 		SET name = $2, description = $3, variables = $4, modified_at = now()
@@ -160,6 +202,7 @@ func (rs *GroupsResource) UpdateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	updated.Variables = policy.MaskJSON(updated.Variables)
 	render.JSON(w, r, updated)
 }
 
@@ -236,6 +279,7 @@ func (rs *GroupsResource) RemoveHostFromGroup(w http.ResponseWriter, r *http.Req
 }
 
 // ListGroupHosts GET /api/v1/groups/{groupId}/hosts
+// With ?effective_vars=true each host includes its effective variables.
 func (rs *GroupsResource) ListGroupHosts(w http.ResponseWriter, r *http.Request) {
 	groupIdStr := chi.URLParam(r, "groupId")
 	groupId, err := strconv.ParseInt(groupIdStr, 10, 64)
@@ -256,9 +300,210 @@ func (rs *GroupsResource) ListGroupHosts(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	rs.renderHosts(w, r, groupId, hosts)
+}
+
+// ListAllGroupHosts GET /api/v1/groups/{groupId}/all_hosts
+// Lists the group's direct hosts and those inherited from its descendants.
+// With ?effective_vars=true each host includes its effective variables.
+func (rs *GroupsResource) ListAllGroupHosts(w http.ResponseWriter, r *http.Request) {
+	groupIdStr := chi.URLParam(r, "groupId")
+	groupId, err := strconv.ParseInt(groupIdStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var hosts []models.Host
+	query := `
+		WITH RECURSIVE tree(id) AS (
+			SELECT $1::bigint
+			UNION
+			SELECT gc.child_id FROM group_children gc JOIN tree t ON gc.parent_id = t.id
+		)
+		SELECT h.* FROM hosts h
+		WHERE h.id IN (
+			SELECT hgm.host_id FROM host_group_mapping hgm JOIN tree t ON hgm.group_id = t.id
+		)
+		ORDER BY h.name`
+	err = rs.DB.SelectContext(r.Context(), &hosts, query, groupId)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	rs.renderHosts(w, r, groupId, hosts)
+}
+
+// hostWithVars is a host with the variables Ansible resolves for it from
+// the inventory, group and host variables.
+type hostWithVars struct {
+	models.Host
+	EffectiveVariables map[string]interface{} `json:"effective_variables"`
+}
+
+// renderHosts writes hosts, adding effective variables when requested.
+func (rs *GroupsResource) renderHosts(w http.ResponseWriter, r *http.Request, groupId int64, hosts []models.Host) {
 	if hosts == nil {
 		hosts = []models.Host{}
 	}
 
-	render.JSON(w, r, hosts)
+	var inventoryId int64
+	if err := rs.DB.GetContext(r.Context(), &inventoryId, "SELECT inventory_id FROM groups WHERE id = $1", groupId); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+	policy, err := variablePolicy(r.Context(), rs.DB, inventoryId)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if r.URL.Query().Get("effective_vars") != "true" {
+		maskHosts(policy, hosts)
+		render.JSON(w, r, hosts)
+		return
+	}
+
+	inv, err := inventory.Load(r.Context(), rs.DB, inventoryId, true)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	out := make([]hostWithVars, len(hosts))
+	for i, h := range hosts {
+		h.Variables = policy.MaskJSON(h.Variables)
+		out[i] = hostWithVars{Host: h, EffectiveVariables: policy.Mask(inv.HostVars(h.Name))}
+	}
+	render.JSON(w, r, out)
+}
+
+// ListChildGroups GET /api/v1/groups/{groupId}/children
+func (rs *GroupsResource) ListChildGroups(w http.ResponseWriter, r *http.Request) {
+	groupIdStr := chi.URLParam(r, "groupId")
+	groupId, err := strconv.ParseInt(groupIdStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var groups []models.Group
+	query := `
+		SELECT g.* FROM groups g
+		JOIN group_children gc ON g.id = gc.child_id
+		WHERE gc.parent_id = $1
+		ORDER BY g.name`
+	err = rs.DB.SelectContext(r.Context(), &groups, query, groupId)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	if groups == nil {
+		groups = []models.Group{}
+	}
+
+	render.JSON(w, r, groups)
+}
+
+// AddChildGroup POST /api/v1/groups/{groupId}/children
+// Rejects children from another inventory and links that would create a cycle.
+func (rs *GroupsResource) AddChildGroup(w http.ResponseWriter, r *http.Request) {
+	groupIdStr := chi.URLParam(r, "groupId")
+	groupId, err := strconv.ParseInt(groupIdStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var input struct {
+		GroupID int64 `json:"group_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	tx, err := rs.DB.BeginTxx(r.Context(), nil)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	var parent, child models.Group
+	if err := tx.GetContext(r.Context(), &parent, "SELECT * FROM groups WHERE id = $1", groupId); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+	if err := tx.GetContext(r.Context(), &child, "SELECT * FROM groups WHERE id = $1", input.GroupID); err != nil {
+		render.ErrInvalidRequest(fmt.Errorf("group %d not found", input.GroupID)).Render(w, r)
+		return
+	}
+	if child.InventoryID != parent.InventoryID {
+		render.ErrInvalidRequest(fmt.Errorf("group %s belongs to another inventory", child.Name)).Render(w, r)
+		return
+	}
+
+	// Serialize hierarchy changes per inventory so concurrent links cannot
+	// form a cycle between them
+	if _, err := tx.ExecContext(r.Context(), "SELECT id FROM inventories WHERE id = $1 FOR UPDATE", parent.InventoryID); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	var cycle bool
+	err = tx.GetContext(r.Context(), &cycle, `
+		WITH RECURSIVE descendants(id) AS (
+			SELECT $1::bigint
+			UNION
+			SELECT gc.child_id FROM group_children gc JOIN descendants d ON gc.parent_id = d.id
+		)
+		SELECT EXISTS(SELECT 1 FROM descendants WHERE id = $2)`, child.ID, parent.ID)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if cycle {
+		render.ErrInvalidRequest(fmt.Errorf("adding %s as a child of %s would create a cycle", child.Name, parent.Name)).Render(w, r)
+		return
+	}
+
+	query := `INSERT INTO group_children (parent_id, child_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if _, err := tx.ExecContext(r.Context(), query, parent.ID, child.ID); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// RemoveChildGroup DELETE /api/v1/groups/{groupId}/children/{childId}
+func (rs *GroupsResource) RemoveChildGroup(w http.ResponseWriter, r *http.Request) {
+	groupIdStr := chi.URLParam(r, "groupId")
+	groupId, err := strconv.ParseInt(groupIdStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	childIdStr := chi.URLParam(r, "childId")
+	childId, err := strconv.ParseInt(childIdStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	query := `DELETE FROM group_children WHERE parent_id = $1 AND child_id = $2`
+	_, err = rs.DB.ExecContext(r.Context(), query, groupId, childId)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
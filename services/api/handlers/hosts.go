@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/inventory"
 	"github.com/praetordev/praetor/pkg/models"
 	"github.com/praetordev/praetor/services/api/render"
 )
@@ -36,10 +38,14 @@ func (rs *HostsResource) HostRoutes() chi.Router {
 	r.Get("/{hostId}", rs.GetHost)
 	r.Put("/{hostId}", rs.UpdateHost)
 	r.Delete("/{hostId}", rs.DeleteHost)
+	r.Get("/{hostId}/ansible_facts", rs.GetHostFacts)
+	r.Get("/{hostId}/job_host_summaries", rs.ListHostJobSummaries)
+	r.Get("/{hostId}/job_events", rs.ListHostJobEvents)
 	return r
 }
 
 // ListHosts GET /api/v1/inventories/{inventoryId}/hosts
+// Filter with ?has_active_failures=true to find hosts their last job failed on.
 func (rs *HostsResource) ListHosts(w http.ResponseWriter, r *http.Request) {
 	inventoryIdStr := chi.URLParam(r, "inventoryId")
 	inventoryId, err := strconv.ParseInt(inventoryIdStr, 10, 64)
@@ -48,9 +54,27 @@ func (rs *HostsResource) ListHosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var hasActiveFailures *bool
+	if s := r.URL.Query().Get("has_active_failures"); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			render.ErrInvalidRequest(err).Render(w, r)
+			return
+		}
+		hasActiveFailures = &v
+	}
+
 	var hosts []models.Host
-	query := `SELECT * FROM hosts WHERE inventory_id = $1 ORDER BY name`
-	err = rs.DB.SelectContext(r.Context(), &hosts, query, inventoryId)
+	query := `
+		SELECT * FROM hosts
+		WHERE inventory_id = $1 AND ($2::boolean IS NULL OR has_active_failures = $2)
+		ORDER BY name`
+	err = rs.DB.SelectContext(r.Context(), &hosts, query, inventoryId, hasActiveFailures)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	policy, err := variablePolicy(r.Context(), rs.DB, inventoryId)
 	if err != nil {
 		render.ErrInternal(err).Render(w, r)
 		return
@@ -59,6 +83,7 @@ func (rs *HostsResource) ListHosts(w http.ResponseWriter, r *http.Request) {
 	if hosts == nil {
 		hosts = []models.Host{}
 	}
+	maskHosts(policy, hosts)
 
 	render.JSON(w, r, hosts)
 }
@@ -85,9 +110,15 @@ func (rs *HostsResource) CreateHost(w http.ResponseWriter, r *http.Request) {
 
 	input.InventoryID = inventoryId
 
-	// Default variables to empty object if nil
-	if input.Variables == nil {
-		input.Variables = json.RawMessage("{}")
+	input.Variables, err = inventory.ParseVariables(input.Variables)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	policy, err := variablePolicy(r.Context(), rs.DB, inventoryId)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
 	}
 
 	query := `
@@ -106,6 +137,7 @@ func (rs *HostsResource) CreateHost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	created.Variables = policy.MaskJSON(created.Variables)
 	render.Created(w, r, created)
 }
 
@@ -125,7 +157,13 @@ func (rs *HostsResource) GetHost(w http.ResponseWriter, r *http.Request) {
 		render.ErrNotFound(nil).Render(w, r)
 		return
 	}
+	policy, err := variablePolicy(r.Context(), rs.DB, host.InventoryID)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
 
+	host.Variables = policy.MaskJSON(host.Variables)
 	render.JSON(w, r, host)
 }
 
@@ -144,6 +182,22 @@ func (rs *HostsResource) UpdateHost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var stored models.Host
+	if err := rs.DB.GetContext(r.Context(), &stored, "SELECT * FROM hosts WHERE id = $1", hostId); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+	policy, err := variablePolicy(r.Context(), rs.DB, stored.InventoryID)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	input.Variables, err = updatedVariables(policy, input.Variables, stored.Variables)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
 	query := `
 		UPDATE hosts 
 		SET name = $2, description = $3, variables = $4, enabled = $5, modified_at = now()
@@ -160,6 +214,7 @@ func (rs *HostsResource) UpdateHost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	updated.Variables = policy.MaskJSON(updated.Variables)
 	render.JSON(w, r, updated)
 }
 
@@ -172,6 +227,16 @@ func (rs *HostsResource) DeleteHost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var owner hostOwner
+	if err := rs.DB.GetContext(r.Context(), &owner, hostOwnerQuery+" WHERE h.id = $1", hostId); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+	if err := owner.checkDelete(); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
 	query := `DELETE FROM hosts WHERE id = $1`
 	_, err = rs.DB.ExecContext(r.Context(), query, hostId)
 	if err != nil {
@@ -181,3 +246,129 @@ func (rs *HostsResource) DeleteHost(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// hostOwner is what decides whether a host can be deleted by hand.
+type hostOwner struct {
+	ID                int64  `db:"id"`
+	Kind              string `db:"kind"`
+	InventorySourceID *int64 `db:"inventory_source_id"`
+}
+
+const hostOwnerQuery = `
+	SELECT h.id, i.kind, h.inventory_source_id
+	FROM hosts h JOIN inventories i ON i.id = h.inventory_id`
+
+// checkDelete rejects deleting hosts of smart and constructed inventories,
+// which do not hold their own hosts, and hosts an inventory source reported,
+// which its next update would bring back.
+func (o hostOwner) checkDelete() error {
+	if o.Kind != models.InventoryKindStatic {
+		return fmt.Errorf("host %d belongs to a %s inventory, which does not hold its own hosts", o.ID, o.Kind)
+	}
+	if o.InventorySourceID != nil {
+		return fmt.Errorf("host %d is managed by inventory source %d", o.ID, *o.InventorySourceID)
+	}
+	return nil
+}
+
+// GetHostFacts GET /api/v1/hosts/{hostId}/ansible_facts
+// Returns the facts last gathered for the host, with when and by which job.
+func (rs *HostsResource) GetHostFacts(w http.ResponseWriter, r *http.Request) {
+	hostIdStr := chi.URLParam(r, "hostId")
+	hostId, err := strconv.ParseInt(hostIdStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var facts models.HostFacts
+	if err := rs.DB.GetContext(r.Context(), &facts, "SELECT * FROM host_facts WHERE host_id = $1", hostId); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, facts)
+}
+
+// ListHostJobSummaries GET /api/v1/hosts/{hostId}/job_host_summaries
+// Returns the host's recap in each job that ran against it, newest first.
+func (rs *HostsResource) ListHostJobSummaries(w http.ResponseWriter, r *http.Request) {
+	hostIdStr := chi.URLParam(r, "hostId")
+	hostId, err := strconv.ParseInt(hostIdStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	pg := render.ParsePagination(r)
+
+	var summaries []models.JobHostSummary
+	query := `
+		SELECT * FROM job_host_summaries
+		WHERE host_id = $1
+		ORDER BY unified_job_id DESC LIMIT $2 OFFSET $3`
+	if err := rs.DB.SelectContext(r.Context(), &summaries, query, hostId, pg.Limit, pg.Offset); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	var total int64
+	_ = rs.DB.Get(&total, "SELECT count(*) FROM job_host_summaries WHERE host_id = $1", hostId)
+
+	if summaries == nil {
+		summaries = []models.JobHostSummary{}
+	}
+
+	render.JSON(w, r, &render.PaginatedResponse{
+		Items:  summaries,
+		Total:  total,
+		Limit:  pg.Limit,
+		Offset: pg.Offset,
+	})
+}
+
+// ListHostJobEvents GET /api/v1/hosts/{hostId}/job_events
+// Returns the events of all jobs about the host, newest first. Filter with
+// ?job_id= to limit them to one job.
+func (rs *HostsResource) ListHostJobEvents(w http.ResponseWriter, r *http.Request) {
+	hostIdStr := chi.URLParam(r, "hostId")
+	hostId, err := strconv.ParseInt(hostIdStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	pg := render.ParsePagination(r)
+
+	var jobID *int64
+	if s := r.URL.Query().Get("job_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			render.ErrInvalidRequest(err).Render(w, r)
+			return
+		}
+		jobID = &id
+	}
+
+	var jobEvents []models.JobEvent
+	query := `
+		SELECT * FROM job_events
+		WHERE host_id = $1 AND ($2::bigint IS NULL OR unified_job_id = $2)
+		ORDER BY id DESC LIMIT $3 OFFSET $4`
+	if err := rs.DB.SelectContext(r.Context(), &jobEvents, query, hostId, jobID, pg.Limit, pg.Offset); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	var total int64
+	_ = rs.DB.Get(&total, "SELECT count(*) FROM job_events WHERE host_id = $1 AND ($2::bigint IS NULL OR unified_job_id = $2)", hostId, jobID)
+
+	if jobEvents == nil {
+		jobEvents = []models.JobEvent{}
+	}
+
+	render.JSON(w, r, &render.PaginatedResponse{
+		Items:  jobEvents,
+		Total:  total,
+		Limit:  pg.Limit,
+		Offset: pg.Offset,
+	})
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/models"
+	"github.com/praetordev/praetor/pkg/podspec"
+	"github.com/praetordev/praetor/services/api/render"
+)
+
+// InstanceGroupsResource handles instance groups, including container groups
+type InstanceGroupsResource struct {
+	DB *sqlx.DB
+}
+
+// NewInstanceGroupsResource creates a new instance groups resource handler
+func NewInstanceGroupsResource(db *sqlx.DB) *InstanceGroupsResource {
+	return &InstanceGroupsResource{DB: db}
+}
+
+// Routes creates a REST router for instance groups
+func (rs *InstanceGroupsResource) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", rs.ListInstanceGroups)
+	r.Post("/", rs.CreateInstanceGroup)
+	r.Get("/{id}", rs.GetInstanceGroup)
+	r.Put("/{id}", rs.UpdateInstanceGroup)
+	r.Delete("/{id}", rs.DeleteInstanceGroup)
+	return r
+}
+
+// ListInstanceGroups GET /api/v1/instance_groups
+func (rs *InstanceGroupsResource) ListInstanceGroups(w http.ResponseWriter, r *http.Request) {
+	pg := render.ParsePagination(r)
+
+	var groups []models.InstanceGroup
+	query := `SELECT * FROM instance_groups ORDER BY id LIMIT $1 OFFSET $2`
+	if err := rs.DB.SelectContext(r.Context(), &groups, query, pg.Limit, pg.Offset); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	var total int64
+	_ = rs.DB.Get(&total, "SELECT count(*) FROM instance_groups")
+
+	if groups == nil {
+		groups = []models.InstanceGroup{}
+	}
+
+	render.JSON(w, r, &render.PaginatedResponse{
+		Items:  groups,
+		Total:  total,
+		Limit:  pg.Limit,
+		Offset: pg.Offset,
+	})
+}
+
+// backends are the execution backends an instance group can select.
+var backends = map[string]bool{
+	"":                       true,
+	models.BackendProcess:    true,
+	models.BackendDocker:     true,
+	models.BackendPodman:     true,
+	models.BackendKubernetes: true,
+}
+
+// decodeInstanceGroup reads and validates an instance group create or
+// update. Pod spec overrides and resource classes must be valid Kubernetes
+// pod spec and resource requirements, and only apply to container groups,
+// which run on the Kubernetes backend.
+func decodeInstanceGroup(r *http.Request) (*models.InstanceGroup, error) {
+	var input models.InstanceGroup
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, err
+	}
+	if input.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if !backends[input.Backend] {
+		return nil, fmt.Errorf("unknown backend %q", input.Backend)
+	}
+	if input.IsContainerGroup {
+		if input.Backend != "" && input.Backend != models.BackendKubernetes {
+			return nil, fmt.Errorf("container groups run on the %s backend", models.BackendKubernetes)
+		}
+		input.Backend = models.BackendKubernetes
+	}
+	if isJSONNull(input.PodSpecOverride) {
+		input.PodSpecOverride = nil
+	}
+	if isJSONNull(input.ResourceClasses) {
+		input.ResourceClasses = json.RawMessage(`{}`)
+	}
+	if !input.IsContainerGroup && (input.PodSpecOverride != nil || string(input.ResourceClasses) != "{}") {
+		return nil, fmt.Errorf("pod_spec_override and resource_classes only apply to container groups")
+	}
+	if _, err := podspec.Parse(input.PodSpecOverride); err != nil {
+		return nil, err
+	}
+	if _, err := podspec.ParseResourceClasses(input.ResourceClasses); err != nil {
+		return nil, err
+	}
+	return &input, nil
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(raw) == "null"
+}
+
+// CreateInstanceGroup POST /api/v1/instance_groups
+func (rs *InstanceGroupsResource) CreateInstanceGroup(w http.ResponseWriter, r *http.Request) {
+	input, err := decodeInstanceGroup(r)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	query := `
+		INSERT INTO instance_groups (name, is_container_group, pod_spec_override, resource_classes, backend)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING *`
+
+	var created models.InstanceGroup
+	err = rs.DB.QueryRowxContext(r.Context(), query,
+		input.Name, input.IsContainerGroup, input.PodSpecOverride, input.ResourceClasses, input.Backend,
+	).StructScan(&created)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	render.Created(w, r, created)
+}
+
+// GetInstanceGroup GET /api/v1/instance_groups/{id}
+func (rs *InstanceGroupsResource) GetInstanceGroup(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var group models.InstanceGroup
+	if err := rs.DB.GetContext(r.Context(), &group, "SELECT * FROM instance_groups WHERE id = $1", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, group)
+}
+
+// UpdateInstanceGroup PUT /api/v1/instance_groups/{id}
+func (rs *InstanceGroupsResource) UpdateInstanceGroup(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	input, err := decodeInstanceGroup(r)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	query := `
+		UPDATE instance_groups
+		SET name = $2, is_container_group = $3, pod_spec_override = $4, resource_classes = $5, backend = $6, modified_at = now()
+		WHERE id = $1
+		RETURNING *`
+
+	var updated models.InstanceGroup
+	err = rs.DB.QueryRowxContext(r.Context(), query,
+		id, input.Name, input.IsContainerGroup, input.PodSpecOverride, input.ResourceClasses, input.Backend,
+	).StructScan(&updated)
+	if err == sql.ErrNoRows {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	} else if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, updated)
+}
+
+// DeleteInstanceGroup DELETE /api/v1/instance_groups/{id}
+func (rs *InstanceGroupsResource) DeleteInstanceGroup(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	if _, err := rs.DB.ExecContext(r.Context(), "DELETE FROM instance_groups WHERE id = $1", id); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkResourceClass makes sure a template's instance group exists and, if
+// it selects a resource class, that the group is a container group defining
+// it.
+func checkResourceClass(ctx context.Context, q sqlx.QueryerContext, groupID *int64, class *string) error {
+	if groupID == nil {
+		if class != nil && *class != "" {
+			return fmt.Errorf("resource_class needs a container group instance_group_id")
+		}
+		return nil
+	}
+
+	var group models.InstanceGroup
+	err := sqlx.GetContext(ctx, q, &group, "SELECT * FROM instance_groups WHERE id = $1", *groupID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("instance group %d not found", *groupID)
+	}
+	if err != nil {
+		return err
+	}
+	if class == nil || *class == "" {
+		return nil
+	}
+	if !group.IsContainerGroup {
+		return fmt.Errorf("instance group %s is not a container group and has no resource classes", group.Name)
+	}
+	classes, err := podspec.ParseResourceClasses(group.ResourceClasses)
+	if err != nil {
+		return err
+	}
+	if _, ok := classes[*class]; !ok {
+		return fmt.Errorf("container group %s has no resource class %q", group.Name, *class)
+	}
+	return nil
+}
@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/hostfilter"
+	"github.com/praetordev/praetor/pkg/inventory"
 	"github.com/praetordev/praetor/pkg/models"
 	"github.com/praetordev/praetor/services/api/render"
 )
@@ -21,14 +25,25 @@ func NewInventoriesResource(db *sqlx.DB) *InventoriesResource {
 	return &InventoriesResource{DB: db}
 }
 
-// Routes creates a REST router for the Inventories resource
-func (rs *InventoriesResource) Routes() chi.Router {
+// Routes creates a REST router for the Inventories resource. nested adds
+// the routes of resources that live under an inventory, such as hosts and
+// groups; they share the {inventoryId} parameter.
+func (rs *InventoriesResource) Routes(nested func(r chi.Router)) chi.Router {
 	r := chi.NewRouter()
 	r.Get("/", rs.ListInventories)
 	r.Post("/", rs.CreateInventory)
-	r.Get("/{id}", rs.GetInventory)
-	r.Put("/{id}", rs.UpdateInventory)
-	r.Delete("/{id}", rs.DeleteInventory)
+	r.Get("/preview", rs.PreviewHostFilter)
+	r.Route("/{inventoryId}", func(r chi.Router) {
+		r.Get("/", rs.GetInventory)
+		r.Put("/", rs.UpdateInventory)
+		r.Delete("/", rs.DeleteInventory)
+		r.Post("/import", rs.ImportInventory)
+		r.Get("/inputs", rs.ListInputInventories)
+		r.Put("/inputs", rs.SetInputInventories)
+		if nested != nil {
+			nested(r)
+		}
+	})
 	return r
 }
 
@@ -51,6 +66,19 @@ func (rs *InventoriesResource) ListInventories(w http.ResponseWriter, r *http.Re
 		inventories = []models.Inventory{}
 	}
 
+	policies := map[int64]*inventory.VariablePolicy{}
+	for i, inv := range inventories {
+		policy, ok := policies[inv.OrganizationID]
+		if !ok {
+			if policy, err = inventory.LoadVariablePolicy(r.Context(), rs.DB, inv.OrganizationID); err != nil {
+				render.ErrInternal(err).Render(w, r)
+				return
+			}
+			policies[inv.OrganizationID] = policy
+		}
+		maskInventory(&inventories[i], policy)
+	}
+
 	render.JSON(w, r, &render.PaginatedResponse{
 		Items:  inventories,
 		Total:  total,
@@ -59,6 +87,14 @@ func (rs *InventoriesResource) ListInventories(w http.ResponseWriter, r *http.Re
 	})
 }
 
+// maskInventory prepares an inventory for a response: sensitive variables are
+// masked and the raw content, which may hold connection passwords, is left
+// out. Updates without content keep the stored one.
+func maskInventory(inv *models.Inventory, policy *inventory.VariablePolicy) {
+	inv.Variables = policy.MaskJSON(inv.Variables)
+	inv.Content = nil
+}
+
 // CreateInventory POST /api/v1/inventories
 func (rs *InventoriesResource) CreateInventory(w http.ResponseWriter, r *http.Request) {
 	var input models.Inventory
@@ -80,18 +116,34 @@ func (rs *InventoriesResource) CreateInventory(w http.ResponseWriter, r *http.Re
 
 	// Default kind
 	if input.Kind == "" {
-		input.Kind = "static"
+		input.Kind = models.InventoryKindStatic
+	}
+	if err := validateKindOptions(input.Kind, input.HostFilter, input.ConstructedRules, false); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var err error
+	input.Variables, err = inventory.ParseVariables(input.Variables)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	policy, err := inventory.LoadVariablePolicy(r.Context(), rs.DB, input.OrganizationID)
+	if err != nil {
+		render.ErrInvalidRequest(fmt.Errorf("organization %d does not exist", input.OrganizationID)).Render(w, r)
+		return
 	}
 
 	query := `
-		INSERT INTO inventories (organization_id, name, description, kind, content) 
-		VALUES ($1, $2, $3, $4, $5) 
+		INSERT INTO inventories (organization_id, name, description, kind, content, variables, host_filter, constructed_rules) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
 		RETURNING *`
 
 	var created models.Inventory
-	err := rs.DB.QueryRowxContext(r.Context(), query,
+	err = rs.DB.QueryRowxContext(r.Context(), query,
 		input.OrganizationID, input.Name, input.Description,
-		input.Kind, input.Content,
+		input.Kind, input.Content, input.Variables, input.HostFilter, nullableJSON(input.ConstructedRules),
 	).StructScan(&created)
 
 	if err != nil {
@@ -99,12 +151,13 @@ func (rs *InventoriesResource) CreateInventory(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	maskInventory(&created, policy)
 	render.Created(w, r, created)
 }
 
 // GetInventory GET /api/v1/inventories/{id}
 func (rs *InventoriesResource) GetInventory(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
+	idStr := chi.URLParam(r, "inventoryId")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		render.ErrInvalidRequest(err).Render(w, r)
@@ -118,13 +171,19 @@ func (rs *InventoriesResource) GetInventory(w http.ResponseWriter, r *http.Reque
 		render.ErrNotFound(nil).Render(w, r)
 		return
 	}
+	policy, err := variablePolicy(r.Context(), rs.DB, id)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
 
+	maskInventory(&inventory, policy)
 	render.JSON(w, r, inventory)
 }
 
 // UpdateInventory PUT /api/v1/inventories/{id}
 func (rs *InventoriesResource) UpdateInventory(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
+	idStr := chi.URLParam(r, "inventoryId")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		render.ErrInvalidRequest(err).Render(w, r)
@@ -137,15 +196,41 @@ func (rs *InventoriesResource) UpdateInventory(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	// The kind is fixed at creation; the host filter and rules must suit it
+	var stored models.Inventory
+	if err := rs.DB.GetContext(r.Context(), &stored, "SELECT * FROM inventories WHERE id = $1", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+	if err := validateKindOptions(stored.Kind, input.HostFilter, input.ConstructedRules, true); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	policy, err := inventory.LoadVariablePolicy(r.Context(), rs.DB, stored.OrganizationID)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if input.Variables != nil {
+		input.Variables, err = updatedVariables(policy, input.Variables, stored.Variables)
+		if err != nil {
+			render.ErrInvalidRequest(err).Render(w, r)
+			return
+		}
+	}
+
 	query := `
 		UPDATE inventories 
-		SET name = $2, description = $3, content = $4, modified_at = now()
+		SET name = $2, description = $3, content = COALESCE($4, content), variables = COALESCE($5, variables),
+		    host_filter = COALESCE($6, host_filter), constructed_rules = COALESCE($7, constructed_rules),
+		    modified_at = now()
 		WHERE id = $1 
 		RETURNING *`
 
 	var updated models.Inventory
 	err = rs.DB.QueryRowxContext(r.Context(), query,
-		id, input.Name, input.Description, input.Content,
+		id, input.Name, input.Description, input.Content, input.Variables, input.HostFilter, nullableJSON(input.ConstructedRules),
 	).StructScan(&updated)
 
 	if err != nil {
@@ -153,12 +238,13 @@ func (rs *InventoriesResource) UpdateInventory(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	maskInventory(&updated, policy)
 	render.JSON(w, r, updated)
 }
 
 // DeleteInventory DELETE /api/v1/inventories/{id}
 func (rs *InventoriesResource) DeleteInventory(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
+	idStr := chi.URLParam(r, "inventoryId")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		render.ErrInvalidRequest(err).Render(w, r)
@@ -174,3 +260,311 @@ func (rs *InventoriesResource) DeleteInventory(w http.ResponseWriter, r *http.Re
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// importRequest is the body of an inventory import. Content defaults to the
+// inventory's stored content.
+type importRequest struct {
+	Content *string `json:"content"`
+	Format  string  `json:"format"` // auto, ini, yaml or json
+	Mode    string  `json:"mode"`   // merge or overwrite
+	DryRun  bool    `json:"dry_run"`
+}
+
+type importResponse struct {
+	Format  string             `json:"format"`
+	Mode    string             `json:"mode"`
+	DryRun  bool               `json:"dry_run"`
+	Changes *inventory.Changes `json:"changes"`
+}
+
+// ImportInventory POST /api/v1/inventories/{id}/import
+// Parses an INI, YAML or ansible-inventory JSON source into the inventory's
+// hosts, groups, membership and variables in one transaction, and stores an
+// imported source as the inventory's content. With dry_run the changes are
+// returned without being applied.
+func (rs *InventoriesResource) ImportInventory(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "inventoryId")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var input importRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	if input.Mode == "" {
+		input.Mode = inventory.ImportMerge
+	}
+	if input.Mode != inventory.ImportMerge && input.Mode != inventory.ImportOverwrite {
+		render.ErrInvalidRequest(fmt.Errorf("mode must be %s or %s", inventory.ImportMerge, inventory.ImportOverwrite)).Render(w, r)
+		return
+	}
+
+	tx, err := rs.DB.BeginTxx(r.Context(), nil)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the inventory so concurrent imports and edits apply in order
+	var stored struct {
+		Kind    string  `db:"kind"`
+		Content *string `db:"content"`
+	}
+	if err := tx.GetContext(r.Context(), &stored, "SELECT kind, content FROM inventories WHERE id = $1 FOR UPDATE", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+	if stored.Kind != models.InventoryKindStatic {
+		render.ErrInvalidRequest(fmt.Errorf("%s inventories do not hold their own hosts", stored.Kind)).Render(w, r)
+		return
+	}
+	source := input.Content
+	if source == nil {
+		source = stored.Content
+	}
+	if source == nil || strings.TrimSpace(*source) == "" {
+		render.ErrInvalidRequest(fmt.Errorf("no inventory content to import")).Render(w, r)
+		return
+	}
+
+	format := input.Format
+	if format == "" || format == inventory.FormatAuto {
+		format = inventory.DetectFormat([]byte(*source))
+	}
+	imported, err := inventory.Parse([]byte(*source), format)
+	if err != nil {
+		render.ErrInvalidRequest(fmt.Errorf("failed to parse %s inventory: %w", format, err)).Render(w, r)
+		return
+	}
+
+	current, err := inventory.Load(r.Context(), tx, id, true)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	target, changes, err := inventory.Plan(current, imported, input.Mode)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	if !input.DryRun {
+		if err := inventory.Apply(r.Context(), tx, id, target, changes); err != nil {
+			render.ErrInternal(err).Render(w, r)
+			return
+		}
+		if input.Content != nil {
+			if _, err := tx.ExecContext(r.Context(), "UPDATE inventories SET content = $2, modified_at = now() WHERE id = $1", id, *input.Content); err != nil {
+				render.ErrInternal(err).Render(w, r)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			render.ErrInternal(err).Render(w, r)
+			return
+		}
+	}
+
+	render.JSON(w, r, importResponse{Format: format, Mode: input.Mode, DryRun: input.DryRun, Changes: changes})
+}
+
+// validateKindOptions checks the options that belong to an inventory kind:
+// smart inventories have a valid host filter and constructed inventories
+// valid rules. An update may leave out the host filter to keep it.
+func validateKindOptions(kind string, filter *string, rules json.RawMessage, update bool) error {
+	hasRules := len(rules) > 0 && string(rules) != "null"
+	switch kind {
+	case models.InventoryKindSmart:
+		if filter == nil && !update {
+			return fmt.Errorf("smart inventories require a host_filter")
+		}
+		if filter != nil {
+			if _, err := hostfilter.Parse(*filter); err != nil {
+				return err
+			}
+		}
+	case models.InventoryKindConstructed:
+		if _, err := inventory.ParseConstructed(rules); err != nil {
+			return err
+		}
+	case models.InventoryKindStatic:
+	default:
+		return fmt.Errorf("kind must be %s, %s or %s",
+			models.InventoryKindStatic, models.InventoryKindSmart, models.InventoryKindConstructed)
+	}
+	if filter != nil && kind != models.InventoryKindSmart {
+		return fmt.Errorf("host_filter only applies to smart inventories")
+	}
+	if hasRules && kind != models.InventoryKindConstructed {
+		return fmt.Errorf("constructed_rules only apply to constructed inventories")
+	}
+	return nil
+}
+
+// PreviewHostFilter GET /api/v1/inventories/preview?host_filter=...
+// Lists the hosts a smart inventory with the filter would contain, including
+// disabled hosts, in the organization given by ?organization_id (default 1).
+func (rs *InventoriesResource) PreviewHostFilter(w http.ResponseWriter, r *http.Request) {
+	pg := render.ParsePagination(r)
+
+	orgID := int64(1)
+	if s := r.URL.Query().Get("organization_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			render.ErrInvalidRequest(err).Render(w, r)
+			return
+		}
+		orgID = id
+	}
+	filter, err := hostfilter.Parse(r.URL.Query().Get("host_filter"))
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	hosts, total, err := inventory.MatchHosts(r.Context(), rs.DB, orgID, filter, true, pg.Limit, pg.Offset)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if hosts == nil {
+		hosts = []models.Host{}
+	}
+	policy, err := inventory.LoadVariablePolicy(r.Context(), rs.DB, orgID)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	maskHosts(policy, hosts)
+
+	render.JSON(w, r, &render.PaginatedResponse{
+		Items:  hosts,
+		Total:  total,
+		Limit:  pg.Limit,
+		Offset: pg.Offset,
+	})
+}
+
+// ListInputInventories GET /api/v1/inventories/{id}/inputs
+// Lists a constructed inventory's inputs in order.
+func (rs *InventoriesResource) ListInputInventories(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "inventoryId")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var inputs []models.Inventory
+	query := `
+		SELECT i.* FROM inventory_inputs ii JOIN inventories i ON i.id = ii.input_inventory_id
+		WHERE ii.inventory_id = $1
+		ORDER BY ii.position`
+	if err := rs.DB.SelectContext(r.Context(), &inputs, query, id); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if inputs == nil {
+		inputs = []models.Inventory{}
+	}
+	// Inputs share the constructed inventory's organization
+	policy, err := variablePolicy(r.Context(), rs.DB, id)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	for i := range inputs {
+		maskInventory(&inputs[i], policy)
+	}
+
+	render.JSON(w, r, inputs)
+}
+
+// inputsRequest is the body of SetInputInventories.
+type inputsRequest struct {
+	InventoryIDs []int64 `json:"inventory_ids"`
+}
+
+// SetInputInventories PUT /api/v1/inventories/{id}/inputs
+// Replaces a constructed inventory's inputs. Inputs are static or smart
+// inventories of the same organization; hosts in later inputs override the
+// variables of the same hosts in earlier ones.
+func (rs *InventoriesResource) SetInputInventories(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "inventoryId")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var input inputsRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	tx, err := rs.DB.BeginTxx(r.Context(), nil)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	var target models.Inventory
+	if err := tx.GetContext(r.Context(), &target, "SELECT * FROM inventories WHERE id = $1 FOR UPDATE", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+	if target.Kind != models.InventoryKindConstructed {
+		render.ErrInvalidRequest(fmt.Errorf("only constructed inventories have inputs")).Render(w, r)
+		return
+	}
+
+	seen := map[int64]bool{}
+	for _, inputID := range input.InventoryIDs {
+		if seen[inputID] {
+			render.ErrInvalidRequest(fmt.Errorf("inventory %d is listed twice", inputID)).Render(w, r)
+			return
+		}
+		seen[inputID] = true
+
+		var in models.Inventory
+		if err := tx.GetContext(r.Context(), &in, "SELECT * FROM inventories WHERE id = $1", inputID); err != nil {
+			render.ErrInvalidRequest(fmt.Errorf("inventory %d does not exist", inputID)).Render(w, r)
+			return
+		}
+		if in.OrganizationID != target.OrganizationID {
+			render.ErrInvalidRequest(fmt.Errorf("inventory %d belongs to another organization", inputID)).Render(w, r)
+			return
+		}
+		if in.Kind == models.InventoryKindConstructed {
+			render.ErrInvalidRequest(fmt.Errorf("inventory %d is constructed and cannot be an input", inputID)).Render(w, r)
+			return
+		}
+	}
+
+	if _, err := tx.ExecContext(r.Context(), "DELETE FROM inventory_inputs WHERE inventory_id = $1", id); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	for i, inputID := range input.InventoryIDs {
+		_, err := tx.ExecContext(r.Context(), `
+			INSERT INTO inventory_inputs (inventory_id, input_inventory_id, position)
+			VALUES ($1, $2, $3)`, id, inputID, i)
+		if err != nil {
+			render.ErrInternal(err).Render(w, r)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	rs.ListInputInventories(w, r)
+}
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/models"
+	"github.com/praetordev/praetor/services/api/render"
+)
+
+// InventorySourcesResource handles dynamic inventory sources and their updates
+type InventorySourcesResource struct {
+	DB *sqlx.DB
+}
+
+// NewInventorySourcesResource creates a new inventory sources resource handler
+func NewInventorySourcesResource(db *sqlx.DB) *InventorySourcesResource {
+	return &InventorySourcesResource{DB: db}
+}
+
+// Routes creates a REST router for inventory sources
+func (rs *InventorySourcesResource) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", rs.ListInventorySources)
+	r.Post("/", rs.CreateInventorySource)
+	r.Get("/{id}", rs.GetInventorySource)
+	r.Put("/{id}", rs.UpdateInventorySource)
+	r.Delete("/{id}", rs.DeleteInventorySource)
+	r.Post("/{id}/sync", rs.SyncInventorySource)
+	r.Get("/{id}/updates", rs.ListInventoryUpdates)
+	return r
+}
+
+// ListInventorySources GET /api/v1/inventory-sources
+// Filter with ?inventory_id=.
+func (rs *InventorySourcesResource) ListInventorySources(w http.ResponseWriter, r *http.Request) {
+	pg := render.ParsePagination(r)
+
+	var inventoryID *int64
+	if s := r.URL.Query().Get("inventory_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			render.ErrInvalidRequest(err).Render(w, r)
+			return
+		}
+		inventoryID = &id
+	}
+
+	var sources []models.InventorySource
+	query := `
+		SELECT * FROM inventory_sources
+		WHERE $1::bigint IS NULL OR inventory_id = $1
+		ORDER BY id DESC LIMIT $2 OFFSET $3`
+	if err := rs.DB.SelectContext(r.Context(), &sources, query, inventoryID, pg.Limit, pg.Offset); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	var total int64
+	_ = rs.DB.Get(&total, "SELECT count(*) FROM inventory_sources WHERE $1::bigint IS NULL OR inventory_id = $1", inventoryID)
+
+	if sources == nil {
+		sources = []models.InventorySource{}
+	}
+
+	render.JSON(w, r, &render.PaginatedResponse{
+		Items:  sources,
+		Total:  total,
+		Limit:  pg.Limit,
+		Offset: pg.Offset,
+	})
+}
+
+// CreateInventorySource POST /api/v1/inventory-sources
+func (rs *InventorySourcesResource) CreateInventorySource(w http.ResponseWriter, r *http.Request) {
+	var input models.InventorySource
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	if input.InventoryID == 0 || input.Name == "" {
+		render.ErrInvalidRequest(fmt.Errorf("inventory_id and name are required")).Render(w, r)
+		return
+	}
+	if err := validateInventorySource(&input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	var kind string
+	if err := rs.DB.GetContext(r.Context(), &kind, "SELECT kind FROM inventories WHERE id = $1", input.InventoryID); err != nil {
+		render.ErrInvalidRequest(fmt.Errorf("inventory %d does not exist", input.InventoryID)).Render(w, r)
+		return
+	}
+	if kind != models.InventoryKindStatic {
+		render.ErrInvalidRequest(fmt.Errorf("sources can only feed static inventories")).Render(w, r)
+		return
+	}
+
+	query := `
+		INSERT INTO inventory_sources (
+			inventory_id, name, description, source, source_project_id, source_path,
+			source_script, source_vars, overwrite, overwrite_vars)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING *`
+
+	var created models.InventorySource
+	err := rs.DB.QueryRowxContext(r.Context(), query,
+		input.InventoryID, input.Name, input.Description, input.Source, input.SourceProjectID,
+		input.SourcePath, input.SourceScript, nullableJSON(input.SourceVars), input.Overwrite, input.OverwriteVars,
+	).StructScan(&created)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	render.Created(w, r, created)
+}
+
+// GetInventorySource GET /api/v1/inventory-sources/{id}
+func (rs *InventorySourcesResource) GetInventorySource(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var source models.InventorySource
+	if err := rs.DB.GetContext(r.Context(), &source, "SELECT * FROM inventory_sources WHERE id = $1", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, source)
+}
+
+// UpdateInventorySource PUT /api/v1/inventory-sources/{id}
+// The inventory of a source cannot be changed.
+func (rs *InventorySourcesResource) UpdateInventorySource(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var input models.InventorySource
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	if input.Name == "" {
+		render.ErrInvalidRequest(fmt.Errorf("name is required")).Render(w, r)
+		return
+	}
+	if err := validateInventorySource(&input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	query := `
+		UPDATE inventory_sources
+		SET name = $2, description = $3, source = $4, source_project_id = $5, source_path = $6,
+		    source_script = $7, source_vars = $8, overwrite = $9, overwrite_vars = $10, modified_at = now()
+		WHERE id = $1
+		RETURNING *`
+
+	var updated models.InventorySource
+	err = rs.DB.QueryRowxContext(r.Context(), query,
+		id, input.Name, input.Description, input.Source, input.SourceProjectID, input.SourcePath,
+		input.SourceScript, nullableJSON(input.SourceVars), input.Overwrite, input.OverwriteVars,
+	).StructScan(&updated)
+	if err == sql.ErrNoRows {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	} else if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, updated)
+}
+
+// DeleteInventorySource DELETE /api/v1/inventory-sources/{id}
+// Hosts and groups the source owns stay in the inventory as manual entries.
+func (rs *InventorySourcesResource) DeleteInventorySource(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	if _, err := rs.DB.ExecContext(r.Context(), "DELETE FROM inventory_sources WHERE id = $1", id); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SyncInventorySource POST /api/v1/inventory-sources/{id}/sync
+// Queues an inventory update job. The executor runs ansible-inventory against
+// the source and the consumer applies the result to the inventory. If an
+// update is already in progress, that job is returned instead of queueing
+// another.
+func (rs *InventorySourcesResource) SyncInventorySource(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	tx, err := rs.DB.BeginTxx(r.Context(), nil)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the source row so concurrent sync requests queue a single update
+	var source models.InventorySource
+	if err := tx.GetContext(r.Context(), &source, "SELECT * FROM inventory_sources WHERE id = $1 FOR UPDATE", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	var active models.UnifiedJob
+	err = tx.GetContext(r.Context(), &active, `
+		SELECT * FROM unified_jobs
+		WHERE kind = 'inventory_update' AND unified_job_template_id = $1
+		  AND status IN ('pending', 'queued', 'running')
+		ORDER BY id DESC LIMIT 1`, id)
+	if err == nil {
+		render.Accepted(w, r, active)
+		return
+	} else if err != sql.ErrNoRows {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	var job models.UnifiedJob
+	err = tx.QueryRowxContext(r.Context(), `
+		INSERT INTO unified_jobs (name, unified_job_template_id, kind, status)
+		VALUES ($1, $2, 'inventory_update', 'pending')
+		RETURNING *`,
+		fmt.Sprintf("%s - inventory update", source.Name), id,
+	).StructScan(&job)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), "UPDATE inventory_sources SET last_update_job_id = $1 WHERE id = $2", job.ID, id); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	render.Accepted(w, r, job)
+}
+
+// ListInventoryUpdates GET /api/v1/inventory-sources/{id}/updates
+func (rs *InventorySourcesResource) ListInventoryUpdates(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	pg := render.ParsePagination(r)
+
+	var updates []models.UnifiedJob
+	query := `
+		SELECT * FROM unified_jobs
+		WHERE kind = 'inventory_update' AND unified_job_template_id = $1
+		ORDER BY id DESC LIMIT $2 OFFSET $3`
+	if err := rs.DB.SelectContext(r.Context(), &updates, query, id, pg.Limit, pg.Offset); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	var total int64
+	_ = rs.DB.Get(&total, "SELECT count(*) FROM unified_jobs WHERE kind = 'inventory_update' AND unified_job_template_id = $1", id)
+
+	if updates == nil {
+		updates = []models.UnifiedJob{}
+	}
+
+	render.JSON(w, r, &render.PaginatedResponse{
+		Items:  updates,
+		Total:  total,
+		Limit:  pg.Limit,
+		Offset: pg.Offset,
+	})
+}
+
+// validateInventorySource checks that the fields the source type needs are
+// set, and clears the ones it does not use.
+func validateInventorySource(s *models.InventorySource) error {
+	switch s.Source {
+	case models.InventorySourceScript:
+		if s.SourceScript == nil || strings.TrimSpace(*s.SourceScript) == "" {
+			return fmt.Errorf("script sources require source_script")
+		}
+		s.SourceProjectID, s.SourcePath, s.SourceVars = nil, nil, nil
+	case models.InventorySourceSCM:
+		if s.SourceProjectID == nil {
+			return fmt.Errorf("scm sources require source_project_id")
+		}
+		if s.SourcePath != nil {
+			if p := path.Clean(*s.SourcePath); path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+				return fmt.Errorf("source_path must be relative to the project root")
+			}
+		}
+		s.SourceScript, s.SourceVars = nil, nil
+	case models.InventorySourcePlugin:
+		var config map[string]interface{}
+		if err := json.Unmarshal(s.SourceVars, &config); err != nil || config == nil {
+			return fmt.Errorf("plugin sources require source_vars with the plugin configuration")
+		}
+		if plugin, _ := config["plugin"].(string); plugin == "" {
+			return fmt.Errorf("source_vars must name the inventory plugin in \"plugin\"")
+		}
+		s.SourceProjectID, s.SourcePath, s.SourceScript = nil, nil, nil
+	default:
+		return fmt.Errorf("source must be one of %s, %s or %s", models.InventorySourceScript, models.InventorySourceSCM, models.InventorySourcePlugin)
+	}
+	return nil
+}
+
+// nullableJSON maps an absent JSON value to SQL NULL.
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
@@ -3,18 +3,24 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/content"
 	"github.com/praetordev/praetor/pkg/models"
 )
 
 type JobsResource struct {
-	DB *sqlx.DB
+	DB        *sqlx.DB
+	Artifacts content.Store // Optional; holds the artifact archives of runs
 }
 
 func NewJobsResource(db *sqlx.DB) *JobsResource {
@@ -26,6 +32,9 @@ func (rs *JobsResource) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Get("/", rs.ListUnifiedJobs)
 	r.Post("/", rs.LaunchJob)
+	r.Delete("/{id}", rs.DeleteJob)
+	r.Get("/{id}/artifacts", rs.GetJobArtifacts)
+	r.Get("/{id}/artifacts/archive", rs.DownloadJobArtifacts)
 	r.Get("/runs/{runID}", rs.GetExecutionRun)
 	r.Get("/runs/{runID}/events", rs.ListJobEvents)
 	return r
@@ -75,6 +84,126 @@ func (rs *JobsResource) LaunchJob(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, map[string]interface{}{"id": jobID, "status": "pending"})
 }
 
+// GetJobArtifacts returns what the last run of a job left in its artifacts
+// directory, including the data the playbook set with set_stats
+func (rs *JobsResource) GetJobArtifacts(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	var artifacts models.JobArtifacts
+	err = rs.DB.GetContext(r.Context(), &artifacts, `SELECT * FROM job_artifacts WHERE unified_job_id = $1`, id)
+	if err == sql.ErrNoRows {
+		render.Render(w, r, ErrNotFound)
+		return
+	} else if err != nil {
+		render.Render(w, r, ErrInternal(err))
+		return
+	}
+
+	render.JSON(w, r, artifacts)
+}
+
+// DownloadJobArtifacts streams the tarball of the artifacts directory of the
+// last run of a job
+func (rs *JobsResource) DownloadJobArtifacts(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	var archive sql.NullString
+	err = rs.DB.GetContext(r.Context(), &archive, `SELECT archive FROM job_artifacts WHERE unified_job_id = $1`, id)
+	if err == sql.ErrNoRows || (err == nil && !archive.Valid) {
+		render.Render(w, r, ErrNotFound)
+		return
+	} else if err != nil {
+		render.Render(w, r, ErrInternal(err))
+		return
+	}
+	if rs.Artifacts == nil {
+		render.Render(w, r, ErrInternal(fmt.Errorf("job artifact store unavailable")))
+		return
+	}
+
+	rc, err := rs.Artifacts.Get(r.Context(), archive.String)
+	if err == content.ErrNotFound {
+		render.Render(w, r, ErrNotFound)
+		return
+	} else if err != nil {
+		render.Render(w, r, ErrInternal(err))
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="job-%d-artifacts.tar.gz"`, id))
+	if _, err := io.Copy(w, rc); err != nil {
+		log.Printf("Failed to stream artifact archive %s: %v", archive.String, err)
+	}
+}
+
+// DeleteJob deletes a finished job with its runs, events and artifacts
+func (rs *JobsResource) DeleteJob(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	tx, err := rs.DB.BeginTxx(r.Context(), nil)
+	if err != nil {
+		render.Render(w, r, ErrInternal(err))
+		return
+	}
+	defer tx.Rollback()
+
+	var job struct {
+		Status  string         `db:"status"`
+		Archive sql.NullString `db:"archive"`
+	}
+	err = tx.GetContext(r.Context(), &job, `
+		SELECT uj.status, ja.archive FROM unified_jobs uj
+		LEFT JOIN job_artifacts ja ON ja.unified_job_id = uj.id
+		WHERE uj.id = $1
+		FOR UPDATE OF uj`, id)
+	if err == sql.ErrNoRows {
+		render.Render(w, r, ErrNotFound)
+		return
+	} else if err != nil {
+		render.Render(w, r, ErrInternal(err))
+		return
+	}
+	switch job.Status {
+	case "successful", "failed", "canceled", "error":
+	default:
+		render.Render(w, r, ErrInvalidRequest(fmt.Errorf("job %d is %s; only finished jobs can be deleted", id, job.Status)))
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM unified_jobs WHERE id = $1`, id); err != nil {
+		render.Render(w, r, ErrInternal(err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		render.Render(w, r, ErrInternal(err))
+		return
+	}
+
+	if job.Archive.Valid && rs.Artifacts != nil {
+		if err := rs.Artifacts.Delete(r.Context(), job.Archive.String); err != nil {
+			log.Printf("Failed to delete artifact archive %s of job %d: %v", job.Archive.String, id, err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // GetExecutionRun returns details of a specific execution run
 func (rs *JobsResource) GetExecutionRun(w http.ResponseWriter, r *http.Request) {
 	runIDStr := chi.URLParam(r, "runID")
@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/praetordev/praetor/pkg/inventory"
 	"github.com/praetordev/praetor/pkg/models"
 	"github.com/praetordev/praetor/services/api/render"
 )
@@ -54,10 +60,18 @@ func (h *ContentHandler) CreateOrganization(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// A new organization can only default to a global environment
+	if input.DefaultEnvironmentID != nil {
+		if err := checkExecutionEnvironment(r.Context(), h.DB, *input.DefaultEnvironmentID, 0); err != nil {
+			render.ErrInvalidRequest(err).Render(w, r)
+			return
+		}
+	}
+
 	// Simple insert
 	query := `
-		INSERT INTO organizations (name, description) 
-		VALUES (:name, :description) 
+		INSERT INTO organizations (name, description, default_environment_id) 
+		VALUES (:name, :description, :default_environment_id) 
 		RETURNING *`
 
 	rows, err := h.DB.NamedQuery(query, input)
@@ -78,3 +92,215 @@ func (h *ContentHandler) CreateOrganization(w http.ResponseWriter, r *http.Reque
 		render.ErrInternal(nil).Render(w, r)
 	}
 }
+
+// ListGalaxyCredentials GET /api/v1/organizations/{id}/galaxy-credentials
+// Returns the organization's Galaxy credentials in the order project syncs
+// try them. Only these servers may be used to install requirements.
+func (h *ContentHandler) ListGalaxyCredentials(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var creds []models.Credential
+	err = h.DB.SelectContext(r.Context(), &creds, `
+		SELECT c.* FROM organization_galaxy_credentials ogc
+		JOIN credentials c ON c.id = ogc.credential_id
+		WHERE ogc.organization_id = $1
+		ORDER BY ogc.position`, id)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if creds == nil {
+		creds = []models.Credential{}
+	}
+
+	// Tokens are never returned
+	for i := range creds {
+		creds[i].Inputs = nil
+	}
+	render.JSON(w, r, &render.PaginatedResponse{
+		Items: creds,
+		Total: int64(len(creds)),
+		Limit: len(creds),
+	})
+}
+
+// SetGalaxyCredentials PUT /api/v1/organizations/{id}/galaxy-credentials
+// Replaces the organization's ordered list of Galaxy credentials.
+func (h *ContentHandler) SetGalaxyCredentials(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var input struct {
+		CredentialIDs []int64 `json:"credential_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	tx, err := h.DB.BeginTxx(r.Context(), nil)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.GetContext(r.Context(), &exists, "SELECT EXISTS(SELECT 1 FROM organizations WHERE id = $1)", id); err != nil || !exists {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), "DELETE FROM organization_galaxy_credentials WHERE organization_id = $1", id); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	for pos, credID := range input.CredentialIDs {
+		var typeName string
+		err := tx.GetContext(r.Context(), &typeName, `
+			SELECT ct.name FROM credentials c JOIN credential_types ct ON ct.id = c.credential_type_id
+			WHERE c.id = $1 AND c.organization_id = $2`, credID, id)
+		if err != nil {
+			render.ErrInvalidRequest(fmt.Errorf("credential %d not found in organization %d", credID, id)).Render(w, r)
+			return
+		}
+		if typeName != models.CredentialTypeGalaxy {
+			render.ErrInvalidRequest(fmt.Errorf("credential %d is a %s credential, not %s", credID, typeName, models.CredentialTypeGalaxy)).Render(w, r)
+			return
+		}
+		_, err = tx.ExecContext(r.Context(), `
+			INSERT INTO organization_galaxy_credentials (organization_id, credential_id, position)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (organization_id, credential_id) DO NOTHING`, id, credID, pos)
+		if err != nil {
+			render.ErrInternal(err).Render(w, r)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	h.ListGalaxyCredentials(w, r)
+}
+
+// variablePolicyResponse describes an organization's sensitive variable keys.
+type variablePolicyResponse struct {
+	SensitiveVariableKeys []string `json:"sensitive_variable_keys"`
+	Default               bool     `json:"default"` // The organization uses the built-in keys
+}
+
+// GetVariablePolicy GET /api/v1/organizations/{id}/variable-policy
+// Returns the variable key patterns whose values are masked in API responses
+// and logs.
+func (h *ContentHandler) GetVariablePolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var keys pq.StringArray
+	if err := h.DB.GetContext(r.Context(), &keys, "SELECT sensitive_variable_keys FROM organizations WHERE id = $1", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+	policy, err := inventory.NewVariablePolicy(keys)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, variablePolicyResponse{SensitiveVariableKeys: policy.SensitiveKeys, Default: keys == nil})
+}
+
+// SetVariablePolicy PUT /api/v1/organizations/{id}/variable-policy
+// Replaces the organization's sensitive variable key patterns. Null restores
+// the built-in defaults and an empty list masks nothing.
+func (h *ContentHandler) SetVariablePolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var input struct {
+		SensitiveVariableKeys []string `json:"sensitive_variable_keys"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	policy, err := inventory.NewVariablePolicy(input.SensitiveVariableKeys)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var keys interface{}
+	if input.SensitiveVariableKeys != nil {
+		keys = pq.Array(policy.SensitiveKeys)
+	}
+	res, err := h.DB.ExecContext(r.Context(), `
+		UPDATE organizations SET sensitive_variable_keys = $2, modified_at = now()
+		WHERE id = $1`, id, keys)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, variablePolicyResponse{SensitiveVariableKeys: policy.SensitiveKeys, Default: input.SensitiveVariableKeys == nil})
+}
+
+// SetDefaultEnvironment PUT /api/v1/organizations/{id}/default-environment
+// Sets the execution environment jobs of the organization run in when neither
+// their template nor their project picks one. Null falls back to the global
+// default.
+func (h *ContentHandler) SetDefaultEnvironment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var input struct {
+		DefaultEnvironmentID *int64 `json:"default_environment_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	if input.DefaultEnvironmentID != nil {
+		if err := checkExecutionEnvironment(r.Context(), h.DB, *input.DefaultEnvironmentID, id); err != nil {
+			render.ErrInvalidRequest(err).Render(w, r)
+			return
+		}
+	}
+
+	var updated models.Organization
+	err = h.DB.GetContext(r.Context(), &updated, `
+		UPDATE organizations SET default_environment_id = $2, modified_at = now()
+		WHERE id = $1
+		RETURNING *`, id, input.DefaultEnvironmentID)
+	if err == sql.ErrNoRows {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	} else if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, updated)
+}
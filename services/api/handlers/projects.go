@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
-	"os/exec"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/praetordev/praetor/pkg/models"
@@ -57,12 +60,24 @@ func (h *ContentHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
 
 	// Default SCM Type
 	if input.SCMType == "" {
-		input.SCMType = "git"
+		input.SCMType = models.SCMTypeGit
+	}
+	if err := h.validateProjectSource(r.Context(), &input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	if input.DefaultEnvironmentID != nil {
+		if err := checkExecutionEnvironment(r.Context(), h.DB, *input.DefaultEnvironmentID, input.OrganizationID); err != nil {
+			render.ErrInvalidRequest(err).Render(w, r)
+			return
+		}
 	}
 
 	query := `
-		INSERT INTO projects (organization_id, name, description, scm_type, scm_url, scm_branch) 
-		VALUES (:organization_id, :name, :description, :scm_type, :scm_url, :scm_branch) 
+		INSERT INTO projects (organization_id, name, description, scm_type, scm_url, scm_branch,
+			scm_submodules, scm_lfs, scm_checksum, credential_id, default_environment_id) 
+		VALUES (:organization_id, :name, :description, :scm_type, :scm_url, :scm_branch,
+			:scm_submodules, :scm_lfs, :scm_checksum, :credential_id, :default_environment_id) 
 		RETURNING *`
 
 	rows, err := h.DB.NamedQuery(query, input)
@@ -84,7 +99,151 @@ func (h *ContentHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// validateProjectSource checks the SCM options against the project type and
+// makes sure the credential, if any, is a Source Control credential.
+func (h *ContentHandler) validateProjectSource(ctx context.Context, p *models.Project) error {
+	switch p.SCMType {
+	case models.SCMTypeGit:
+		if p.SCMChecksum != nil {
+			return fmt.Errorf("scm_checksum only applies to archive projects")
+		}
+	case models.SCMTypeArchive:
+		if !strings.HasPrefix(p.SCMURL, "http://") && !strings.HasPrefix(p.SCMURL, "https://") {
+			return fmt.Errorf("archive projects need an http(s) scm_url")
+		}
+		if p.SCMChecksum != nil && !sha256Digest.MatchString(*p.SCMChecksum) {
+			return fmt.Errorf("scm_checksum must be sha256:<64 hex digits>")
+		}
+	case models.SCMTypeManual:
+		if filepath.IsAbs(p.SCMURL) || strings.Contains(p.SCMURL, "..") {
+			return fmt.Errorf("manual projects need scm_url relative to the executor projects root")
+		}
+		if p.CredentialID != nil {
+			return fmt.Errorf("manual projects do not use a credential")
+		}
+	default:
+		return fmt.Errorf("unsupported scm_type %q (expected git, archive or manual)", p.SCMType)
+	}
+	if p.SCMType != models.SCMTypeGit && (p.SCMSubmodules || p.SCMLFS || p.SCMBranch != nil) {
+		return fmt.Errorf("scm_branch, scm_submodules and scm_lfs only apply to git projects")
+	}
+	if p.SCMBranch != nil && *p.SCMBranch != "" {
+		if err := checkRefFormat(*p.SCMBranch); err != nil {
+			return fmt.Errorf("invalid scm_branch %q: %w", *p.SCMBranch, err)
+		}
+	}
+
+	if p.CredentialID != nil {
+		var typeName string
+		err := h.DB.GetContext(ctx, &typeName, `
+			SELECT ct.name FROM credentials c JOIN credential_types ct ON ct.id = c.credential_type_id
+			WHERE c.id = $1`, *p.CredentialID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("credential %d not found", *p.CredentialID)
+		}
+		if err != nil {
+			return err
+		}
+		if typeName != models.CredentialTypeSourceControl {
+			return fmt.Errorf("credential %d is a %s credential, not %s", *p.CredentialID, typeName, models.CredentialTypeSourceControl)
+		}
+	}
+	return nil
+}
+
+var sha256Digest = regexp.MustCompile(`^sha256:[0-9a-fA-F]{64}$`)
+
+// checkRefFormat applies the rules of git check-ref-format to a branch, tag
+// or commit SHA. Refs starting with "-" are rejected so git never reads one
+// as an option.
+func checkRefFormat(ref string) error {
+	switch {
+	case strings.HasPrefix(ref, "-"):
+		return fmt.Errorf("must not start with -")
+	case ref == "@" || strings.HasPrefix(ref, "/") || strings.HasSuffix(ref, "/") || strings.HasSuffix(ref, "."):
+		return fmt.Errorf("not a valid ref name")
+	case strings.Contains(ref, "..") || strings.Contains(ref, "@{") || strings.Contains(ref, "//"):
+		return fmt.Errorf("must not contain \"..\", \"@{\" or \"//\"")
+	}
+	for _, c := range ref {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return fmt.Errorf("must not contain %q", c)
+		}
+	}
+	for _, part := range strings.Split(ref, "/") {
+		if strings.HasPrefix(part, ".") || strings.HasSuffix(part, ".lock") {
+			return fmt.Errorf("components must not start with . or end with .lock")
+		}
+	}
+	return nil
+}
+
+// GetProject GET /api/v1/projects/{id}
+func (h *ContentHandler) GetProject(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var project models.Project
+	if err := h.DB.GetContext(r.Context(), &project, "SELECT * FROM projects WHERE id = $1", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, project)
+}
+
+// ListProjectPlaybooks GET /api/v1/projects/{id}/playbooks
+// Lists the playbooks detected in the project's last synced revision.
+func (h *ContentHandler) ListProjectPlaybooks(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var project models.Project
+	if err := h.DB.GetContext(r.Context(), &project, "SELECT * FROM projects WHERE id = $1", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	playbooks, err := projectPlaybooks(project)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"project_id":   project.ID,
+		"scm_revision": project.SCMRevision,
+		"playbooks":    playbooks,
+	})
+}
+
+// projectPlaybooks returns the playbooks detected in the project's last synced
+// revision. It fails if the project has never been synced.
+func projectPlaybooks(project models.Project) ([]string, error) {
+	if project.SCMRevision == nil {
+		return nil, fmt.Errorf("project %s has not been synced yet", project.Name)
+	}
+	playbooks := []string{}
+	if len(project.Playbooks) > 0 {
+		if err := json.Unmarshal(project.Playbooks, &playbooks); err != nil {
+			return nil, err
+		}
+	}
+	return playbooks, nil
+}
+
 // SyncProject POST /api/v1/projects/{id}/sync
+// Queues a project update job. The executor checks out the project and the
+// resulting commit SHA is recorded as the project's scm_revision. If an update
+// is already in progress, that job is returned instead of queueing another.
 func (h *ContentHandler) SyncProject(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -93,47 +252,90 @@ func (h *ContentHandler) SyncProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tx, err := h.DB.BeginTxx(r.Context(), nil)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the project row so concurrent sync requests queue a single update
 	var project models.Project
-	if err := h.DB.Get(&project, "SELECT * FROM projects WHERE id = $1", id); err != nil {
-		render.ErrInvalidRequest(err).Render(w, r)
+	if err := tx.GetContext(r.Context(), &project, "SELECT * FROM projects WHERE id = $1 FOR UPDATE", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	var active models.UnifiedJob
+	err = tx.GetContext(r.Context(), &active, `
+		SELECT * FROM unified_jobs
+		WHERE kind = 'project_update' AND unified_job_template_id = $1
+		  AND status IN ('pending', 'queued', 'running')
+		ORDER BY id DESC LIMIT 1`, id)
+	if err == nil {
+		render.Accepted(w, r, active)
+		return
+	} else if err != sql.ErrNoRows {
+		render.ErrInternal(err).Render(w, r)
 		return
 	}
 
-	// Create temp directory
-	tmpDir, err := os.MkdirTemp("", "project_sync_")
+	var job models.UnifiedJob
+	err = tx.QueryRowxContext(r.Context(), `
+		INSERT INTO unified_jobs (name, unified_job_template_id, kind, status)
+		VALUES ($1, $2, 'project_update', 'pending')
+		RETURNING *`,
+		fmt.Sprintf("%s - project update", project.Name), id,
+	).StructScan(&job)
 	if err != nil {
 		render.ErrInternal(err).Render(w, r)
 		return
 	}
-	defer os.RemoveAll(tmpDir)
 
-	// Clone repo to verify access
-	cmd := exec.Command("git", "clone", "--depth", "1", project.SCMURL, tmpDir)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		render.JSON(w, r, map[string]interface{}{
-			"success": false,
-			"error":   fmt.Sprintf("git clone failed: %v\nOutput: %s", err, string(output)),
-		})
+	if _, err := tx.ExecContext(r.Context(), "UPDATE projects SET last_update_job_id = $1 WHERE id = $2", job.ID, id); err != nil {
+		render.ErrInternal(err).Render(w, r)
 		return
 	}
 
-	// Get Commit Hash
-	cmdRev := exec.Command("git", "-C", tmpDir, "rev-parse", "--short", "HEAD")
-	revOutput, _ := cmdRev.Output()
-	revision := string(revOutput)
+	if err := tx.Commit(); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
 
-	// Get Commit Message
-	cmdMsg := exec.Command("git", "-C", tmpDir, "log", "-1", "--pretty=%s")
-	msgOutput, _ := cmdMsg.Output()
-	message := string(msgOutput)
+	render.Accepted(w, r, job)
+}
 
-	// Update modified_at to signal sync
-	_, _ = h.DB.Exec("UPDATE projects SET modified_at = NOW() WHERE id = $1", id)
+// ListProjectUpdates GET /api/v1/projects/{id}/updates
+func (h *ContentHandler) ListProjectUpdates(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+	pg := render.ParsePagination(r)
 
-	render.JSON(w, r, map[string]interface{}{
-		"success":    true,
-		"message":    "Project synced successfully",
-		"revision":   revision,
-		"commit_msg": message,
+	var updates []models.UnifiedJob
+	query := `
+		SELECT * FROM unified_jobs
+		WHERE kind = 'project_update' AND unified_job_template_id = $1
+		ORDER BY id DESC LIMIT $2 OFFSET $3`
+	if err := h.DB.SelectContext(r.Context(), &updates, query, id, pg.Limit, pg.Offset); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	var total int64
+	_ = h.DB.Get(&total, "SELECT count(*) FROM unified_jobs WHERE kind = 'project_update' AND unified_job_template_id = $1", id)
+
+	if updates == nil {
+		updates = []models.UnifiedJob{}
+	}
+
+	render.JSON(w, r, &render.PaginatedResponse{
+		Items:  updates,
+		Total:  total,
+		Limit:  pg.Limit,
+		Offset: pg.Offset,
 	})
 }
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/models"
+	"github.com/praetordev/praetor/services/api/render"
+)
+
+// SchedulesResource handles schedules that launch jobs and updates periodically
+type SchedulesResource struct {
+	DB *sqlx.DB
+}
+
+// NewSchedulesResource creates a new schedules resource handler
+func NewSchedulesResource(db *sqlx.DB) *SchedulesResource {
+	return &SchedulesResource{DB: db}
+}
+
+// Routes creates a REST router for schedules
+func (rs *SchedulesResource) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", rs.ListSchedules)
+	r.Post("/", rs.CreateSchedule)
+	r.Get("/{id}", rs.GetSchedule)
+	r.Put("/{id}", rs.UpdateSchedule)
+	r.Delete("/{id}", rs.DeleteSchedule)
+	return r
+}
+
+// ListSchedules GET /api/v1/schedules
+func (rs *SchedulesResource) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	pg := render.ParsePagination(r)
+
+	var schedules []models.Schedule
+	query := `SELECT * FROM schedules ORDER BY id DESC LIMIT $1 OFFSET $2`
+	if err := rs.DB.SelectContext(r.Context(), &schedules, query, pg.Limit, pg.Offset); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	var total int64
+	_ = rs.DB.Get(&total, "SELECT count(*) FROM schedules")
+
+	if schedules == nil {
+		schedules = []models.Schedule{}
+	}
+
+	render.JSON(w, r, &render.PaginatedResponse{
+		Items:  schedules,
+		Total:  total,
+		Limit:  pg.Limit,
+		Offset: pg.Offset,
+	})
+}
+
+// scheduleRequest is the body of a schedule create or update. NextRunAt
+// defaults to now, so a new schedule runs on the scheduler's next tick.
+type scheduleRequest struct {
+	Name                 string     `json:"name"`
+	Kind                 string     `json:"kind"`
+	UnifiedJobTemplateID int64      `json:"unified_job_template_id"`
+	IntervalSeconds      int        `json:"interval_seconds"`
+	Enabled              *bool      `json:"enabled"`
+	NextRunAt            *time.Time `json:"next_run_at"`
+}
+
+// decodeSchedule reads and validates a schedule request, checking that the
+// template it launches exists.
+func (rs *SchedulesResource) decodeSchedule(r *http.Request) (*scheduleRequest, error) {
+	var input scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, err
+	}
+	if input.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if input.IntervalSeconds <= 0 {
+		return nil, fmt.Errorf("interval_seconds must be positive")
+	}
+	if input.Enabled == nil {
+		enabled := true
+		input.Enabled = &enabled
+	}
+	if input.NextRunAt == nil {
+		now := time.Now()
+		input.NextRunAt = &now
+	}
+
+	table, ok := models.UnifiedJobTemplateTables[input.Kind]
+	if !ok {
+		return nil, fmt.Errorf("kind must be one of %s, %s or %s",
+			models.UnifiedJobKindJob, models.UnifiedJobKindProjectUpdate, models.UnifiedJobKindInventoryUpdate)
+	}
+	var exists bool
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1)", table)
+	if err := rs.DB.GetContext(r.Context(), &exists, query, input.UnifiedJobTemplateID); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%s %d does not exist", table, input.UnifiedJobTemplateID)
+	}
+	return &input, nil
+}
+
+// CreateSchedule POST /api/v1/schedules
+func (rs *SchedulesResource) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	input, err := rs.decodeSchedule(r)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	query := `
+		INSERT INTO schedules (name, kind, unified_job_template_id, interval_seconds, enabled, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING *`
+
+	var created models.Schedule
+	err = rs.DB.QueryRowxContext(r.Context(), query,
+		input.Name, input.Kind, input.UnifiedJobTemplateID, input.IntervalSeconds, *input.Enabled, *input.NextRunAt,
+	).StructScan(&created)
+	if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	render.Created(w, r, created)
+}
+
+// GetSchedule GET /api/v1/schedules/{id}
+func (rs *SchedulesResource) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	var schedule models.Schedule
+	if err := rs.DB.GetContext(r.Context(), &schedule, "SELECT * FROM schedules WHERE id = $1", id); err != nil {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, schedule)
+}
+
+// UpdateSchedule PUT /api/v1/schedules/{id}
+func (rs *SchedulesResource) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	input, err := rs.decodeSchedule(r)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	query := `
+		UPDATE schedules
+		SET name = $2, kind = $3, unified_job_template_id = $4, interval_seconds = $5,
+		    enabled = $6, next_run_at = $7, modified_at = now()
+		WHERE id = $1
+		RETURNING *`
+
+	var updated models.Schedule
+	err = rs.DB.QueryRowxContext(r.Context(), query,
+		id, input.Name, input.Kind, input.UnifiedJobTemplateID, input.IntervalSeconds, *input.Enabled, *input.NextRunAt,
+	).StructScan(&updated)
+	if err == sql.ErrNoRows {
+		render.ErrNotFound(nil).Render(w, r)
+		return
+	} else if err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	render.JSON(w, r, updated)
+}
+
+// DeleteSchedule DELETE /api/v1/schedules/{id}
+func (rs *SchedulesResource) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	if _, err := rs.DB.ExecContext(r.Context(), "DELETE FROM schedules WHERE id = $1", id); err != nil {
+		render.ErrInternal(err).Render(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -84,21 +86,39 @@ func (rs *TemplatesResource) CreateTemplate(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if err := rs.validatePlaybook(r, input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	if input.ExecutionEnvironmentID != nil {
+		if err := checkExecutionEnvironment(r.Context(), rs.DB, *input.ExecutionEnvironmentID, input.OrganizationID); err != nil {
+			render.ErrInvalidRequest(err).Render(w, r)
+			return
+		}
+	}
+	if err := checkResourceClass(r.Context(), rs.DB, input.InstanceGroupID, input.ResourceClass); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
 	// Default job type
 	if input.JobType == "" {
 		input.JobType = "run"
 	}
 
 	query := `
-		INSERT INTO job_templates (organization_id, name, description, playbook, playbook_content, project_id, inventory_id, job_type, verbosity) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) 
+		INSERT INTO job_templates (organization_id, name, description, playbook, playbook_content, project_id, inventory_id, job_type, verbosity, use_fact_cache, execution_environment_id,
+			instance_group_id, resource_class) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) 
 		RETURNING *`
 
 	var created models.JobTemplate
 	err := rs.DB.QueryRowxContext(r.Context(), query,
 		input.OrganizationID, input.Name, input.Description,
 		input.Playbook, input.PlaybookContent, input.ProjectID, input.InventoryID,
-		input.JobType, input.Verbosity,
+		input.JobType, input.Verbosity, input.UseFactCache, input.ExecutionEnvironmentID,
+		input.InstanceGroupID, input.ResourceClass,
 	).StructScan(&created)
 
 	if err != nil {
@@ -144,17 +164,40 @@ func (rs *TemplatesResource) UpdateTemplate(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if err := rs.validatePlaybook(r, input); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
+	if input.ExecutionEnvironmentID != nil {
+		var orgID int64
+		if err := rs.DB.GetContext(r.Context(), &orgID, "SELECT organization_id FROM job_templates WHERE id = $1", id); err != nil {
+			render.ErrNotFound(nil).Render(w, r)
+			return
+		}
+		if err := checkExecutionEnvironment(r.Context(), rs.DB, *input.ExecutionEnvironmentID, orgID); err != nil {
+			render.ErrInvalidRequest(err).Render(w, r)
+			return
+		}
+	}
+	if err := checkResourceClass(r.Context(), rs.DB, input.InstanceGroupID, input.ResourceClass); err != nil {
+		render.ErrInvalidRequest(err).Render(w, r)
+		return
+	}
+
 	query := `
 		UPDATE job_templates 
 		SET name = $2, description = $3, playbook = $4, playbook_content = $5, 
-		    project_id = $6, verbosity = $7, inventory_id = $8, modified_at = now()
+		    project_id = $6, verbosity = $7, inventory_id = $8, use_fact_cache = $9,
+		    execution_environment_id = $10, instance_group_id = $11, resource_class = $12, modified_at = now()
 		WHERE id = $1 
 		RETURNING *`
 
 	var updated models.JobTemplate
 	err = rs.DB.QueryRowxContext(r.Context(), query,
 		id, input.Name, input.Description, input.Playbook,
-		input.PlaybookContent, input.ProjectID, input.Verbosity, input.InventoryID,
+		input.PlaybookContent, input.ProjectID, input.Verbosity, input.InventoryID, input.UseFactCache,
+		input.ExecutionEnvironmentID, input.InstanceGroupID, input.ResourceClass,
 	).StructScan(&updated)
 
 	if err != nil {
@@ -183,3 +226,34 @@ func (rs *TemplatesResource) DeleteTemplate(w http.ResponseWriter, r *http.Reque
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// validatePlaybook checks that a template's playbook exists in the last synced
+// revision of its project. Templates with inline playbook content are not checked.
+func (rs *TemplatesResource) validatePlaybook(r *http.Request, t models.JobTemplate) error {
+	if t.ProjectID == nil || t.PlaybookContent != nil {
+		return nil
+	}
+	if t.Playbook == "" {
+		return fmt.Errorf("playbook is required for templates with a project")
+	}
+
+	var project models.Project
+	err := rs.DB.GetContext(r.Context(), &project, "SELECT * FROM projects WHERE id = $1", *t.ProjectID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("project %d not found", *t.ProjectID)
+	}
+	if err != nil {
+		return err
+	}
+
+	playbooks, err := projectPlaybooks(project)
+	if err != nil {
+		return fmt.Errorf("%w; sync the project before choosing a playbook", err)
+	}
+	for _, p := range playbooks {
+		if p == t.Playbook {
+			return nil
+		}
+	}
+	return fmt.Errorf("playbook %q not found in project %s at revision %s", t.Playbook, project.Name, *project.SCMRevision)
+}
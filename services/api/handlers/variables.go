@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/inventory"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// variablePolicy returns the variable policy of the organization that owns
+// the inventory.
+func variablePolicy(ctx context.Context, q sqlx.QueryerContext, inventoryID int64) (*inventory.VariablePolicy, error) {
+	var orgID int64
+	if err := sqlx.GetContext(ctx, q, &orgID, "SELECT organization_id FROM inventories WHERE id = $1", inventoryID); err != nil {
+		return nil, fmt.Errorf("failed to fetch inventory %d: %w", inventoryID, err)
+	}
+	return inventory.LoadVariablePolicy(ctx, q, orgID)
+}
+
+// updatedVariables parses the variables sent in an update, keeping the
+// stored values of sensitive variables that were sent back masked.
+func updatedVariables(p *inventory.VariablePolicy, raw, stored json.RawMessage) (json.RawMessage, error) {
+	vars, err := inventory.ParseVariables(raw)
+	if err != nil {
+		return nil, err
+	}
+	return p.UnmaskJSON(vars, stored)
+}
+
+func maskHosts(p *inventory.VariablePolicy, hosts []models.Host) {
+	for i := range hosts {
+		hosts[i].Variables = p.MaskJSON(hosts[i].Variables)
+	}
+}
+
+func maskGroups(p *inventory.VariablePolicy, groups []models.Group) {
+	for i := range groups {
+		groups[i].Variables = p.MaskJSON(groups[i].Variables)
+	}
+}
@@ -60,24 +60,49 @@ func Created(w http.ResponseWriter, r *http.Request, v interface{}) {
 	render.JSON(w, r, v)
 }
 
+// Accepted responds with 202 Accepted and the payload.
+func Accepted(w http.ResponseWriter, r *http.Request, v interface{}) {
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, v)
+}
+
 // ErrorResponse represents a standard error.
 type ErrorResponse struct {
 	Err            error `json:"-"` // low-level runtime error
 	HTTPStatusCode int   `json:"-"` // http response status code
 
-	ErrorText string `json:"error"` // user-facing error message
+	ErrorText string      `json:"error"`             // user-facing error message
+	Details   interface{} `json:"details,omitempty"` // per-item errors, if any
 }
 
+// Render writes the error response. Handlers call it directly, e.g.
+// render.ErrInvalidRequest(err).Render(w, r).
 func (e *ErrorResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	render.Status(r, e.HTTPStatusCode)
+	render.JSON(w, r, e)
 	return nil
 }
 
 func ErrInvalidRequest(err error) render.Renderer {
+	text := "Invalid request"
+	if err != nil {
+		text = err.Error()
+	}
+	return &ErrorResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusBadRequest,
+		ErrorText:      text,
+	}
+}
+
+// ErrInvalidItems responds with 400 Bad Request for a request whose items
+// failed validation, listing the failures in details.
+func ErrInvalidItems(err error, details interface{}) render.Renderer {
 	return &ErrorResponse{
 		Err:            err,
 		HTTPStatusCode: http.StatusBadRequest,
 		ErrorText:      err.Error(),
+		Details:        details,
 	}
 }
 
@@ -8,13 +8,15 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/go-chi/render"
 	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/content"
 	"github.com/praetordev/praetor/services/api/handlers"
 	modelAuth "github.com/praetordev/praetor/services/api/middleware"
 	praetorRender "github.com/praetordev/praetor/services/api/render"
 )
 
-// NewRouter instantiates the chi Router and wires middleware.
-func NewRouter(db *sqlx.DB) *chi.Mux {
+// NewRouter instantiates the chi Router and wires middleware. artifacts is
+// the store of job artifact archives; nil leaves them unavailable.
+func NewRouter(db *sqlx.DB, artifacts content.Store) *chi.Mux {
 	r := chi.NewRouter()
 
 	// Base Middleware
@@ -49,35 +51,61 @@ func NewRouter(db *sqlx.DB) *chi.Mux {
 
 		r.Get("/organizations", content.ListOrganizations)
 		r.Post("/organizations", content.CreateOrganization)
+		r.Get("/organizations/{id}/galaxy-credentials", content.ListGalaxyCredentials)
+		r.Put("/organizations/{id}/galaxy-credentials", content.SetGalaxyCredentials)
+		r.Get("/organizations/{id}/variable-policy", content.GetVariablePolicy)
+		r.Put("/organizations/{id}/variable-policy", content.SetVariablePolicy)
+		r.Put("/organizations/{id}/default-environment", content.SetDefaultEnvironment)
 
 		r.Get("/users", content.ListUsers)
 		r.Post("/users", content.CreateUser)
 
 		r.Get("/projects", content.ListProjects)
 		r.Post("/projects", content.CreateProject)
+		r.Get("/projects/{id}", content.GetProject)
 		r.Post("/projects/{id}/sync", content.SyncProject)
+		r.Get("/projects/{id}/updates", content.ListProjectUpdates)
+		r.Get("/projects/{id}/playbooks", content.ListProjectPlaybooks)
+
+		credentials := handlers.NewCredentialsResource(db)
+		r.Mount("/credentials", credentials.Routes())
+		r.Get("/credential-types", credentials.ListCredentialTypes)
 
 		jobs := handlers.NewJobsResource(db)
+		jobs.Artifacts = artifacts
 		r.Mount("/jobs", jobs.Routes())
 
+		executionEnvironments := handlers.NewExecutionEnvironmentsResource(db)
+		r.Mount("/execution_environments", executionEnvironments.Routes())
+
+		instanceGroups := handlers.NewInstanceGroupsResource(db)
+		r.Mount("/instance_groups", instanceGroups.Routes())
+
 		templates := handlers.NewTemplatesResource(db)
 		r.Mount("/job-templates", templates.Routes())
 
-		inventories := handlers.NewInventoriesResource(db)
-		r.Mount("/inventories", inventories.Routes())
-
-		// Nested hosts/groups under inventories
+		// Hosts and groups are nested under inventories
 		hosts := handlers.NewHostsResource(db)
 		groups := handlers.NewGroupsResource(db)
 
-		r.Route("/inventories/{inventoryId}", func(r chi.Router) {
+		inventories := handlers.NewInventoriesResource(db)
+		r.Mount("/inventories", inventories.Routes(func(r chi.Router) {
 			r.Mount("/hosts", hosts.Routes())
 			r.Mount("/groups", groups.Routes())
-		})
+		}))
 
 		// Direct access to hosts and groups by ID
 		r.Mount("/hosts", hosts.HostRoutes())
 		r.Mount("/groups", groups.GroupRoutes())
+
+		inventorySources := handlers.NewInventorySourcesResource(db)
+		r.Mount("/inventory-sources", inventorySources.Routes())
+
+		schedules := handlers.NewSchedulesResource(db)
+		r.Mount("/schedules", schedules.Routes())
+
+		bulk := handlers.NewBulkResource(db)
+		r.Mount("/bulk", bulk.Routes())
 	})
 
 	return r
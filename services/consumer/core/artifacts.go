@@ -0,0 +1,57 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+// recordArtifacts stores the artifacts a run reported as those of its job,
+// replacing the ones of an earlier attempt, and returns the archive of those
+// it replaced. The stored event keeps only a summary.
+func (w *DBWriter) recordArtifacts(ctx context.Context, tx *sqlx.Tx, evt events.JobEvent) (string, error) {
+	var data events.JobArtifacts
+	if len(evt.EventData) == 0 || json.Unmarshal(evt.EventData, &data) != nil {
+		return "", nil
+	}
+
+	var replaced string
+	err := tx.GetContext(ctx, &replaced, `
+		SELECT COALESCE(archive, '') FROM job_artifacts WHERE unified_job_id = $1 FOR UPDATE`, evt.UnifiedJobID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if replaced == data.Archive {
+		replaced = ""
+	}
+
+	artifactData := "{}"
+	if len(data.ArtifactData) > 0 {
+		artifactData = string(data.ArtifactData)
+	}
+	var archive *string
+	if data.Archive != "" {
+		archive = &data.Archive
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO job_artifacts (unified_job_id, execution_run_id, artifact_data, rc, status, archive, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (unified_job_id) DO UPDATE
+		SET execution_run_id = EXCLUDED.execution_run_id, artifact_data = EXCLUDED.artifact_data,
+			rc = EXCLUDED.rc, status = EXCLUDED.status, archive = EXCLUDED.archive, created_at = EXCLUDED.created_at`,
+		evt.UnifiedJobID, evt.ExecutionRunID, artifactData, data.RC, data.Status, archive, evt.Timestamp)
+	if err != nil {
+		return "", err
+	}
+
+	var stats map[string]json.RawMessage
+	_ = json.Unmarshal(data.ArtifactData, &stats)
+	summary, _ := json.Marshal(map[string]interface{}{"rc": data.RC, "status": data.Status, "artifact_data": len(stats), "archive": data.Archive})
+	_, err = tx.ExecContext(ctx, `
+		UPDATE job_events SET event_data = $3
+		WHERE execution_run_id = $1 AND seq = $2`, evt.ExecutionRunID, evt.Seq, summary)
+	return replaced, err
+}
@@ -7,11 +7,14 @@ import (
 	"log"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/content"
 	"github.com/praetordev/praetor/pkg/events"
 )
 
 type DBWriter struct {
-	DB *sqlx.DB
+	DB        *sqlx.DB
+	Results   content.Store // Optional; holds inventory update results too large for an event
+	Artifacts content.Store // Optional; holds artifact archives, deleted when a rerun replaces them
 }
 
 func NewDBWriter(db *sqlx.DB) *DBWriter {
@@ -31,14 +34,32 @@ func (w *DBWriter) WriteEvent(ctx context.Context, evt events.JobEvent) error {
 	// We need to map JobEvent fields to DB columns.
 	eventDataJSON, _ := json.Marshal(evt.EventData)
 
-	_, err = tx.ExecContext(ctx, `
+	// Link events about a host to its row; the job may know the name by
+	// several rows through smart and constructed inventories
+	var hostID interface{}
+	if evt.Host != nil {
+		hostIDs, err := jobHostIDs(ctx, tx, evt.UnifiedJobID, *evt.Host)
+		if err != nil {
+			return fmt.Errorf("look up host %s failed: %w", *evt.Host, err)
+		}
+		if len(hostIDs) > 0 {
+			hostID = hostIDs[0]
+		}
+	}
+
+	// Events without a sequence number, such as failures an executor
+	// reports for a run on another backend, follow the run's last event
+	err = tx.QueryRowxContext(ctx, `
 		INSERT INTO job_events (
 			unified_job_id, execution_run_id, seq, event_type, 
 			host_id, task_name, play_name, event_data, stdout_snippet, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		) VALUES ($1, $2, CASE WHEN $3::bigint > 0 THEN $3::bigint ELSE (
+			SELECT COALESCE(MAX(seq), 0) + 1 FROM job_events WHERE execution_run_id = $2
+		) END, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING seq`,
 		evt.UnifiedJobID, evt.ExecutionRunID, evt.Seq, evt.EventType,
-		nil, evt.TaskName, evt.PlayName, eventDataJSON, evt.StdoutSnippet, evt.Timestamp,
-	)
+		hostID, evt.TaskName, evt.PlayName, eventDataJSON, evt.StdoutSnippet, evt.Timestamp,
+	).Scan(&evt.Seq)
 	if err != nil {
 		return fmt.Errorf("insert job_event failed: %w", err)
 	}
@@ -48,7 +69,42 @@ func (w *DBWriter) WriteEvent(ctx context.Context, evt events.JobEvent) error {
 		return fmt.Errorf("update run state failed: %w", err)
 	}
 
-	return tx.Commit()
+	// 3. Store the facts the run left in the fact cache and its artifacts
+	if evt.EventType == "HOST_FACTS" {
+		if err := w.recordHostFacts(ctx, tx, evt); err != nil {
+			return fmt.Errorf("record host facts failed: %w", err)
+		}
+	}
+	var replacedArchive string
+	if evt.EventType == "JOB_ARTIFACTS" {
+		if replacedArchive, err = w.recordArtifacts(ctx, tx, evt); err != nil {
+			return fmt.Errorf("record artifacts failed: %w", err)
+		}
+	}
+
+	// 4. Record the play recap and the synced revision or inventory when a
+	// run completes
+	if evt.EventType == "JOB_COMPLETED" {
+		if err := w.recordHostSummaries(ctx, tx, evt); err != nil {
+			return fmt.Errorf("record host summaries failed: %w", err)
+		}
+		if err := w.recordProjectRevision(ctx, tx, evt); err != nil {
+			return fmt.Errorf("record project revision failed: %w", err)
+		}
+		if err := w.ingestInventoryUpdate(ctx, tx, evt); err != nil {
+			return fmt.Errorf("ingest inventory update failed: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if replacedArchive != "" && w.Artifacts != nil {
+		if err := w.Artifacts.Delete(ctx, replacedArchive); err != nil {
+			log.Printf("Failed to delete replaced artifact archive %s: %v", replacedArchive, err)
+		}
+	}
+	return nil
 }
 
 func (w *DBWriter) updateRunState(ctx context.Context, tx *sqlx.Tx, evt events.JobEvent) error {
@@ -69,6 +125,15 @@ func (w *DBWriter) updateRunState(ctx context.Context, tx *sqlx.Tx, evt events.J
 	case "JOB_FAILED":
 		newState = "failed"
 		newStatus = "failed"
+		// Executors flag runs they abandoned (e.g. on shutdown) as lost and
+		// runs they were asked to stop as canceled
+		switch runStateOverride(evt) {
+		case "lost":
+			newState = "lost"
+		case "canceled":
+			newState = "canceled"
+			newStatus = "canceled"
+		}
 		finished = true
 	default:
 		// Normal task events don't change state
@@ -119,3 +184,65 @@ func (w *DBWriter) updateRunState(ctx context.Context, tx *sqlx.Tx, evt events.J
 
 	return nil
 }
+
+// recordProjectRevision stores the commit SHA and the playbooks reported by a
+// completed project update on its project, so later jobs are pinned to that
+// revision and templates are validated against it.
+func (w *DBWriter) recordProjectRevision(ctx context.Context, tx *sqlx.Tx, evt events.JobEvent) error {
+	var data struct {
+		SCMRevision string          `json:"scm_revision"`
+		Playbooks   json.RawMessage `json:"playbooks"`
+	}
+	if len(evt.EventData) == 0 || json.Unmarshal(evt.EventData, &data) != nil || data.SCMRevision == "" {
+		return nil
+	}
+	var playbooks interface{}
+	if len(data.Playbooks) > 0 && string(data.Playbooks) != "null" {
+		playbooks = string(data.Playbooks)
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		UPDATE projects p
+		SET scm_revision = $1, last_synced_at = $2, playbooks = $4::jsonb, modified_at = now()
+		FROM unified_jobs uj
+		WHERE uj.id = $3 AND uj.kind = 'project_update' AND p.id = uj.unified_job_template_id`,
+		data.SCMRevision, evt.Timestamp, evt.UnifiedJobID, playbooks,
+	)
+	return err
+}
+
+// runStateOverride returns the "run_state" hint carried in the event data, if any.
+func runStateOverride(evt events.JobEvent) string {
+	var data struct {
+		RunState string `json:"run_state"`
+	}
+	if len(evt.EventData) == 0 || json.Unmarshal(evt.EventData, &data) != nil {
+		return ""
+	}
+	return data.RunState
+}
+
+// RegisterInstance upserts an executor into the instances table. Capacity and
+// enabled are owned by operators once the row exists, so a re-registering
+// executor only refreshes its version and receives the stored settings.
+func (w *DBWriter) RegisterInstance(ctx context.Context, reg events.InstanceRegistration) (events.InstanceRegistrationReply, error) {
+	var reply events.InstanceRegistrationReply
+	if reg.Hostname == "" {
+		return reply, fmt.Errorf("hostname is required")
+	}
+
+	err := w.DB.QueryRowxContext(ctx, `
+		INSERT INTO instances (hostname, version, capacity)
+		VALUES ($1, NULLIF($2, ''), $3)
+		ON CONFLICT (hostname) DO UPDATE
+		SET version = EXCLUDED.version, modified_at = now()
+		RETURNING id, COALESCE(capacity, 0), COALESCE(enabled, true)`,
+		reg.Hostname, reg.Version, reg.Capacity,
+	).Scan(&reply.InstanceID, &reply.Capacity, &reply.Enabled)
+	if err != nil {
+		return reply, fmt.Errorf("register instance %s failed: %w", reg.Hostname, err)
+	}
+
+	log.Printf("Registered instance %s (id %d, capacity %d, enabled %t)", reg.Hostname, reply.InstanceID, reply.Capacity, reply.Enabled)
+	return reply, nil
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+// recordHostFacts stores the facts a run reported for a host on every host
+// row the job knew by that name, or forgets them if the run cleared them.
+// The stored event keeps only a summary.
+func (w *DBWriter) recordHostFacts(ctx context.Context, tx *sqlx.Tx, evt events.JobEvent) error {
+	var data events.HostFacts
+	if evt.Host == nil || len(evt.EventData) == 0 || json.Unmarshal(evt.EventData, &data) != nil {
+		return nil
+	}
+
+	hostIDs, err := jobHostIDs(ctx, tx, evt.UnifiedJobID, *evt.Host)
+	if err != nil {
+		return err
+	}
+	if len(hostIDs) == 0 {
+		log.Printf("Job %d reported facts for %s, which is not one of its inventory hosts", evt.UnifiedJobID, *evt.Host)
+	}
+
+	for _, id := range hostIDs {
+		if data.Cleared {
+			_, err = tx.ExecContext(ctx, "DELETE FROM host_facts WHERE host_id = $1", id)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO host_facts (host_id, facts, unified_job_id, modified_at)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (host_id) DO UPDATE
+				SET facts = EXCLUDED.facts, unified_job_id = EXCLUDED.unified_job_id, modified_at = EXCLUDED.modified_at`,
+				id, string(data.Facts), evt.UnifiedJobID, evt.Timestamp)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var facts map[string]json.RawMessage
+	_ = json.Unmarshal(data.Facts, &facts)
+	summary, _ := json.Marshal(map[string]interface{}{"host": *evt.Host, "cleared": data.Cleared, "facts": len(facts)})
+	_, err = tx.ExecContext(ctx, `
+		UPDATE job_events SET event_data = $3
+		WHERE execution_run_id = $1 AND seq = $2`, evt.ExecutionRunID, evt.Seq, summary)
+	return err
+}
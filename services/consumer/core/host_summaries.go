@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+// playStats are the per-host counters of a playbook_on_stats event, keyed by
+// host name. Ansible calls unreachable hosts "dark".
+type playStats struct {
+	Ok        map[string]int `json:"ok"`
+	Changed   map[string]int `json:"changed"`
+	Failures  map[string]int `json:"failures"`
+	Dark      map[string]int `json:"dark"`
+	Skipped   map[string]int `json:"skipped"`
+	Processed map[string]int `json:"processed"`
+}
+
+// jobHostIDs returns the IDs of the host rows the job knew by name.
+func jobHostIDs(ctx context.Context, tx *sqlx.Tx, jobID int64, name string) ([]int64, error) {
+	var ids []int64
+	err := tx.SelectContext(ctx, &ids, `
+		SELECT host_id FROM job_hosts
+		WHERE unified_job_id = $1 AND host_name = $2
+		ORDER BY host_id`, jobID, name)
+	return ids, err
+}
+
+// recordHostSummaries stores the play recap of a run as a job host summary
+// per host, and makes the job the last one of each host it ran against.
+// Hosts whose last job failed or could not reach them have active failures.
+func (w *DBWriter) recordHostSummaries(ctx context.Context, tx *sqlx.Tx, evt events.JobEvent) error {
+	var raw struct {
+		EventData playStats `json:"event_data"`
+	}
+	if len(evt.EventData) == 0 || json.Unmarshal(evt.EventData, &raw) != nil {
+		return nil
+	}
+	stats := raw.EventData
+
+	names := map[string]bool{}
+	for _, counts := range []map[string]int{stats.Ok, stats.Changed, stats.Failures, stats.Dark, stats.Skipped, stats.Processed} {
+		for name := range counts {
+			names[name] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		hostIDs, err := jobHostIDs(ctx, tx, evt.UnifiedJobID, name)
+		if err != nil {
+			return err
+		}
+		failed, unreachable := stats.Failures[name], stats.Dark[name]
+		for _, hostID := range hostIDs {
+			var summaryID int64
+			err := tx.QueryRowxContext(ctx, `
+				INSERT INTO job_host_summaries (unified_job_id, host_id, changed, failed, ok, skipped, unreachable, last_event_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				ON CONFLICT (unified_job_id, host_id) DO UPDATE
+				SET changed = EXCLUDED.changed, failed = EXCLUDED.failed, ok = EXCLUDED.ok,
+					skipped = EXCLUDED.skipped, unreachable = EXCLUDED.unreachable, last_event_at = EXCLUDED.last_event_at
+				RETURNING id`,
+				evt.UnifiedJobID, hostID, stats.Changed[name], failed, stats.Ok[name],
+				stats.Skipped[name], unreachable, evt.Timestamp,
+			).Scan(&summaryID)
+			if err != nil {
+				return err
+			}
+
+			// Job IDs only grow, so an older job finishing late does not
+			// replace the last job of the host
+			_, err = tx.ExecContext(ctx, `
+				UPDATE hosts
+				SET last_job_id = $2, last_job_host_summary_id = $3, has_active_failures = $4
+				WHERE id = $1 AND (last_job_id IS NULL OR last_job_id <= $2)`,
+				hostID, evt.UnifiedJobID, summaryID, failed > 0 || unreachable > 0)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/inventory"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// ingestInventoryUpdate applies the inventory reported by a completed
+// inventory update to the source's inventory, and takes ownership of the
+// hosts and groups it reported. Bad content fails the job rather than the
+// event, so the job never stays running; the stored event's data is replaced
+// by the changes made.
+func (w *DBWriter) ingestInventoryUpdate(ctx context.Context, tx *sqlx.Tx, evt events.JobEvent) error {
+	var src models.InventorySource
+	err := tx.GetContext(ctx, &src, `
+		SELECT s.* FROM inventory_sources s
+		JOIN unified_jobs uj ON uj.unified_job_template_id = s.id
+		WHERE uj.id = $1 AND uj.kind = 'inventory_update'`, evt.UnifiedJobID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Serialize with imports and other sources of the same inventory
+	if _, err := tx.ExecContext(ctx, "SELECT id FROM inventories WHERE id = $1 FOR UPDATE", src.InventoryID); err != nil {
+		return err
+	}
+
+	data, err := w.inventoryResult(ctx, evt)
+	if err != nil {
+		return failInventoryUpdate(ctx, tx, evt, err)
+	}
+	reported, err := inventory.ParseList(data)
+	if err != nil {
+		return failInventoryUpdate(ctx, tx, evt, fmt.Errorf("invalid inventory: %w", err))
+	}
+
+	current, err := inventory.Load(ctx, tx, src.InventoryID, true)
+	if err != nil {
+		return err
+	}
+	ownedHosts, ownedGroups, err := inventory.Owned(ctx, tx, src.ID)
+	if err != nil {
+		return err
+	}
+	target, changes, err := inventory.PlanSync(current, reported, inventory.SyncOptions{
+		Overwrite:     src.Overwrite,
+		OverwriteVars: src.OverwriteVars,
+		OwnedHosts:    ownedHosts,
+		OwnedGroups:   ownedGroups,
+	})
+	if err != nil {
+		return failInventoryUpdate(ctx, tx, evt, err)
+	}
+
+	if err := inventory.Apply(ctx, tx, src.InventoryID, target, changes); err != nil {
+		return err
+	}
+	if err := inventory.Claim(ctx, tx, src.InventoryID, src.ID, reported); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE inventory_sources SET last_updated_at = $2 WHERE id = $1", src.ID, evt.Timestamp); err != nil {
+		return err
+	}
+
+	summary, _ := json.Marshal(map[string]interface{}{"changes": changes})
+	if _, err := tx.ExecContext(ctx, "UPDATE job_events SET event_data = $3 WHERE execution_run_id = $1 AND seq = $2", evt.ExecutionRunID, evt.Seq, summary); err != nil {
+		return err
+	}
+
+	log.Printf("Inventory update %d applied source %s to inventory %d: %d hosts created, %d updated, %d deleted",
+		evt.UnifiedJobID, src.Name, src.InventoryID, len(changes.HostsCreated), len(changes.HostsUpdated), len(changes.HostsDeleted))
+	return nil
+}
+
+// inventoryResult returns the ansible-inventory output carried by the event,
+// inline or in the result store.
+func (w *DBWriter) inventoryResult(ctx context.Context, evt events.JobEvent) ([]byte, error) {
+	var data struct {
+		Inventory json.RawMessage `json:"inventory"`
+		Object    string          `json:"inventory_object"`
+	}
+	if err := json.Unmarshal(evt.EventData, &data); err != nil {
+		return nil, fmt.Errorf("invalid event data: %w", err)
+	}
+	if len(data.Inventory) > 0 {
+		return data.Inventory, nil
+	}
+	if data.Object == "" {
+		return nil, fmt.Errorf("no inventory reported")
+	}
+	if w.Results == nil {
+		return nil, fmt.Errorf("inventory %s is in the result store, which is unavailable", data.Object)
+	}
+	r, err := w.Results.Get(ctx, data.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch inventory %s: %w", data.Object, err)
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// failInventoryUpdate marks the update's run and job failed, recording why on
+// the completion event.
+func failInventoryUpdate(ctx context.Context, tx *sqlx.Tx, evt events.JobEvent, cause error) error {
+	log.Printf("Inventory update %d failed to apply: %v", evt.UnifiedJobID, cause)
+	msg := fmt.Sprintf("Inventory update failed to apply: %v", cause)
+	if _, err := tx.ExecContext(ctx, "UPDATE job_events SET stdout_snippet = $3 WHERE execution_run_id = $1 AND seq = $2", evt.ExecutionRunID, evt.Seq, msg); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE execution_runs SET state = 'failed' WHERE id = $1", evt.ExecutionRunID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", evt.UnifiedJobID)
+	return err
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/backend"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The Controller is the Kubernetes execution backend.
+var _ backend.ExecutionBackend = (*Controller)(nil)
+
+func (c *Controller) runJob(ctx context.Context, runID uuid.UUID) (*batchv1.Job, error) {
+	job, err := c.K8sClient.BatchV1().Jobs(c.Config.Namespace).Get(ctx, runResourceName(runID), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, backend.ErrUnknownRun
+	}
+	return job, err
+}
+
+// Cancel suspends the run's Job, which terminates its pod, and marks it
+// cancelled.
+func (c *Controller) Cancel(ctx context.Context, runID uuid.UUID) error {
+	job, err := c.runJob(ctx, runID)
+	if err != nil {
+		return err
+	}
+	if jobStatus(job).Finished() {
+		return nil
+	}
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:"true"}},"spec":{"suspend":true}}`, AnnotationCanceled)
+	_, err = c.K8sClient.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		return backend.ErrUnknownRun
+	}
+	return err
+}
+
+// Status reads the state of the run's Job.
+func (c *Controller) Status(ctx context.Context, runID uuid.UUID) (backend.Status, error) {
+	job, err := c.runJob(ctx, runID)
+	if err != nil {
+		return backend.Status{}, err
+	}
+	return jobStatus(job), nil
+}
+
+func jobStatus(job *batchv1.Job) backend.Status {
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobComplete && cond.Status == corev1.ConditionTrue {
+			return backend.Status{State: backend.StateSuccessful}
+		}
+	}
+	if reason, _, failed := jobFailure(job); failed {
+		return backend.Status{State: backend.StateFailed, Reason: fmt.Sprintf("Executor Job %s failed: %s", job.Name, reason)}
+	}
+	if job.Annotations[AnnotationCanceled] != "" {
+		return backend.Status{State: backend.StateCanceled}
+	}
+	if job.Status.Active > 0 {
+		return backend.Status{State: backend.StateRunning}
+	}
+	return backend.Status{State: backend.StatePending}
+}
+
+// Cleanup deletes the run's Job with its pod and Secrets.
+func (c *Controller) Cleanup(ctx context.Context, runID uuid.UUID) error {
+	ns, name := c.Config.Namespace, runResourceName(runID)
+	propagation := metav1.DeletePropagationBackground
+	err := c.K8sClient.BatchV1().Jobs(ns).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete job: %w", err)
+	}
+	// Owner references take care of these too, unless garbage collection lags
+	for _, secret := range []string{name, name + "-registry"} {
+		err := c.K8sClient.CoreV1().Secrets(ns).Delete(ctx, secret, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete secret %s: %w", secret, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/backend/backendtest"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBackendConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) *backendtest.Harness {
+		client := fake.NewSimpleClientset()
+		c, _ := newController(client)
+		return &backendtest.Harness{
+			Backend: c,
+			// Kubernetes finishes the Job once its pod exits
+			Finish: func(t *testing.T, runID uuid.UUID, succeed bool) {
+				ctx := context.Background()
+				job, err := client.BatchV1().Jobs("automation").Get(ctx, "execution-"+runID.String(), metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				cond := batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue, LastTransitionTime: metav1.Now()}
+				if !succeed {
+					cond.Type, cond.Reason = batchv1.JobFailed, "BackoffLimitExceeded"
+				}
+				job.Status.Conditions = append(job.Status.Conditions, cond)
+				job.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+				if _, err := client.BatchV1().Jobs("automation").UpdateStatus(ctx, job, metav1.UpdateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		}
+	})
+}
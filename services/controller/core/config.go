@@ -0,0 +1,98 @@
+package core
+
+import (
+	"log"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Config holds how the controller runs executor Jobs.
+type Config struct {
+	Namespace       string            // Namespace of executor Jobs and their Secrets
+	Image           string            // Executor image
+	ImagePullPolicy corev1.PullPolicy // Pull policy of the executor image
+	NatsURL         string            // NATS URL executor pods publish job events to
+
+	// ReconcileInterval is how often Job status is checked. A Job that failed
+	// less than FailureGrace ago is left alone, so events its pod published
+	// before dying are written first.
+	ReconcileInterval time.Duration
+	FailureGrace      time.Duration
+
+	// JobTTL is how long finished Jobs, their pods and Secrets are kept.
+	// KeepFailed, if longer, keeps those of failed runs around for debugging.
+	// Every GCInterval, resources of finished runs that Kubernetes does not
+	// clean up itself, e.g. Jobs whose pod never started, are deleted.
+	JobTTL     time.Duration
+	KeepFailed time.Duration
+	GCInterval time.Duration
+}
+
+// ConfigFromEnv reads the controller configuration from the environment.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Namespace:         os.Getenv("POD_NAMESPACE"),
+		Image:             os.Getenv("EXECUTOR_IMAGE"),
+		ImagePullPolicy:   corev1.PullPolicy(os.Getenv("EXECUTOR_IMAGE_PULL_POLICY")),
+		NatsURL:           os.Getenv("EXECUTOR_NATS_URL"),
+		ReconcileInterval: 10 * time.Second,
+		FailureGrace:      30 * time.Second,
+		JobTTL:            envDuration("EXECUTOR_JOB_TTL", 10*time.Minute),
+		KeepFailed:        envDuration("EXECUTOR_KEEP_FAILED", 0),
+		GCInterval:        envDuration("CONTROLLER_GC_INTERVAL", 5*time.Minute),
+	}
+	if cfg.NatsURL == "" {
+		cfg.NatsURL = os.Getenv("NATS_URL")
+	}
+	if d := envDuration("CONTROLLER_RECONCILE_INTERVAL", 0); d > 0 {
+		cfg.ReconcileInterval = d
+	}
+	return cfg.withDefaults()
+}
+
+// envDuration reads a duration such as "10m" from the environment, falling
+// back to def if it is unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		log.Printf("Ignoring invalid %s %q", key, val)
+		return def
+	}
+	return d
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Namespace == "" {
+		cfg.Namespace = "default"
+	}
+	if cfg.Image == "" {
+		cfg.Image = "praetor-executor:latest"
+	}
+	if cfg.ImagePullPolicy == "" {
+		cfg.ImagePullPolicy = corev1.PullIfNotPresent
+	}
+	if cfg.NatsURL == "" {
+		cfg.NatsURL = "nats://praetor-nats:4222"
+	}
+	if cfg.ReconcileInterval == 0 {
+		cfg.ReconcileInterval = 10 * time.Second
+	}
+	if cfg.GCInterval == 0 {
+		cfg.GCInterval = 5 * time.Minute
+	}
+	return cfg
+}
+
+// retention is how long the resources of a finished run are kept.
+func (cfg Config) retention(failed bool) time.Duration {
+	if failed && cfg.KeepFailed > cfg.JobTTL {
+		return cfg.KeepFailed
+	}
+	return cfg.JobTTL
+}
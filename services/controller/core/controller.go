@@ -2,153 +2,199 @@ package core
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
-	"os"
+	"strconv"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/praetordev/praetor/pkg/events"
-	"github.com/nats-io/nats.go"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
+// RequestSource hands out execution requests, such as the NATS work queue.
+type RequestSource interface {
+	FetchExecutionRequest(ctx context.Context) (*events.ExecutionRequest, error)
+}
+
+// Controller is the Kubernetes execution backend. It runs each execution
+// run as a batch/v1 Job of the executor in one-shot mode, and fails runs
+// whose pod or Job failed without the executor reporting it, e.g. because the
+// image could not be pulled or the pod was OOMKilled or evicted.
 type Controller struct {
-	NatsConn  *nats.Conn
-	K8sClient *kubernetes.Clientset
-	Namespace string
+	K8sClient kubernetes.Interface
+	Requests  RequestSource
+	Runs      RunStore
+	Config    Config
+
+	Now func() time.Time // Defaults to time.Now
 }
 
-func NewController(natsURL string) (*Controller, error) {
-	// 1. Connect to NATS
-	nc, err := nats.Connect(natsURL)
-	if err != nil {
-		return nil, fmt.Errorf("nats connect failed: %w", err)
+func NewController(client kubernetes.Interface, requests RequestSource, runs RunStore, cfg Config) *Controller {
+	return &Controller{
+		K8sClient: client,
+		Requests:  requests,
+		Runs:      runs,
+		Config:    cfg.withDefaults(),
+		Now:       time.Now,
 	}
+}
 
-	// 2. Connect to K8s
-	// Try in-cluster config first, then fallback to kubeconfig
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		home := os.Getenv("HOME")
-		kubeconfig := home + "/.kube/config"
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+// Start launches Jobs for incoming requests, reconciles their status and
+// collects the resources of finished runs until ctx is cancelled.
+func (c *Controller) Start(ctx context.Context) {
+	log.Printf("Controller started, launching executor Jobs in namespace %s with image %s", c.Config.Namespace, c.Config.Image)
+
+	go c.reconcileLoop(ctx)
+	go c.WatchPods(ctx)
+	go c.gcLoop(ctx)
+
+	for {
+		req, err := c.Requests.FetchExecutionRequest(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("k8s config failed: %w", err)
+			if ctx.Err() != nil {
+				log.Println("Controller stopped")
+				return
+			}
+			log.Printf("Failed to fetch execution request: %v", err)
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+			continue
 		}
-	}
 
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("k8s clientset failed: %w", err)
+		if err := c.Launch(ctx, req); err != nil {
+			log.Printf("Failed to launch run %s: %v", req.ExecutionRunID, err)
+			failure := Failure{Reason: fmt.Sprintf("Failed to launch executor Job: %v", err)}
+			if err := c.Runs.FailRun(ctx, req.ExecutionRunID, req.UnifiedJobID, failure); err != nil {
+				log.Printf("Failed to mark run %s failed: %v", req.ExecutionRunID, err)
+			}
+		}
 	}
+}
 
-	ns := os.Getenv("POD_NAMESPACE")
-	if ns == "" {
-		ns = "default"
+func (c *Controller) reconcileLoop(ctx context.Context) {
+	ticker := time.NewTicker(c.Config.ReconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Reconcile(ctx); err != nil {
+				log.Printf("Error reconciling executor Jobs: %v", err)
+			}
+		}
 	}
-
-	return &Controller{
-		NatsConn:  nc,
-		K8sClient: clientset,
-		Namespace: ns,
-	}, nil
 }
 
-func (c *Controller) Start() {
-	log.Println("Controller started, listening for job requests...")
+// Launch creates the Job and manifest Secret of a run. A run whose Job
+// already exists, e.g. from a redelivered request, is left as it is.
+func (c *Controller) Launch(ctx context.Context, req *events.ExecutionRequest) error {
+	ns := c.Config.Namespace
+	job, err := buildJob(req, c.Config)
+	if err != nil {
+		return err
+	}
+	job, err = c.K8sClient.BatchV1().Jobs(ns).Create(ctx, job, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		log.Printf("Job %s already exists, not launching run %s again", ResourceName(req), req.ExecutionRunID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("create job: %w", err)
+	}
 
-	// Subscribe to execution requests
-	// QueueSubscribe ensures load balancing if we run multiple controllers (leader election better later)
-	c.NatsConn.QueueSubscribe(events.JobRequestSubject, "praetor-controller", func(m *nats.Msg) {
-		var req events.ExecutionRequest
-		if err := json.Unmarshal(m.Data, &req); err != nil {
-			log.Printf("Failed to unmarshal request: %v", err)
-			return
+	if err := c.createSecrets(ctx, req, job); err != nil {
+		// Without its manifest and pull credentials the pod would never start
+		propagation := metav1.DeletePropagationBackground
+		if delErr := c.K8sClient.BatchV1().Jobs(ns).Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation}); delErr != nil {
+			log.Printf("Failed to delete Job %s: %v", job.Name, delErr)
 		}
-		c.reconcileJob(req)
-	})
+		return err
+	}
 
-	select {} // Block forever
+	log.Printf("Launched Job %s with image %s for job %d, run %s", job.Name, job.Spec.Template.Spec.Containers[0].Image, req.UnifiedJobID, req.ExecutionRunID)
+	return nil
 }
 
-func (c *Controller) reconcileJob(req events.ExecutionRequest) {
-	runID := req.ExecutionRunID.String()
-	log.Printf("Reconciling job %d, run %s", req.UnifiedJobID, runID)
-
-	ctx := context.Background()
-
-	// 1. Create Secret with Manifest
-	reqBytes, _ := json.Marshal(req)
-	secretName := fmt.Sprintf("execution-%s", runID)
-	secret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: secretName,
-		},
-		StringData: map[string]string{
-			"manifest.json": string(reqBytes),
-		},
+// createSecrets creates the manifest Secret of a run's Job and, if its
+// execution environment has a registry credential, the image pull Secret.
+func (c *Controller) createSecrets(ctx context.Context, req *events.ExecutionRequest, job *batchv1.Job) error {
+	manifest, err := buildSecret(req, job)
+	if err != nil {
+		return err
 	}
-
-	_, err := c.K8sClient.CoreV1().Secrets(c.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+	pull, err := buildPullSecret(req, job)
 	if err != nil {
-		log.Printf("Failed to create secret %s: %v", secretName, err)
-		// Should we retry or ack? For now, we log.
-		return
+		return err
 	}
-
-	// 2. Create Pod
-	podName := fmt.Sprintf("execution-%s", runID)
-	pod := &corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: podName,
-			Labels: map[string]string{
-				"app":          "praetor-execution",
-				"execution_id": runID,
-			},
-		},
-		Spec: corev1.PodSpec{
-			RestartPolicy: corev1.RestartPolicyNever,
-			Containers: []corev1.Container{
-				{
-					Name:            "executor",
-					Image:           "praetor-executor:latest", // Needs to be configurable or same version
-					ImagePullPolicy: corev1.PullNever,          // For local Dev/Kind
-					Env: []corev1.EnvVar{
-						{Name: "PRAETOR_MODE", Value: "oneshot"},
-						{Name: "NATS_URL", Value: "nats://praetor-nats:4222"}, // Hardcoded service DNS for now
-					},
-					VolumeMounts: []corev1.VolumeMount{
-						{
-							Name:      "manifest-volume",
-							MountPath: "/etc/praetor",
-							ReadOnly:  true,
-						},
-					},
-				},
-			},
-			Volumes: []corev1.Volume{
-				{
-					Name: "manifest-volume",
-					VolumeSource: corev1.VolumeSource{
-						Secret: &corev1.SecretVolumeSource{
-							SecretName: secretName,
-						},
-					},
-				},
-			},
-		},
+	for _, secret := range []*corev1.Secret{manifest, pull} {
+		if secret == nil {
+			continue
+		}
+		_, err := c.K8sClient.CoreV1().Secrets(job.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("create secret %s: %w", secret.Name, err)
+		}
 	}
+	return nil
+}
 
-	_, err = c.K8sClient.CoreV1().Pods(c.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+// Reconcile fails the active runs of executor Jobs that failed more than
+// FailureGrace ago. Runs the executor finished itself are left alone. Failed
+// Jobs are kept for KeepFailed.
+func (c *Controller) Reconcile(ctx context.Context) error {
+	jobs, err := c.K8sClient.BatchV1().Jobs(c.Config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: LabelApp + "=" + appExecution,
+	})
 	if err != nil {
-		log.Printf("Failed to create pod %s: %v", podName, err)
-		// Cleanup secret?
-		return
+		return fmt.Errorf("list jobs: %w", err)
 	}
 
-	log.Printf("Launched Pod %s for Run %s", podName, runID)
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		reason, since, failed := jobFailure(job)
+		if !failed {
+			continue
+		}
+		c.keepFailedJob(ctx, job)
+		if c.Now().Sub(since.Time) < c.Config.FailureGrace {
+			continue
+		}
+
+		runID, err := uuid.Parse(job.Labels[LabelRunID])
+		if err != nil {
+			log.Printf("Job %s has no valid run ID label: %v", job.Name, err)
+			continue
+		}
+		jobID, err := strconv.ParseInt(job.Labels[LabelJobID], 10, 64)
+		if err != nil {
+			log.Printf("Job %s has no valid job ID label: %v", job.Name, err)
+			continue
+		}
+
+		status, err := c.Runs.RunStatus(ctx, runID)
+		if err != nil {
+			log.Printf("Failed to look up run %s: %v", runID, err)
+			continue
+		}
+		if !status.Active() {
+			continue
+		}
+		failure, ok := c.jobPodFailure(ctx, runID)
+		if !ok {
+			failure = Failure{Reason: fmt.Sprintf("Executor Job %s failed: %s", job.Name, reason)}
+		}
+		log.Printf("Job %s failed without its run %s finishing: %s", job.Name, runID, failure.Reason)
+		if err := c.Runs.FailRun(ctx, runID, jobID, failure); err != nil {
+			log.Printf("Failed to mark run %s failed: %v", runID, err)
+		}
+	}
+	return nil
 }
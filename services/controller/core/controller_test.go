@@ -0,0 +1,515 @@
+package core_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/services/controller/core"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeRuns is a RunStore of runs that are running until failed or
+// finished.
+type fakeRuns struct {
+	mu       sync.Mutex
+	failed   map[uuid.UUID]core.Failure
+	finished map[uuid.UUID]core.RunStatus
+}
+
+func (f *fakeRuns) RunStatus(ctx context.Context, runID uuid.UUID) (core.RunStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if status, ok := f.finished[runID]; ok {
+		return status, nil
+	}
+	if _, failed := f.failed[runID]; failed {
+		return core.RunStatus{State: "failed"}, nil
+	}
+	return core.RunStatus{State: "running"}, nil
+}
+
+func (f *fakeRuns) FailRun(ctx context.Context, runID uuid.UUID, jobID int64, failure core.Failure) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failed[runID] = failure
+	return nil
+}
+
+func (f *fakeRuns) failure(runID uuid.UUID) (core.Failure, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	failure, ok := f.failed[runID]
+	return failure, ok
+}
+
+func (f *fakeRuns) finish(runID uuid.UUID, state string, at time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.finished[runID] = core.RunStatus{State: state, FinishedAt: &at}
+}
+
+func newController(client *fake.Clientset) (*core.Controller, *fakeRuns) {
+	runs := &fakeRuns{failed: map[uuid.UUID]core.Failure{}, finished: map[uuid.UUID]core.RunStatus{}}
+	c := core.NewController(client, nil, runs, core.Config{
+		Namespace:       "automation",
+		Image:           "registry.example.com/praetor-executor:1.2",
+		ImagePullPolicy: corev1.PullAlways,
+		NatsURL:         "nats://nats.automation:4222",
+		FailureGrace:    30 * time.Second,
+		JobTTL:          10 * time.Minute,
+		KeepFailed:      24 * time.Hour,
+	})
+	return c, runs
+}
+
+func newRequest() *events.ExecutionRequest {
+	return &events.ExecutionRequest{
+		ExecutionRunID: uuid.New(),
+		UnifiedJobID:   42,
+		JobManifest:    events.JobManifest{Playbook: "site.yml"},
+	}
+}
+
+func TestLaunchCreatesJobAndSecret(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	c, _ := newController(client)
+	req := newRequest()
+	ctx := context.Background()
+
+	if err := c.Launch(ctx, req); err != nil {
+		t.Fatalf("Launch failed: %v", err)
+	}
+
+	name := core.ResourceName(req)
+	job, err := client.BatchV1().Jobs("automation").Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Job not created: %v", err)
+	}
+	if job.Labels[core.LabelRunID] != req.ExecutionRunID.String() || job.Labels[core.LabelJobID] != "42" {
+		t.Errorf("unexpected Job labels %v", job.Labels)
+	}
+	if job.Spec.BackoffLimit == nil || *job.Spec.BackoffLimit != 0 {
+		t.Errorf("Job must not be retried, backoffLimit %v", job.Spec.BackoffLimit)
+	}
+	if ttl := job.Spec.TTLSecondsAfterFinished; ttl == nil || *ttl != 600 {
+		t.Errorf("finished Job should be deleted after 10 minutes, ttlSecondsAfterFinished %v", ttl)
+	}
+	pod := job.Spec.Template.Spec
+	if pod.RestartPolicy != corev1.RestartPolicyNever || len(pod.Containers) != 1 {
+		t.Fatalf("unexpected pod spec %+v", pod)
+	}
+	container := pod.Containers[0]
+	if container.Image != "registry.example.com/praetor-executor:1.2" || container.ImagePullPolicy != corev1.PullAlways {
+		t.Errorf("unexpected image %s (%s)", container.Image, container.ImagePullPolicy)
+	}
+	env := map[string]string{}
+	for _, e := range container.Env {
+		env[e.Name] = e.Value
+	}
+	if env["PRAETOR_MODE"] != "oneshot" || env["NATS_URL"] != "nats://nats.automation:4222" {
+		t.Errorf("unexpected env %v", env)
+	}
+	if len(pod.Volumes) != 1 || pod.Volumes[0].Secret == nil || pod.Volumes[0].Secret.SecretName != name {
+		t.Errorf("manifest Secret not mounted: %+v", pod.Volumes)
+	}
+
+	secret, err := client.CoreV1().Secrets("automation").Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Secret not created: %v", err)
+	}
+	var manifest events.ExecutionRequest
+	if err := json.Unmarshal(secret.Data["manifest.json"], &manifest); err != nil {
+		t.Fatalf("bad manifest: %v", err)
+	}
+	if manifest.ExecutionRunID != req.ExecutionRunID || manifest.JobManifest.Playbook != "site.yml" {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+	owners := secret.OwnerReferences
+	if len(owners) != 1 || owners[0].Kind != "Job" || owners[0].Name != name {
+		t.Errorf("Secret should be owned by its Job, got %+v", owners)
+	}
+}
+
+func TestLaunchUsesExecutionEnvironment(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	c, _ := newController(client)
+	req := newRequest()
+	req.JobManifest.ExecutionEnvironment = &events.ExecutionEnvironment{
+		Name:  "Network EE",
+		Image: "quay.example.com/automation/network-ee:2.0",
+		Pull:  "missing",
+		Credential: &events.RegistryCredential{
+			Username: "robot",
+			Password: "s3cret",
+		},
+	}
+	ctx := context.Background()
+
+	if err := c.Launch(ctx, req); err != nil {
+		t.Fatalf("Launch failed: %v", err)
+	}
+
+	job, err := client.BatchV1().Jobs("automation").Get(ctx, core.ResourceName(req), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Job not created: %v", err)
+	}
+	pod := job.Spec.Template.Spec
+	if pod.Containers[0].Image != "quay.example.com/automation/network-ee:2.0" || pod.Containers[0].ImagePullPolicy != corev1.PullIfNotPresent {
+		t.Errorf("unexpected image %s (%s)", pod.Containers[0].Image, pod.Containers[0].ImagePullPolicy)
+	}
+	if len(pod.ImagePullSecrets) != 1 {
+		t.Fatalf("expected one image pull secret, got %+v", pod.ImagePullSecrets)
+	}
+
+	secret, err := client.CoreV1().Secrets("automation").Get(ctx, pod.ImagePullSecrets[0].Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("pull Secret not created: %v", err)
+	}
+	if secret.Type != corev1.SecretTypeDockerConfigJson || len(secret.OwnerReferences) != 1 {
+		t.Errorf("unexpected pull Secret %+v", secret.ObjectMeta)
+	}
+	var config struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+		t.Fatalf("bad docker config: %v", err)
+	}
+	auth, ok := config.Auths["quay.example.com"]
+	if !ok || auth.Username != "robot" || auth.Password != "s3cret" {
+		t.Errorf("unexpected registry auths %+v", config.Auths)
+	}
+}
+
+func TestLaunchAppliesContainerGroup(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	c, _ := newController(client)
+	req := newRequest()
+	req.JobManifest.ContainerGroup = &events.ContainerGroup{
+		Name:            "restricted",
+		PodSpecOverride: json.RawMessage(`{"serviceAccountName": "automation", "nodeSelector": {"pool": "automation"}}`),
+		ResourceClass:   "small",
+		Resources:       json.RawMessage(`{"requests": {"cpu": "500m"}, "limits": {"memory": "1Gi"}}`),
+	}
+	ctx := context.Background()
+
+	if err := c.Launch(ctx, req); err != nil {
+		t.Fatalf("Launch failed: %v", err)
+	}
+
+	job, err := client.BatchV1().Jobs("automation").Get(ctx, core.ResourceName(req), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Job not created: %v", err)
+	}
+	pod := job.Spec.Template.Spec
+	if pod.ServiceAccountName != "automation" || pod.NodeSelector["pool"] != "automation" {
+		t.Errorf("pod spec override not applied: %+v", pod)
+	}
+	if pod.RestartPolicy != corev1.RestartPolicyNever || len(pod.Volumes) != 1 {
+		t.Errorf("override dropped the executor's restart policy or manifest volume: %+v", pod)
+	}
+	if got := pod.Containers[0].Resources.Limits.Memory().String(); got != "1Gi" {
+		t.Errorf("resource class not applied, memory limit %s", got)
+	}
+
+	bad := newRequest()
+	bad.JobManifest.ContainerGroup = &events.ContainerGroup{Name: "broken", PodSpecOverride: json.RawMessage(`{"nodeSelektor": {}}`)}
+	if err := c.Launch(ctx, bad); err == nil {
+		t.Error("Launch should reject an invalid pod spec override")
+	}
+}
+
+func TestLaunchIsIdempotent(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	c, _ := newController(client)
+	req := newRequest()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := c.Launch(ctx, req); err != nil {
+			t.Fatalf("Launch %d failed: %v", i, err)
+		}
+	}
+	jobs, _ := client.BatchV1().Jobs("automation").List(ctx, metav1.ListOptions{})
+	if len(jobs.Items) != 1 {
+		t.Errorf("got %d Jobs, want 1", len(jobs.Items))
+	}
+}
+
+func TestLaunchRemovesJobWhenSecretFails(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("quota exceeded")
+	})
+	c, _ := newController(client)
+	ctx := context.Background()
+
+	if err := c.Launch(ctx, newRequest()); err == nil {
+		t.Fatal("Launch should fail without its Secret")
+	}
+	jobs, _ := client.BatchV1().Jobs("automation").List(ctx, metav1.ListOptions{})
+	if len(jobs.Items) != 0 {
+		t.Errorf("Job without a manifest was left behind: %v", jobs.Items[0].Name)
+	}
+}
+
+func TestReconcileFailsRunsOfFailedJobs(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	c, runs := newController(client)
+	now := time.Now()
+	c.Now = func() time.Time { return now }
+	ctx := context.Background()
+
+	setStatus := func(req *events.ExecutionRequest, cond batchv1.JobConditionType, reason string, at time.Time) {
+		job, err := client.BatchV1().Jobs("automation").Get(ctx, core.ResourceName(req), metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type:               cond,
+			Status:             corev1.ConditionTrue,
+			Reason:             reason,
+			Message:            "Job has reached the specified backoff limit",
+			LastTransitionTime: metav1.NewTime(at),
+		}}
+		if _, err := client.BatchV1().Jobs("automation").UpdateStatus(ctx, job, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failed, recent, complete := newRequest(), newRequest(), newRequest()
+	for _, req := range []*events.ExecutionRequest{failed, recent, complete} {
+		if err := c.Launch(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setStatus(failed, batchv1.JobFailed, "BackoffLimitExceeded", now.Add(-time.Minute))
+	setStatus(recent, batchv1.JobFailed, "BackoffLimitExceeded", now.Add(-time.Second))
+	setStatus(complete, batchv1.JobComplete, "", now.Add(-time.Minute))
+
+	if err := c.Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+
+	want := fmt.Sprintf("Executor Job %s failed: BackoffLimitExceeded: Job has reached the specified backoff limit", core.ResourceName(failed))
+	if got, _ := runs.failure(failed.ExecutionRunID); got.Reason != want {
+		t.Errorf("failed run reason %q, want %q", got.Reason, want)
+	}
+	if _, ok := runs.failure(recent.ExecutionRunID); ok {
+		t.Error("run of a Job that just failed should get time to report its own events")
+	}
+	if _, ok := runs.failure(complete.ExecutionRunID); ok {
+		t.Error("run of a completed Job should not be failed")
+	}
+
+	for req, want := range map[*events.ExecutionRequest]int32{failed: 86400, recent: 86400, complete: 600} {
+		job, err := client.BatchV1().Jobs("automation").Get(ctx, core.ResourceName(req), metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl := job.Spec.TTLSecondsAfterFinished; ttl == nil || *ttl != want {
+			t.Errorf("Job %s ttlSecondsAfterFinished %v, want %d", job.Name, ttl, want)
+		}
+	}
+}
+
+func TestCollectDeletesResourcesOfFinishedRuns(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	c, runs := newController(client)
+	now := time.Now()
+	c.Now = func() time.Time { return now }
+	ctx := context.Background()
+
+	running, succeeded, recent, failed, kept := newRequest(), newRequest(), newRequest(), newRequest(), newRequest()
+	for _, req := range []*events.ExecutionRequest{running, succeeded, recent, failed, kept} {
+		if err := c.Launch(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs.finish(succeeded.ExecutionRunID, "successful", now.Add(-time.Hour))
+	runs.finish(recent.ExecutionRunID, "successful", now.Add(-time.Minute))
+	runs.finish(failed.ExecutionRunID, "failed", now.Add(-25*time.Hour))
+	runs.finish(kept.ExecutionRunID, "failed", now.Add(-time.Hour))
+
+	// A pod and Secret whose Job was deleted without its dependents
+	orphan := newRequest()
+	runs.finish(orphan.ExecutionRunID, "lost", now.Add(-48*time.Hour))
+	if _, err := client.CoreV1().Pods("automation").Create(ctx, executorPod(orphan, corev1.PodStatus{}), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	orphanSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:      core.ResourceName(orphan),
+		Namespace: "automation",
+		Labels:    executorPod(orphan, corev1.PodStatus{}).Labels,
+	}}
+	if _, err := client.CoreV1().Secrets("automation").Create(ctx, orphanSecret, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Collect(ctx); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	for req, want := range map[*events.ExecutionRequest]bool{running: true, succeeded: false, recent: true, failed: false, kept: true} {
+		_, err := client.BatchV1().Jobs("automation").Get(ctx, core.ResourceName(req), metav1.GetOptions{})
+		if exists := err == nil; exists != want {
+			t.Errorf("Job %s exists %v, want %v", core.ResourceName(req), exists, want)
+		}
+	}
+	pods, _ := client.CoreV1().Pods("automation").List(ctx, metav1.ListOptions{})
+	if len(pods.Items) != 0 {
+		t.Errorf("orphaned pods not deleted: %+v", pods.Items)
+	}
+	if _, err := client.CoreV1().Secrets("automation").Get(ctx, core.ResourceName(orphan), metav1.GetOptions{}); err == nil {
+		t.Error("orphaned Secret not deleted")
+	}
+	if _, err := client.CoreV1().Secrets("automation").Get(ctx, core.ResourceName(running), metav1.GetOptions{}); err != nil {
+		t.Errorf("Secret of a running run deleted: %v", err)
+	}
+}
+
+func executorPod(req *events.ExecutionRequest, status corev1.PodStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      core.ResourceName(req) + "-x7k2p",
+			Namespace: "automation",
+			Labels: map[string]string{
+				core.LabelApp:   "praetor-execution",
+				core.LabelRunID: req.ExecutionRunID.String(),
+				core.LabelJobID: "42",
+			},
+		},
+		Status: status,
+	}
+}
+
+func TestWatchPodsFailsRunsOfDeadPods(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	c, runs := newController(client)
+	c.Config.ReconcileInterval = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pullFailed, oomKilled, recent, running := newRequest(), newRequest(), newRequest(), newRequest()
+	longAgo := metav1.NewTime(time.Now().Add(-time.Minute))
+	pods := []*corev1.Pod{
+		executorPod(pullFailed, corev1.PodStatus{
+			Phase: corev1.PodPending,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "executor",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+					Reason:  "ImagePullBackOff",
+					Message: `Back-off pulling image "quay.example.com/ee:missing"`,
+				}},
+			}},
+		}),
+		executorPod(oomKilled, corev1.PodStatus{
+			Phase: corev1.PodFailed,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "executor",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					Reason:     "OOMKilled",
+					ExitCode:   137,
+					FinishedAt: longAgo,
+				}},
+			}},
+		}),
+		executorPod(recent, corev1.PodStatus{
+			Phase: corev1.PodFailed,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "executor",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					Reason:     "Error",
+					ExitCode:   1,
+					FinishedAt: metav1.Now(),
+				}},
+			}},
+		}),
+		executorPod(running, corev1.PodStatus{Phase: corev1.PodRunning}),
+	}
+	for _, pod := range pods {
+		if _, err := client.CoreV1().Pods("automation").Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	go c.WatchPods(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, pulled := runs.failure(pullFailed.ExecutionRunID)
+		_, killed := runs.failure(oomKilled.ExecutionRunID)
+		if pulled && killed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("runs of dead pods were not failed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	got, _ := runs.failure(pullFailed.ExecutionRunID)
+	if !strings.HasPrefix(got.Reason, "Container executor cannot start: ImagePullBackOff") {
+		t.Errorf("unexpected image pull failure %q", got.Reason)
+	}
+	got, _ = runs.failure(oomKilled.ExecutionRunID)
+	if got.Reason != "Container executor terminated: OOMKilled (exit code 137)" || got.Logs == "" {
+		t.Errorf("unexpected OOM failure %+v", got)
+	}
+	if _, ok := runs.failure(recent.ExecutionRunID); ok {
+		t.Error("run of a pod that just died should get time to report its own events")
+	}
+	if _, ok := runs.failure(running.ExecutionRunID); ok {
+		t.Error("run of a running pod should not be failed")
+	}
+}
+
+func TestReconcileReportsPodFailure(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	c, runs := newController(client)
+	ctx := context.Background()
+
+	req := newRequest()
+	if err := c.Launch(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	job, _ := client.BatchV1().Jobs("automation").Get(ctx, core.ResourceName(req), metav1.GetOptions{})
+	job.Status.Conditions = []batchv1.JobCondition{{
+		Type:               batchv1.JobFailed,
+		Status:             corev1.ConditionTrue,
+		Reason:             "BackoffLimitExceeded",
+		LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Minute)),
+	}}
+	if _, err := client.BatchV1().Jobs("automation").UpdateStatus(ctx, job, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	pod := executorPod(req, corev1.PodStatus{
+		Phase:   corev1.PodFailed,
+		Reason:  "Evicted",
+		Message: "The node was low on resource: memory.",
+	})
+	if _, err := client.CoreV1().Pods("automation").Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if got, _ := runs.failure(req.ExecutionRunID); got.Reason != "Pod Evicted: The node was low on resource: memory." {
+		t.Errorf("unexpected failure reason %q", got.Reason)
+	}
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func (c *Controller) gcLoop(ctx context.Context) {
+	ticker := time.NewTicker(c.Config.GCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Collect(ctx); err != nil {
+				log.Printf("Error collecting executor resources: %v", err)
+			}
+		}
+	}
+}
+
+// keepFailedJob extends the TTL of a failed Job to KeepFailed, so its pod
+// can still be inspected after the run failed.
+func (c *Controller) keepFailedJob(ctx context.Context, job *batchv1.Job) {
+	ttl := int32(c.Config.retention(true) / time.Second)
+	if job.Spec.TTLSecondsAfterFinished != nil && *job.Spec.TTLSecondsAfterFinished >= ttl {
+		return
+	}
+	patch := fmt.Sprintf(`{"spec":{"ttlSecondsAfterFinished":%d}}`, ttl)
+	_, err := c.K8sClient.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("Failed to keep failed Job %s: %v", job.Name, err)
+	}
+}
+
+// Collect deletes the executor Jobs, pods and Secrets of runs that are no
+// longer active once they have been kept for their retention. This covers
+// what ttlSecondsAfterFinished does not: Jobs that never finish because
+// their pod cannot start, and pods and Secrets left behind by Jobs deleted
+// without their dependents.
+func (c *Controller) Collect(ctx context.Context) error {
+	ns := c.Config.Namespace
+	selector := metav1.ListOptions{LabelSelector: LabelApp + "=" + appExecution}
+	propagation := metav1.DeletePropagationBackground
+	deleteOpts := metav1.DeleteOptions{PropagationPolicy: &propagation}
+
+	jobs, err := c.K8sClient.BatchV1().Jobs(ns).List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("list jobs: %w", err)
+	}
+	jobRuns := map[string]bool{}
+	for _, job := range jobs.Items {
+		jobRuns[job.Labels[LabelRunID]] = true
+		if !c.expired(ctx, job.Labels[LabelRunID], job.CreationTimestamp) {
+			continue
+		}
+		log.Printf("Deleting Job %s of finished run %s", job.Name, job.Labels[LabelRunID])
+		if err := c.K8sClient.BatchV1().Jobs(ns).Delete(ctx, job.Name, deleteOpts); err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("Failed to delete Job %s: %v", job.Name, err)
+		}
+	}
+
+	// Pods and Secrets of existing Jobs go with them
+	pods, err := c.K8sClient.CoreV1().Pods(ns).List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		runID := pod.Labels[LabelRunID]
+		if jobRuns[runID] || !c.expired(ctx, runID, pod.CreationTimestamp) {
+			continue
+		}
+		log.Printf("Deleting orphaned pod %s of run %s", pod.Name, runID)
+		if err := c.K8sClient.CoreV1().Pods(ns).Delete(ctx, pod.Name, deleteOpts); err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("Failed to delete pod %s: %v", pod.Name, err)
+		}
+	}
+
+	secrets, err := c.K8sClient.CoreV1().Secrets(ns).List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("list secrets: %w", err)
+	}
+	for _, secret := range secrets.Items {
+		runID := secret.Labels[LabelRunID]
+		if jobRuns[runID] || !strings.HasPrefix(secret.Name, "execution-") || !c.expired(ctx, runID, secret.CreationTimestamp) {
+			continue
+		}
+		log.Printf("Deleting orphaned Secret %s of run %s", secret.Name, runID)
+		if err := c.K8sClient.CoreV1().Secrets(ns).Delete(ctx, secret.Name, deleteOpts); err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("Failed to delete Secret %s: %v", secret.Name, err)
+		}
+	}
+	return nil
+}
+
+// expired reports whether the resources of a run can be deleted: the run is
+// no longer active and finished, or for runs unknown to the database the
+// resource was created, longer than its retention ago.
+func (c *Controller) expired(ctx context.Context, runLabel string, created metav1.Time) bool {
+	runID, err := uuid.Parse(runLabel)
+	if err != nil {
+		return false
+	}
+	status, err := c.Runs.RunStatus(ctx, runID)
+	if err != nil {
+		log.Printf("Failed to look up run %s: %v", runID, err)
+		return false
+	}
+	if status.Active() {
+		return false
+	}
+	since := created.Time
+	if status.FinishedAt != nil {
+		since = *status.FinishedAt
+	}
+	return c.Now().Sub(since) >= c.Config.retention(status.Failed())
+}
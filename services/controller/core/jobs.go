@@ -0,0 +1,195 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/models"
+	"github.com/praetordev/praetor/pkg/podspec"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Labels of the resources the controller creates for a run.
+const (
+	LabelApp   = "app"
+	LabelRunID = "praetor.io/run-id"
+	LabelJobID = "praetor.io/job-id"
+
+	// AnnotationCanceled marks the Jobs of cancelled runs.
+	AnnotationCanceled = "praetor.io/canceled"
+
+	appExecution = "praetor-execution"
+	manifestKey  = "manifest.json"
+	manifestDir  = "/etc/praetor"
+)
+
+// ResourceName is the name of the Job and Secret of an execution run.
+func ResourceName(req *events.ExecutionRequest) string {
+	return runResourceName(req.ExecutionRunID)
+}
+
+func runResourceName(runID uuid.UUID) string {
+	return "execution-" + runID.String()
+}
+
+func runLabels(req *events.ExecutionRequest) map[string]string {
+	return map[string]string{
+		LabelApp:   appExecution,
+		LabelRunID: req.ExecutionRunID.String(),
+		LabelJobID: strconv.FormatInt(req.UnifiedJobID, 10),
+	}
+}
+
+// buildJob returns the Job that runs the executor in one-shot mode on the
+// manifest mounted from the run's Secret. Runs are never retried by
+// Kubernetes: a new attempt is a new execution run. Finished Jobs are deleted
+// with their pods and Secrets after JobTTL. Runs in a container group
+// get its pod spec override and resource class merged into their pod.
+func buildJob(req *events.ExecutionRequest, cfg Config) (*batchv1.Job, error) {
+	name := ResourceName(req)
+	backoffLimit := int32(0)
+	ttl := int32(cfg.JobTTL / time.Second)
+	image, pullPolicy := cfg.Image, cfg.ImagePullPolicy
+	var pullSecrets []corev1.LocalObjectReference
+	if env := req.JobManifest.ExecutionEnvironment; env != nil {
+		image = env.Image
+		if policy, ok := pullPolicies[env.Pull]; ok {
+			pullPolicy = policy
+		}
+		if env.Credential != nil {
+			pullSecrets = []corev1.LocalObjectReference{{Name: pullSecretName(req)}}
+		}
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cfg.Namespace,
+			Labels:    runLabels(req),
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: runLabels(req)},
+				Spec: corev1.PodSpec{
+					RestartPolicy:    corev1.RestartPolicyNever,
+					ImagePullSecrets: pullSecrets,
+					Containers: []corev1.Container{{
+						Name:            podspec.ExecutorContainer,
+						Image:           image,
+						ImagePullPolicy: pullPolicy,
+						Env: []corev1.EnvVar{
+							{Name: "PRAETOR_MODE", Value: "oneshot"},
+							{Name: "PRAETOR_MANIFEST_PATH", Value: manifestDir + "/" + manifestKey},
+							{Name: "NATS_URL", Value: cfg.NatsURL},
+						},
+						VolumeMounts: []corev1.VolumeMount{{
+							Name:      "manifest",
+							MountPath: manifestDir,
+							ReadOnly:  true,
+						}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "manifest",
+						VolumeSource: corev1.VolumeSource{
+							Secret: &corev1.SecretVolumeSource{SecretName: name},
+						},
+					}},
+				},
+			},
+		},
+	}
+
+	if group := req.JobManifest.ContainerGroup; group != nil {
+		override, err := podspec.Parse(group.PodSpecOverride)
+		if err != nil {
+			return nil, fmt.Errorf("container group %s: %w", group.Name, err)
+		}
+		var resources *corev1.ResourceRequirements
+		if len(group.Resources) > 0 {
+			if resources, err = podspec.ParseResources(group.Resources); err != nil {
+				return nil, fmt.Errorf("container group %s resource class %s: %w", group.Name, group.ResourceClass, err)
+			}
+		}
+		job.Spec.Template.Spec = *podspec.Merge(&job.Spec.Template.Spec, override, resources)
+	}
+	return job, nil
+}
+
+// buildSecret returns the Secret holding the run's manifest, owned by its
+// Job so Kubernetes deletes it along with the Job.
+func buildSecret(req *events.ExecutionRequest, job *batchv1.Job) (*corev1.Secret, error) {
+	manifest, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name,
+			Namespace: job.Namespace,
+			Labels:    runLabels(req),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job")),
+			},
+		},
+		Data: map[string][]byte{manifestKey: manifest},
+	}, nil
+}
+
+// pullPolicies maps execution environment pull options to image pull
+// policies. Environments without one use the configured policy.
+var pullPolicies = map[string]corev1.PullPolicy{
+	models.PullAlways:  corev1.PullAlways,
+	models.PullMissing: corev1.PullIfNotPresent,
+	models.PullNever:   corev1.PullNever,
+}
+
+func pullSecretName(req *events.ExecutionRequest) string {
+	return ResourceName(req) + "-registry"
+}
+
+// buildPullSecret returns the image pull Secret for the run's execution
+// environment registry credential, owned by its Job, or nil if it has none.
+func buildPullSecret(req *events.ExecutionRequest, job *batchv1.Job) (*corev1.Secret, error) {
+	env := req.JobManifest.ExecutionEnvironment
+	if env == nil || env.Credential == nil {
+		return nil, nil
+	}
+	config, err := env.Credential.DockerConfig(env.Image)
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pullSecretName(req),
+			Namespace: job.Namespace,
+			Labels:    runLabels(req),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job")),
+			},
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: config},
+	}, nil
+}
+
+// jobFailure reports whether a Job has failed, why, and since when.
+func jobFailure(job *batchv1.Job) (reason string, since metav1.Time, failed bool) {
+	for _, cond := range job.Status.Conditions {
+		if cond.Type != batchv1.JobFailed || cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		reason = cond.Reason
+		if cond.Message != "" {
+			reason += ": " + cond.Message
+		}
+		return reason, cond.LastTransitionTime, true
+	}
+	return "", metav1.Time{}, false
+}
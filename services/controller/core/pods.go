@@ -0,0 +1,170 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/podspec"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Bounds of the executor log tail recorded for runs whose pod failed
+const (
+	logTailLines = 50
+	logTailBytes = 16 << 10
+)
+
+// fatalWaitingReasons are container waiting reasons a pod does not recover
+// from without someone fixing the image, registry credentials or pod spec.
+var fatalWaitingReasons = map[string]bool{
+	"ImagePullBackOff":           true,
+	"ErrImageNeverPull":          true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// WatchPods fails the runs of executor pods that cannot start or died, e.g.
+// because their image cannot be pulled or they were OOMKilled or evicted,
+// until ctx is cancelled. Such runs never report their own failure.
+func (c *Controller) WatchPods(ctx context.Context) {
+	factory := informers.NewSharedInformerFactoryWithOptions(c.K8sClient, c.Config.ReconcileInterval,
+		informers.WithNamespace(c.Config.Namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = LabelApp + "=" + appExecution
+		}),
+	)
+	informer := factory.Core().V1().Pods().Informer()
+	// Resyncs redeliver pods still within the failure grace period
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.checkPod(ctx, obj) },
+		UpdateFunc: func(_, obj interface{}) { c.checkPod(ctx, obj) },
+	})
+	if err != nil {
+		log.Printf("Failed to watch executor pods: %v", err)
+		return
+	}
+
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	<-ctx.Done()
+	factory.Shutdown()
+}
+
+func (c *Controller) checkPod(ctx context.Context, obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	reason, since, failed := podFailure(pod)
+	if !failed || c.Now().Sub(since) < c.Config.FailureGrace {
+		return
+	}
+
+	runID, err := uuid.Parse(pod.Labels[LabelRunID])
+	if err != nil {
+		log.Printf("Pod %s has no valid run ID label: %v", pod.Name, err)
+		return
+	}
+	jobID, err := strconv.ParseInt(pod.Labels[LabelJobID], 10, 64)
+	if err != nil {
+		log.Printf("Pod %s has no valid job ID label: %v", pod.Name, err)
+		return
+	}
+
+	status, err := c.Runs.RunStatus(ctx, runID)
+	if err != nil {
+		log.Printf("Failed to look up run %s: %v", runID, err)
+		return
+	}
+	if !status.Active() {
+		return
+	}
+	log.Printf("Pod %s failed without its run %s finishing: %s", pod.Name, runID, reason)
+	failure := Failure{Reason: reason, Logs: c.podLogTail(ctx, pod)}
+	if err := c.Runs.FailRun(ctx, runID, jobID, failure); err != nil {
+		log.Printf("Failed to mark run %s failed: %v", runID, err)
+	}
+}
+
+// podFailure reports whether an executor pod has failed, why, and since
+// when. Pods that cannot start fail at once; pods that died are given since
+// their end, so the executor's last events can be ingested first.
+func podFailure(pod *corev1.Pod) (reason string, since time.Time, failed bool) {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, s := range statuses {
+		if w := s.State.Waiting; w != nil && fatalWaitingReasons[w.Reason] {
+			return withMessage(fmt.Sprintf("Container %s cannot start: %s", s.Name, w.Reason), w.Message), time.Time{}, true
+		}
+	}
+
+	if pod.Status.Phase != corev1.PodFailed {
+		return "", time.Time{}, false
+	}
+	since = pod.CreationTimestamp.Time
+	for _, cond := range pod.Status.Conditions {
+		if cond.LastTransitionTime.After(since) {
+			since = cond.LastTransitionTime.Time
+		}
+	}
+	if pod.Status.Reason != "" {
+		// Evicted, DeadlineExceeded and the like apply to the whole pod
+		return withMessage("Pod "+pod.Status.Reason, pod.Status.Message), since, true
+	}
+	for _, s := range statuses {
+		if t := s.State.Terminated; t != nil && t.ExitCode != 0 {
+			reason := fmt.Sprintf("Container %s terminated: %s (exit code %d)", s.Name, t.Reason, t.ExitCode)
+			return withMessage(reason, t.Message), t.FinishedAt.Time, true
+		}
+	}
+	return withMessage("Pod failed", pod.Status.Message), since, true
+}
+
+func withMessage(reason, message string) string {
+	if message = strings.TrimSpace(message); message != "" {
+		return reason + ": " + message
+	}
+	return reason
+}
+
+// podLogTail returns the last lines the executor container logged, or an
+// empty string if there are none, e.g. because it never started.
+func (c *Controller) podLogTail(ctx context.Context, pod *corev1.Pod) string {
+	lines, limit := int64(logTailLines), int64(logTailBytes)
+	logs, err := c.K8sClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container:  podspec.ExecutorContainer,
+		TailLines:  &lines,
+		LimitBytes: &limit,
+	}).DoRaw(ctx)
+	if err != nil {
+		return ""
+	}
+	return string(logs)
+}
+
+// jobPodFailure returns the failure of the first failed pod of a Job, which
+// is more precise than the Job's own failure condition.
+func (c *Controller) jobPodFailure(ctx context.Context, runID uuid.UUID) (Failure, bool) {
+	pods, err := c.K8sClient.CoreV1().Pods(c.Config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: LabelRunID + "=" + runID.String(),
+	})
+	if err != nil {
+		log.Printf("Failed to list pods of run %s: %v", runID, err)
+		return Failure{}, false
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if reason, _, failed := podFailure(pod); failed {
+			return Failure{Reason: reason, Logs: c.podLogTail(ctx, pod)}, true
+		}
+	}
+	return Failure{}, false
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// RunStore is what the controller reads and records about execution runs.
+type RunStore interface {
+	// RunStatus returns the state of the run; runs that do not exist have
+	// no state.
+	RunStatus(ctx context.Context, runID uuid.UUID) (RunStatus, error)
+	// FailRun marks an active run and its job failed, recording the failure
+	// as the run's last event.
+	FailRun(ctx context.Context, runID uuid.UUID, jobID int64, failure Failure) error
+}
+
+// RunStatus is the state of an execution run and when it finished.
+type RunStatus struct {
+	State      string     `db:"state"`
+	FinishedAt *time.Time `db:"finished_at"`
+}
+
+// Active reports whether the run is still pending or running.
+func (s RunStatus) Active() bool {
+	return s.State == "pending" || s.State == "running"
+}
+
+// Failed reports whether the run failed or was lost.
+func (s RunStatus) Failed() bool {
+	return s.State == "failed" || s.State == "lost"
+}
+
+// Failure is why the controller failed a run, with the tail of the executor
+// log if there was one.
+type Failure struct {
+	Reason string `json:"reason"`
+	Logs   string `json:"log_tail,omitempty"`
+}
+
+// DBRunStore keeps execution runs in the database.
+type DBRunStore struct {
+	DB *sqlx.DB
+}
+
+func NewDBRunStore(db *sqlx.DB) *DBRunStore {
+	return &DBRunStore{DB: db}
+}
+
+func (s *DBRunStore) RunStatus(ctx context.Context, runID uuid.UUID) (RunStatus, error) {
+	var status RunStatus
+	err := s.DB.GetContext(ctx, &status, "SELECT state, finished_at FROM execution_runs WHERE id = $1", runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RunStatus{}, nil
+	}
+	return status, err
+}
+
+func (s *DBRunStore) FailRun(ctx context.Context, runID uuid.UUID, jobID int64, failure Failure) error {
+	data, err := json.Marshal(failure)
+	if err != nil {
+		return err
+	}
+	stdout := failure.Reason
+	if failure.Logs != "" {
+		stdout += "\n" + failure.Logs
+	}
+
+	tx, err := s.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE execution_runs SET state = 'failed', finished_at = now()
+		WHERE id = $1 AND state IN ('pending', 'running')`, runID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// The run finished in the meantime
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed', finished_at = now() WHERE id = $1", jobID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO job_events (unified_job_id, execution_run_id, seq, event_type, event_data, stdout_snippet)
+		SELECT $1, $2, COALESCE(MAX(seq), 0) + 1, 'JOB_FAILED', $3, $4
+		FROM job_events WHERE execution_run_id = $2`, jobID, runID, data, stdout)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,20 +1,48 @@
 package core
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/praetordev/praetor/pkg/backend"
 	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// backendPollInterval is how often the agent checks on runs it launched on a
+// backend, readyRetryInterval how often a worker whose runner is not
+// ready checks again.
+var (
+	backendPollInterval = time.Second
+	readyRetryInterval  = 5 * time.Second
 )
 
 type Agent struct {
 	Subscriber EventSubscriber
 	Publisher  EventPublisher
 	Runner     Runner
+	Registrar  InstanceRegistrar // Optional; when set, Workers follows the registered capacity
+	Backends   *backend.Router   // Runs requests on the backend they name; NewAgent registers the process backend
+	Hostname   string
 	Workers    int
+	InstanceID int64
 	wg         sync.WaitGroup
+
+	// fetchCtx is cancelled when draining starts so idle workers stop pulling
+	// jobs; runCtx is passed to every job and cancelled when a drain times out.
+	fetchCtx    context.Context
+	cancelFetch context.CancelFunc
+	runCtx      context.Context
+	cancelRun   context.CancelFunc
+	draining    atomic.Bool
 }
 
 func NewAgent(sub EventSubscriber, pub EventPublisher, runner Runner) *Agent {
@@ -25,66 +53,310 @@ func NewAgent(sub EventSubscriber, pub EventPublisher, runner Runner) *Agent {
 		}
 	}
 
+	hostname, _ := os.Hostname()
+
+	fetchCtx, cancelFetch := context.WithCancel(context.Background())
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	process := NewProcessBackend(runCtx, runner, pub)
 	return &Agent{
-		Subscriber: sub,
-		Publisher:  pub,
-		Runner:     runner,
-		Workers:    workers,
+		Subscriber:  sub,
+		Publisher:   pub,
+		Runner:      runner,
+		Backends:    backend.NewRouter(map[string]backend.ExecutionBackend{models.BackendProcess: process}, models.BackendProcess),
+		Hostname:    hostname,
+		Workers:     workers,
+		fetchCtx:    fetchCtx,
+		cancelFetch: cancelFetch,
+		runCtx:      runCtx,
+		cancelRun:   cancelRun,
 	}
 }
 
+// Start registers the instance (if a Registrar is set), then runs one worker
+// per unit of capacity. Start blocks until all workers have exited, which
+// happens once the agent is stopped (see Stop).
 func (a *Agent) Start() error {
-	reqChan, err := a.Subscriber.SubscribeToExecutionRequests()
-	if err != nil {
-		return err
+	if a.Registrar != nil {
+		if err := a.register(); err != nil {
+			return err
+		}
 	}
 
-	log.Println("Agent started, waiting for jobs...")
+	log.Printf("Agent started with capacity %d, waiting for jobs...", a.Workers)
 
-	// simple worker pool
+	// One worker per slot: a worker only pulls a job when it is idle, which
+	// bounds the in-flight jobs by the instance capacity.
 	for i := 0; i < a.Workers; i++ {
 		a.wg.Add(1)
-		go a.worker(i, reqChan)
+		go a.worker(i)
 	}
 
 	a.wg.Wait()
+	log.Println("Agent stopped")
 	return nil
 }
 
-func (a *Agent) worker(id int, reqChan <-chan events.ExecutionRequest) {
+// register announces this instance and adopts the capacity the control plane
+// grants it. If the control plane does not answer, the local worker count is kept.
+func (a *Agent) register() error {
+	reply, err := a.Registrar.RegisterInstance(&events.InstanceRegistration{
+		Hostname: a.Hostname,
+		Capacity: a.Workers,
+	})
+	if err != nil {
+		log.Printf("Instance registration failed, using local capacity %d: %v", a.Workers, err)
+		return nil
+	}
+	if reply.Error != "" {
+		return fmt.Errorf("instance registration rejected: %s", reply.Error)
+	}
+	if !reply.Enabled {
+		return fmt.Errorf("instance %s (id %d) is disabled", a.Hostname, reply.InstanceID)
+	}
+	if reply.Capacity <= 0 {
+		return fmt.Errorf("instance %s (id %d) has no capacity", a.Hostname, reply.InstanceID)
+	}
+
+	a.InstanceID = reply.InstanceID
+	a.Workers = reply.Capacity
+	log.Printf("Registered as instance %d (%s)", a.InstanceID, a.Hostname)
+	return nil
+}
+
+// Stop drains the agent. It stops pulling new execution requests and waits
+// for in-flight jobs to finish. If ctx expires first, the remaining jobs are
+// cancelled and reported as lost, and ctx.Err() is returned.
+func (a *Agent) Stop(ctx context.Context) error {
+	if !a.draining.CompareAndSwap(false, true) {
+		return nil
+	}
+	log.Println("Agent draining: no longer accepting new jobs")
+	a.cancelFetch()
+
+	finished := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		log.Println("Agent drained, all jobs finished")
+		return nil
+	case <-ctx.Done():
+		log.Printf("Drain deadline exceeded, cancelling in-flight jobs")
+		a.cancelRun()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+func (a *Agent) worker(id int) {
 	defer a.wg.Done()
 	log.Printf("Worker %d started", id)
 
-	for req := range reqChan {
+	refusing := false
+	for {
+		if a.draining.Load() {
+			log.Printf("Worker %d stopped", id)
+			return
+		}
+
+		if checker, ok := a.Runner.(ReadyChecker); ok {
+			if err := checker.Ready(); err != nil {
+				if !refusing {
+					log.Printf("Worker %d not taking new jobs: %v", id, err)
+					refusing = true
+				}
+				select {
+				case <-time.After(readyRetryInterval):
+				case <-a.fetchCtx.Done():
+				}
+				continue
+			}
+			if refusing {
+				log.Printf("Worker %d taking new jobs again", id)
+				refusing = false
+			}
+		}
+
+		req, err := a.Subscriber.FetchExecutionRequest(a.fetchCtx)
+		if err != nil {
+			if a.fetchCtx.Err() != nil {
+				log.Printf("Worker %d stopped", id)
+				return
+			}
+			log.Printf("Worker %d failed to fetch a job: %v", id, err)
+			select {
+			case <-time.After(time.Second):
+			case <-a.fetchCtx.Done():
+			}
+			continue
+		}
+
 		log.Printf("Worker %d picked up run %s", id, req.ExecutionRunID)
-		a.processRequest(req)
+		a.runOnBackend(*req)
 	}
 }
 
-func (a *Agent) processRequest(req events.ExecutionRequest) {
+// runAndPublish runs req, publishing its events, and returns once every event
+// was handed to pub. A run that fails is reported as JOB_FAILED, one stopped
+// through ctx with the event stopped returns. The error is the runner's, or
+// the failure the run reported itself, as runners return nil for a playbook
+// that failed.
+func runAndPublish(ctx context.Context, runner Runner, pub EventPublisher, req events.ExecutionRequest, stopped func() events.JobEvent) error {
 	// Channel to receive events from the runner
 	// We make it buffered so the runner doesn't block too easily
 	eventChan := make(chan events.JobEvent, 100)
+	published := make(chan struct{})
+	var reported error
 
 	// Start a goroutine to consume events from the runner and publish them
 	go func() {
+		defer close(published)
 		seq := int64(1)
 		for evt := range eventChan {
+			if evt.EventType == "JOB_FAILED" && evt.StdoutSnippet != nil {
+				reported = errors.New(*evt.StdoutSnippet)
+			}
+
 			evt.Seq = seq // overwrite logical sequence or trust runner?
 			// Let's trust runner for now, or enforce monotonic here.
 			// Ideally the runner is the source of truth for order, but we can double check.
 
-			if err := a.Publisher.PublishJobEvent(&evt); err != nil {
+			if err := pub.PublishJobEvent(&evt); err != nil {
 				log.Printf("Failed to publish event: %v", err)
 			}
 			seq++
 		}
 	}()
 
-	// Run the job (blocking for this worker)
-	if err := a.Runner.Run(&req, eventChan); err != nil {
-		log.Printf("Job run failed: %v", err)
-		// TODO: Emit JOB_FAILED event if runner didn't
+	err := runner.Run(ctx, &req, eventChan)
+	if err != nil {
+		if ctx.Err() != nil {
+			eventChan <- stopped()
+		} else {
+			log.Printf("Job run failed: %v", err)
+			eventChan <- failedEvent(req, fmt.Sprintf("Job run failed: %v", err))
+		}
 	}
 	close(eventChan)
+
+	// Make sure every event is handed to the bus before the worker moves on,
+	// otherwise a shutdown could close the connection with events pending.
+	<-published
+	if err == nil {
+		err = reported
+	}
+	return err
+}
+
+// runOnBackend launches a request on the backend its instance group selected,
+// the process backend if none, and holds the worker's slot until the run
+// finished there. Such runs report
+// their own events; runs that could not be launched, failed on the backend
+// (e.g. were OOMKilled) or disappeared from it are reported failed here, as
+// their executor may never have had the chance.
+func (a *Agent) runOnBackend(req events.ExecutionRequest) {
+	name, runID := req.JobManifest.Backend, req.ExecutionRunID
+	if name == "" {
+		name = models.BackendProcess
+	}
+	err := fmt.Errorf("executor has no %s backend", name)
+	if a.Backends != nil {
+		err = a.Backends.Launch(a.runCtx, &req)
+	}
+	if err != nil {
+		log.Printf("Failed to launch run %s on the %s backend: %v", runID, name, err)
+		a.publishFailure(req, fmt.Sprintf("Failed to launch run on the %s backend: %v", name, err))
+		return
+	}
+	defer func() {
+		if err := a.Backends.Cleanup(context.Background(), runID); err != nil {
+			log.Printf("Failed to clean up run %s on the %s backend: %v", runID, name, err)
+		}
+	}()
+
+	// Backends that tell when a run finished need not wait for the next poll
+	done, _ := a.Backends.Done(runID)
+	ticker := time.NewTicker(backendPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.runCtx.Done():
+			// Stopping the run gives it the chance to report it was cut short
+			log.Printf("Run %s cancelled during shutdown", runID)
+			if err := a.Backends.Cancel(context.Background(), runID); err != nil {
+				log.Printf("Failed to cancel run %s on the %s backend: %v", runID, name, err)
+			}
+			return
+		case <-ticker.C:
+		case <-done:
+		}
+
+		status, err := a.Backends.Status(a.runCtx, runID)
+		if errors.Is(err, backend.ErrUnknownRun) {
+			log.Printf("Run %s disappeared from the %s backend", runID, name)
+			a.publishFailure(req, fmt.Sprintf("Run disappeared from the %s backend", name))
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to check run %s on the %s backend: %v", runID, name, err)
+			continue
+		}
+		if status.Finished() {
+			log.Printf("Run %s finished on the %s backend: %s %s", runID, name, status.State, status.Reason)
+			// The process backend ran the job here, which reported how it ended
+			if status.State == backend.StateFailed && name != models.BackendProcess {
+				msg := fmt.Sprintf("Run failed on the %s backend", name)
+				if status.Reason != "" {
+					msg += ": " + status.Reason
+				}
+				a.publishFailure(req, msg)
+			}
+			return
+		}
+	}
+}
+
+// publishFailure reports a run failed outside the events its runner
+// publishes. The event has no sequence number, so the consumer numbers it
+// after the run's last event.
+func (a *Agent) publishFailure(req events.ExecutionRequest, msg string) {
+	evt := failedEvent(req, msg)
+	if err := a.Publisher.PublishJobEvent(&evt); err != nil {
+		log.Printf("Failed to publish event: %v", err)
+	}
+}
+
+func failedEvent(req events.ExecutionRequest, msg string) events.JobEvent {
+	return events.JobEvent{
+		ExecutionRunID: req.ExecutionRunID,
+		UnifiedJobID:   req.UnifiedJobID,
+		EventType:      "JOB_FAILED",
+		Timestamp:      time.Now(),
+		StdoutSnippet:  &msg,
+	}
+}
+
+// lostEvent builds the terminal event for a run the executor abandoned. The
+// consumer records the execution run as "lost" and the job as failed.
+func lostEvent(req events.ExecutionRequest, reason string) events.JobEvent {
+	return stoppedEvent(req, "lost", reason)
+}
+
+// canceledEvent builds the terminal event for a run that was cancelled. The
+// consumer records both the execution run and the job as "canceled".
+func canceledEvent(req events.ExecutionRequest, reason string) events.JobEvent {
+	return stoppedEvent(req, "canceled", reason)
+}
+
+func stoppedEvent(req events.ExecutionRequest, state, reason string) events.JobEvent {
+	data, _ := json.Marshal(map[string]string{
+		"run_state": state,
+		"reason":    reason,
+	})
+	evt := failedEvent(req, reason)
+	evt.EventData = data
+	return evt
 }
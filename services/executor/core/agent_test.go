@@ -1,6 +1,10 @@
 package core_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -22,6 +26,7 @@ func TestAgentProcessing(t *testing.T) {
 
 	// Start Agent in goroutine
 	go agent.Start()
+	defer agent.Stop(context.Background())
 
 	// Feed a request
 	uid := uuid.New()
@@ -30,7 +35,6 @@ func TestAgentProcessing(t *testing.T) {
 		UnifiedJobID:   1,
 	}
 	reqChan <- req
-	close(reqChan) // Close to let agent finish after processing
 
 	// Collect events
 	// We expect 5 events from MockRunner
@@ -58,14 +62,230 @@ func TestAgentProcessing(t *testing.T) {
 	}
 }
 
+func TestAgentStopDrainsInFlightJobs(t *testing.T) {
+	reqChan := make(chan events.ExecutionRequest, 10)
+	eventChan := make(chan events.JobEvent, 20)
+
+	sub := &TestSubscriber{ch: reqChan}
+	pub := &TestPublisher{ch: eventChan}
+	agent := core.NewAgent(sub, pub, &core.MockRunner{TaskDelay: 50 * time.Millisecond})
+
+	started := make(chan error, 1)
+	go func() { started <- agent.Start() }()
+
+	uid := uuid.New()
+	reqChan <- events.ExecutionRequest{ExecutionRunID: uid, UnifiedJobID: 1}
+	waitForEvent(t, eventChan, "JOB_STARTED")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := agent.Stop(ctx); err != nil {
+		t.Fatalf("Expected clean drain, got %v", err)
+	}
+
+	// The in-flight job must have completed normally
+	var last events.JobEvent
+	for len(eventChan) > 0 {
+		last = <-eventChan
+	}
+	if last.EventType != "JOB_COMPLETED" {
+		t.Errorf("Expected last event JOB_COMPLETED, got %s", last.EventType)
+	}
+
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Errorf("Start returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start did not return after Stop")
+	}
+}
+
+func TestAgentStopCancelsJobsAfterDeadline(t *testing.T) {
+	reqChan := make(chan events.ExecutionRequest, 10)
+	eventChan := make(chan events.JobEvent, 20)
+
+	sub := &TestSubscriber{ch: reqChan}
+	pub := &TestPublisher{ch: eventChan}
+	agent := core.NewAgent(sub, pub, &core.MockRunner{TaskDelay: 10 * time.Second})
+	agent.Workers = 1
+
+	go agent.Start()
+
+	running := uuid.New()
+	queued := uuid.New()
+	reqChan <- events.ExecutionRequest{ExecutionRunID: running, UnifiedJobID: 1}
+	waitForEvent(t, eventChan, "JOB_STARTED")
+	reqChan <- events.ExecutionRequest{ExecutionRunID: queued, UnifiedJobID: 2}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := agent.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+
+	evt := waitForEvent(t, eventChan, "JOB_FAILED")
+	if evt.ExecutionRunID != running {
+		t.Errorf("Expected in-flight run %s to be reported, got %s", running, evt.ExecutionRunID)
+	}
+	var data map[string]string
+	if err := json.Unmarshal(evt.EventData, &data); err != nil || data["run_state"] != "lost" {
+		t.Errorf("Expected lost run_state, got %s", evt.EventData)
+	}
+
+	// The queued request was never pulled, so another executor can still run it
+	if len(reqChan) != 1 {
+		t.Fatalf("Expected queued request to remain in the queue, %d left", len(reqChan))
+	}
+	if left := <-reqChan; left.ExecutionRunID != queued {
+		t.Errorf("Expected %s to remain queued, got %s", queued, left.ExecutionRunID)
+	}
+}
+
+func TestAgentInFlightBoundedByRegisteredCapacity(t *testing.T) {
+	reqChan := make(chan events.ExecutionRequest, 10)
+	eventChan := make(chan events.JobEvent, 50)
+
+	runner := &trackingRunner{inner: &core.MockRunner{TaskDelay: 20 * time.Millisecond}}
+	agent := core.NewAgent(&TestSubscriber{ch: reqChan}, &TestPublisher{ch: eventChan}, runner)
+	agent.Workers = 5
+	agent.Registrar = &TestRegistrar{reply: events.InstanceRegistrationReply{InstanceID: 7, Capacity: 2, Enabled: true}}
+
+	go agent.Start()
+	defer agent.Stop(context.Background())
+
+	for i := 0; i < 6; i++ {
+		reqChan <- events.ExecutionRequest{ExecutionRunID: uuid.New(), UnifiedJobID: int64(i)}
+	}
+	for i := 0; i < 6; i++ {
+		waitForEvent(t, eventChan, "JOB_COMPLETED")
+	}
+
+	if agent.InstanceID != 7 {
+		t.Errorf("Expected instance ID 7, got %d", agent.InstanceID)
+	}
+	if max := runner.max.Load(); max != 2 {
+		t.Errorf("Expected at most 2 jobs in flight (registered capacity), observed %d", max)
+	}
+}
+
+func TestAgentRegistrationRejectsDisabledInstance(t *testing.T) {
+	agent := core.NewAgent(&TestSubscriber{ch: make(chan events.ExecutionRequest)}, &TestPublisher{}, &core.MockRunner{})
+	agent.Registrar = &TestRegistrar{reply: events.InstanceRegistrationReply{InstanceID: 3, Capacity: 4, Enabled: false}}
+
+	if err := agent.Start(); err == nil {
+		t.Fatal("Expected Start to fail for a disabled instance")
+	}
+}
+
+func TestAgentsShareQueueFairly(t *testing.T) {
+	// Both agents pull from the same queue; each has a single slot
+	reqChan := make(chan events.ExecutionRequest, 10)
+	sub := &TestSubscriber{ch: reqChan}
+
+	jobs := 6
+	completed := make(chan string, jobs)
+	agents := map[string]*core.Agent{}
+	for _, name := range []string{"exec-a", "exec-b"} {
+		pub := &TestPublisher{ch: make(chan events.JobEvent, 50)}
+		agent := core.NewAgent(sub, pub, &core.MockRunner{TaskDelay: 30 * time.Millisecond})
+		agent.Workers = 1
+		agents[name] = agent
+
+		go agent.Start()
+		defer agent.Stop(context.Background())
+
+		go func(name string, ch <-chan events.JobEvent) {
+			for evt := range ch {
+				if evt.EventType == "JOB_COMPLETED" {
+					completed <- name
+				}
+			}
+		}(name, pub.ch)
+	}
+
+	for i := 0; i < jobs; i++ {
+		reqChan <- events.ExecutionRequest{ExecutionRunID: uuid.New(), UnifiedJobID: int64(i)}
+	}
+
+	counts := map[string]int{}
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < jobs; i++ {
+		select {
+		case name := <-completed:
+			counts[name]++
+		case <-timeout:
+			t.Fatalf("Timed out waiting for jobs, completed: %v", counts)
+		}
+	}
+
+	// A greedy executor would take every queued job; pull-based fetching
+	// should split them roughly evenly.
+	for name := range agents {
+		if counts[name] < 2 {
+			t.Errorf("Expected %s to run at least 2 of %d jobs, got distribution %v", name, jobs, counts)
+		}
+	}
+}
+
 // -- Test Helpers --
 
+func waitForEvent(t *testing.T, ch <-chan events.JobEvent, eventType string) events.JobEvent {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case evt := <-ch:
+			if evt.EventType == eventType {
+				return evt
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %s event", eventType)
+		}
+	}
+}
+
+// TestSubscriber is an in-memory work queue shared by any number of agents.
 type TestSubscriber struct {
 	ch chan events.ExecutionRequest
 }
 
-func (s *TestSubscriber) SubscribeToExecutionRequests() (<-chan events.ExecutionRequest, error) {
-	return s.ch, nil
+func (s *TestSubscriber) FetchExecutionRequest(ctx context.Context) (*events.ExecutionRequest, error) {
+	select {
+	case req := <-s.ch:
+		return &req, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type TestRegistrar struct {
+	reply events.InstanceRegistrationReply
+}
+
+func (r *TestRegistrar) RegisterInstance(reg *events.InstanceRegistration) (*events.InstanceRegistrationReply, error) {
+	reply := r.reply
+	return &reply, nil
+}
+
+// trackingRunner records the highest number of concurrent runs.
+type trackingRunner struct {
+	inner   core.Runner
+	current atomic.Int64
+	max     atomic.Int64
+}
+
+func (r *trackingRunner) Run(ctx context.Context, req *events.ExecutionRequest, eventChan chan<- events.JobEvent) error {
+	n := r.current.Add(1)
+	defer r.current.Add(-1)
+	for {
+		max := r.max.Load()
+		if n <= max || r.max.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	return r.inner.Run(ctx, req, eventChan)
 }
 
 type TestPublisher struct {
@@ -79,3 +299,21 @@ func (p *TestPublisher) PublishJobEvent(event *events.JobEvent) error {
 func (p *TestPublisher) PublishLogChunk(chunk *events.LogChunk) error {
 	return nil
 }
+
+func TestAgentFailsRequestsOfBackendsItLacks(t *testing.T) {
+	reqChan := make(chan events.ExecutionRequest, 10)
+	eventChan := make(chan events.JobEvent, 10)
+	runner := &trackingRunner{inner: &core.MockRunner{}}
+	agent := core.NewAgent(&TestSubscriber{ch: reqChan}, &TestPublisher{ch: eventChan}, runner)
+	go agent.Start()
+	defer agent.Stop(context.Background())
+
+	reqChan <- events.ExecutionRequest{ExecutionRunID: uuid.New(), UnifiedJobID: 1, JobManifest: events.JobManifest{Backend: "docker"}}
+	evt := waitForEvent(t, eventChan, "JOB_FAILED")
+	if evt.StdoutSnippet == nil || *evt.StdoutSnippet != "Failed to launch run on the docker backend: no \"docker\" execution backend available" {
+		t.Errorf("unexpected failure %v", evt.StdoutSnippet)
+	}
+	if runner.max.Load() != 0 {
+		t.Error("request of the docker backend was run in process")
+	}
+}
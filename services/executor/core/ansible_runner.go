@@ -1,21 +1,21 @@
 package core
 
 import (
-	"archive/tar"
 	"bytes"
-	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/praetordev/praetor/pkg/content"
 	"github.com/praetordev/praetor/pkg/events"
 )
 
@@ -30,41 +30,120 @@ func extractSeq(filename string) int {
 }
 
 type AnsibleRunner struct {
-	BaseDir string
+	BaseDir      string        // Directory holding the private run directories
+	ProjectsRoot string        // Directory holding manual projects
+	Cache        *ProjectCache // Optional; when set, projects are served from synced archives
+	Results      content.Store // Optional; holds inventory update results too large for an event
+	Artifacts    content.Store // Optional; when set, a tarball of each playbook run's artifacts is kept
+	Facts        content.Store // Optional; holds the fact caches manifests refer to
+
+	KeepFailed   bool   // Keep the directories of failed playbook and inventory update runs for debugging
+	MinFreeBytes int64  // Refuse new runs with less space left on BaseDir's volume; 0 disables
+	Isolation    string // IsolationBubblewrap sandboxes ansible-runner; empty runs it directly
+
+	MaxArchiveBytes  int64 // Largest archive project download; 0 disables
+	MaxUnpackedBytes int64 // Most an archive project may unpack to; 0 disables
 }
 
 func NewAnsibleRunner() *AnsibleRunner {
-	// Create base dir for runs
-	base := "/tmp/praetor_runs"
-	if err := os.MkdirAll(base, 0755); err != nil {
+	// Run directories hold inventories and credentials, so only the
+	// executor's user may enter them
+	base := os.Getenv("EXECUTOR_RUN_DIR")
+	if base == "" {
+		base = "/tmp/praetor_runs"
+	}
+	if err := os.MkdirAll(base, 0700); err != nil {
 		log.Printf("Warning: Failed to create base dir %s: %v", base, err)
 	}
-	return &AnsibleRunner{BaseDir: base}
+	projectsRoot := os.Getenv("PROJECTS_ROOT")
+	if projectsRoot == "" {
+		projectsRoot = "/var/lib/praetor/projects"
+	}
+
+	r := &AnsibleRunner{
+		BaseDir:      base,
+		ProjectsRoot: projectsRoot,
+		MinFreeBytes: 1024 << 20,
+		Isolation:    os.Getenv("EXECUTOR_ISOLATION"),
+
+		MaxArchiveBytes:  1024 << 20,
+		MaxUnpackedBytes: 4096 << 20,
+	}
+	if val := os.Getenv("EXECUTOR_KEEP_FAILED_RUNS"); val != "" {
+		keep, err := strconv.ParseBool(val)
+		if err != nil {
+			log.Printf("Invalid EXECUTOR_KEEP_FAILED_RUNS %q, removing failed runs", val)
+		}
+		r.KeepFailed = keep
+	}
+	if val := os.Getenv("EXECUTOR_MIN_FREE_MB"); val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n >= 0 {
+			r.MinFreeBytes = n << 20
+		} else {
+			log.Printf("Invalid EXECUTOR_MIN_FREE_MB %q, using %d", val, r.MinFreeBytes>>20)
+		}
+	}
+	for env, limit := range map[string]*int64{"EXECUTOR_MAX_ARCHIVE_MB": &r.MaxArchiveBytes, "EXECUTOR_MAX_UNPACKED_MB": &r.MaxUnpackedBytes} {
+		if val := os.Getenv(env); val != "" {
+			if n, err := strconv.ParseInt(val, 10, 64); err == nil && n >= 0 {
+				*limit = n << 20
+			} else {
+				log.Printf("Invalid %s %q, using %d", env, val, *limit>>20)
+			}
+		}
+	}
+	if r.Isolation != "" && r.Isolation != IsolationBubblewrap {
+		log.Printf("Unknown EXECUTOR_ISOLATION %q, running playbooks without isolation", r.Isolation)
+		r.Isolation = ""
+	}
+	return r
 }
 
-func (r *AnsibleRunner) Run(req *events.ExecutionRequest, eventChan chan<- events.JobEvent) error {
+func (r *AnsibleRunner) Run(ctx context.Context, req *events.ExecutionRequest, eventChan chan<- events.JobEvent) error {
+	if req.JobManifest.JobType == events.JobTypeProjectUpdate {
+		return r.runProjectUpdate(ctx, req, eventChan)
+	}
+	if req.JobManifest.JobType == events.JobTypeInventoryUpdate {
+		return r.runInventoryUpdate(ctx, req, eventChan)
+	}
+
+	if err := r.Ready(); err != nil {
+		return err
+	}
+
 	runID := req.ExecutionRunID.String()
 	runDir := filepath.Join(r.BaseDir, runID)
 	log.Printf("AnsibleRunner: Preparing run %s in %s", runID, runDir)
+	failed := true
+	defer func() { r.finishRunDir(runDir, failed) }()
 
 	// 1. Prepare Directory Structure
 	// ansible-runner expects:
 	// private_data_dir/
 	//   inventory/
-	//     hosts
+	//     hosts.json
 	//   project/
 	//     playbook.yml
 	//   env/
 	//     extravars
-	if err := r.prepareDirectory(runDir, req); err != nil {
+	if err := r.prepareDirectory(ctx, runDir, req); err != nil {
 		return fmt.Errorf("failed to prepare directory: %w", err)
 	}
+	factsDir := factCacheDir(runDir, runID)
+	seeded, err := seedFactCache(factsDir, r.loadFactCache(ctx, req))
+	if err != nil {
+		return fmt.Errorf("failed to seed fact cache: %w", err)
+	}
 
 	// 2. Start Event Watcher
 	// We watch artifacts/<ident>/job_events/ for *.json files
 	// Since ansible-runner creates directories dynamically, we'll poll inside the goroutine
 	doneChan := make(chan bool)
-	go r.watchEvents(runDir, req, eventChan, doneChan)
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		r.watchEvents(runDir, req, eventChan, doneChan)
+	}()
 
 	// 3. Exec ansible-runner with verbosity for detailed output
 	// Use playbook path from manifest, default to playbook.yml
@@ -73,7 +152,14 @@ func (r *AnsibleRunner) Run(req *events.ExecutionRequest, eventChan chan<- event
 		playbookPath = "playbook.yml"
 	}
 	log.Printf("AnsibleRunner: Executing ansible-runner with playbook %s...", playbookPath)
-	cmd := exec.Command("ansible-runner", "run", runDir, "-p", playbookPath, "-v")
+	// The run ID as ident fixes the artifacts directory, and so the fact cache
+	cmd := r.playbookCommand(ctx, runDir, "run", runDir, "-p", playbookPath, "-v", "--ident", runID)
+	// On cancellation ask ansible-runner to stop so it can terminate its own
+	// ansible-playbook children, and only kill it if it does not exit in time.
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = 15 * time.Second
 	var stdoutBuf, stderrBuf bytes.Buffer
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
@@ -86,7 +172,25 @@ func (r *AnsibleRunner) Run(req *events.ExecutionRequest, eventChan chan<- event
 		Timestamp:      time.Now(),
 	}
 
-	if err := cmd.Run(); err != nil {
+	runErr := cmd.Run()
+	// Every event is read before the run directory may go away
+	close(doneChan)
+	<-watched
+	if runErr != nil && ctx.Err() != nil {
+		// Killed because the executor is shutting down; the caller reports the run as lost
+		log.Printf("AnsibleRunner: run %s interrupted: %v", runID, ctx.Err())
+		return ctx.Err()
+	}
+
+	// Facts gathered and artifacts left before a failure are reported too
+	for _, evt := range collectFacts(factsDir, seeded, req) {
+		eventChan <- evt
+	}
+	if evt, ok := r.collectArtifacts(ctx, artifactsDir(runDir, runID), req); ok {
+		eventChan <- evt
+	}
+
+	if err := runErr; err != nil {
 		// Runner failed (could be playbook failure or system failure)
 		log.Printf("AnsibleRunner: execution failed: %v", err)
 		log.Printf("AnsibleRunner Stdout: %s", stdoutBuf.String())
@@ -106,6 +210,7 @@ func (r *AnsibleRunner) Run(req *events.ExecutionRequest, eventChan chan<- event
 		}
 	} else {
 		// Emit explicit COMPLETED event on success
+		failed = false
 		eventChan <- events.JobEvent{
 			ExecutionRunID: req.ExecutionRunID,
 			UnifiedJobID:   req.UnifiedJobID,
@@ -114,63 +219,52 @@ func (r *AnsibleRunner) Run(req *events.ExecutionRequest, eventChan chan<- event
 		}
 	}
 
-	// 4. Cleanup / Finish
-	close(doneChan)
 	log.Printf("AnsibleRunner: Finished run %s", runID)
-
-	// Emit completion event if not already emitted by watcher (usually watcher handles tasks, but Agent handles completion?
-	// Actually, Agent code says: "Emit JOB_FAILED event if runner did not".
-	// The watchers usually emit a recap or specific event.
-	// For simplicity, we let the Agent handle the final JOB_COMPLETED/FAILED based on our return,
-	// OR we ensure we emit at least JOB_STARTED/COMPLETED via the loop.
-	// But let's assume successful return means success.
-
-	// Wait a moment for watcher to drain?
-	time.Sleep(1 * time.Second)
-
 	return nil
 }
 
-func (r *AnsibleRunner) prepareDirectory(runDir string, req *events.ExecutionRequest) error {
-	if err := os.MkdirAll(filepath.Join(runDir, "inventory"), 0755); err != nil {
+func (r *AnsibleRunner) prepareDirectory(ctx context.Context, runDir string, req *events.ExecutionRequest) error {
+	if err := os.MkdirAll(filepath.Join(runDir, "inventory"), 0700); err != nil {
 		return err
 	}
-	if err := os.MkdirAll(filepath.Join(runDir, "project"), 0755); err != nil {
+	if err := os.MkdirAll(filepath.Join(runDir, "project"), 0700); err != nil {
 		return err
 	}
-	if err := os.MkdirAll(filepath.Join(runDir, "env"), 0755); err != nil {
+	if err := os.MkdirAll(filepath.Join(runDir, "env"), 0700); err != nil {
 		return err
 	}
 
-	// Inventory
+	// Inventory - JSON in the YAML inventory structure from the scheduler;
+	// anything else is passed through as INI
 	inv := req.JobManifest.Inventory
 	log.Printf("AnsibleRunner: Received Inventory Length: %d", len(inv))
-	if len(inv) > 100 {
-		log.Printf("AnsibleRunner: Inventory Content Head: %s", inv[:100])
-	} else {
-		log.Printf("AnsibleRunner: Inventory Content: %s", inv)
-	}
 
+	invFile := "hosts.json"
 	if inv == "" {
-		inv = "localhost ansible_connection=local"
+		inv, invFile = "localhost ansible_connection=local", "hosts.ini"
+	} else if !strings.HasPrefix(strings.TrimSpace(inv), "{") {
+		invFile = "hosts.ini"
 	}
-	if err := os.WriteFile(filepath.Join(runDir, "inventory", "hosts.ini"), []byte(inv), 0644); err != nil {
+	if err := os.WriteFile(filepath.Join(runDir, "inventory", invFile), []byte(inv), 0600); err != nil {
 		return err
 	}
 
-	// Project - clone from git if URL provided
+	// Project - fetch the pinned revision if a project is provided
 	projectURL := req.JobManifest.ProjectURL
 	if projectURL != "" {
-		// Clone the project repository
 		projectDir := filepath.Join(runDir, "project")
-		log.Printf("Cloning project from %s to %s", projectURL, projectDir)
+		projectRef := req.JobManifest.ProjectRef
+		if r.restoreProject(ctx, req.JobManifest.ProjectArchive, projectDir) {
+			log.Printf("Restored project %s at %q from archive %s", projectURL, projectRef, req.JobManifest.ProjectArchive)
+		} else {
+			log.Printf("Fetching %s project %s at %q to %s", sourceType(req.JobManifest.ProjectSource), projectURL, projectRef, projectDir)
 
-		cmd := exec.Command("git", "clone", "--depth", "1", projectURL, projectDir)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("failed to clone project: %w\n%s", err, string(output))
+			src, err := r.fetchProject(ctx, req.JobManifest, filepath.Join(runDir, "scm"), projectDir)
+			if err != nil {
+				return fmt.Errorf("failed to fetch project: %w\n%s", err, string(src.Output))
+			}
+			log.Printf("Fetched project successfully")
 		}
-		log.Printf("Cloned project successfully")
 	} else {
 		// Use inline playbook content if provided, otherwise default to ping
 		play := req.JobManifest.PlaybookContent
@@ -178,68 +272,40 @@ func (r *AnsibleRunner) prepareDirectory(runDir string, req *events.ExecutionReq
 			play = "- hosts: all\n  tasks:\n    - name: Ping\n      ping:"
 		}
 
-		if err := os.WriteFile(filepath.Join(runDir, "project", "playbook.yml"), []byte(play), 0644); err != nil {
+		if err := os.WriteFile(filepath.Join(runDir, "project", "playbook.yml"), []byte(play), 0600); err != nil {
 			return err
 		}
 	}
 
+	if err := writeRunnerEnv(runDir, filepath.Join(runDir, "project")); err != nil {
+		return err
+	}
+
 	// ExtraVars
 	// TODO: Marshal map to JSON/YAML and write to env/extravars
 
 	return nil
 }
 
-// extractTarGz extracts a tar.gz byte slice to the target directory
-func extractTarGz(data []byte, targetDir string) error {
-	gr, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return err
+// restoreProject extracts the synced project archive into projectDir. It
+// reports false when there is no archive to use, in which case projectDir is
+// left empty for a git checkout.
+func (r *AnsibleRunner) restoreProject(ctx context.Context, key, projectDir string) bool {
+	if r.Cache == nil || key == "" {
+		return false
 	}
-	defer gr.Close()
-
-	tr := tar.NewReader(gr)
-
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		targetPath := filepath.Join(targetDir, header.Name)
-
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(targetPath, 0755); err != nil {
-				return err
-			}
-		case tar.TypeReg:
-			// Ensure parent directory exists
-			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-				return err
-			}
-
-			outFile, err := os.Create(targetPath)
-			if err != nil {
-				return err
-			}
-
-			if _, err := io.Copy(outFile, tr); err != nil {
-				outFile.Close()
-				return err
-			}
-			outFile.Close()
-
-			// Set permissions
-			if err := os.Chmod(targetPath, os.FileMode(header.Mode)); err != nil {
-				return err
-			}
-		}
+	err := r.Cache.Extract(ctx, key, projectDir)
+	if err == nil {
+		return true
 	}
-
-	return nil
+	if errors.Is(err, content.ErrNotFound) {
+		log.Printf("Project archive %s not cached, falling back to git", key)
+	} else {
+		log.Printf("Failed to restore project archive %s, falling back to git: %v", key, err)
+	}
+	// Start the checkout from a clean directory
+	_ = os.RemoveAll(projectDir)
+	return false
 }
 
 func (r *AnsibleRunner) watchEvents(runDir string, req *events.ExecutionRequest, eventChan chan<- events.JobEvent, doneChan <-chan bool) {
@@ -345,11 +411,14 @@ func (r *AnsibleRunner) processNewEvents(eventsDir string, req *events.Execution
 		}
 
 		if praetorType != "UNKNOWN" {
-			var taskName string
+			var taskName, host string
 			if eventData, ok := rawEvt["event_data"].(map[string]interface{}); ok {
 				if t, ok := eventData["task"].(string); ok {
 					taskName = t
 				}
+				if h, ok := eventData["host"].(string); ok {
+					host = h
+				}
 			}
 
 			eventChan <- events.JobEvent{
@@ -358,6 +427,7 @@ func (r *AnsibleRunner) processNewEvents(eventsDir string, req *events.Execution
 				EventType:      praetorType,
 				Timestamp:      time.Now(),
 				Seq:            int64(counter),
+				Host:           safeStringPtr(host),
 				TaskName:       safeStringPtr(taskName),
 				EventData:      json.RawMessage(content),
 				StdoutSnippet:  stdoutSnippet,
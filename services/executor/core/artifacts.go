@@ -0,0 +1,135 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/praetordev/praetor/pkg/content"
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+// maxArtifactData is the largest set_stats data reported in an event; larger
+// data is dropped from the event but kept in the uploaded archive.
+const maxArtifactData = 512 << 10
+
+// artifactsDir is where ansible-runner leaves the artifacts of a run started
+// with --ident ident.
+func artifactsDir(runDir, ident string) string {
+	return filepath.Join(runDir, "artifacts", ident)
+}
+
+// artifactArchiveKey is the Artifacts store key of a run's artifacts tarball.
+func artifactArchiveKey(runID string) string {
+	return fmt.Sprintf("job-artifacts/%s.tar.gz", runID)
+}
+
+// collectArtifacts builds the JOB_ARTIFACTS event of a playbook run from its
+// artifacts directory, uploading a tarball of the directory when an
+// Artifacts store is set. It reports false if the run left no artifacts.
+func (r *AnsibleRunner) collectArtifacts(ctx context.Context, dir string, req *events.ExecutionRequest) (events.JobEvent, bool) {
+	if _, err := os.Stat(dir); err != nil {
+		return events.JobEvent{}, false
+	}
+
+	var data events.JobArtifacts
+	if rc, err := os.ReadFile(filepath.Join(dir, "rc")); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(rc))); err == nil {
+			data.RC = &n
+		}
+	}
+	if status, err := os.ReadFile(filepath.Join(dir, "status")); err == nil {
+		data.Status = strings.TrimSpace(string(status))
+	}
+	if stats, err := readArtifactData(filepath.Join(dir, "job_events")); err != nil {
+		log.Printf("Skipping set_stats data of run %s: %v", req.ExecutionRunID, err)
+	} else {
+		data.ArtifactData = stats
+	}
+
+	if r.Artifacts != nil {
+		key := artifactArchiveKey(req.ExecutionRunID.String())
+		if err := r.uploadArtifacts(ctx, dir, key); err != nil {
+			log.Printf("Failed to upload artifacts of run %s: %v", req.ExecutionRunID, err)
+		} else {
+			data.Archive = key
+		}
+	}
+
+	raw, _ := json.Marshal(data)
+	return events.JobEvent{
+		ExecutionRunID: req.ExecutionRunID,
+		UnifiedJobID:   req.UnifiedJobID,
+		EventType:      "JOB_ARTIFACTS",
+		Timestamp:      time.Now(),
+		EventData:      raw,
+	}, true
+}
+
+// readArtifactData returns the artifact_data of the last play recap among
+// the run's events, which holds what the playbook set with set_stats.
+func readArtifactData(eventsDir string) (json.RawMessage, error) {
+	files, err := os.ReadDir(eventsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return extractSeq(files[i].Name()) > extractSeq(files[j].Name())
+	})
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(eventsDir, f.Name()))
+		if err != nil {
+			continue
+		}
+		var evt struct {
+			Event     string `json:"event"`
+			EventData struct {
+				ArtifactData json.RawMessage `json:"artifact_data"`
+			} `json:"event_data"`
+		}
+		if json.Unmarshal(content, &evt) != nil || evt.Event != "playbook_on_stats" {
+			continue
+		}
+		stats := evt.EventData.ArtifactData
+		if len(stats) == 0 || string(stats) == "null" {
+			return nil, nil
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, stats); err != nil {
+			return nil, err
+		}
+		if compact.Len() > maxArtifactData {
+			return nil, fmt.Errorf("%d bytes of set_stats data exceed the %d byte limit", compact.Len(), maxArtifactData)
+		}
+		return compact.Bytes(), nil
+	}
+	return nil, nil
+}
+
+// uploadArtifacts streams a gzipped tarball of the artifacts directory to the
+// Artifacts store under key.
+func (r *AnsibleRunner) uploadArtifacts(ctx context.Context, dir, key string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(content.PackDir(dir, pw))
+	}()
+	err := r.Artifacts.Put(ctx, key, pr)
+	// Unblock the packer if the store gave up early
+	pr.CloseWithError(err)
+	return err
+}
@@ -0,0 +1,102 @@
+package core_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/praetordev/praetor/pkg/content"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/services/executor/core"
+)
+
+// fakeArtifactsRunner puts an ansible-runner on PATH that leaves artifacts
+// as a playbook calling set_stats would.
+func fakeArtifactsRunner(t *testing.T) {
+	t.Helper()
+	bin := t.TempDir()
+	script := `#!/bin/sh
+dir="$2"
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--ident" ]; then ident="$2"; fi
+  shift
+done
+art="$dir/artifacts/$ident"
+mkdir -p "$art/job_events"
+echo '{"event": "playbook_on_start", "counter": 1}' > "$art/job_events/1-start.json"
+echo '{"event": "playbook_on_stats", "counter": 2, "event_data": {"artifact_data": {"release": "1.4.2", "hosts": 3}}}' > "$art/job_events/2-stats.json"
+echo 0 > "$art/rc"
+echo successful > "$art/status"
+`
+	if err := os.WriteFile(filepath.Join(bin, "ansible-runner"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRunReportsArtifacts(t *testing.T) {
+	fakeArtifactsRunner(t)
+	store := newMemoryStore()
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir(), Artifacts: store}
+	_, evts := runPlaybook(t, runner, "site.yml")
+
+	var data *events.JobArtifacts
+	for _, evt := range evts {
+		if evt.EventType == "JOB_ARTIFACTS" {
+			data = &events.JobArtifacts{}
+			if err := json.Unmarshal(evt.EventData, data); err != nil {
+				t.Fatalf("bad JOB_ARTIFACTS data %s: %v", evt.EventData, err)
+			}
+		}
+	}
+	if data == nil {
+		t.Fatal("no JOB_ARTIFACTS event")
+	}
+	if last := evts[len(evts)-1].EventType; last != "JOB_COMPLETED" {
+		t.Fatalf("last event %s, want JOB_COMPLETED", last)
+	}
+
+	if got := string(data.ArtifactData); got != `{"release":"1.4.2","hosts":3}` {
+		t.Errorf("artifact data %s", got)
+	}
+	if data.RC == nil || *data.RC != 0 || data.Status != "successful" {
+		t.Errorf("got rc %v and status %q, want 0 and successful", data.RC, data.Status)
+	}
+
+	archive, ok := store.objects[data.Archive]
+	if !ok {
+		t.Fatalf("archive %q not uploaded", data.Archive)
+	}
+	dir := t.TempDir()
+	if err := content.Extract(bytes.NewReader(archive), dir); err != nil {
+		t.Fatalf("archive not extractable: %v", err)
+	}
+	for _, file := range []string{"rc", "status", "job_events/2-stats.json"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Errorf("archive lacks %s: %v", file, err)
+		}
+	}
+}
+
+func TestRunWithoutArtifactStore(t *testing.T) {
+	fakeArtifactsRunner(t)
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir()}
+	_, evts := runPlaybook(t, runner, "site.yml")
+
+	for _, evt := range evts {
+		if evt.EventType != "JOB_ARTIFACTS" {
+			continue
+		}
+		var data events.JobArtifacts
+		if err := json.Unmarshal(evt.EventData, &data); err != nil {
+			t.Fatalf("bad JOB_ARTIFACTS data %s: %v", evt.EventData, err)
+		}
+		if data.Archive != "" || len(data.ArtifactData) == 0 {
+			t.Errorf("got archive %q and artifact data %s, want only the data", data.Archive, data.ArtifactData)
+		}
+		return
+	}
+	t.Error("no JOB_ARTIFACTS event")
+}
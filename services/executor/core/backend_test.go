@@ -0,0 +1,282 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/backend"
+	"github.com/praetordev/praetor/pkg/backend/backendtest"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/models"
+	"github.com/praetordev/praetor/services/executor/core"
+)
+
+// blockingRunner runs jobs until the test finishes them. Like AnsibleRunner,
+// it reports a failed playbook with JOB_FAILED rather than an error.
+type blockingRunner struct {
+	mu      sync.Mutex
+	results map[uuid.UUID]chan bool
+}
+
+func (r *blockingRunner) result(runID uuid.UUID) chan bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.results[runID] == nil {
+		r.results[runID] = make(chan bool, 1)
+	}
+	return r.results[runID]
+}
+
+func (r *blockingRunner) Run(ctx context.Context, req *events.ExecutionRequest, eventChan chan<- events.JobEvent) error {
+	eventChan <- events.JobEvent{ExecutionRunID: req.ExecutionRunID, UnifiedJobID: req.UnifiedJobID, EventType: "JOB_STARTED"}
+	select {
+	case succeed := <-r.result(req.ExecutionRunID):
+		evt := events.JobEvent{ExecutionRunID: req.ExecutionRunID, UnifiedJobID: req.UnifiedJobID, EventType: "JOB_COMPLETED"}
+		if !succeed {
+			msg := "Ansible execution process failed: exit status 2"
+			evt.EventType, evt.StdoutSnippet = "JOB_FAILED", &msg
+		}
+		eventChan <- evt
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newProcessHarness(t *testing.T) *backendtest.Harness {
+	runner := &blockingRunner{results: map[uuid.UUID]chan bool{}}
+	b := core.NewProcessBackend(context.Background(), runner, &TestPublisher{ch: make(chan events.JobEvent, 10)})
+	return &backendtest.Harness{
+		Backend: b,
+		Finish: func(t *testing.T, runID uuid.UUID, succeed bool) {
+			runner.result(runID) <- succeed
+		},
+	}
+}
+
+func TestProcessBackendConformance(t *testing.T) {
+	backendtest.Run(t, newProcessHarness)
+}
+
+func TestRouterConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) *backendtest.Harness {
+		h := newProcessHarness(t)
+		h.Backend = backend.NewRouter(map[string]backend.ExecutionBackend{models.BackendProcess: h.Backend}, models.BackendProcess)
+		return h
+	})
+}
+
+func TestAgentRunsProcessJobsOnProcessBackend(t *testing.T) {
+	runner := &blockingRunner{results: map[uuid.UUID]chan bool{}}
+	reqChan := make(chan events.ExecutionRequest, 1)
+	eventChan := make(chan events.JobEvent, 10)
+	agent := core.NewAgent(&TestSubscriber{ch: reqChan}, &TestPublisher{ch: eventChan}, runner)
+	go agent.Start()
+	defer agent.Stop(context.Background())
+
+	runID := uuid.New()
+	reqChan <- events.ExecutionRequest{ExecutionRunID: runID, UnifiedJobID: 42}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if status, err := agent.Backends.Status(context.Background(), runID); err == nil && status.State == backend.StateRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("run was not launched on the process backend")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	runner.result(runID) <- false
+
+	// The failure the run reported is the only one published
+	waitForEvent(t, eventChan, "JOB_FAILED")
+	deadline = time.Now().Add(2 * time.Second)
+	for {
+		if _, err := agent.Backends.Status(context.Background(), runID); errors.Is(err, backend.ErrUnknownRun) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("run was not cleaned up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(eventChan) != 0 {
+		t.Errorf("got %d more events, e.g. %s", len(eventChan), (<-eventChan).EventType)
+	}
+}
+
+// fakeRuntime is a container CLI keeping containers in memory.
+type fakeRuntime struct {
+	mu         sync.Mutex
+	containers map[string]string // Name to inspect output
+	runs       [][]string
+}
+
+func (f *fakeRuntime) command(ctx context.Context, env []string, args ...string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := args[len(args)-1]
+	switch args[0] {
+	case "run":
+		f.runs = append(f.runs, args)
+		name = args[3]
+		if _, ok := f.containers[name]; ok {
+			return []byte("Conflict. The container name is already in use"), errors.New("exit status 125")
+		}
+		f.containers[name] = "running 0 false"
+		return []byte("c0ffee"), nil
+	case "inspect":
+		out, ok := f.containers[name]
+		if !ok {
+			return []byte("Error: No such object: " + name), errors.New("exit status 1")
+		}
+		return []byte(out), nil
+	case "stop":
+		if strings.HasPrefix(f.containers[name], "running") {
+			f.containers[name] = "exited 143 false"
+		}
+		return []byte(name), nil
+	case "rm":
+		delete(f.containers, name)
+		return []byte(name), nil
+	}
+	return nil, fmt.Errorf("unexpected command %v", args)
+}
+
+func (f *fakeRuntime) exit(name string, code int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.containers[name] = fmt.Sprintf("exited %d false", code)
+}
+
+func newContainerBackend(t *testing.T) (*core.ContainerBackend, *fakeRuntime) {
+	runtime := &fakeRuntime{containers: map[string]string{}}
+	b := core.NewContainerBackend("podman", "praetor-executor:1.2", "nats://nats:4222", t.TempDir())
+	b.Command = runtime.command
+	return b, runtime
+}
+
+func newContainerHarness(t *testing.T) (*backendtest.Harness, *fakeRuntime) {
+	b, runtime := newContainerBackend(t)
+	return &backendtest.Harness{
+		Backend: b,
+		Finish: func(t *testing.T, runID uuid.UUID, succeed bool) {
+			code := 0
+			if !succeed {
+				code = 2
+			}
+			runtime.exit("execution-"+runID.String(), code)
+		},
+	}, runtime
+}
+
+func TestContainerBackendConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) *backendtest.Harness {
+		h, _ := newContainerHarness(t)
+		return h
+	})
+}
+
+func TestAgentReportsRunsFailedOnBackend(t *testing.T) {
+	cases := []struct {
+		name string
+		end  func(t *testing.T, h *backendtest.Harness, runtime *fakeRuntime, runID uuid.UUID)
+		want string
+	}{
+		{"failed", func(t *testing.T, h *backendtest.Harness, runtime *fakeRuntime, runID uuid.UUID) {
+			h.Finish(t, runID, false)
+		}, "Run failed on the podman backend: Container exited with code 2"},
+		{"unknown", func(t *testing.T, h *backendtest.Harness, runtime *fakeRuntime, runID uuid.UUID) {
+			runtime.mu.Lock()
+			delete(runtime.containers, "execution-"+runID.String())
+			runtime.mu.Unlock()
+		}, "Run disappeared from the podman backend"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, runtime := newContainerHarness(t)
+			reqChan := make(chan events.ExecutionRequest, 1)
+			eventChan := make(chan events.JobEvent, 10)
+			agent := core.NewAgent(&TestSubscriber{ch: reqChan}, &TestPublisher{ch: eventChan}, &core.MockRunner{})
+			agent.Backends = backend.NewRouter(map[string]backend.ExecutionBackend{models.BackendPodman: h.Backend}, "")
+			go agent.Start()
+			defer agent.Stop(context.Background())
+
+			runID := uuid.New()
+			reqChan <- events.ExecutionRequest{ExecutionRunID: runID, UnifiedJobID: 42, JobManifest: events.JobManifest{Backend: models.BackendPodman}}
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				if status, err := h.Backend.Status(context.Background(), runID); err == nil && status.State == backend.StateRunning {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("run was not launched")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			tc.end(t, h, runtime, runID)
+
+			evt := waitForEvent(t, eventChan, "JOB_FAILED")
+			if evt.ExecutionRunID != runID || evt.StdoutSnippet == nil || *evt.StdoutSnippet != tc.want {
+				t.Errorf("got failure %v of run %s, want %q", evt.StdoutSnippet, evt.ExecutionRunID, tc.want)
+			}
+		})
+	}
+}
+
+func TestContainerBackendLaunch(t *testing.T) {
+	b, runtime := newContainerBackend(t)
+	req := &events.ExecutionRequest{
+		ExecutionRunID: uuid.New(),
+		UnifiedJobID:   42,
+		JobManifest: events.JobManifest{
+			Playbook: "site.yml",
+			ExecutionEnvironment: &events.ExecutionEnvironment{
+				Image:      "registry.example.com/ee:2",
+				Pull:       "always",
+				Credential: &events.RegistryCredential{Username: "robot", Password: "s3cret"},
+			},
+		},
+	}
+	if err := b.Launch(context.Background(), req); err != nil {
+		t.Fatalf("Launch failed: %v", err)
+	}
+
+	if len(runtime.runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(runtime.runs))
+	}
+	args := strings.Join(runtime.runs[0], " ")
+	for _, want := range []string{"--env PRAETOR_MODE=oneshot", "--pull always", "--env NATS_URL=nats://nats:4222"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("run %q lacks %q", args, want)
+		}
+	}
+	if !strings.HasSuffix(args, " registry.example.com/ee:2") {
+		t.Errorf("run %q does not use the execution environment image", args)
+	}
+
+	dir := filepath.Join(b.Dir, "execution-"+req.ExecutionRunID.String())
+	for _, file := range []string{"manifest.json", "config.json"} {
+		info, err := os.Stat(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatalf("%s not written: %v", file, err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s has mode %v, want 0600", file, info.Mode().Perm())
+		}
+	}
+	if err := b.Cleanup(context.Background(), req.ExecutionRunID); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("run directory not removed: %v", err)
+	}
+}
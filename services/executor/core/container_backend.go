@@ -0,0 +1,206 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/backend"
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+// containerManifestPath is where run containers find their manifest.
+const containerManifestPath = "/etc/praetor/manifest.json"
+
+// ContainerBackend is the execution backend running each job in a docker or
+// podman container of the executor in one-shot mode, the way the Kubernetes
+// backend runs it in a pod. The container publishes the run's events itself.
+type ContainerBackend struct {
+	Runtime string // Container CLI, docker or podman
+	Image   string // Executor image of jobs without an execution environment
+	NatsURL string // NATS URL run containers publish job events to
+	Network string // Optional network run containers join, e.g. to reach NATS
+	Dir     string // Where run manifests and registry credentials are written
+
+	// Command runs the container CLI with extra environment variables and
+	// returns its combined output. Defaults to running Runtime.
+	Command func(ctx context.Context, env []string, args ...string) ([]byte, error)
+
+	mu       sync.Mutex
+	canceled map[uuid.UUID]bool
+}
+
+func NewContainerBackend(runtime, image, natsURL, dir string) *ContainerBackend {
+	b := &ContainerBackend{
+		Runtime:  runtime,
+		Image:    image,
+		NatsURL:  natsURL,
+		Dir:      dir,
+		canceled: map[uuid.UUID]bool{},
+	}
+	b.Command = func(ctx context.Context, env []string, args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, b.Runtime, args...)
+		cmd.Env = append(os.Environ(), env...)
+		return cmd.CombinedOutput()
+	}
+	return b
+}
+
+var _ backend.ExecutionBackend = (*ContainerBackend)(nil)
+
+func containerName(runID uuid.UUID) string {
+	return "execution-" + runID.String()
+}
+
+func (b *ContainerBackend) runDir(runID uuid.UUID) string {
+	return filepath.Join(b.Dir, containerName(runID))
+}
+
+// cli runs the container CLI, turning a failure into an error carrying its
+// output.
+func (b *ContainerBackend) cli(ctx context.Context, env []string, args ...string) (string, error) {
+	out, err := b.Command(ctx, env, args...)
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", b.Runtime, args[0], err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func isNoSuchContainer(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "no such")
+}
+
+// Launch writes the run's manifest, and its registry credential if any, to
+// a private directory and starts the run's container detached. A container
+// that already exists is left as it is.
+func (b *ContainerBackend) Launch(ctx context.Context, req *events.ExecutionRequest) error {
+	name := containerName(req.ExecutionRunID)
+	if _, err := b.Status(ctx, req.ExecutionRunID); err == nil {
+		return nil
+	} else if err != backend.ErrUnknownRun {
+		return err
+	}
+
+	dir := b.runDir(req.ExecutionRunID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("create run directory: %w", err)
+	}
+	manifest, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	manifestPath := filepath.Join(dir, "manifest.json")
+	if err := os.WriteFile(manifestPath, manifest, 0600); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	args := []string{"run", "--detach", "--name", name,
+		"--label", "praetor.io/run-id=" + req.ExecutionRunID.String(),
+		"--label", "praetor.io/job-id=" + strconv.FormatInt(req.UnifiedJobID, 10),
+		"--env", "PRAETOR_MODE=oneshot",
+		"--env", "PRAETOR_MANIFEST_PATH=" + containerManifestPath,
+		"--env", "NATS_URL=" + b.NatsURL,
+		"--volume", manifestPath + ":" + containerManifestPath + ":ro",
+	}
+	if b.Network != "" {
+		args = append(args, "--network", b.Network)
+	}
+	var env []string
+	image := b.Image
+	if ee := req.JobManifest.ExecutionEnvironment; ee != nil {
+		image = ee.Image
+		if ee.Pull != "" {
+			// docker and podman both take always, missing and never
+			args = append(args, "--pull", ee.Pull)
+		}
+		if ee.Credential != nil {
+			config, err := ee.Credential.DockerConfig(ee.Image)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(dir, "config.json"), config, 0600); err != nil {
+				return fmt.Errorf("write registry credential: %w", err)
+			}
+			env = []string{"DOCKER_CONFIG=" + dir, "REGISTRY_AUTH_FILE=" + filepath.Join(dir, "config.json")}
+		}
+	}
+	args = append(args, image)
+
+	if _, err := b.cli(ctx, env, args...); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	return nil
+}
+
+// Cancel stops the run's container, giving the executor in it time to report
+// the run's end.
+func (b *ContainerBackend) Cancel(ctx context.Context, runID uuid.UUID) error {
+	status, err := b.Status(ctx, runID)
+	if err != nil || status.Finished() {
+		return err
+	}
+	b.mu.Lock()
+	b.canceled[runID] = true
+	b.mu.Unlock()
+	if _, err := b.cli(ctx, nil, "stop", "--time", "10", containerName(runID)); err != nil && !isNoSuchContainer(err) {
+		return err
+	}
+	return nil
+}
+
+// Status reads the state of the run's container.
+func (b *ContainerBackend) Status(ctx context.Context, runID uuid.UUID) (backend.Status, error) {
+	out, err := b.cli(ctx, nil, "inspect", "--format", "{{.State.Status}} {{.State.ExitCode}} {{.State.OOMKilled}}", containerName(runID))
+	if isNoSuchContainer(err) {
+		return backend.Status{}, backend.ErrUnknownRun
+	}
+	if err != nil {
+		return backend.Status{}, err
+	}
+	var state string
+	var exitCode int
+	var oomKilled bool
+	if _, err := fmt.Sscan(out, &state, &exitCode, &oomKilled); err != nil {
+		return backend.Status{}, fmt.Errorf("unexpected %s inspect output %q", b.Runtime, out)
+	}
+
+	switch state {
+	case "created", "configured", "initialized":
+		return backend.Status{State: backend.StatePending}, nil
+	case "running", "restarting", "paused", "stopping", "removing":
+		return backend.Status{State: backend.StateRunning}, nil
+	}
+	b.mu.Lock()
+	canceled := b.canceled[runID]
+	b.mu.Unlock()
+	switch {
+	case canceled:
+		return backend.Status{State: backend.StateCanceled}, nil
+	case exitCode == 0:
+		return backend.Status{State: backend.StateSuccessful}, nil
+	case oomKilled:
+		return backend.Status{State: backend.StateFailed, Reason: fmt.Sprintf("Container OOMKilled (exit code %d)", exitCode)}, nil
+	default:
+		return backend.Status{State: backend.StateFailed, Reason: fmt.Sprintf("Container exited with code %d", exitCode)}, nil
+	}
+}
+
+// Cleanup removes the run's container, stopping it if needed, and its
+// directory.
+func (b *ContainerBackend) Cleanup(ctx context.Context, runID uuid.UUID) error {
+	if _, err := b.cli(ctx, nil, "rm", "--force", containerName(runID)); err != nil && !isNoSuchContainer(err) {
+		return err
+	}
+	b.mu.Lock()
+	delete(b.canceled, runID)
+	b.mu.Unlock()
+	return os.RemoveAll(b.runDir(runID))
+}
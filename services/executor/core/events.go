@@ -1,12 +1,17 @@
 package core
 
 import (
+	"context"
+
 	"github.com/praetordev/praetor/pkg/events"
 )
 
-// EventSubscriber defines how the executor listens for jobs.
+// EventSubscriber defines how the executor pulls jobs.
+// FetchExecutionRequest blocks until a request is handed to this executor or
+// ctx is done. Workers only fetch when they are free, so queued requests stay
+// available to idle executors instead of piling up in a busy one.
 type EventSubscriber interface {
-	SubscribeToExecutionRequests() (<-chan events.ExecutionRequest, error)
+	FetchExecutionRequest(ctx context.Context) (*events.ExecutionRequest, error)
 }
 
 // EventPublisher defines how the executor emits events.
@@ -15,6 +20,12 @@ type EventPublisher interface {
 	PublishLogChunk(chunk *events.LogChunk) error
 }
 
+// InstanceRegistrar registers the executor with the control plane, which
+// answers with the capacity granted to this instance.
+type InstanceRegistrar interface {
+	RegisterInstance(reg *events.InstanceRegistration) (*events.InstanceRegistrationReply, error)
+}
+
 // NOOPEventBus is a placeholder for testing/dev
 type NOOPEventBus struct {
 	ReqChan chan events.ExecutionRequest
@@ -26,8 +37,13 @@ func NewNOOPEventBus() *NOOPEventBus {
 	}
 }
 
-func (b *NOOPEventBus) SubscribeToExecutionRequests() (<-chan events.ExecutionRequest, error) {
-	return b.ReqChan, nil
+func (b *NOOPEventBus) FetchExecutionRequest(ctx context.Context) (*events.ExecutionRequest, error) {
+	select {
+	case req := <-b.ReqChan:
+		return &req, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 func (b *NOOPEventBus) PublishJobEvent(event *events.JobEvent) error {
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+// maxFactsEvent is the largest fact cache entry reported for a host; larger
+// entries are dropped so the event fits in a message.
+const maxFactsEvent = 512 << 10
+
+// factCacheDir is where ansible-runner points Ansible's jsonfile fact cache
+// for a run started with --ident ident. Each file holds one host's facts and
+// is named after the host.
+func factCacheDir(runDir, ident string) string {
+	return filepath.Join(runDir, "artifacts", ident, "fact_cache")
+}
+
+// seedFactCache writes the stored facts into the fact cache before the run,
+// dated when they were gathered so Ansible's cache timeout applies to them.
+// It returns the modification time of each file written, which tells the
+// files the run left alone from those it rewrote.
+func seedFactCache(dir string, cache map[string]events.CachedFacts) (map[string]time.Time, error) {
+	seeded := map[string]time.Time{}
+	if len(cache) == 0 {
+		return seeded, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	for host, facts := range cache {
+		if !validCacheName(host) {
+			log.Printf("Not seeding facts of host %q: not usable as a file name", host)
+			continue
+		}
+		path := filepath.Join(dir, host)
+		if err := os.WriteFile(path, facts.Facts, 0600); err != nil {
+			return nil, err
+		}
+		if err := os.Chtimes(path, facts.ModifiedAt, facts.ModifiedAt); err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		seeded[host] = info.ModTime()
+	}
+	return seeded, nil
+}
+
+// loadFactCache returns the stored facts a run is seeded with, fetching them
+// from the Facts store when the manifest only refers to them. A run whose
+// facts cannot be fetched runs without them, gathering facts anew.
+func (r *AnsibleRunner) loadFactCache(ctx context.Context, req *events.ExecutionRequest) map[string]events.CachedFacts {
+	key := req.JobManifest.FactCacheObject
+	if key == "" {
+		return req.JobManifest.FactCache
+	}
+	if r.Facts == nil {
+		log.Printf("No fact cache store to fetch %s from, running %s without stored facts", key, req.ExecutionRunID)
+		return nil
+	}
+	rc, err := r.Facts.Get(ctx, key)
+	if err != nil {
+		log.Printf("Failed to fetch fact cache %s, running %s without stored facts: %v", key, req.ExecutionRunID, err)
+		return nil
+	}
+	defer rc.Close()
+	var cache map[string]events.CachedFacts
+	if err := json.NewDecoder(rc).Decode(&cache); err != nil {
+		log.Printf("Invalid fact cache %s, running %s without stored facts: %v", key, req.ExecutionRunID, err)
+		return nil
+	}
+	return cache
+}
+
+// collectFacts builds a HOST_FACTS event for each host whose facts the run
+// gathered or cleared. Seeded entries the run did not touch are skipped.
+func collectFacts(dir string, seeded map[string]time.Time, req *events.ExecutionRequest) []events.JobEvent {
+	var out []events.JobEvent
+	report := func(host string, data events.HostFacts) {
+		raw, _ := json.Marshal(data)
+		h := host
+		out = append(out, events.JobEvent{
+			ExecutionRunID: req.ExecutionRunID,
+			UnifiedJobID:   req.UnifiedJobID,
+			EventType:      "HOST_FACTS",
+			Timestamp:      time.Now(),
+			Host:           &h,
+			EventData:      raw,
+		})
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to read fact cache %s: %v", dir, err)
+	}
+	found := map[string]bool{}
+	for _, f := range files {
+		if !f.Type().IsRegular() {
+			continue
+		}
+		host := f.Name()
+		found[host] = true
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		if t, ok := seeded[host]; ok && info.ModTime().Equal(t) {
+			continue
+		}
+		facts, err := readFacts(filepath.Join(dir, host))
+		if err != nil {
+			log.Printf("Skipping facts of host %s: %v", host, err)
+			continue
+		}
+		report(host, events.HostFacts{Facts: facts})
+	}
+
+	// Seeded entries removed by the run, such as with meta: clear_facts
+	var cleared []string
+	for host := range seeded {
+		if !found[host] {
+			cleared = append(cleared, host)
+		}
+	}
+	sort.Strings(cleared)
+	for _, host := range cleared {
+		report(host, events.HostFacts{Cleared: true})
+	}
+	return out
+}
+
+// readFacts reads a fact cache file, which must hold a JSON object.
+func readFacts(path string) (json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var facts map[string]interface{}
+	if err := json.Unmarshal(data, &facts); err != nil {
+		return nil, fmt.Errorf("not a JSON object: %w", err)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, err
+	}
+	if compact.Len() > maxFactsEvent {
+		return nil, fmt.Errorf("%d bytes of facts exceed the %d byte limit", compact.Len(), maxFactsEvent)
+	}
+	return compact.Bytes(), nil
+}
+
+func validCacheName(host string) bool {
+	return host != "" && host != "." && host != ".." && filepath.Base(host) == host
+}
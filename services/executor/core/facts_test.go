@@ -0,0 +1,118 @@
+package core_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/services/executor/core"
+)
+
+// fakeAnsibleRunner puts an ansible-runner on PATH that acts on the fact
+// cache as a playbook would: it gathers facts for web1, clears those of
+// gone and leaves kept alone. It fails if the seeded entries are missing.
+func fakeAnsibleRunner(t *testing.T) {
+	t.Helper()
+	bin := t.TempDir()
+	script := `#!/bin/sh
+dir="$2"
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--ident" ]; then ident="$2"; fi
+  shift
+done
+cache="$dir/artifacts/$ident/fact_cache"
+[ -f "$cache/kept" ] && [ -f "$cache/gone" ] || exit 1
+echo '{"ansible_hostname": "web1", "ansible_distribution": "Debian"}' > "$cache/web1"
+rm "$cache/gone"
+`
+	if err := os.WriteFile(filepath.Join(bin, "ansible-runner"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRunReportsFactCache(t *testing.T) {
+	fakeAnsibleRunner(t)
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir()}
+
+	gathered := time.Now().Add(-time.Hour).Truncate(time.Second)
+	req := &events.ExecutionRequest{
+		ExecutionRunID: uuid.New(),
+		UnifiedJobID:   7,
+		JobManifest: events.JobManifest{
+			FactCache: map[string]events.CachedFacts{
+				"kept": {Facts: json.RawMessage(`{"ansible_hostname": "kept"}`), ModifiedAt: gathered},
+				"gone": {Facts: json.RawMessage(`{"ansible_hostname": "gone"}`), ModifiedAt: gathered},
+			},
+		},
+	}
+	eventChan := make(chan events.JobEvent, 100)
+	if err := runner.Run(context.Background(), req, eventChan); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	close(eventChan)
+
+	facts := map[string]events.HostFacts{}
+	var last string
+	for evt := range eventChan {
+		last = evt.EventType
+		if evt.EventType != "HOST_FACTS" {
+			continue
+		}
+		var data events.HostFacts
+		if err := json.Unmarshal(evt.EventData, &data); err != nil {
+			t.Fatalf("bad HOST_FACTS data %s: %v", evt.EventData, err)
+		}
+		facts[*evt.Host] = data
+	}
+	if last != "JOB_COMPLETED" {
+		t.Fatalf("last event %s, want JOB_COMPLETED", last)
+	}
+
+	if len(facts) != 2 {
+		t.Fatalf("got facts for %d hosts, want web1 and gone: %v", len(facts), facts)
+	}
+	if got := string(facts["web1"].Facts); got != `{"ansible_hostname":"web1","ansible_distribution":"Debian"}` {
+		t.Errorf("web1 facts: got %s", got)
+	}
+	if !facts["gone"].Cleared {
+		t.Errorf("gone should be reported cleared, got %+v", facts["gone"])
+	}
+}
+
+func TestRunSeedsFactCacheFromStore(t *testing.T) {
+	fakeAnsibleRunner(t)
+	store := newMemoryStore()
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir(), Facts: store}
+
+	runID := uuid.New()
+	key := "fact-caches/" + runID.String() + ".json"
+	store.objects[key] = []byte(`{
+		"kept": {"ansible_facts": {"ansible_hostname": "kept"}, "modified_at": "2026-01-02T03:04:05Z"},
+		"gone": {"ansible_facts": {"ansible_hostname": "gone"}, "modified_at": "2026-01-02T03:04:05Z"}
+	}`)
+	req := &events.ExecutionRequest{
+		ExecutionRunID: runID,
+		UnifiedJobID:   8,
+		JobManifest:    events.JobManifest{FactCacheObject: key},
+	}
+	eventChan := make(chan events.JobEvent, 100)
+	if err := runner.Run(context.Background(), req, eventChan); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	close(eventChan)
+
+	// The fake runner exits non-zero unless kept and gone were seeded
+	var last string
+	for evt := range eventChan {
+		last = evt.EventType
+	}
+	if last != "JOB_COMPLETED" {
+		t.Fatalf("last event %s, want JOB_COMPLETED", last)
+	}
+}
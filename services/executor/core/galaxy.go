@@ -0,0 +1,222 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/praetordev/praetor/pkg/events"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultGalaxyServer is the server ansible-galaxy uses when an organization
+// has no Galaxy credentials.
+const defaultGalaxyServer = "https://galaxy.ansible.com"
+
+// requirementsFiles are the dependency files installRequirements looks for,
+// relative to the project root, with the ansible-galaxy content type and the
+// project directory the content is installed into.
+var requirementsFiles = []struct {
+	path    string
+	kind    string
+	install string
+}{
+	{"collections/requirements.yml", "collection", "collections"},
+	{"collections/requirements.yaml", "collection", "collections"},
+	{"roles/requirements.yml", "role", "roles"},
+	{"roles/requirements.yaml", "role", "roles"},
+}
+
+// installRequirements installs the project's collection and role requirements
+// into the project directory, so they are packed into the project archive and
+// runs start with their dependencies present. Only the servers in src may be
+// used as sources.
+func installRequirements(ctx context.Context, dir string, src *events.ProjectSource) ([]byte, error) {
+	var output bytes.Buffer
+	for _, req := range requirementsFiles {
+		file := filepath.Join(dir, req.path)
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		if err := checkRequirementSources(file, src.GalaxyServers); err != nil {
+			return output.Bytes(), fmt.Errorf("%s: %w", req.path, err)
+		}
+		if _, err := exec.LookPath("ansible-galaxy"); err != nil {
+			return output.Bytes(), fmt.Errorf("%s found but ansible-galaxy is not installed on the executor", req.path)
+		}
+
+		args := []string{req.kind, "install", "-r", file, "-p", filepath.Join(dir, req.install)}
+		cmd := exec.CommandContext(ctx, "ansible-galaxy", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), galaxyServerEnv(src.GalaxyServers)...)
+		out, err := cmd.CombinedOutput()
+		output.Write(out)
+		if err != nil {
+			return output.Bytes(), fmt.Errorf("ansible-galaxy %s install from %s failed: %w", req.kind, req.path, err)
+		}
+	}
+	return output.Bytes(), nil
+}
+
+// galaxyServerEnv configures ansible-galaxy's server list through the
+// environment, keeping tokens out of files in the project.
+func galaxyServerEnv(servers []events.GalaxyServer) []string {
+	if len(servers) == 0 {
+		return nil
+	}
+	ids := make([]string, len(servers))
+	var env []string
+	for i, s := range servers {
+		ids[i] = fmt.Sprintf("server%d", i)
+		prefix := fmt.Sprintf("ANSIBLE_GALAXY_SERVER_SERVER%d_", i)
+		env = append(env, prefix+"URL="+s.URL)
+		if s.AuthURL != "" {
+			env = append(env, prefix+"AUTH_URL="+s.AuthURL)
+		}
+		if s.Token != "" {
+			env = append(env, prefix+"TOKEN="+s.Token)
+		}
+	}
+	return append(env, "ANSIBLE_GALAXY_SERVER_LIST="+strings.Join(ids, ","))
+}
+
+// checkRequirementSources rejects requirements that would install content
+// from anywhere but the organization's Galaxy servers: collections pinned to
+// another server, collections and roles fetched from git or a URL, and roles
+// from an scm.
+func checkRequirementSources(file string, servers []events.GalaxyServer) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var reqs struct {
+		Collections []yaml.Node `yaml:"collections"`
+		Roles       []yaml.Node `yaml:"roles"`
+	}
+	// A bare list is a roles-only requirements file
+	var list []yaml.Node
+	if err := yaml.Unmarshal(data, &list); err == nil {
+		reqs.Roles = list
+	} else if err := yaml.Unmarshal(data, &reqs); err != nil {
+		return fmt.Errorf("invalid requirements file: %w", err)
+	}
+
+	allowed := map[string]bool{}
+	for _, s := range servers {
+		allowed[normalizeServer(s.URL)] = true
+		allowed[s.Name] = true
+	}
+	if len(servers) == 0 {
+		allowed[normalizeServer(defaultGalaxyServer)] = true
+	}
+
+	for _, node := range reqs.Collections {
+		if err := checkCollection(node, allowed); err != nil {
+			return err
+		}
+	}
+	for _, node := range reqs.Roles {
+		if err := checkRole(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCollection checks a collection requirement, given as a name or a
+// mapping, against the allowed servers.
+func checkCollection(node yaml.Node, allowed map[string]bool) error {
+	var entry struct {
+		Name   string `yaml:"name"`
+		Source string `yaml:"source"`
+		Type   string `yaml:"type"`
+	}
+	switch node.Kind {
+	case yaml.ScalarNode:
+		entry.Name = node.Value
+	case yaml.MappingNode:
+		if err := node.Decode(&entry); err != nil {
+			return fmt.Errorf("invalid collection requirement on line %d: %w", node.Line, err)
+		}
+	default:
+		return fmt.Errorf("invalid collection requirement on line %d", node.Line)
+	}
+
+	switch entry.Type {
+	case "", "galaxy", "file", "dir", "subdirs":
+	default:
+		return fmt.Errorf("collection %s is installed from %s, which is not allowed for this organization", entry.Name, entry.Type)
+	}
+	if isRemoteSource(entry.Name) {
+		return fmt.Errorf("collection %s is not installed from a Galaxy server, which is not allowed for this organization", entry.Name)
+	}
+	if entry.Source != "" && !allowed[entry.Source] && !allowed[normalizeServer(entry.Source)] {
+		return fmt.Errorf("collection %s uses Galaxy server %s, which is not allowed for this organization", entry.Name, entry.Source)
+	}
+	return nil
+}
+
+// checkRole checks a role requirement, given as a src or a mapping, is
+// installed by name from a Galaxy server.
+func checkRole(node yaml.Node) error {
+	var entry struct {
+		Name string `yaml:"name"`
+		Src  string `yaml:"src"`
+		SCM  string `yaml:"scm"`
+	}
+	switch node.Kind {
+	case yaml.ScalarNode:
+		entry.Src = node.Value
+	case yaml.MappingNode:
+		if err := node.Decode(&entry); err != nil {
+			return fmt.Errorf("invalid role requirement on line %d: %w", node.Line, err)
+		}
+	default:
+		return fmt.Errorf("invalid role requirement on line %d", node.Line)
+	}
+
+	src := entry.Src
+	if src == "" {
+		src = entry.Name
+	}
+	if entry.SCM != "" || isRemoteSource(src) {
+		return fmt.Errorf("role %s is not installed from a Galaxy server, which is not allowed for this organization", src)
+	}
+	return nil
+}
+
+// isRemoteSource reports whether a requirement names a URL or repository
+// rather than Galaxy content.
+func isRemoteSource(src string) bool {
+	return strings.Contains(src, "://") || strings.HasPrefix(src, "git+") || strings.HasPrefix(src, "git@")
+}
+
+func normalizeServer(url string) string {
+	return strings.ToLower(strings.TrimRight(url, "/"))
+}
+
+// writeRunnerEnv points Ansible at the collections and roles installed into
+// the project, wherever the playbook lives in it.
+func writeRunnerEnv(runDir, projectDir string) error {
+	envvars := map[string]string{}
+	if _, err := os.Stat(filepath.Join(projectDir, "collections")); err == nil {
+		envvars["ANSIBLE_COLLECTIONS_PATH"] = filepath.Join(projectDir, "collections") + ":~/.ansible/collections:/usr/share/ansible/collections"
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, "roles")); err == nil {
+		envvars["ANSIBLE_ROLES_PATH"] = filepath.Join(projectDir, "roles") + ":~/.ansible/roles:/usr/share/ansible/roles:/etc/ansible/roles"
+	}
+	if len(envvars) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(envvars)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(runDir, "env", "envvars"), data, 0600)
+}
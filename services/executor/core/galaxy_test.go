@@ -0,0 +1,137 @@
+package core_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/praetordev/praetor/pkg/content"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/services/executor/core"
+)
+
+// fakeGalaxy puts an ansible-galaxy on PATH that records its arguments and
+// server configuration, and "installs" by creating a marker in the -p path.
+func fakeGalaxy(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	log := filepath.Join(bin, "calls.log")
+	script := `#!/bin/sh
+echo "$1 $2 servers=$ANSIBLE_GALAXY_SERVER_LIST url=$ANSIBLE_GALAXY_SERVER_SERVER0_URL token=$ANSIBLE_GALAXY_SERVER_SERVER0_TOKEN" >> ` + log + `
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-p" ]; then mkdir -p "$2" && touch "$2/installed"; fi
+  shift
+done
+`
+	if err := os.WriteFile(filepath.Join(bin, "ansible-galaxy"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+func TestProjectSyncInstallsRequirements(t *testing.T) {
+	calls := fakeGalaxy(t)
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "ops", "site.yml"), "- hosts: all\n")
+	writeTestFile(t, filepath.Join(root, "ops", "collections", "requirements.yml"),
+		"collections:\n  - name: community.general\n    source: https://hub.example.com/api/galaxy/\n")
+	writeTestFile(t, filepath.Join(root, "ops", "roles", "requirements.yml"), "- src: geerlingguy.nginx\n")
+
+	cache, err := core.NewProjectCache(t.TempDir(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir(), ProjectsRoot: root, Cache: cache}
+	source := &events.ProjectSource{
+		Type: "manual",
+		GalaxyServers: []events.GalaxyServer{
+			{Name: "hub", URL: "https://hub.example.com/api/galaxy", Token: "hub-token"},
+		},
+	}
+	evt := runProjectUpdateWith(t, runner, "ops", "", source)
+	if evt.EventType != "JOB_COMPLETED" {
+		t.Fatalf("Expected JOB_COMPLETED, got %s (%v)", evt.EventType, deref(evt.StdoutSnippet))
+	}
+
+	log, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatalf("ansible-galaxy was not run: %v", err)
+	}
+	for _, want := range []string{
+		"collection install servers=server0 url=https://hub.example.com/api/galaxy token=hub-token",
+		"role install servers=server0",
+	} {
+		if !strings.Contains(string(log), want) {
+			t.Errorf("Expected ansible-galaxy call %q, got:\n%s", want, log)
+		}
+	}
+
+	// The installed content ships with the synced project archive
+	dir := t.TempDir()
+	if err := cache.Extract(context.Background(), content.ArchiveKey("ops", revision(t, evt)), dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"collections/installed", "roles/installed"} {
+		if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+			t.Errorf("Expected %s in the project archive: %v", path, err)
+		}
+	}
+}
+
+func TestProjectSyncRejectsDisallowedGalaxyServer(t *testing.T) {
+	calls := fakeGalaxy(t)
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "ops", "collections", "requirements.yml"),
+		"collections:\n  - name: evil.payload\n    source: https://galaxy.evil.example.com\n")
+
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir(), ProjectsRoot: root}
+	evt := runProjectUpdateWith(t, runner, "ops", "", &events.ProjectSource{Type: "manual"})
+	if evt.EventType != "JOB_FAILED" || !strings.Contains(deref(evt.StdoutSnippet), "not allowed") {
+		t.Fatalf("Expected the sync to fail on a disallowed server, got %s: %s", evt.EventType, deref(evt.StdoutSnippet))
+	}
+	if _, err := os.Stat(calls); err == nil {
+		t.Errorf("ansible-galaxy should not run for a disallowed server")
+	}
+}
+
+func TestProjectSyncRejectsNonGalaxySources(t *testing.T) {
+	cases := []struct {
+		name, path, content string
+	}{
+		{"role from git", "roles/requirements.yml",
+			"- src: https://github.com/evil/payload.git\n  scm: git\n"},
+		{"role url", "roles/requirements.yml",
+			"- git+https://github.com/evil/payload.git\n"},
+		{"roles section", "collections/requirements.yml",
+			"roles:\n  - src: https://evil.example.com/payload.tar.gz\n"},
+		{"git collection", "collections/requirements.yml",
+			"collections:\n  - name: https://github.com/evil/payload.git\n    type: git\n"},
+		{"url collection", "collections/requirements.yml",
+			"collections:\n  - name: https://evil.example.com/payload.tar.gz\n    type: url\n"},
+		{"bare url collection", "collections/requirements.yml",
+			"collections:\n  - https://evil.example.com/payload.tar.gz\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := fakeGalaxy(t)
+			root := t.TempDir()
+			writeTestFile(t, filepath.Join(root, "ops", tc.path), tc.content)
+
+			runner := &core.AnsibleRunner{BaseDir: t.TempDir(), ProjectsRoot: root}
+			source := &events.ProjectSource{
+				Type:          "manual",
+				GalaxyServers: []events.GalaxyServer{{Name: "hub", URL: "https://hub.example.com/api/galaxy"}},
+			}
+			evt := runProjectUpdateWith(t, runner, "ops", "", source)
+			if evt.EventType != "JOB_FAILED" || !strings.Contains(deref(evt.StdoutSnippet), "not allowed") {
+				t.Fatalf("Expected the sync to fail, got %s: %s", evt.EventType, deref(evt.StdoutSnippet))
+			}
+			if _, err := os.Stat(calls); err == nil {
+				t.Errorf("ansible-galaxy should not run for disallowed sources")
+			}
+		})
+	}
+}
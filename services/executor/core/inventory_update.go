@@ -0,0 +1,194 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/inventory"
+)
+
+// maxInlineInventory is the largest ansible-inventory output sent inline in
+// the JOB_COMPLETED event; larger results go through the Results store to
+// stay under the message bus payload limit.
+const maxInlineInventory = 512 << 10
+
+// runInventoryUpdate runs ansible-inventory --list against the manifest's
+// inventory source and reports the resulting inventory in the JOB_COMPLETED
+// event data, which the consumer ingests into the inventory.
+func (r *AnsibleRunner) runInventoryUpdate(ctx context.Context, req *events.ExecutionRequest, eventChan chan<- events.JobEvent) error {
+	runDir := filepath.Join(r.BaseDir, req.ExecutionRunID.String())
+	failed := true
+	defer func() { r.finishRunDir(runDir, failed) }()
+
+	manifest := req.JobManifest
+	if manifest.InventorySource == nil {
+		return fmt.Errorf("inventory update requires an inventory source")
+	}
+	log.Printf("AnsibleRunner: Updating inventory from %s source for run %s", manifest.InventorySource.Type, req.ExecutionRunID)
+
+	eventChan <- events.JobEvent{
+		ExecutionRunID: req.ExecutionRunID,
+		UnifiedJobID:   req.UnifiedJobID,
+		EventType:      "JOB_STARTED",
+		Timestamp:      time.Now(),
+	}
+	fail := func(msg string) {
+		eventChan <- events.JobEvent{
+			ExecutionRunID: req.ExecutionRunID,
+			UnifiedJobID:   req.UnifiedJobID,
+			EventType:      "JOB_FAILED",
+			Timestamp:      time.Now(),
+			StdoutSnippet:  &msg,
+		}
+	}
+
+	source, err := r.prepareInventorySource(ctx, runDir, manifest)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fail(fmt.Sprintf("Inventory source unavailable: %v", err))
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, "ansible-inventory", "-i", source, "--list", "--export")
+	cmd.Dir = runDir
+	// Fail instead of returning an empty inventory when the source cannot be parsed
+	cmd.Env = append(os.Environ(), "ANSIBLE_INVENTORY_UNPARSED_FAILED=true", "ANSIBLE_NOCOLOR=true")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	if stderr.Len() > 0 {
+		output := stderr.String()
+		eventChan <- events.JobEvent{
+			ExecutionRunID: req.ExecutionRunID,
+			UnifiedJobID:   req.UnifiedJobID,
+			EventType:      "JOB_LOG",
+			Timestamp:      time.Now(),
+			StdoutSnippet:  &output,
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fail(fmt.Sprintf("ansible-inventory failed: %v", err))
+		return nil
+	}
+
+	inv, err := inventory.ParseList(stdout.Bytes())
+	if err != nil {
+		fail(fmt.Sprintf("ansible-inventory returned an invalid inventory: %v", err))
+		return nil
+	}
+
+	result := map[string]interface{}{}
+	if stdout.Len() <= maxInlineInventory {
+		result["inventory"] = json.RawMessage(stdout.Bytes())
+	} else if r.Results != nil {
+		key := inventoryResultKey(req.ExecutionRunID.String())
+		if err := r.Results.Put(ctx, key, bytes.NewReader(stdout.Bytes())); err != nil {
+			fail(fmt.Sprintf("Failed to store inventory of %d bytes: %v", stdout.Len(), err))
+			return nil
+		}
+		result["inventory_object"] = key
+	} else {
+		fail(fmt.Sprintf("Inventory of %d bytes is too large to report without a result store", stdout.Len()))
+		return nil
+	}
+
+	data, _ := json.Marshal(result)
+	summary := fmt.Sprintf("Inventory source reported %d hosts and %d groups", len(inv.Hosts), len(inv.Groups))
+	eventChan <- events.JobEvent{
+		ExecutionRunID: req.ExecutionRunID,
+		UnifiedJobID:   req.UnifiedJobID,
+		EventType:      "JOB_COMPLETED",
+		Timestamp:      time.Now(),
+		StdoutSnippet:  &summary,
+		EventData:      data,
+	}
+	failed = false
+
+	log.Printf("AnsibleRunner: %s", summary)
+	return nil
+}
+
+// inventoryResultKey is the Results store key of an inventory update's output.
+func inventoryResultKey(runID string) string {
+	return fmt.Sprintf("inventory-updates/%s.json", runID)
+}
+
+// prepareInventorySource writes or fetches the inventory source into runDir
+// and returns the path to pass to ansible-inventory -i.
+func (r *AnsibleRunner) prepareInventorySource(ctx context.Context, runDir string, m events.JobManifest) (string, error) {
+	if err := os.MkdirAll(runDir, 0700); err != nil {
+		return "", err
+	}
+
+	src := m.InventorySource
+	switch src.Type {
+	case "script":
+		path := filepath.Join(runDir, "inventory_script")
+		if err := os.WriteFile(path, []byte(src.Script), 0700); err != nil {
+			return "", err
+		}
+		return path, nil
+
+	case "plugin":
+		var config struct {
+			Plugin string `json:"plugin"`
+		}
+		if err := json.Unmarshal(src.PluginConfig, &config); err != nil || config.Plugin == "" {
+			return "", fmt.Errorf("plugin configuration must be an object naming the plugin")
+		}
+		// Plugins only accept config files named after them, like aws_ec2.yml
+		name := config.Plugin[strings.LastIndex(config.Plugin, ".")+1:]
+		path := filepath.Join(runDir, filepath.Base(name)+".yml")
+		// JSON is valid YAML
+		if err := os.WriteFile(path, src.PluginConfig, 0600); err != nil {
+			return "", err
+		}
+		return path, nil
+
+	case "scm":
+		if m.ProjectURL == "" {
+			return "", fmt.Errorf("scm source requires a project")
+		}
+		projectDir := filepath.Join(runDir, "project")
+		if !r.restoreProject(ctx, m.ProjectArchive, projectDir) {
+			if out, err := r.fetchProject(ctx, m, filepath.Join(runDir, "scm"), projectDir); err != nil {
+				return "", fmt.Errorf("failed to fetch project: %w\n%s", err, out.Output)
+			}
+		}
+		return projectPath(projectDir, src.Path)
+
+	default:
+		return "", fmt.Errorf("unknown inventory source type %q", src.Type)
+	}
+}
+
+// projectPath resolves rel inside projectDir, refusing paths that leave the
+// project, including through symlinks.
+func projectPath(projectDir, rel string) (string, error) {
+	root, err := filepath.EvalSymlinks(projectDir)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, filepath.Clean("/"+rel)))
+	if err != nil {
+		return "", fmt.Errorf("inventory path %q not found in project", rel)
+	}
+	if inside, err := filepath.Rel(root, path); err != nil || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("inventory path %q is outside the project", rel)
+	}
+	return path, nil
+}
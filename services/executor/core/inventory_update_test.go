@@ -0,0 +1,161 @@
+package core_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/inventory"
+	"github.com/praetordev/praetor/services/executor/core"
+)
+
+// fakeAnsibleInventory puts an ansible-inventory on PATH that records the
+// -i source, runs it if it is a script and prints it otherwise. Plugin
+// configs (*.yml) report a single host.
+func fakeAnsibleInventory(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	log := filepath.Join(bin, "sources.log")
+	script := `#!/bin/sh
+echo "$2" >> ` + log + `
+case "$2" in
+  *.yml) echo '{"_meta": {"hostvars": {}}, "all": {"children": ["ungrouped"]}, "ungrouped": {"hosts": ["plugin-host"]}}' ;;
+  *) if [ -x "$2" ]; then exec "$2" --list; else cat "$2"; fi ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "ansible-inventory"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+const listOutput = `{"_meta": {"hostvars": {"web1": {"ansible_host": "10.0.0.1"}}}, "all": {"children": ["ungrouped", "web"]}, "web": {"hosts": ["web1"]}}`
+
+func TestInventoryUpdateSources(t *testing.T) {
+	calls := fakeAnsibleInventory(t)
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "infra", "inventory", "hosts.json"), listOutput)
+
+	cases := []struct {
+		name     string
+		source   events.InventorySource
+		project  string
+		wantHost string
+	}{
+		{"script", events.InventorySource{Type: "script", Script: "#!/bin/sh\necho '" + listOutput + "'\n"}, "", "web1"},
+		{"scm", events.InventorySource{Type: "scm", Path: "inventory/hosts.json"}, "infra", "web1"},
+		{"plugin", events.InventorySource{Type: "plugin", PluginConfig: json.RawMessage(`{"plugin": "amazon.aws.aws_ec2"}`)}, "", "plugin-host"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			runner := &core.AnsibleRunner{BaseDir: t.TempDir(), ProjectsRoot: root}
+			evt := runInventoryUpdate(t, runner, tc.source, tc.project)
+			if evt.EventType != "JOB_COMPLETED" {
+				t.Fatalf("Expected JOB_COMPLETED, got %s (%v)", evt.EventType, deref(evt.StdoutSnippet))
+			}
+
+			var result struct {
+				Inventory json.RawMessage `json:"inventory"`
+			}
+			if err := json.Unmarshal(evt.EventData, &result); err != nil {
+				t.Fatalf("Invalid event data: %v", err)
+			}
+			inv, err := inventory.ParseList(result.Inventory)
+			if err != nil {
+				t.Fatalf("Reported inventory does not parse: %v", err)
+			}
+			if _, ok := inv.Hosts[tc.wantHost]; !ok {
+				t.Errorf("Expected host %s in %s", tc.wantHost, result.Inventory)
+			}
+		})
+	}
+
+	log, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(log), "/aws_ec2.yml") {
+		t.Errorf("Plugin config not named after the plugin:\n%s", log)
+	}
+}
+
+func TestInventoryUpdateRejectsPathOutsideProject(t *testing.T) {
+	fakeAnsibleInventory(t)
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "infra", "hosts.json"), listOutput)
+	if err := os.Symlink("/etc", filepath.Join(root, "infra", "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"../../etc/hosts", "escape/hosts"} {
+		runner := &core.AnsibleRunner{BaseDir: t.TempDir(), ProjectsRoot: root}
+		evt := runInventoryUpdate(t, runner, events.InventorySource{Type: "scm", Path: path}, "infra")
+		if evt.EventType != "JOB_FAILED" {
+			t.Errorf("%s: expected JOB_FAILED, got %s", path, evt.EventType)
+		}
+	}
+}
+
+// runInventoryUpdate runs an inventory update, reading scm sources from the
+// manual project under the runner's projects root, and returns its terminal
+// event.
+func runInventoryUpdate(t *testing.T, runner *core.AnsibleRunner, source events.InventorySource, project string) events.JobEvent {
+	t.Helper()
+	req := &events.ExecutionRequest{
+		ExecutionRunID: uuid.New(),
+		UnifiedJobID:   1,
+		JobManifest: events.JobManifest{
+			JobType:         events.JobTypeInventoryUpdate,
+			InventorySource: &source,
+		},
+	}
+	if project != "" {
+		req.JobManifest.ProjectURL = project
+		req.JobManifest.ProjectSource = &events.ProjectSource{Type: "manual"}
+	}
+
+	eventChan := make(chan events.JobEvent, 10)
+	if err := runner.Run(context.Background(), req, eventChan); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	close(eventChan)
+
+	var last events.JobEvent
+	for evt := range eventChan {
+		last = evt
+	}
+	return last
+}
+
+func TestInventoryUpdateRunDirectoryCleanup(t *testing.T) {
+	fakeAnsibleInventory(t)
+
+	cases := []struct {
+		name       string
+		script     string
+		keepFailed bool
+		wantKept   bool
+	}{
+		{"successful", "#!/bin/sh\necho '" + listOutput + "'\n", true, false},
+		{"failed", "#!/bin/sh\nexit 1\n", false, false},
+		{"failed and kept", "#!/bin/sh\nexit 1\n", true, true},
+	}
+	for _, tc := range cases {
+		runner := &core.AnsibleRunner{BaseDir: t.TempDir(), KeepFailed: tc.keepFailed}
+		runInventoryUpdate(t, runner, events.InventorySource{Type: "script", Script: tc.script}, "")
+
+		entries, err := os.ReadDir(runner.BaseDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept := len(entries) > 0; kept != tc.wantKept {
+			t.Errorf("%s: run directory kept %v, want %v", tc.name, kept, tc.wantKept)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxPlaybookSize bounds the files parsed during playbook discovery.
+const maxPlaybookSize = 1 << 20
+
+// skipPlaybookDirs hold YAML that is never a playbook: role content, installed
+// dependencies and inventory variables.
+var skipPlaybookDirs = map[string]bool{
+	"roles":       true,
+	"collections": true,
+	"group_vars":  true,
+	"host_vars":   true,
+}
+
+// discoverPlaybooks returns the project-relative paths of the playbooks in
+// dir: YAML files whose top level is a list of plays, each with "hosts" or
+// an import_playbook.
+func discoverPlaybooks(dir string) ([]string, error) {
+	playbooks := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && (strings.HasPrefix(d.Name(), ".") || skipPlaybookDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if ext != ".yml" && ext != ".yaml" {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || !info.Mode().IsRegular() || info.Size() > maxPlaybookSize {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		if isPlaybook(data) {
+			rel, _ := filepath.Rel(dir, path)
+			playbooks = append(playbooks, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(playbooks)
+	return playbooks, err
+}
+
+func isPlaybook(data []byte) bool {
+	var plays []map[string]interface{}
+	if err := yaml.Unmarshal(data, &plays); err != nil || len(plays) == 0 {
+		return false
+	}
+	for _, play := range plays {
+		_, hosts := play["hosts"]
+		_, imported := play["import_playbook"]
+		_, fqcn := play["ansible.builtin.import_playbook"]
+		if !hosts && !imported && !fqcn {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package core_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/services/executor/core"
+)
+
+func TestProjectSyncReportsPlaybooks(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"site.yml":                 "- hosts: all\n  roles: [web]\n",
+		"playbooks/deploy.yaml":    "- hosts: web\n  tasks: []\n- import_playbook: ../site.yml\n",
+		"all.yml":                  "- ansible.builtin.import_playbook: site.yml\n",
+		"vars.yml":                 "app_port: 8080\n",
+		"tasks.yml":                "- name: Ping\n  ping:\n",
+		"roles/web/tasks/main.yml": "- hosts: all\n",
+		"group_vars/all.yml":       "- hosts: all\n",
+		".github/workflows/ci.yml": "- hosts: all\n",
+		"inventory/hosts.yml":      "all:\n  hosts:\n    web1:\n",
+		"collections/ansible_collections/x/y/playbooks/p.yml": "- hosts: all\n",
+	}
+	for path, data := range files {
+		writeTestFile(t, filepath.Join(root, "ops", path), data)
+	}
+
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir(), ProjectsRoot: root}
+	evt := runProjectUpdateWith(t, runner, "ops", "", &events.ProjectSource{Type: "manual"})
+	if evt.EventType != "JOB_COMPLETED" {
+		t.Fatalf("Expected JOB_COMPLETED, got %s (%v)", evt.EventType, deref(evt.StdoutSnippet))
+	}
+
+	var data struct {
+		Playbooks []string `json:"playbooks"`
+	}
+	if err := json.Unmarshal(evt.EventData, &data); err != nil {
+		t.Fatalf("Invalid event data: %v", err)
+	}
+	want := []string{"all.yml", "playbooks/deploy.yaml", "site.yml"}
+	if !reflect.DeepEqual(data.Playbooks, want) {
+		t.Errorf("Expected playbooks %v, got %v", want, data.Playbooks)
+	}
+}
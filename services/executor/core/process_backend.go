@@ -0,0 +1,136 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/backend"
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+// ProcessBackend is the execution backend running jobs with a Runner inside
+// the executor process, publishing their events. The Agent routes the jobs of
+// the process backend through it.
+type ProcessBackend struct {
+	Runner    Runner
+	Publisher EventPublisher
+
+	// ctx ends when the executor gives up on its runs; runs stopped by it
+	// rather than by Cancel are reported lost.
+	ctx  context.Context
+	mu   sync.Mutex
+	runs map[uuid.UUID]*processRun
+}
+
+type processRun struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	canceled bool
+	status   backend.Status
+}
+
+func NewProcessBackend(ctx context.Context, runner Runner, pub EventPublisher) *ProcessBackend {
+	return &ProcessBackend{Runner: runner, Publisher: pub, ctx: ctx, runs: map[uuid.UUID]*processRun{}}
+}
+
+var (
+	_ backend.ExecutionBackend = (*ProcessBackend)(nil)
+	_ backend.Waiter           = (*ProcessBackend)(nil)
+)
+
+// Launch starts the run in the background. ctx only bounds the launch; use
+// Cancel to stop the run.
+func (b *ProcessBackend) Launch(ctx context.Context, req *events.ExecutionRequest) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.runs[req.ExecutionRunID]; ok {
+		return nil
+	}
+
+	runCtx, cancel := context.WithCancel(b.ctx)
+	run := &processRun{cancel: cancel, done: make(chan struct{}), status: backend.Status{State: backend.StateRunning}}
+	b.runs[req.ExecutionRunID] = run
+
+	go func(req events.ExecutionRequest) {
+		defer close(run.done)
+		err := runAndPublish(runCtx, b.Runner, b.Publisher, req, func() events.JobEvent {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if run.canceled {
+				return canceledEvent(req, "Run was cancelled")
+			}
+			return lostEvent(req, "Executor shut down before the job finished")
+		})
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		switch {
+		case err == nil:
+			run.status = backend.Status{State: backend.StateSuccessful}
+		case run.canceled:
+			run.status = backend.Status{State: backend.StateCanceled}
+		default:
+			run.status = backend.Status{State: backend.StateFailed, Reason: fmt.Sprintf("Job run failed: %v", err)}
+		}
+	}(*req)
+	return nil
+}
+
+func (b *ProcessBackend) Cancel(ctx context.Context, runID uuid.UUID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	run, ok := b.runs[runID]
+	if !ok {
+		return backend.ErrUnknownRun
+	}
+	if !run.status.Finished() {
+		// Once the executor shuts down its runs are lost, not cancelled
+		if b.ctx.Err() == nil {
+			run.canceled = true
+		}
+		run.cancel()
+	}
+	return nil
+}
+
+func (b *ProcessBackend) Status(ctx context.Context, runID uuid.UUID) (backend.Status, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	run, ok := b.runs[runID]
+	if !ok {
+		return backend.Status{}, backend.ErrUnknownRun
+	}
+	return run.status, nil
+}
+
+func (b *ProcessBackend) Done(runID uuid.UUID) (<-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	run, ok := b.runs[runID]
+	if !ok {
+		return nil, backend.ErrUnknownRun
+	}
+	return run.done, nil
+}
+
+// Cleanup cancels the run if it is still going and waits for it to stop.
+func (b *ProcessBackend) Cleanup(ctx context.Context, runID uuid.UUID) error {
+	if err := b.Cancel(ctx, runID); err == backend.ErrUnknownRun {
+		return nil
+	}
+	b.mu.Lock()
+	run := b.runs[runID]
+	b.mu.Unlock()
+
+	select {
+	case <-run.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	b.mu.Lock()
+	delete(b.runs, runID)
+	b.mu.Unlock()
+	return nil
+}
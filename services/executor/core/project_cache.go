@@ -0,0 +1,193 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/praetordev/praetor/pkg/content"
+)
+
+// ProjectCache keeps project archives on local disk, keyed by their
+// content-addressed archive key. Archives missing locally are fetched from the
+// shared Store; the least recently used archives are evicted once the cache
+// grows beyond MaxBytes.
+type ProjectCache struct {
+	Dir      string
+	MaxBytes int64
+	Store    content.Store // Optional; without it only locally synced archives are cached
+
+	mu sync.Mutex
+}
+
+func NewProjectCache(dir string, maxBytes int64, store content.Store) (*ProjectCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create project cache dir %s: %w", dir, err)
+	}
+	return &ProjectCache{Dir: dir, MaxBytes: maxBytes, Store: store}, nil
+}
+
+// Add packs projectDir, uploads the archive to the store and keeps a local copy.
+func (c *ProjectCache) Add(ctx context.Context, key, projectDir string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.Dir, ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := content.PackDir(projectDir, tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to pack project: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if c.Store != nil {
+		f, err := os.Open(tmp.Name())
+		if err != nil {
+			return err
+		}
+		err = c.Store.Put(ctx, key, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to upload project archive %s: %w", key, err)
+		}
+	}
+
+	return c.commit(tmp.Name(), key)
+}
+
+// Extract unpacks the archive for key into dir. It returns content.ErrNotFound
+// when neither the local cache nor the store has the archive.
+func (c *ProjectCache) Extract(ctx context.Context, key, dir string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	path := c.path(key)
+	if _, err := os.Stat(path); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if err := c.fetch(ctx, key); err != nil {
+			return err
+		}
+		log.Printf("Project cache miss for %s, fetched from store", key)
+	} else {
+		// Mark as recently used
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return content.Extract(f, dir)
+}
+
+// fetch downloads the archive for key from the store into the local cache.
+func (c *ProjectCache) fetch(ctx context.Context, key string) error {
+	if c.Store == nil {
+		return content.ErrNotFound
+	}
+	rc, err := c.Store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp(c.Dir, ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.ReadFrom(rc); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download project archive %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return c.commit(tmp.Name(), key)
+}
+
+// commit moves a downloaded or packed archive into place and enforces the size limit.
+func (c *ProjectCache) commit(tmpPath, key string) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	c.evict(path)
+	return nil
+}
+
+// evict removes the least recently used archives until the cache fits in
+// MaxBytes. The archive at keep is never removed.
+func (c *ProjectCache) evict(keep string) {
+	if c.MaxBytes <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type entry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var entries []entry
+	var total int64
+	_ = filepath.Walk(c.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() || !strings.HasSuffix(path, ".tar.gz") {
+			return nil
+		}
+		entries = append(entries, entry{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	for _, e := range entries {
+		if total <= c.MaxBytes {
+			break
+		}
+		if e.path == keep {
+			continue
+		}
+		if err := os.Remove(e.path); err != nil {
+			log.Printf("Failed to evict cached project archive %s: %v", e.path, err)
+			continue
+		}
+		log.Printf("Evicted cached project archive %s", e.path)
+		total -= e.size
+	}
+}
+
+func (c *ProjectCache) path(key string) string {
+	return filepath.Join(c.Dir, filepath.FromSlash(key))
+}
+
+// checkKey rejects archive keys that would resolve outside the cache directory.
+func checkKey(key string) error {
+	if key == "" || filepath.IsAbs(key) || strings.Contains(key, "..") {
+		return fmt.Errorf("invalid project archive key %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package core_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/praetordev/praetor/pkg/content"
+	"github.com/praetordev/praetor/services/executor/core"
+)
+
+func TestProjectCacheFetchesMissesFromStore(t *testing.T) {
+	store := newMemoryStore()
+	ctx := context.Background()
+
+	// One executor syncs the project and publishes the archive
+	syncer, err := core.NewProjectCache(t.TempDir(), 0, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "site.yml"), []byte("- hosts: all\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key := content.ArchiveKey("https://example.com/repo.git", "abc123")
+	if err := syncer.Add(ctx, key, src); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// Another executor starts with an empty cache
+	cache, err := core.NewProjectCache(t.TempDir(), 0, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		dst := t.TempDir()
+		if err := cache.Extract(ctx, key, dst); err != nil {
+			t.Fatalf("Extract %d failed: %v", i, err)
+		}
+		if _, err := os.Stat(filepath.Join(dst, "site.yml")); err != nil {
+			t.Errorf("Extract %d: site.yml missing: %v", i, err)
+		}
+	}
+	if store.gets != 1 {
+		t.Errorf("Expected a single store download, got %d", store.gets)
+	}
+
+	if err := cache.Extract(ctx, content.ArchiveKey("https://example.com/repo.git", "unknown"), t.TempDir()); err != content.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for an unknown revision, got %v", err)
+	}
+}
+
+func TestProjectCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	// Incompressible content so every archive has a predictable size
+	payload := make([]byte, 64<<10)
+	for i := range payload {
+		payload[i] = byte(i*7919 + i>>3)
+	}
+	if err := os.WriteFile(filepath.Join(src, "blob"), payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	cache, err := core.NewProjectCache(dir, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"projects/r/a.tar.gz", "projects/r/b.tar.gz", "projects/r/c.tar.gz"}
+	base := time.Now().Add(-time.Hour)
+	for i, key := range keys[:2] {
+		if err := cache.Add(ctx, key, src); err != nil {
+			t.Fatal(err)
+		}
+		ts := base.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(filepath.Join(dir, key), ts, ts)
+	}
+
+	// Using "a" makes "b" the least recently used archive
+	if err := cache.Extract(ctx, keys[0], t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, keys[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.MaxBytes = 2*info.Size() + info.Size()/2
+	if err := cache.Add(ctx, keys[2], src); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]bool{keys[0]: true, keys[1]: false, keys[2]: true} {
+		_, err := os.Stat(filepath.Join(dir, key))
+		if got := err == nil; got != want {
+			t.Errorf("%s cached = %v, want %v", key, got, want)
+		}
+	}
+}
+
+// memoryStore is an in-memory content.Store.
+type memoryStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	gets    int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{objects: map[string][]byte{}}
+}
+
+func (s *memoryStore) Put(ctx context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = data
+	return nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, content.ErrNotFound
+	}
+	s.gets++
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/praetordev/praetor/pkg/content"
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+// runProjectUpdate syncs a project: it fetches the project source (checking
+// out the requested branch or the default branch for git) and reports the
+// resolved revision in the JOB_COMPLETED event data, which the consumer
+// records on the project.
+func (r *AnsibleRunner) runProjectUpdate(ctx context.Context, req *events.ExecutionRequest, eventChan chan<- events.JobEvent) error {
+	runDir := filepath.Join(r.BaseDir, req.ExecutionRunID.String())
+	defer os.RemoveAll(runDir)
+
+	manifest := req.JobManifest
+	log.Printf("AnsibleRunner: Syncing %s project %s (ref %q) for run %s", sourceType(manifest.ProjectSource), manifest.ProjectURL, manifest.ProjectRef, req.ExecutionRunID)
+
+	eventChan <- events.JobEvent{
+		ExecutionRunID: req.ExecutionRunID,
+		UnifiedJobID:   req.UnifiedJobID,
+		EventType:      "JOB_STARTED",
+		Timestamp:      time.Now(),
+	}
+
+	if manifest.ProjectURL == "" {
+		return fmt.Errorf("project update requires a project URL")
+	}
+
+	projectDir := filepath.Join(runDir, "project")
+	src, err := r.fetchProject(ctx, manifest, filepath.Join(runDir, "scm"), projectDir)
+	if len(src.Output) > 0 {
+		stdout := string(src.Output)
+		eventChan <- events.JobEvent{
+			ExecutionRunID: req.ExecutionRunID,
+			UnifiedJobID:   req.UnifiedJobID,
+			EventType:      "JOB_LOG",
+			Timestamp:      time.Now(),
+			StdoutSnippet:  &stdout,
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		msg := fmt.Sprintf("Project sync failed: %v", err)
+		eventChan <- events.JobEvent{
+			ExecutionRunID: req.ExecutionRunID,
+			UnifiedJobID:   req.UnifiedJobID,
+			EventType:      "JOB_FAILED",
+			Timestamp:      time.Now(),
+			StdoutSnippet:  &msg,
+		}
+		return nil
+	}
+
+	playbooks, err := discoverPlaybooks(projectDir)
+	if err != nil {
+		log.Printf("AnsibleRunner: Playbook discovery failed for %s: %v", manifest.ProjectURL, err)
+	}
+
+	result := map[string]interface{}{
+		"scm_revision":   src.Revision,
+		"scm_ref":        manifest.ProjectRef,
+		"commit_message": src.Message,
+		"playbooks":      playbooks,
+	}
+	// Publish the checkout so jobs pinned to this revision skip the clone
+	if r.Cache != nil {
+		key := content.ArchiveKey(manifest.ProjectURL, src.Revision)
+		if err := r.Cache.Add(ctx, key, projectDir); err != nil {
+			log.Printf("AnsibleRunner: Failed to archive project %s at %s: %v", manifest.ProjectURL, src.Revision, err)
+		} else {
+			result["archive_key"] = key
+		}
+	}
+	data, _ := json.Marshal(result)
+	summary := fmt.Sprintf("Project synced at revision %s", src.Revision)
+	eventChan <- events.JobEvent{
+		ExecutionRunID: req.ExecutionRunID,
+		UnifiedJobID:   req.UnifiedJobID,
+		EventType:      "JOB_COMPLETED",
+		Timestamp:      time.Now(),
+		StdoutSnippet:  &summary,
+		EventData:      data,
+	}
+
+	log.Printf("AnsibleRunner: Project %s synced at %s", manifest.ProjectURL, src.Revision)
+	return nil
+}
+
+// checkoutProject places the project at ref in dir, returning git's combined
+// output. An empty ref checks out the tip of the default branch. Branches,
+// tags and commit SHAs are accepted: a shallow fetch of the ref is tried
+// first, with a full clone as fallback for servers that refuse to serve
+// commits they do not advertise.
+func checkoutProject(ctx context.Context, url, ref, dir string, env []string) ([]byte, error) {
+	// Refs and URLs come from users; --end-of-options keeps git from taking
+	// one for an option such as --upload-pack. git checkout does not honour
+	// it, so refs that look like options are refused outright.
+	if strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("invalid ref %q", ref)
+	}
+	if ref == "" {
+		return runGit(ctx, env, "clone", "--depth", "1", "--end-of-options", url, dir)
+	}
+
+	var output bytes.Buffer
+	steps := [][]string{
+		{"init", "-q", dir},
+		{"-C", dir, "remote", "add", "--end-of-options", "origin", url},
+		{"-C", dir, "fetch", "-q", "--depth", "1", "--end-of-options", "origin", ref},
+		{"-C", dir, "checkout", "-q", "--detach", "FETCH_HEAD"},
+	}
+	var err error
+	for _, args := range steps {
+		var out []byte
+		out, err = runGit(ctx, env, args...)
+		output.Write(out)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil || ctx.Err() != nil {
+		return output.Bytes(), err
+	}
+
+	log.Printf("Shallow fetch of %s@%s failed (%v), falling back to full clone", url, ref, err)
+	if err := os.RemoveAll(dir); err != nil {
+		return output.Bytes(), err
+	}
+	out, err := runGit(ctx, env, "clone", "-q", "--end-of-options", url, dir)
+	output.Write(out)
+	if err != nil {
+		return output.Bytes(), err
+	}
+	// Branches other than the default only exist as remote-tracking refs
+	target := ref
+	if _, err := gitOutput(ctx, dir, "rev-parse", "-q", "--verify", "refs/remotes/origin/"+ref+"^{commit}"); err == nil {
+		target = "origin/" + ref
+	}
+	out, err = runGit(ctx, env, "-C", dir, "checkout", "-q", "--detach", target)
+	output.Write(out)
+	return output.Bytes(), err
+}
+
+func runGit(ctx context.Context, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	// Never block on an interactive credential prompt
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("git %s: %w", gitSubcommand(args), err)
+	}
+	return out, nil
+}
+
+// gitSubcommand returns the subcommand of git arguments, past any -C <dir>.
+func gitSubcommand(args []string) string {
+	for len(args) > 1 && args[0] == "-C" {
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	out, err := runGit(ctx, nil, append([]string{"-C", dir}, args...)...)
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,145 @@
+package core_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+func TestProjectUpdateReportsRevision(t *testing.T) {
+	repo, commits := newTestRepo(t)
+
+	cases := []struct {
+		name string
+		ref  string
+		want string
+	}{
+		{"default branch", "", commits[1]},
+		{"branch", "main", commits[1]},
+		{"pinned commit", commits[0], commits[0]},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			evt := runProjectUpdate(t, repo, tc.ref)
+			if evt.EventType != "JOB_COMPLETED" {
+				t.Fatalf("Expected JOB_COMPLETED, got %s (%v)", evt.EventType, deref(evt.StdoutSnippet))
+			}
+
+			if got := revision(t, evt); got != tc.want {
+				t.Errorf("Expected revision %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestProjectUpdateFailsForUnknownRef(t *testing.T) {
+	repo, _ := newTestRepo(t)
+
+	evt := runProjectUpdate(t, repo, "no-such-branch")
+	if evt.EventType != "JOB_FAILED" {
+		t.Fatalf("Expected JOB_FAILED, got %s", evt.EventType)
+	}
+}
+
+// runProjectUpdate runs a git project update and returns its terminal event.
+func runProjectUpdate(t *testing.T, repo, ref string) events.JobEvent {
+	t.Helper()
+	return syncProject(t, repo, ref, nil)
+}
+
+// newTestRepo creates a git repository with two commits on main and returns
+// its file:// URL and the commit SHAs, oldest first.
+func newTestRepo(t *testing.T) (string, []string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	git("init", "-q", "-b", "main")
+	var commits []string
+	for _, content := range []string{"- hosts: all\n", "- hosts: all\n  gather_facts: false\n"} {
+		if err := os.WriteFile(filepath.Join(dir, "site.yml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "site.yml")
+		git("commit", "-q", "-m", "update site")
+		commits = append(commits, git("rev-parse", "HEAD"))
+	}
+	return "file://" + dir, commits
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func TestProjectUpdateFallsBackToFullClone(t *testing.T) {
+	repo, _ := newTestRepo(t)
+	dir := strings.TrimPrefix(repo, "file://")
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("checkout", "-q", "-b", "feature")
+	git("commit", "-q", "--allow-empty", "-m", "feature work")
+	feature := git("rev-parse", "HEAD")
+	git("checkout", "-q", "main")
+
+	// A git that refuses shallow fetches, as some servers do
+	realGit, err := exec.LookPath("git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := t.TempDir()
+	script := `#!/bin/sh
+for arg in "$@"; do
+  if [ "$arg" = "--depth" ]; then echo "shallow fetch refused" >&2; exit 128; fi
+done
+exec ` + realGit + ` "$@"
+`
+	if err := os.WriteFile(filepath.Join(bin, "git"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	evt := runProjectUpdate(t, repo, "feature")
+	if evt.EventType != "JOB_COMPLETED" {
+		t.Fatalf("Expected JOB_COMPLETED, got %s (%v)", evt.EventType, deref(evt.StdoutSnippet))
+	}
+	if got := revision(t, evt); got != feature {
+		t.Errorf("Expected revision %s, got %s", feature, got)
+	}
+}
+
+func TestProjectUpdateRejectsOptionRef(t *testing.T) {
+	repo, _ := newTestRepo(t)
+	marker := filepath.Join(t.TempDir(), "pwned")
+
+	evt := runProjectUpdate(t, repo, "--upload-pack=touch "+marker)
+	if evt.EventType != "JOB_FAILED" {
+		t.Fatalf("Expected JOB_FAILED, got %s", evt.EventType)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("ref was run as a git option")
+	}
+}
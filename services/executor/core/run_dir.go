@@ -0,0 +1,73 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+// IsolationBubblewrap runs ansible-runner in a bubblewrap (bwrap) sandbox.
+const IsolationBubblewrap = "bubblewrap"
+
+// Ready reports an error while the volume holding the run directories has
+// less than MinFreeBytes left, so no new runs are taken on.
+func (r *AnsibleRunner) Ready() error {
+	if r.MinFreeBytes <= 0 {
+		return nil
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(r.BaseDir, &st); err != nil {
+		return fmt.Errorf("check free space of %s: %w", r.BaseDir, err)
+	}
+	free := int64(st.Bavail) * int64(st.Bsize)
+	if free < r.MinFreeBytes {
+		return fmt.Errorf("run directory volume %s is nearly full: %d MB free, %d MB required", r.BaseDir, free>>20, r.MinFreeBytes>>20)
+	}
+	return nil
+}
+
+// finishRunDir removes the directory of a playbook or inventory update run
+// once its results were read, unless the run failed and failed runs are kept.
+func (r *AnsibleRunner) finishRunDir(runDir string, failed bool) {
+	if failed && r.KeepFailed {
+		log.Printf("AnsibleRunner: Keeping run directory %s of failed run", runDir)
+		return
+	}
+	if err := os.RemoveAll(runDir); err != nil {
+		log.Printf("AnsibleRunner: Failed to remove run directory %s: %v", runDir, err)
+	}
+}
+
+// playbookCommand returns the ansible-runner command of a playbook run. With
+// bubblewrap isolation the host is mounted read-only, /tmp and the other run
+// directories are hidden and only the run's own directory is writable; the
+// network is shared so hosts can still be reached.
+func (r *AnsibleRunner) playbookCommand(ctx context.Context, runDir string, args ...string) *exec.Cmd {
+	if r.Isolation != IsolationBubblewrap {
+		return exec.CommandContext(ctx, "ansible-runner", args...)
+	}
+	base, err := filepath.Abs(r.BaseDir)
+	if err != nil {
+		base = r.BaseDir
+	}
+	dir := filepath.Join(base, filepath.Base(runDir))
+	bwrap := []string{
+		"--die-with-parent", "--new-session",
+		"--unshare-pid", "--unshare-ipc", "--unshare-uts",
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		"--tmpfs", base,
+		"--bind", dir, dir,
+		// Ansible's own temporary files go where the playbook may write
+		"--setenv", "ANSIBLE_LOCAL_TEMP", filepath.Join(dir, "tmp"),
+		"--setenv", "ANSIBLE_SSH_CONTROL_PATH_DIR", filepath.Join(dir, "cp"),
+		"--", "ansible-runner",
+	}
+	return exec.CommandContext(ctx, "bwrap", append(bwrap, args...)...)
+}
@@ -0,0 +1,128 @@
+package core_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/services/executor/core"
+)
+
+// fakePlaybookRunner puts an ansible-runner on PATH that fails the playbook
+// fail.yml and succeeds any other.
+func fakePlaybookRunner(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	script := `#!/bin/sh
+[ "$4" = fail.yml ] && exit 1
+exit 0
+`
+	if err := os.WriteFile(filepath.Join(bin, "ansible-runner"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return bin
+}
+
+func runPlaybook(t *testing.T, runner *core.AnsibleRunner, playbook string) (string, []events.JobEvent) {
+	t.Helper()
+	req := &events.ExecutionRequest{ExecutionRunID: uuid.New(), UnifiedJobID: 7, JobManifest: events.JobManifest{Playbook: playbook}}
+	eventChan := make(chan events.JobEvent, 100)
+	if err := runner.Run(context.Background(), req, eventChan); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	close(eventChan)
+	var evts []events.JobEvent
+	for evt := range eventChan {
+		evts = append(evts, evt)
+	}
+	return filepath.Join(runner.BaseDir, req.ExecutionRunID.String()), evts
+}
+
+func TestRunDirectoryCleanup(t *testing.T) {
+	fakePlaybookRunner(t)
+
+	cases := []struct {
+		playbook   string
+		keepFailed bool
+		wantKept   bool
+	}{
+		{"site.yml", true, false},
+		{"fail.yml", false, false},
+		{"fail.yml", true, true},
+	}
+	for _, tc := range cases {
+		runner := &core.AnsibleRunner{BaseDir: t.TempDir(), KeepFailed: tc.keepFailed}
+		runDir, _ := runPlaybook(t, runner, tc.playbook)
+
+		info, err := os.Stat(runDir)
+		if kept := err == nil; kept != tc.wantKept {
+			t.Errorf("%s (keep failed %v): run directory kept %v, want %v", tc.playbook, tc.keepFailed, kept, tc.wantKept)
+			continue
+		}
+		if !tc.wantKept {
+			continue
+		}
+		if info.Mode().Perm() != 0700 {
+			t.Errorf("run directory has mode %v, want 0700", info.Mode().Perm())
+		}
+		inv, err := os.Stat(filepath.Join(runDir, "inventory", "hosts.ini"))
+		if err != nil {
+			t.Fatalf("inventory not written: %v", err)
+		}
+		if inv.Mode().Perm() != 0600 {
+			t.Errorf("inventory has mode %v, want 0600", inv.Mode().Perm())
+		}
+	}
+}
+
+func TestRunIsolation(t *testing.T) {
+	bin := fakePlaybookRunner(t)
+	log := filepath.Join(bin, "bwrap.log")
+	script := `#!/bin/sh
+echo "$@" > ` + log + `
+while [ "$1" != "--" ]; do shift; done
+shift
+exec "$@"
+`
+	if err := os.WriteFile(filepath.Join(bin, "bwrap"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir(), Isolation: core.IsolationBubblewrap}
+	runDir, evts := runPlaybook(t, runner, "site.yml")
+	if last := evts[len(evts)-1].EventType; last != "JOB_COMPLETED" {
+		t.Fatalf("last event %s, want JOB_COMPLETED", last)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("ansible-runner not run through bwrap: %v", err)
+	}
+	args := string(data)
+	for _, want := range []string{"--ro-bind / /", "--tmpfs " + runner.BaseDir, "--bind " + runDir + " " + runDir, "-- ansible-runner run " + runDir} {
+		if !strings.Contains(args, want) {
+			t.Errorf("bwrap %q lacks %q", args, want)
+		}
+	}
+}
+
+func TestReadyRefusesNearlyFullVolume(t *testing.T) {
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir()}
+	if err := runner.Ready(); err != nil {
+		t.Errorf("Ready without a free space limit failed: %v", err)
+	}
+
+	runner.MinFreeBytes = 1 << 62
+	if err := runner.Ready(); err == nil || !strings.Contains(err.Error(), "nearly full") {
+		t.Errorf("Ready returned %v, want a nearly full error", err)
+	}
+	req := &events.ExecutionRequest{ExecutionRunID: uuid.New()}
+	if err := runner.Run(context.Background(), req, make(chan events.JobEvent, 10)); err == nil {
+		t.Error("Run should refuse to start on a nearly full volume")
+	}
+}
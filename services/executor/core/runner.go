@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"log"
 	"time"
 
@@ -8,14 +9,25 @@ import (
 )
 
 // Runner defines the interface for running a job.
+// Implementations must stop work and return ctx.Err() once ctx is cancelled.
 type Runner interface {
-	Run(req *events.ExecutionRequest, eventChan chan<- events.JobEvent) error
+	Run(ctx context.Context, req *events.ExecutionRequest, eventChan chan<- events.JobEvent) error
+}
+
+// ReadyChecker is implemented by runners that cannot always take on work,
+// e.g. because their disk is nearly full. Workers only fetch jobs while
+// Ready returns nil.
+type ReadyChecker interface {
+	Ready() error
 }
 
 // MockRunner simulates an Ansible run.
-type MockRunner struct{}
+type MockRunner struct {
+	// TaskDelay is the simulated duration of each task (defaults to 500ms).
+	TaskDelay time.Duration
+}
 
-func (r *MockRunner) Run(req *events.ExecutionRequest, eventChan chan<- events.JobEvent) error {
+func (r *MockRunner) Run(ctx context.Context, req *events.ExecutionRequest, eventChan chan<- events.JobEvent) error {
 	log.Printf("MockRunner: Starting job %d (Run %s)", req.UnifiedJobID, req.ExecutionRunID)
 
 	// 1. Emit JOB_STARTED
@@ -26,10 +38,21 @@ func (r *MockRunner) Run(req *events.ExecutionRequest, eventChan chan<- events.J
 		Timestamp:      time.Now(),
 	}
 
+	delay := r.TaskDelay
+	if delay == 0 {
+		delay = 500 * time.Millisecond
+	}
+
 	// 2. Simulate some tasks
 	tasks := []string{"Gathering Facts", "Install Nginx", "Start Service"}
 	for i, task := range tasks {
-		time.Sleep(500 * time.Millisecond) // Simulate work
+		// Simulate work
+		select {
+		case <-ctx.Done():
+			log.Printf("MockRunner: Job %d interrupted: %v", req.UnifiedJobID, ctx.Err())
+			return ctx.Err()
+		case <-time.After(delay):
+		}
 
 		eventChan <- events.JobEvent{
 			ExecutionRunID: req.ExecutionRunID,
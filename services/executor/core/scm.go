@@ -0,0 +1,216 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+// fetchedProject is the result of fetching a project's source.
+type fetchedProject struct {
+	Output   []byte // Tool output, with credentials redacted
+	Revision string // Commit SHA for git, content digest for archive and manual projects
+	Message  string // Commit subject, git only
+}
+
+// fetchProject places the project described by the manifest in dir and
+// installs its Galaxy requirements. workDir holds credential material and
+// downloads; the caller removes it. Errors carry a hint about the likely
+// cause when one can be derived from the tool output.
+func (r *AnsibleRunner) fetchProject(ctx context.Context, m events.JobManifest, workDir, dir string) (fetchedProject, error) {
+	if err := os.MkdirAll(workDir, 0700); err != nil {
+		return fetchedProject{}, err
+	}
+	defer os.RemoveAll(workDir)
+
+	src := m.ProjectSource
+	if src == nil {
+		src = &events.ProjectSource{}
+	}
+
+	var res fetchedProject
+	var err error
+	switch sourceType(src) {
+	case "git":
+		res, err = fetchGit(ctx, m.ProjectURL, m.ProjectRef, src, workDir, dir)
+	case "archive":
+		res, err = r.fetchArchive(ctx, m.ProjectURL, m.ProjectRef, src, workDir, dir)
+	case "manual":
+		res, err = r.fetchManual(m.ProjectURL, m.ProjectRef, dir)
+	default:
+		return fetchedProject{}, fmt.Errorf("unsupported project type %q", src.Type)
+	}
+
+	if err == nil {
+		var out []byte
+		out, err = installRequirements(ctx, dir, src)
+		res.Output = append(res.Output, out...)
+	}
+
+	res.Output = redact(res.Output, src)
+	if err != nil {
+		msg := redact([]byte(err.Error()), src)
+		if hint := scmErrorHint(res.Output); hint != "" {
+			return res, fmt.Errorf("%s (%s)", msg, hint)
+		}
+		return res, fmt.Errorf("%s", msg)
+	}
+	return res, nil
+}
+
+func sourceType(src *events.ProjectSource) string {
+	if src == nil || src.Type == "" {
+		return "git"
+	}
+	return src.Type
+}
+
+// fetchGit checks out url at ref, then the submodules and LFS objects if the
+// project asks for them.
+func fetchGit(ctx context.Context, url, ref string, src *events.ProjectSource, workDir, dir string) (fetchedProject, error) {
+	env, err := gitAuthEnv(workDir, src.Credential)
+	if err != nil {
+		return fetchedProject{}, fmt.Errorf("failed to set up SCM credential: %w", err)
+	}
+
+	var output bytes.Buffer
+	out, err := checkoutProject(ctx, url, ref, dir, env)
+	output.Write(out)
+	if err != nil {
+		return fetchedProject{Output: output.Bytes()}, err
+	}
+
+	if src.Submodules {
+		out, err := runGit(ctx, env, "-C", dir, "submodule", "update", "--init", "--recursive")
+		output.Write(out)
+		if err != nil {
+			return fetchedProject{Output: output.Bytes()}, fmt.Errorf("submodule update failed: %w", err)
+		}
+	}
+	if src.LFS {
+		for _, args := range [][]string{{"lfs", "install", "--local"}, {"lfs", "pull"}} {
+			out, err := runGit(ctx, env, append([]string{"-C", dir}, args...)...)
+			output.Write(out)
+			if err != nil {
+				return fetchedProject{Output: output.Bytes()}, fmt.Errorf("LFS fetch failed: %w", err)
+			}
+		}
+	}
+
+	revision, err := gitOutput(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return fetchedProject{Output: output.Bytes()}, fmt.Errorf("failed to resolve synced revision: %w", err)
+	}
+	message, _ := gitOutput(ctx, dir, "log", "-1", "--pretty=%s")
+	return fetchedProject{Output: output.Bytes(), Revision: revision, Message: message}, nil
+}
+
+// askpassScript answers git's username/password prompts and ssh's key
+// passphrase prompt from the environment, so secrets never appear in
+// command lines or URLs.
+const askpassScript = `#!/bin/sh
+case "$1" in
+  Username*) printf '%s\n' "$PRAETOR_SCM_USERNAME" ;;
+  *passphrase*) printf '%s\n' "$PRAETOR_SCM_KEY_UNLOCK" ;;
+  *) printf '%s\n' "$PRAETOR_SCM_PASSWORD" ;;
+esac
+`
+
+// gitAuthEnv writes the credential's key material to workDir and returns the
+// environment git needs to use it. Without known_hosts in the credential,
+// unknown SSH host keys are accepted on first use for this sync only.
+func gitAuthEnv(workDir string, cred *events.SCMCredential) ([]string, error) {
+	if cred == nil {
+		return nil, nil
+	}
+
+	askpass := filepath.Join(workDir, "askpass.sh")
+	if err := os.WriteFile(askpass, []byte(askpassScript), 0700); err != nil {
+		return nil, err
+	}
+	env := []string{
+		"GIT_ASKPASS=" + askpass,
+		"SSH_ASKPASS=" + askpass,
+		"SSH_ASKPASS_REQUIRE=force",
+		"PRAETOR_SCM_USERNAME=" + cred.Username,
+		"PRAETOR_SCM_PASSWORD=" + cred.Password,
+		"PRAETOR_SCM_KEY_UNLOCK=" + cred.SSHKeyUnlock,
+	}
+
+	knownHosts := filepath.Join(workDir, "known_hosts")
+	if err := os.WriteFile(knownHosts, []byte(cred.KnownHosts), 0600); err != nil {
+		return nil, err
+	}
+	hostKeyChecking := "yes"
+	if strings.TrimSpace(cred.KnownHosts) == "" {
+		hostKeyChecking = "accept-new"
+	}
+	ssh := fmt.Sprintf("ssh -o UserKnownHostsFile=%s -o StrictHostKeyChecking=%s", knownHosts, hostKeyChecking)
+
+	if cred.SSHKeyData != "" {
+		key := filepath.Join(workDir, "id_scm")
+		data := cred.SSHKeyData
+		if !strings.HasSuffix(data, "\n") {
+			data += "\n"
+		}
+		if err := os.WriteFile(key, []byte(data), 0600); err != nil {
+			return nil, err
+		}
+		ssh += fmt.Sprintf(" -i %s -o IdentitiesOnly=yes", key)
+	}
+	return append(env, "GIT_SSH_COMMAND="+ssh), nil
+}
+
+var urlUserinfo = regexp.MustCompile(`://[^/@\s]+@`)
+
+// redact removes credential secrets and URL userinfo from tool output.
+func redact(output []byte, src *events.ProjectSource) []byte {
+	output = urlUserinfo.ReplaceAll(output, []byte("://****@"))
+	var secrets []string
+	if cred := src.Credential; cred != nil {
+		secrets = append(secrets, cred.Password, cred.SSHKeyUnlock)
+	}
+	for _, server := range src.GalaxyServers {
+		secrets = append(secrets, server.Token)
+	}
+	for _, secret := range secrets {
+		if secret != "" {
+			output = bytes.ReplaceAll(output, []byte(secret), []byte("****"))
+		}
+	}
+	return output
+}
+
+// scmErrorHints maps well-known git and ssh messages to a likely cause.
+var scmErrorHints = []struct {
+	match string
+	hint  string
+}{
+	{"Host key verification failed", "the SSH host key is not trusted; add it to the credential's known hosts"},
+	{"REMOTE HOST IDENTIFICATION HAS CHANGED", "the SSH host key does not match the credential's known hosts"},
+	{"Permission denied (publickey", "SSH authentication failed; check the credential's private key"},
+	{"incorrect passphrase", "the private key passphrase is wrong"},
+	{"Authentication failed", "authentication failed; check the credential's username and password or token"},
+	{"could not read Username", "the repository requires authentication; attach a Source Control credential"},
+	{"could not read Password", "the repository requires a password or token"},
+	{"Repository not found", "the repository does not exist or the credential cannot access it"},
+	{"does not appear to be a git repository", "the URL is not a git repository"},
+	{"couldn't find remote ref", "the branch, tag or commit does not exist"},
+	{"did not match any file(s) known to git", "the branch, tag or commit does not exist"},
+	{"'lfs' is not a git command", "Git LFS is not installed on the executor"},
+}
+
+func scmErrorHint(output []byte) string {
+	for _, h := range scmErrorHints {
+		if bytes.Contains(output, []byte(h.match)) {
+			return h.hint
+		}
+	}
+	return ""
+}
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/praetordev/praetor/pkg/content"
+	"github.com/praetordev/praetor/pkg/events"
+)
+
+// fetchArchive downloads a tar, tar.gz or zip archive and unpacks it into dir.
+// The revision is the archive's sha256 digest; it must match the project's
+// checksum and, for jobs, the revision recorded by the last sync. A single
+// top-level directory in the archive is stripped. Archives larger than
+// MaxArchiveBytes, or unpacking to more than MaxUnpackedBytes, are rejected.
+func (r *AnsibleRunner) fetchArchive(ctx context.Context, url, ref string, src *events.ProjectSource, workDir, dir string) (fetchedProject, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return fetchedProject{}, fmt.Errorf("archive URL must be http or https: %s", url)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fetchedProject{}, err
+	}
+	if cred := src.Credential; cred != nil && (cred.Username != "" || cred.Password != "") {
+		req.SetBasicAuth(cred.Username, cred.Password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fetchedProject{}, fmt.Errorf("archive download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fetchedProject{}, fmt.Errorf("archive download failed: %s", resp.Status)
+	}
+	tooLarge := fmt.Errorf("archive is larger than the limit of %d MB", r.MaxArchiveBytes>>20)
+	if r.MaxArchiveBytes > 0 && resp.ContentLength > r.MaxArchiveBytes {
+		return fetchedProject{}, tooLarge
+	}
+	body := io.Reader(resp.Body)
+	if r.MaxArchiveBytes > 0 {
+		body = io.LimitReader(resp.Body, r.MaxArchiveBytes+1)
+	}
+
+	path := filepath.Join(workDir, "archive")
+	f, err := os.Create(path)
+	if err != nil {
+		return fetchedProject{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), body)
+	if err != nil {
+		return fetchedProject{}, fmt.Errorf("archive download failed: %w", err)
+	}
+	if r.MaxArchiveBytes > 0 && size > r.MaxArchiveBytes {
+		return fetchedProject{}, tooLarge
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	output := []byte(fmt.Sprintf("Downloaded %s (%d bytes, sha256:%s)\n", url, size, digest))
+
+	if want := normalizeDigest(src.Checksum); want != "" && want != digest {
+		return fetchedProject{Output: output}, fmt.Errorf("archive checksum mismatch: expected sha256:%s, got sha256:%s", want, digest)
+	}
+	if ref != "" && normalizeDigest(ref) != digest {
+		return fetchedProject{Output: output}, fmt.Errorf("archive changed since the last project sync: expected sha256:%s, got sha256:%s", normalizeDigest(ref), digest)
+	}
+
+	staging := filepath.Join(workDir, "unpacked")
+	if err := unpackArchive(f, size, staging, r.MaxUnpackedBytes); err != nil {
+		if errors.Is(err, content.ErrTooLarge) {
+			return fetchedProject{Output: output}, fmt.Errorf("failed to unpack archive: contents are larger than the limit of %d MB", r.MaxUnpackedBytes>>20)
+		}
+		return fetchedProject{Output: output}, fmt.Errorf("failed to unpack archive: %w", err)
+	}
+	if err := placeUnpacked(staging, dir); err != nil {
+		return fetchedProject{Output: output}, err
+	}
+	return fetchedProject{Output: output, Revision: digest}, nil
+}
+
+// unpackArchive detects the archive format from its magic bytes and unpacks
+// at most maxBytes of files, unless it is 0.
+func unpackArchive(f *os.File, size int64, dir string, maxBytes int64) error {
+	magic := make([]byte, 4)
+	if _, err := f.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return content.ExtractZip(f, size, dir, maxBytes)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		return content.ExtractTar(gr, dir, maxBytes)
+	default:
+		return content.ExtractTar(f, dir, maxBytes)
+	}
+}
+
+// placeUnpacked moves the unpacked archive to dir, stripping a single
+// top-level directory such as the "repo-main/" prefix of release tarballs.
+func placeUnpacked(staging, dir string) error {
+	entries, err := os.ReadDir(staging)
+	if err != nil {
+		return err
+	}
+	root := staging
+	if len(entries) == 1 && entries[0].IsDir() {
+		root = filepath.Join(staging, entries[0].Name())
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	return os.Rename(root, dir)
+}
+
+func normalizeDigest(s string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "sha256:"))
+}
+
+// fetchManual copies a directory from the executor's projects root. Manual
+// projects are edited in place, so a revision that differs from the last sync
+// is logged rather than rejected.
+func (r *AnsibleRunner) fetchManual(path, ref, dir string) (fetchedProject, error) {
+	if filepath.IsAbs(path) || strings.Contains(path, "..") {
+		return fetchedProject{}, fmt.Errorf("manual project path must be relative to the projects root: %s", path)
+	}
+	srcDir := filepath.Join(r.ProjectsRoot, path)
+	info, err := os.Stat(srcDir)
+	if err != nil {
+		return fetchedProject{}, fmt.Errorf("manual project directory %s not found on this executor: %w", srcDir, err)
+	}
+	if !info.IsDir() {
+		return fetchedProject{}, fmt.Errorf("manual project path %s is not a directory", srcDir)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fetchedProject{}, err
+	}
+	if err := copyDir(srcDir, dir); err != nil {
+		return fetchedProject{}, fmt.Errorf("failed to copy manual project: %w", err)
+	}
+	digest, err := content.DirDigest(dir)
+	if err != nil {
+		return fetchedProject{}, err
+	}
+	if ref != "" && ref != digest {
+		log.Printf("Manual project %s changed since the last sync (%s, now %s)", path, ref, digest)
+	}
+	output := []byte(fmt.Sprintf("Copied %s (sha256:%s)\n", srcDir, digest))
+	return fetchedProject{Output: output, Revision: digest}, nil
+}
+
+// copyDir copies the regular files, directories and symlinks under src to dst.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			in, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, in); err != nil {
+				out.Close()
+				return err
+			}
+			return out.Close()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,289 @@
+package core_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/praetordev/praetor/pkg/content"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/services/executor/core"
+)
+
+func TestArchiveProjectSync(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "site.yml"), "- hosts: all\n")
+	var tgz bytes.Buffer
+	if err := content.PackDir(src, &tgz); err != nil {
+		t.Fatal(err)
+	}
+	archives := map[string][]byte{
+		"/project.tar.gz": tgz.Bytes(),
+		"/project.zip":    zipWithPrefix(t, "project-main/", map[string]string{"site.yml": "- hosts: all\n"}),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := archives[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	for path, data := range archives {
+		t.Run(path, func(t *testing.T) {
+			sum := sha256.Sum256(data)
+			digest := hex.EncodeToString(sum[:])
+
+			evt := syncProject(t, srv.URL+path, "", &events.ProjectSource{Type: "archive", Checksum: "sha256:" + digest})
+			if evt.EventType != "JOB_COMPLETED" {
+				t.Fatalf("Expected JOB_COMPLETED, got %s (%v)", evt.EventType, deref(evt.StdoutSnippet))
+			}
+			if got := revision(t, evt); got != digest {
+				t.Errorf("Expected revision %s, got %s", digest, got)
+			}
+		})
+	}
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		evt := syncProject(t, srv.URL+"/project.tar.gz", "", &events.ProjectSource{Type: "archive", Checksum: "sha256:" + strings.Repeat("0", 64)})
+		if evt.EventType != "JOB_FAILED" || !strings.Contains(deref(evt.StdoutSnippet), "checksum mismatch") {
+			t.Errorf("Expected a checksum failure, got %s: %s", evt.EventType, deref(evt.StdoutSnippet))
+		}
+	})
+}
+
+func TestArchiveProjectSyncSizeLimits(t *testing.T) {
+	data := zipWithPrefix(t, "", map[string]string{"site.yml": strings.Repeat("- hosts: all\n", 1000)})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Without a length the download itself has to be cut off
+		w.(http.Flusher).Flush()
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name    string
+		runner  *core.AnsibleRunner
+		wantErr string
+	}{
+		{"download", &core.AnsibleRunner{BaseDir: t.TempDir(), MaxArchiveBytes: int64(len(data)) - 1}, "archive is larger than the limit"},
+		{"unpacked", &core.AnsibleRunner{BaseDir: t.TempDir(), MaxUnpackedBytes: 10000}, "contents are larger than the limit"},
+		{"within limits", &core.AnsibleRunner{BaseDir: t.TempDir(), MaxArchiveBytes: int64(len(data)), MaxUnpackedBytes: 13000}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			evt := runProjectUpdateWith(t, tc.runner, srv.URL+"/project.zip", "", &events.ProjectSource{Type: "archive"})
+			if tc.wantErr == "" {
+				if evt.EventType != "JOB_COMPLETED" {
+					t.Errorf("Expected JOB_COMPLETED, got %s (%v)", evt.EventType, deref(evt.StdoutSnippet))
+				}
+				return
+			}
+			if evt.EventType != "JOB_FAILED" || !strings.Contains(deref(evt.StdoutSnippet), tc.wantErr) {
+				t.Errorf("Expected a failure mentioning %q, got %s: %s", tc.wantErr, evt.EventType, deref(evt.StdoutSnippet))
+			}
+		})
+	}
+}
+
+func TestArchiveProjectSyncStripsTopLevelDirectory(t *testing.T) {
+	data := zipWithPrefix(t, "project-main/", map[string]string{"site.yml": "- hosts: all\n"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(data) }))
+	defer srv.Close()
+
+	cache, err := core.NewProjectCache(t.TempDir(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir(), Cache: cache}
+	url := srv.URL + "/project.zip"
+	evt := runProjectUpdateWith(t, runner, url, "", &events.ProjectSource{Type: "archive"})
+	if evt.EventType != "JOB_COMPLETED" {
+		t.Fatalf("Expected JOB_COMPLETED, got %s (%v)", evt.EventType, deref(evt.StdoutSnippet))
+	}
+
+	// Jobs get the synced archive from the cache
+	dir := t.TempDir()
+	if err := cache.Extract(context.Background(), content.ArchiveKey(url, revision(t, evt)), dir); err != nil {
+		t.Fatalf("Synced archive not cached: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "site.yml")); err != nil {
+		t.Errorf("Expected site.yml at the project root: %v", err)
+	}
+}
+
+func TestManualProjectSync(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "ops", "site.yml"), "- hosts: all\n")
+
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir(), ProjectsRoot: root}
+	first := runProjectUpdateWith(t, runner, "ops", "", &events.ProjectSource{Type: "manual"})
+	if first.EventType != "JOB_COMPLETED" {
+		t.Fatalf("Expected JOB_COMPLETED, got %s (%v)", first.EventType, deref(first.StdoutSnippet))
+	}
+
+	writeTestFile(t, filepath.Join(root, "ops", "site.yml"), "- hosts: web\n")
+	second := runProjectUpdateWith(t, runner, "ops", "", &events.ProjectSource{Type: "manual"})
+	if revision(t, first) == revision(t, second) {
+		t.Errorf("Expected the revision to change with the directory content")
+	}
+
+	missing := runProjectUpdateWith(t, runner, "../etc", "", &events.ProjectSource{Type: "manual"})
+	if missing.EventType != "JOB_FAILED" {
+		t.Errorf("Expected paths outside the projects root to be rejected, got %s", missing.EventType)
+	}
+}
+
+func TestGitProjectWithSubmodules(t *testing.T) {
+	sub, _ := newTestRepo(t)
+	repo, _ := newTestRepo(t)
+	// Allow file:// submodules, which git refuses by default
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "protocol.file.allow")
+	t.Setenv("GIT_CONFIG_VALUE_0", "always")
+
+	dir := strings.TrimPrefix(repo, "file://")
+	gitIn(t, dir, "submodule", "add", "-q", sub, "roles/common")
+	gitIn(t, dir, "commit", "-q", "-m", "add submodule")
+
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir()}
+	evt := runProjectUpdateWith(t, runner, repo, "main", &events.ProjectSource{Type: "git", Submodules: true})
+	if evt.EventType != "JOB_COMPLETED" {
+		t.Fatalf("Expected JOB_COMPLETED, got %s (%v)", evt.EventType, deref(evt.StdoutSnippet))
+	}
+}
+
+func TestGitProjectHTTPSCredential(t *testing.T) {
+	repo, _ := newTestRepo(t)
+	execPath, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Skip("git exec path not available")
+	}
+	backend := filepath.Join(strings.TrimSpace(string(execPath)), "git-http-backend")
+	if _, err := os.Stat(backend); err != nil {
+		t.Skip("git-http-backend not available")
+	}
+
+	repoDir := strings.TrimPrefix(repo, "file://")
+	handler := &cgi.Handler{
+		Path: backend,
+		Env:  []string{"GIT_PROJECT_ROOT=" + filepath.Dir(repoDir), "GIT_HTTP_EXPORT_ALL=1"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "deploy" || pass != "s3cret-token" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	url := srv.URL + "/" + filepath.Base(repoDir)
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir()}
+
+	evt := runProjectUpdateWith(t, runner, url, "main", &events.ProjectSource{
+		Credential: &events.SCMCredential{Username: "deploy", Password: "s3cret-token"},
+	})
+	if evt.EventType != "JOB_COMPLETED" {
+		t.Fatalf("Expected JOB_COMPLETED with the credential, got %s (%v)", evt.EventType, deref(evt.StdoutSnippet))
+	}
+
+	evt = runProjectUpdateWith(t, runner, url, "main", nil)
+	msg := deref(evt.StdoutSnippet)
+	if evt.EventType != "JOB_FAILED" || !strings.Contains(msg, "requires authentication") {
+		t.Errorf("Expected an authentication hint without the credential, got %s: %s", evt.EventType, msg)
+	}
+}
+
+// syncProject runs a project update for url and returns its terminal event.
+func syncProject(t *testing.T, url, ref string, source *events.ProjectSource) events.JobEvent {
+	t.Helper()
+	runner := &core.AnsibleRunner{BaseDir: t.TempDir()}
+	return runProjectUpdateWith(t, runner, url, ref, source)
+}
+
+func runProjectUpdateWith(t *testing.T, runner *core.AnsibleRunner, url, ref string, source *events.ProjectSource) events.JobEvent {
+	t.Helper()
+	req := &events.ExecutionRequest{
+		ExecutionRunID: uuid.New(),
+		UnifiedJobID:   1,
+		JobManifest: events.JobManifest{
+			JobType:       events.JobTypeProjectUpdate,
+			ProjectURL:    url,
+			ProjectRef:    ref,
+			ProjectSource: source,
+		},
+	}
+
+	eventChan := make(chan events.JobEvent, 10)
+	if err := runner.Run(context.Background(), req, eventChan); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	close(eventChan)
+
+	var last events.JobEvent
+	for evt := range eventChan {
+		last = evt
+	}
+	return last
+}
+
+func revision(t *testing.T, evt events.JobEvent) string {
+	t.Helper()
+	var result struct {
+		SCMRevision string `json:"scm_revision"`
+	}
+	if err := json.Unmarshal(evt.EventData, &result); err != nil {
+		t.Fatalf("Invalid event data: %v", err)
+	}
+	return result.SCMRevision
+}
+
+func zipWithPrefix(t *testing.T, prefix string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		f, err := zw.Create(prefix + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeTestFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gitIn(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+}
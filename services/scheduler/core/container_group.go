@@ -0,0 +1,52 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// instanceGroup resolves the execution backend of a template's jobs and, for
+// container groups, the group and the resources of its resource class. The
+// group is nil when the template does not run in a container group.
+func instanceGroup(ctx context.Context, tx *sqlx.Tx, template models.JobTemplate) (string, *events.ContainerGroup, error) {
+	var class string
+	if template.ResourceClass != nil {
+		class = *template.ResourceClass
+	}
+	if template.InstanceGroupID == nil {
+		if class != "" {
+			return "", nil, fmt.Errorf("resource class %q needs a container group", class)
+		}
+		return "", nil, nil
+	}
+
+	var group models.InstanceGroup
+	if err := tx.GetContext(ctx, &group, "SELECT * FROM instance_groups WHERE id = $1", *template.InstanceGroupID); err != nil {
+		return "", nil, fmt.Errorf("failed to load instance group %d: %w", *template.InstanceGroupID, err)
+	}
+	if !group.IsContainerGroup {
+		if class != "" {
+			return "", nil, fmt.Errorf("resource class %q needs a container group, %s is not one", class, group.Name)
+		}
+		return group.Backend, nil, nil
+	}
+
+	cg := &events.ContainerGroup{Name: group.Name, PodSpecOverride: group.PodSpecOverride, ResourceClass: class}
+	if class != "" {
+		var classes map[string]json.RawMessage
+		if err := json.Unmarshal(group.ResourceClasses, &classes); err != nil {
+			return "", nil, fmt.Errorf("invalid resource classes for container group %s: %w", group.Name, err)
+		}
+		resources, ok := classes[class]
+		if !ok {
+			return "", nil, fmt.Errorf("container group %s has no resource class %q", group.Name, class)
+		}
+		cg.Resources = resources
+	}
+	return models.BackendKubernetes, cg, nil
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// executionEnvironment resolves the execution environment of a job in the
+// organization: the first of ids that is set (e.g. the template's, then the
+// project's default), else the organization's default, else the global
+// default. It returns nil when none is configured.
+func executionEnvironment(ctx context.Context, tx *sqlx.Tx, orgID int64, ids ...*int64) (*events.ExecutionEnvironment, error) {
+	var ee models.ExecutionEnvironment
+	found := false
+	for _, id := range ids {
+		if id == nil {
+			continue
+		}
+		if err := tx.GetContext(ctx, &ee, "SELECT * FROM execution_environments WHERE id = $1", *id); err != nil {
+			return nil, fmt.Errorf("failed to load execution environment %d: %w", *id, err)
+		}
+		found = true
+		break
+	}
+	if !found {
+		err := tx.GetContext(ctx, &ee, `
+			SELECT ee.* FROM execution_environments ee
+			JOIN organizations o ON o.default_environment_id = ee.id
+			WHERE o.id = $1`, orgID)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = tx.GetContext(ctx, &ee, "SELECT * FROM execution_environments WHERE is_default AND organization_id IS NULL")
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load default execution environment: %w", err)
+		}
+	}
+
+	env := &events.ExecutionEnvironment{Name: ee.Name, Image: ee.Image, Pull: ee.Pull}
+	if ee.CredentialID != nil {
+		var cred struct {
+			TypeName string          `db:"type_name"`
+			Inputs   json.RawMessage `db:"inputs"`
+		}
+		err := tx.GetContext(ctx, &cred, `
+			SELECT ct.name AS type_name, c.inputs
+			FROM credentials c JOIN credential_types ct ON ct.id = c.credential_type_id
+			WHERE c.id = $1`, *ee.CredentialID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load credential %d: %w", *ee.CredentialID, err)
+		}
+		if cred.TypeName != models.CredentialTypeRegistry {
+			return nil, fmt.Errorf("credential %d is a %s credential, not %s", *ee.CredentialID, cred.TypeName, models.CredentialTypeRegistry)
+		}
+		var registry events.RegistryCredential
+		if err := json.Unmarshal(cred.Inputs, &registry); err != nil {
+			return nil, fmt.Errorf("invalid inputs for credential %d: %w", *ee.CredentialID, err)
+		}
+		env.Credential = &registry
+	}
+	return env, nil
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/inventory"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// recordJobHosts remembers which host rows the job's inventory hosts stand
+// for, so the consumer can attribute what the run reports per host name.
+func recordJobHosts(ctx context.Context, tx *sqlx.Tx, jobID int64, inv *inventory.Inventory) error {
+	for name, h := range inv.Hosts {
+		for _, id := range h.IDs {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO job_hosts (unified_job_id, host_id, host_name)
+				VALUES ($1, $2, $3)
+				ON CONFLICT DO NOTHING`, jobID, id, name)
+			if err != nil {
+				return fmt.Errorf("failed to record host %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadFactCache returns the stored facts of the inventory's hosts. A name
+// standing for several hosts gets the most recently gathered facts.
+func loadFactCache(ctx context.Context, tx *sqlx.Tx, inv *inventory.Inventory) (map[string]events.CachedFacts, error) {
+	names := map[int64]string{}
+	var ids []int64
+	for name, h := range inv.Hosts {
+		for _, id := range h.IDs {
+			names[id] = name
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var stored []models.HostFacts
+	err := tx.SelectContext(ctx, &stored, `
+		SELECT * FROM host_facts WHERE host_id = ANY($1)
+		ORDER BY modified_at`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch host facts: %w", err)
+	}
+
+	cache := map[string]events.CachedFacts{}
+	for _, f := range stored {
+		cache[names[f.HostID]] = events.CachedFacts{Facts: f.Facts, ModifiedAt: f.ModifiedAt}
+	}
+	return cache, nil
+}
+
+// storeFactCache puts the facts a run is seeded with in the Facts store and
+// returns the key the run's manifest refers to them by.
+func (s *Scheduler) storeFactCache(ctx context.Context, runID uuid.UUID, cache map[string]events.CachedFacts) (string, error) {
+	if len(cache) == 0 {
+		return "", nil
+	}
+	if s.Facts == nil {
+		return "", fmt.Errorf("no fact cache store")
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("fact-caches/%s.json", runID)
+	if err := s.Facts.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		return "", fmt.Errorf("failed to store fact cache: %w", err)
+	}
+	return key, nil
+}
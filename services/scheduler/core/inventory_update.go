@@ -0,0 +1,112 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/content"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// scheduleInventoryUpdate returns the execution request for an inventory
+// update job, or nil once it failed the job. The executor runs
+// ansible-inventory against the source and reports the resulting inventory
+// back through the job events.
+func (s *Scheduler) scheduleInventoryUpdate(ctx context.Context, tx *sqlx.Tx, job models.UnifiedJob, runID uuid.UUID) *events.ExecutionRequest {
+	if job.UnifiedJobTemplateID == nil {
+		log.Printf("Inventory update %d has no inventory source - failing", job.ID)
+		_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+		return nil
+	}
+
+	var src models.InventorySource
+	if err := tx.GetContext(ctx, &src, "SELECT * FROM inventory_sources WHERE id = $1", *job.UnifiedJobTemplateID); err != nil {
+		log.Printf("Failed to find inventory source %d for update %d: %v", *job.UnifiedJobTemplateID, job.ID, err)
+		_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+		return nil
+	}
+
+	manifest, err := inventoryUpdateManifest(ctx, tx, src)
+	if err != nil {
+		log.Printf("Inventory update %d for source %s cannot be scheduled: %v", job.ID, src.Name, err)
+		_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+		return nil
+	}
+
+	req := &events.ExecutionRequest{
+		ExecutionRunID: runID,
+		UnifiedJobID:   job.ID,
+		JobManifest:    *manifest,
+		CreatedAt:      time.Now(),
+	}
+
+	log.Printf("Publishing inventory update %d for %s source %s (inventory %d)", job.ID, src.Source, src.Name, src.InventoryID)
+	return req
+}
+
+// inventoryUpdateManifest builds the manifest for updating from src. SCM
+// sources read the inventory file from the project's last synced revision.
+func inventoryUpdateManifest(ctx context.Context, tx *sqlx.Tx, src models.InventorySource) (*events.JobManifest, error) {
+	manifest := &events.JobManifest{
+		JobType:         events.JobTypeInventoryUpdate,
+		InventorySource: &events.InventorySource{Type: src.Source},
+		ExtraVars:       map[string]interface{}{},
+		EnvironmentRefs: []string{},
+	}
+
+	var orgID int64
+	if err := tx.GetContext(ctx, &orgID, "SELECT organization_id FROM inventories WHERE id = $1", src.InventoryID); err != nil {
+		return nil, fmt.Errorf("failed to find inventory %d: %w", src.InventoryID, err)
+	}
+	var projectEnvID *int64
+
+	switch src.Source {
+	case models.InventorySourceScript:
+		if src.SourceScript == nil || *src.SourceScript == "" {
+			return nil, fmt.Errorf("script source has no script")
+		}
+		manifest.InventorySource.Script = *src.SourceScript
+	case models.InventorySourcePlugin:
+		if len(src.SourceVars) == 0 {
+			return nil, fmt.Errorf("plugin source has no plugin configuration")
+		}
+		manifest.InventorySource.PluginConfig = src.SourceVars
+	case models.InventorySourceSCM:
+		if src.SourceProjectID == nil {
+			return nil, fmt.Errorf("scm source has no project")
+		}
+		var project models.Project
+		if err := tx.GetContext(ctx, &project, "SELECT * FROM projects WHERE id = $1", *src.SourceProjectID); err != nil {
+			return nil, fmt.Errorf("failed to find project %d: %w", *src.SourceProjectID, err)
+		}
+		if project.SCMRevision == nil {
+			return nil, fmt.Errorf("project %s has not been synced yet", project.Name)
+		}
+		source, err := projectSource(ctx, tx, project)
+		if err != nil {
+			return nil, err
+		}
+		manifest.ProjectURL = project.SCMURL
+		manifest.ProjectRef = *project.SCMRevision
+		manifest.ProjectArchive = content.ArchiveKey(project.SCMURL, manifest.ProjectRef)
+		manifest.ProjectSource = source
+		projectEnvID = project.DefaultEnvironmentID
+		if src.SourcePath != nil {
+			manifest.InventorySource.Path = *src.SourcePath
+		}
+	default:
+		return nil, fmt.Errorf("unknown source type %q", src.Source)
+	}
+
+	env, err := executionEnvironment(ctx, tx, orgID, projectEnvID)
+	if err != nil {
+		return nil, err
+	}
+	manifest.ExecutionEnvironment = env
+	return manifest, nil
+}
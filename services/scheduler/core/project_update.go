@@ -0,0 +1,145 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// scheduleProjectUpdate returns the execution request for a project update
+// job, or nil once it failed the job. The executor checks out the project's
+// branch (or default branch) and reports the resolved commit SHA back
+// through the job events.
+func (s *Scheduler) scheduleProjectUpdate(ctx context.Context, tx *sqlx.Tx, job models.UnifiedJob, runID uuid.UUID) *events.ExecutionRequest {
+	if job.UnifiedJobTemplateID == nil {
+		log.Printf("Project update %d has no project - failing", job.ID)
+		_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+		return nil
+	}
+
+	var project models.Project
+	if err := tx.GetContext(ctx, &project, "SELECT * FROM projects WHERE id = $1", *job.UnifiedJobTemplateID); err != nil {
+		log.Printf("Failed to find project %d for update %d: %v", *job.UnifiedJobTemplateID, job.ID, err)
+		_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+		return nil
+	}
+
+	source, err := projectSource(ctx, tx, project)
+	if err != nil {
+		log.Printf("Project update %d for project %s cannot be scheduled: %v", job.ID, project.Name, err)
+		_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+		return nil
+	}
+
+	env, err := executionEnvironment(ctx, tx, project.OrganizationID, project.DefaultEnvironmentID)
+	if err != nil {
+		log.Printf("Project update %d for project %s cannot be scheduled: %v", job.ID, project.Name, err)
+		_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+		return nil
+	}
+
+	var ref string
+	if project.SCMBranch != nil && source.Type == models.SCMTypeGit {
+		ref = *project.SCMBranch
+	}
+
+	req := &events.ExecutionRequest{
+		ExecutionRunID: runID,
+		UnifiedJobID:   job.ID,
+		JobManifest: events.JobManifest{
+			JobType:         events.JobTypeProjectUpdate,
+			ProjectURL:      project.SCMURL,
+			ProjectRef:      ref,
+			ProjectSource:   source,
+			ExtraVars:       map[string]interface{}{},
+			EnvironmentRefs: []string{},
+
+			ExecutionEnvironment: env,
+		},
+		CreatedAt: time.Now(),
+	}
+
+	log.Printf("Publishing project update %d for %s project %s (%s@%s)", job.ID, source.Type, project.Name, project.SCMURL, ref)
+	return req
+}
+
+// projectSource resolves how executors fetch the project, including the
+// inputs of its Source Control credential.
+func projectSource(ctx context.Context, tx *sqlx.Tx, project models.Project) (*events.ProjectSource, error) {
+	source := &events.ProjectSource{
+		Type:       project.SCMType,
+		Submodules: project.SCMSubmodules,
+		LFS:        project.SCMLFS,
+	}
+	if source.Type == "" {
+		source.Type = models.SCMTypeGit
+	}
+	if project.SCMChecksum != nil {
+		source.Checksum = *project.SCMChecksum
+	}
+
+	if project.CredentialID != nil {
+		var cred struct {
+			TypeName string          `db:"type_name"`
+			Inputs   json.RawMessage `db:"inputs"`
+		}
+		err := tx.GetContext(ctx, &cred, `
+			SELECT ct.name AS type_name, c.inputs
+			FROM credentials c JOIN credential_types ct ON ct.id = c.credential_type_id
+			WHERE c.id = $1`, *project.CredentialID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load credential %d: %w", *project.CredentialID, err)
+		}
+		if cred.TypeName != models.CredentialTypeSourceControl {
+			return nil, fmt.Errorf("credential %d is a %s credential, not %s", *project.CredentialID, cred.TypeName, models.CredentialTypeSourceControl)
+		}
+		var scm events.SCMCredential
+		if err := json.Unmarshal(cred.Inputs, &scm); err != nil {
+			return nil, fmt.Errorf("invalid inputs for credential %d: %w", *project.CredentialID, err)
+		}
+		source.Credential = &scm
+	}
+
+	servers, err := galaxyServers(ctx, tx, project.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	source.GalaxyServers = servers
+	return source, nil
+}
+
+// galaxyServers returns the organization's Galaxy credentials as the ordered
+// list of servers project syncs may install requirements from.
+func galaxyServers(ctx context.Context, tx *sqlx.Tx, orgID int64) ([]events.GalaxyServer, error) {
+	var rows []struct {
+		Name   string          `db:"name"`
+		Inputs json.RawMessage `db:"inputs"`
+	}
+	err := tx.SelectContext(ctx, &rows, `
+		SELECT c.name, c.inputs
+		FROM organization_galaxy_credentials ogc
+		JOIN credentials c ON c.id = ogc.credential_id
+		WHERE ogc.organization_id = $1
+		ORDER BY ogc.position`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Galaxy credentials for organization %d: %w", orgID, err)
+	}
+
+	servers := make([]events.GalaxyServer, 0, len(rows))
+	for _, row := range rows {
+		server := events.GalaxyServer{Name: row.Name}
+		if err := json.Unmarshal(row.Inputs, &server); err != nil {
+			return nil, fmt.Errorf("invalid inputs for Galaxy credential %s: %w", row.Name, err)
+		}
+		server.Name = row.Name
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
@@ -1,24 +1,16 @@
 package core
 
 import (
-	"archive/tar"
-	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"os"
-	"strings"
 	"time"
 
-	"github.com/go-git/go-billy/v5"
-	"github.com/go-git/go-billy/v5/util"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/content"
 	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/inventory"
 	"github.com/praetordev/praetor/pkg/models"
 )
 
@@ -27,6 +19,8 @@ type Scheduler struct {
 	Ticker    *time.Ticker
 	Done      chan bool
 	Publisher EventPublisher
+	Facts     content.Store // Optional; holds the fact caches of queued jobs, which run without them if unset
+	Debug     bool          // Log generated inventories, with sensitive variables masked
 }
 
 func NewScheduler(db *sqlx.DB, interval time.Duration, publisher EventPublisher) *Scheduler {
@@ -45,6 +39,9 @@ func (s *Scheduler) Start() {
 		case <-s.Done:
 			return
 		case <-s.Ticker.C:
+			if err := s.enqueueDueSchedules(); err != nil {
+				log.Printf("Error processing schedules: %v", err)
+			}
 			if err := s.processPendingJobs(); err != nil {
 				log.Printf("Error processing jobs: %v", err)
 			}
@@ -70,7 +67,7 @@ func (s *Scheduler) processPendingJobs() error {
 
 	// 1. Fetch pending jobs with SKIP LOCKED
 	query := `
-		SELECT id, name, unified_job_template_id, status 
+		SELECT id, name, unified_job_template_id, kind, status 
 		FROM unified_jobs 
 		WHERE status = 'pending' AND current_run_id IS NULL
 		FOR UPDATE SKIP LOCKED 
@@ -86,327 +83,294 @@ func (s *Scheduler) processPendingJobs() error {
 	}
 
 	for _, job := range jobs {
-		// 3. Create Execution Run
-		var runID uuid.UUID
-		err := tx.QueryRowContext(ctx, `
-			INSERT INTO execution_runs (unified_job_id, attempt_number, state) 
-			VALUES ($1, 1, 'pending') 
-			RETURNING id`, job.ID).Scan(&runID)
-
-		if err != nil {
-			log.Printf("Failed to create run for job %d: %v", job.ID, err)
-			continue
-		}
-
-		// 4. Update Job
-		_, err = tx.ExecContext(ctx, `
-			UPDATE unified_jobs 
-			SET status = 'queued', current_run_id = $1 
-			WHERE id = $2`, runID, job.ID)
-
-		if err != nil {
-			log.Printf("Failed to update job %d: %v", job.ID, err)
-			continue
-		}
-
-		// 5. Resolve Project from Template - REQUIRES a template with a project
-		if job.UnifiedJobTemplateID == nil {
-			log.Printf("Job %d has no template - skipping (template required)", job.ID)
-			_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
-			continue
-		}
-
-		// Look up Template
-		var template models.JobTemplate
-		err = tx.GetContext(ctx, &template, "SELECT * FROM job_templates WHERE id = $1", *job.UnifiedJobTemplateID)
-		if err != nil {
-			log.Printf("Failed to find template %d for job %d: %v", *job.UnifiedJobTemplateID, job.ID, err)
-			_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
-			continue
-		}
-
-		// Sync from Git project (if provided)
-		var projectURL string
-		if template.ProjectID != nil {
-			var project models.Project
-			err = tx.GetContext(ctx, &project, "SELECT * FROM projects WHERE id = $1", *template.ProjectID)
-			if err != nil {
-				log.Printf("Failed to find project %d for template %s: %v", *template.ProjectID, template.Name, err)
-				_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
-				continue
-			}
-			projectURL = project.SCMURL
-			log.Printf("Using project %s (%s) for job %d", project.Name, project.SCMURL, job.ID)
-		} else {
-			log.Printf("Template %s has no project - using default/inline logic for job %d", template.Name, job.ID)
+		// Each job is scheduled under a savepoint: a failed statement aborts
+		// the transaction, which must not undo the jobs already published
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT schedule_job"); err != nil {
+			return err
 		}
-
-		// 6. Generate inventory from structured hosts and groups
-		var inventoryContent string
-		if template.InventoryID != nil {
-			var inventory models.Inventory
-			err = tx.GetContext(ctx, &inventory, "SELECT * FROM inventories WHERE id = $1", *template.InventoryID)
-			if err != nil {
-				log.Printf("Failed to find inventory %d for template %s: %v", *template.InventoryID, template.Name, err)
-				_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
-				continue
-			}
-
-			// Fetch all hosts in this inventory
-			var hosts []models.Host
-			err = tx.SelectContext(ctx, &hosts, "SELECT * FROM hosts WHERE inventory_id = $1 AND enabled = true", *template.InventoryID)
-			if err != nil {
-				log.Printf("Failed to fetch hosts for inventory %d: %v", *template.InventoryID, err)
-				_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
-				continue
-			}
-
-			// Fetch all groups in this inventory
-			var groups []models.Group
-			err = tx.SelectContext(ctx, &groups, "SELECT * FROM groups WHERE inventory_id = $1", *template.InventoryID)
-			if err != nil {
-				log.Printf("Failed to fetch groups for inventory %d: %v", *template.InventoryID, err)
+		req := s.scheduleJob(ctx, tx, job)
+		if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT schedule_job"); err != nil {
+			log.Printf("Scheduling job %d aborted, failing it: %v", job.ID, err)
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT schedule_job"); err != nil {
+				return err
 			}
-
-			// Build INI inventory
-			inventoryContent = generateInventoryINI(tx, ctx, hosts, groups)
-			log.Printf("Generated inventory for %s (Job %d) Content:\n%s", inventory.Name, job.ID, inventoryContent)
-			log.Printf("Generated inventory for %s with %d hosts and %d groups for job %d", inventory.Name, len(hosts), len(groups), job.ID)
-
-			if len(hosts) == 0 {
-				log.Printf("Inventory %s has no enabled hosts - proceeding anyway to allow Ansible to handle it (e.g. localhost or group vars)", inventory.Name)
+			if _, err := tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed', finished_at = now() WHERE id = $1", job.ID); err != nil {
+				return err
 			}
-		} else {
-			log.Printf("Template %s has no inventory - using default localhost for job %d", template.Name, job.ID)
-			// inventoryContent remains empty, Executor will default to localhost
-		}
-
-		var pbContent string
-		if template.PlaybookContent != nil {
-			pbContent = *template.PlaybookContent
-		}
-
-		manifest := events.JobManifest{
-			Inventory:       inventoryContent,
-			ProjectURL:      projectURL,
-			Playbook:        template.Playbook,
-			PlaybookContent: pbContent,
-			ExtraVars:       map[string]interface{}{},
-			EnvironmentRefs: []string{},
+			continue
 		}
 
-		req := &events.ExecutionRequest{
-			ExecutionRunID: runID,
-			UnifiedJobID:   job.ID,
-			JobManifest:    manifest,
-			CreatedAt:      time.Now(),
+		// Published only once the job's statements all succeeded
+		if req == nil {
+			continue
 		}
-
-		log.Printf("Publishing ExecutionRequest for Job %d. Playbook: %s, PlaybookContent Length: %d", job.ID, manifest.Playbook, len(manifest.PlaybookContent))
-
 		if err := s.Publisher.PublishExecutionRequest(req); err != nil {
-			log.Printf("Failed to publish execution request for run %s: %v", runID, err)
+			log.Printf("Failed to publish execution request for run %s: %v", req.ExecutionRunID, err)
+			failUnpublishedRun(ctx, tx, job.ID, req.ExecutionRunID, err)
 		}
-
 	}
 
 	return tx.Commit()
 }
 
-func findFile(fs billy.Filesystem, path string) (billy.File, error) {
-	// Try direct
-	f, err := fs.Open(path)
-	if err == nil {
-		return f, nil
-	}
+// scheduleJob creates the run of a pending job and returns its execution
+// request, or fails the job and returns nil when it cannot run.
+func (s *Scheduler) scheduleJob(ctx context.Context, tx *sqlx.Tx, job models.UnifiedJob) *events.ExecutionRequest {
+	// 3. Create Execution Run
+	var runID uuid.UUID
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO execution_runs (unified_job_id, attempt_number, state) 
+		VALUES ($1, 1, 'pending') 
+		RETURNING id`, job.ID).Scan(&runID)
 
-	// Try with leading slash
-	if len(path) > 0 && path[0] != '/' {
-		f, err = fs.Open("/" + path)
-		if err == nil {
-			return f, nil
-		}
+	if err != nil {
+		log.Printf("Failed to create run for job %d: %v", job.ID, err)
+		return nil
 	}
 
-	// Walk to find match
-	var foundPath string
-	_ = util.Walk(fs, "/", func(p string, info os.FileInfo, err error) error {
-		if foundPath != "" {
-			return nil
-		}
-
-		// Debug log
-		// log.Printf(" - Visiting: %s", p)
+	// 4. Update Job
+	_, err = tx.ExecContext(ctx, `
+		UPDATE unified_jobs 
+		SET status = 'queued', current_run_id = $1 
+		WHERE id = $2`, runID, job.ID)
 
-		// Match strict but ignoring leading slash for comparison
-		cleanP := p
-		if len(cleanP) > 0 && cleanP[0] == '/' {
-			cleanP = cleanP[1:]
-		}
-		cleanTarget := path
-		if len(cleanTarget) > 0 && cleanTarget[0] == '/' {
-			cleanTarget = cleanTarget[1:]
-		}
-
-		if cleanP == cleanTarget {
-			foundPath = p
-		}
+	if err != nil {
+		log.Printf("Failed to update job %d: %v", job.ID, err)
 		return nil
-	})
-
-	if foundPath != "" {
-		return fs.Open(foundPath)
 	}
 
-	return nil, fmt.Errorf("file not found: %s", path)
-}
-
-// generateInventoryINI converts structured hosts and groups to Ansible INI format
-func generateInventoryINI(tx *sqlx.Tx, ctx context.Context, hosts []models.Host, groups []models.Group) string {
-	var sb strings.Builder
-
-	// Build map of host ID to groups
-	hostGroups := make(map[int64][]string)
-	ungroupedHosts := make(map[int64]bool)
+	// Project updates only need the project, not a job template
+	if job.Kind == models.UnifiedJobKindProjectUpdate {
+		return s.scheduleProjectUpdate(ctx, tx, job, runID)
+	}
+	if job.Kind == models.UnifiedJobKindInventoryUpdate {
+		return s.scheduleInventoryUpdate(ctx, tx, job, runID)
+	}
 
-	for _, h := range hosts {
-		ungroupedHosts[h.ID] = true
+	// 5. Resolve Project from Template - REQUIRES a template with a project
+	if job.UnifiedJobTemplateID == nil {
+		log.Printf("Job %d has no template - skipping (template required)", job.ID)
+		_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+		return nil
 	}
 
-	// Process each group
-	for _, g := range groups {
-		// Get hosts in this group
-		var groupHostIDs []int64
-		tx.SelectContext(ctx, &groupHostIDs, "SELECT host_id FROM host_group_mapping WHERE group_id = $1", g.ID)
-
-		if len(groupHostIDs) > 0 {
-			sb.WriteString(fmt.Sprintf("[%s]\n", g.Name))
-
-			for _, hostID := range groupHostIDs {
-				// Find the host
-				for _, h := range hosts {
-					if h.ID == hostID {
-						sb.WriteString(formatHostLine(h))
-						delete(ungroupedHosts, h.ID)
-						hostGroups[h.ID] = append(hostGroups[h.ID], g.Name)
-						break
-					}
-				}
-			}
-			sb.WriteString("\n")
-		}
+	// Look up Template
+	var template models.JobTemplate
+	err = tx.GetContext(ctx, &template, "SELECT * FROM job_templates WHERE id = $1", *job.UnifiedJobTemplateID)
+	if err != nil {
+		log.Printf("Failed to find template %d for job %d: %v", *job.UnifiedJobTemplateID, job.ID, err)
+		_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+		return nil
 	}
 
-	// Add ungrouped hosts under [all] if any
-	if len(ungroupedHosts) > 0 {
-		sb.WriteString("[ungrouped]\n")
-		for _, h := range hosts {
-			if ungroupedHosts[h.ID] {
-				sb.WriteString(formatHostLine(h))
-			}
+	// Sync from Git project (if provided), pinned to the last synced revision
+	var projectURL, projectRef, projectArchive string
+	var source *events.ProjectSource
+	var projectEnvID *int64
+	if template.ProjectID != nil {
+		var project models.Project
+		err = tx.GetContext(ctx, &project, "SELECT * FROM projects WHERE id = $1", *template.ProjectID)
+		if err != nil {
+			log.Printf("Failed to find project %d for template %s: %v", *template.ProjectID, template.Name, err)
+			_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+			return nil
 		}
-		sb.WriteString("\n")
+		source, err = projectSource(ctx, tx, project)
+		if err != nil {
+			log.Printf("Project %s for template %s cannot be used: %v", project.Name, template.Name, err)
+			_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+			return nil
+		}
+		projectURL = project.SCMURL
+		projectEnvID = project.DefaultEnvironmentID
+		if project.SCMRevision != nil {
+			projectRef = *project.SCMRevision
+			projectArchive = content.ArchiveKey(project.SCMURL, projectRef)
+		} else if project.SCMBranch != nil && source.Type == models.SCMTypeGit {
+			// Never synced: fall back to the branch tip, which is not reproducible
+			projectRef = *project.SCMBranch
+			log.Printf("Project %s has not been synced yet - job %d will use branch %s", project.Name, job.ID, projectRef)
+		}
+		log.Printf("Using project %s (%s@%s) for job %d", project.Name, project.SCMURL, projectRef, job.ID)
+	} else {
+		log.Printf("Template %s has no project - using default/inline logic for job %d", template.Name, job.ID)
 	}
 
-	return sb.String()
-}
-
-// formatHostLine formats a host with its variables for INI
-func formatHostLine(h models.Host) string {
-	var sb strings.Builder
-	sb.WriteString(h.Name)
-
-	// Parse variables JSON
-	// Parse variables JSON
-	var vars map[string]interface{}
-	if h.Variables != nil {
-		_ = json.Unmarshal(h.Variables, &vars)
+	env, err := executionEnvironment(ctx, tx, template.OrganizationID, template.ExecutionEnvironmentID, projectEnvID)
+	if err != nil {
+		log.Printf("Failed to resolve execution environment for job %d: %v", job.ID, err)
+		_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+		return nil
 	}
-	if vars == nil {
-		vars = make(map[string]interface{})
+	if env != nil {
+		log.Printf("Using execution environment %s (%s) for job %d", env.Name, env.Image, job.ID)
 	}
 
-	// Inject ControlMaster=no to prevent Docker crashes
-	if val, ok := vars["ansible_ssh_common_args"]; ok {
-		vars["ansible_ssh_common_args"] = fmt.Sprintf("%v -o ControlMaster=no", val)
-	} else {
-		vars["ansible_ssh_common_args"] = "-o StrictHostKeyChecking=no -o ControlMaster=no"
+	backend, group, err := instanceGroup(ctx, tx, template)
+	if err != nil {
+		log.Printf("Failed to resolve container group for job %d: %v", job.ID, err)
+		_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+		return nil
 	}
-
-	for k, v := range vars {
-		// Quote string values if they contain spaces
-		strVal := fmt.Sprintf("%v", v)
-		if strings.Contains(strVal, " ") {
-			sb.WriteString(fmt.Sprintf(" %s=\"%s\"", k, strVal))
-		} else {
-			sb.WriteString(fmt.Sprintf(" %s=%s", k, strVal))
-		}
+	if group != nil {
+		log.Printf("Running job %d in container group %s (resource class %q)", job.ID, group.Name, group.ResourceClass)
 	}
 
-	sb.WriteString("\n")
-	return sb.String()
-}
-
-// packProjectToTar creates a base64-encoded tar.gz of the entire in-memory filesystem
-func packProjectToTar(fs billy.Filesystem) (string, error) {
-	var buf bytes.Buffer
-	gzw := gzip.NewWriter(&buf)
-	tw := tar.NewWriter(gzw)
-
-	err := util.Walk(fs, "/", func(path string, info os.FileInfo, err error) error {
+	// 6. Generate inventory from structured hosts and groups
+	var inventoryContent string
+	var factCacheObject string
+	if template.InventoryID != nil {
+		inv, err := loadJobInventory(ctx, tx, *template.InventoryID)
 		if err != nil {
-			return err
-		}
-
-		// Skip root
-		if path == "/" {
+			log.Printf("Failed to load inventory %d for template %s: %v", *template.InventoryID, template.Name, err)
+			_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
 			return nil
 		}
 
-		// Create tar header
-		header, err := tar.FileInfoHeader(info, "")
+		inventoryContent, err = renderInventory(inv)
 		if err != nil {
-			return err
+			log.Printf("Failed to render inventory %d for job %d: %v", *template.InventoryID, job.ID, err)
+			_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed' WHERE id = $1", job.ID)
+			return nil
 		}
-
-		// Use relative path (strip leading /)
-		if len(path) > 0 && path[0] == '/' {
-			header.Name = path[1:]
-		} else {
-			header.Name = path
+		log.Printf("Generated inventory %d with %d hosts and %d groups for job %d", *template.InventoryID, len(inv.Hosts), len(inv.Groups), job.ID)
+		if s.Debug {
+			logInventory(ctx, tx, *template.InventoryID, job.ID, inv)
 		}
 
-		if err := tw.WriteHeader(header); err != nil {
-			return err
+		if len(inv.Hosts) == 0 {
+			log.Printf("Inventory %d has no enabled hosts - proceeding anyway to allow Ansible to handle it (e.g. localhost or group vars)", *template.InventoryID)
 		}
 
-		// Write file content if not a directory
-		if !info.IsDir() {
-			file, err := fs.Open(path)
-			if err != nil {
-				return err
+		if err := recordJobHosts(ctx, tx, job.ID, inv); err != nil {
+			log.Printf("Failed to record hosts of job %d: %v", job.ID, err)
+		}
+		if template.UseFactCache {
+			factCache, err := loadFactCache(ctx, tx, inv)
+			if err == nil {
+				factCacheObject, err = s.storeFactCache(ctx, runID, factCache)
 			}
-			defer file.Close()
-
-			_, err = io.Copy(tw, file)
 			if err != nil {
-				return err
+				log.Printf("Failed to load fact cache for job %d - running without it: %v", job.ID, err)
 			}
 		}
+	} else {
+		log.Printf("Template %s has no inventory - using default localhost for job %d", template.Name, job.ID)
+		// inventoryContent remains empty, Executor will default to localhost
+	}
 
-		return nil
-	})
+	var pbContent string
+	if template.PlaybookContent != nil {
+		pbContent = *template.PlaybookContent
+	}
+
+	manifest := events.JobManifest{
+		Inventory:       inventoryContent,
+		ProjectURL:      projectURL,
+		ProjectRef:      projectRef,
+		ProjectArchive:  projectArchive,
+		ProjectSource:   source,
+		Playbook:        template.Playbook,
+		PlaybookContent: pbContent,
+		ExtraVars:       map[string]interface{}{},
+		EnvironmentRefs: []string{},
+		FactCacheObject: factCacheObject,
+
+		ExecutionEnvironment: env,
+		ContainerGroup:       group,
+		Backend:              backend,
+	}
 
+	req := &events.ExecutionRequest{
+		ExecutionRunID: runID,
+		UnifiedJobID:   job.ID,
+		JobManifest:    manifest,
+		CreatedAt:      time.Now(),
+	}
+
+	log.Printf("Publishing ExecutionRequest for Job %d. Playbook: %s, PlaybookContent Length: %d", job.ID, manifest.Playbook, len(manifest.PlaybookContent))
+
+	return req
+}
+
+// failUnpublishedRun fails a run whose execution request could not be
+// queued, as no executor would ever pick it up.
+func failUnpublishedRun(ctx context.Context, tx *sqlx.Tx, jobID int64, runID uuid.UUID, err error) {
+	_, _ = tx.ExecContext(ctx, "UPDATE execution_runs SET state = 'failed', finished_at = now() WHERE id = $1", runID)
+	_, _ = tx.ExecContext(ctx, "UPDATE unified_jobs SET status = 'failed', finished_at = now() WHERE id = $1", jobID)
+	_, _ = tx.ExecContext(ctx, `
+		INSERT INTO job_events (unified_job_id, execution_run_id, seq, event_type, stdout_snippet)
+		VALUES ($1, $2, 1, 'JOB_FAILED', $3)`, jobID, runID, fmt.Sprintf("Failed to queue the job: %v", err))
+}
+
+// loadJobInventory loads the inventory a job runs against. Smart and
+// constructed inventories are evaluated now, so jobs see the hosts that
+// match at launch.
+func loadJobInventory(ctx context.Context, tx *sqlx.Tx, id int64) (*inventory.Inventory, error) {
+	var inv models.Inventory
+	if err := tx.GetContext(ctx, &inv, "SELECT * FROM inventories WHERE id = $1", id); err != nil {
+		return nil, fmt.Errorf("failed to fetch inventory %d: %w", id, err)
+	}
+	switch inv.Kind {
+	case models.InventoryKindSmart:
+		return inventory.LoadSmart(ctx, tx, inv)
+	case models.InventoryKindConstructed:
+		return inventory.LoadConstructed(ctx, tx, inv)
+	}
+	return inventory.Load(ctx, tx, id, false)
+}
+
+// renderInventory renders the inventory's hosts, groups and variables as a
+// JSON document in Ansible's YAML inventory structure.
+func renderInventory(inv *inventory.Inventory) (string, error) {
+	disableControlMaster(inv)
+	data, err := inv.RenderJSON()
 	if err != nil {
 		return "", err
 	}
+	return string(data), nil
+}
 
-	if err := tw.Close(); err != nil {
-		return "", err
+// logInventory logs the inventory generated for a job with the variables its
+// organization's policy treats as sensitive masked.
+func logInventory(ctx context.Context, tx *sqlx.Tx, inventoryID, jobID int64, inv *inventory.Inventory) {
+	var orgID int64
+	if err := tx.GetContext(ctx, &orgID, "SELECT organization_id FROM inventories WHERE id = $1", inventoryID); err != nil {
+		log.Printf("Not logging inventory %d for job %d: %v", inventoryID, jobID, err)
+		return
 	}
-	if err := gzw.Close(); err != nil {
-		return "", err
+	policy, err := inventory.LoadVariablePolicy(ctx, tx, orgID)
+	if err != nil {
+		log.Printf("Not logging inventory %d for job %d: %v", inventoryID, jobID, err)
+		return
+	}
+	data, err := policy.MaskInventory(inv).RenderJSON()
+	if err != nil {
+		log.Printf("Not logging inventory %d for job %d: %v", inventoryID, jobID, err)
+		return
+	}
+	log.Printf("Inventory %d for job %d: %s", inventoryID, jobID, data)
+}
+
+// disableControlMaster adds "-o ControlMaster=no" to every SSH common args
+// setting, defaulting it for all hosts, to prevent Docker crashes.
+func disableControlMaster(inv *inventory.Inventory) {
+	const key = "ansible_ssh_common_args"
+	appendOption := func(vars map[string]interface{}) {
+		if val, ok := vars[key]; ok {
+			vars[key] = fmt.Sprintf("%v -o ControlMaster=no", val)
+		}
 	}
 
-	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+	if _, ok := inv.Vars[key]; ok {
+		appendOption(inv.Vars)
+	} else {
+		inv.Vars[key] = "-o StrictHostKeyChecking=no -o ControlMaster=no"
+	}
+	for _, g := range inv.Groups {
+		appendOption(g.Vars)
+	}
+	for _, h := range inv.Hosts {
+		appendOption(h.Vars)
+	}
 }
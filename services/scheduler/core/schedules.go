@@ -0,0 +1,117 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/models"
+)
+
+// enqueueDueSchedules queues a pending job for every enabled schedule that is
+// due. A schedule whose previous job is still active skips the run, so slow
+// updates do not pile up.
+func (s *Scheduler) enqueueDueSchedules() error {
+	ctx := context.Background()
+
+	tx, err := s.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var due []models.Schedule
+	err = tx.SelectContext(ctx, &due, `
+		SELECT * FROM schedules
+		WHERE enabled AND next_run_at <= now()
+		ORDER BY next_run_at
+		FOR UPDATE SKIP LOCKED
+		LIMIT 50`)
+	if err != nil {
+		return fmt.Errorf("failed to select due schedules: %w", err)
+	}
+
+	now := time.Now()
+	for _, sch := range due {
+		next := nextRunAt(sch.NextRunAt, time.Duration(sch.IntervalSeconds)*time.Second, now)
+
+		jobID, err := enqueueScheduledJob(ctx, tx, sch)
+		if err != nil {
+			log.Printf("Schedule %d (%s) skipped: %v", sch.ID, sch.Name, err)
+			if _, err := tx.ExecContext(ctx, "UPDATE schedules SET next_run_at = $2 WHERE id = $1", sch.ID, next); err != nil {
+				return fmt.Errorf("failed to advance schedule %d: %w", sch.ID, err)
+			}
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE schedules SET next_run_at = $2, last_run_at = now(), last_job_id = $3
+			WHERE id = $1`, sch.ID, next, jobID)
+		if err != nil {
+			return fmt.Errorf("failed to advance schedule %d: %w", sch.ID, err)
+		}
+		log.Printf("Schedule %d (%s) queued %s job %d, next run at %s", sch.ID, sch.Name, sch.Kind, jobID, next.Format(time.RFC3339))
+	}
+
+	return tx.Commit()
+}
+
+// enqueueScheduledJob inserts the pending job for a schedule run.
+func enqueueScheduledJob(ctx context.Context, tx *sqlx.Tx, sch models.Schedule) (int64, error) {
+	table, ok := models.UnifiedJobTemplateTables[sch.Kind]
+	if !ok {
+		return 0, fmt.Errorf("unknown kind %q", sch.Kind)
+	}
+
+	var name string
+	if err := tx.GetContext(ctx, &name, fmt.Sprintf("SELECT name FROM %s WHERE id = $1", table), sch.UnifiedJobTemplateID); err != nil {
+		return 0, fmt.Errorf("failed to find %s %d: %w", table, sch.UnifiedJobTemplateID, err)
+	}
+
+	var active bool
+	err := tx.GetContext(ctx, &active, `
+		SELECT EXISTS (
+			SELECT 1 FROM unified_jobs
+			WHERE kind = $1 AND unified_job_template_id = $2
+			  AND status IN ('pending', 'queued', 'running'))`, sch.Kind, sch.UnifiedJobTemplateID)
+	if err != nil {
+		return 0, err
+	}
+	if active {
+		return 0, fmt.Errorf("a %s job for %s is still active", sch.Kind, name)
+	}
+
+	var jobID int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO unified_jobs (name, unified_job_template_id, kind, status)
+		VALUES ($1, $2, $3, 'pending')
+		RETURNING id`,
+		fmt.Sprintf("%s - %s", name, sch.Name), sch.UnifiedJobTemplateID, sch.Kind,
+	).Scan(&jobID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue job: %w", err)
+	}
+
+	// Updates are tracked on their project or source like manual syncs
+	if sch.Kind != models.UnifiedJobKindJob {
+		query := fmt.Sprintf("UPDATE %s SET last_update_job_id = $1 WHERE id = $2", table)
+		if _, err := tx.ExecContext(ctx, query, jobID, sch.UnifiedJobTemplateID); err != nil {
+			return 0, err
+		}
+	}
+	return jobID, nil
+}
+
+// nextRunAt returns the first run after now on the schedule's cadence.
+// Runs missed while the scheduler was down are not replayed.
+func nextRunAt(last time.Time, interval time.Duration, now time.Time) time.Time {
+	if interval <= 0 {
+		return now
+	}
+	if last.After(now) {
+		return last
+	}
+	return last.Add((now.Sub(last)/interval + 1) * interval)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/praetordev/praetor/services/api"
@@ -11,7 +12,7 @@ import (
 
 func TestAPISkeletonPing(t *testing.T) {
 	// Pass nil DB for skeleton test (ping doesn't need DB)
-	router := api.NewRouter(nil)
+	router := api.NewRouter(nil, nil)
 	ts := httptest.NewServer(router)
 	defer ts.Close()
 
@@ -35,3 +36,79 @@ func TestAPISkeletonPing(t *testing.T) {
 		t.Errorf("Expected pong, got %v", data["status"])
 	}
 }
+
+func TestAPIErrorResponseBody(t *testing.T) {
+	router := api.NewRouter(nil, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Malformed JSON renders the decode error; missing fields render the
+	// generic message of an error-less ErrInvalidRequest
+	for _, body := range []string{"{not json", "{}"} {
+		resp, err := http.Post(ts.URL+"/api/v1/projects", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, resp.StatusCode)
+		}
+
+		var data map[string]string
+		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+			t.Fatalf("%s: failed to decode error response: %v", body, err)
+		}
+		if data["error"] == "" {
+			t.Errorf("%s: expected an error message, got %v", body, data)
+		}
+	}
+}
+
+func TestAPIInventoryRoutes(t *testing.T) {
+	router := api.NewRouter(nil, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Inventory routes by ID must not be shadowed by the nested host and
+	// group routes; an invalid ID is rejected by the handler, not a 404
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/inventories/abc"},
+		{http.MethodPut, "/api/v1/inventories/abc"},
+		{http.MethodPost, "/api/v1/inventories/abc/import"},
+		{http.MethodGet, "/api/v1/inventories/abc/groups"},
+	} {
+		req, err := http.NewRequest(tc.method, ts.URL+tc.path, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s %s: expected status 400, got %d", tc.method, tc.path, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPIRejectsInvalidSCMBranch(t *testing.T) {
+	router := api.NewRouter(nil, nil)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	for _, branch := range []string{"--upload-pack=touch /tmp/pwned", "main..dev", "feature branch", "refs/heads/x.lock"} {
+		body, _ := json.Marshal(map[string]interface{}{
+			"organization_id": 1, "name": "ops", "scm_url": "https://git.example.com/ops.git", "scm_branch": branch,
+		})
+		resp, err := http.Post(ts.URL+"/api/v1/projects", "application/json", strings.NewReader(string(body)))
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d", branch, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/praetordev/praetor/pkg/models"
+	"github.com/praetordev/praetor/services/api"
+	"github.com/praetordev/praetor/services/api/handlers"
+)
+
+// doJSON sends body as JSON and decodes the response into out, if given,
+// returning the response status.
+func doJSON(t *testing.T, method, url string, body, out interface{}) int {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: failed to decode response: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+type bulkErrorResponse struct {
+	Error   string `json:"error"`
+	Details []struct {
+		Index int    `json:"index"`
+		Error string `json:"error"`
+	} `json:"details"`
+}
+
+// indexes returns the indexes of the items the response rejected.
+func (e bulkErrorResponse) indexes() []int {
+	var idx []int
+	for _, d := range e.Details {
+		idx = append(idx, d.Index)
+	}
+	return idx
+}
+
+func TestBulkLimits(t *testing.T) {
+	ts := httptest.NewServer(api.NewRouter(nil, nil))
+	defer ts.Close()
+
+	ids := func(n int) []int64 {
+		out := make([]int64, n)
+		for i := range out {
+			out[i] = int64(i + 1)
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		name string
+		body map[string]interface{}
+		want string
+	}{
+		{"empty", map[string]interface{}{"host_ids": []int64{}}, "no items given"},
+		{"sync", map[string]interface{}{"host_ids": ids(1001)}, "1001 items exceed the limit of 1000; set async to apply up to 100000 in the background"},
+		{"async", map[string]interface{}{"host_ids": ids(100001), "async": true}, "100001 items exceed the limit of 100000"},
+	} {
+		var resp bulkErrorResponse
+		if status := doJSON(t, http.MethodPost, ts.URL+"/api/v1/bulk/host_delete", tc.body, &resp); status != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", tc.name, status)
+		}
+		if resp.Error != tc.want {
+			t.Errorf("%s: got error %q, want %q", tc.name, resp.Error, tc.want)
+		}
+	}
+}
+
+func TestBulkHostCreateIsAllOrNothing(t *testing.T) {
+	db := testDB(t)
+	ts := httptest.NewServer(api.NewRouter(db, nil))
+	defer ts.Close()
+	inv := testInventory(t, db, models.InventoryKindStatic)
+
+	var created struct {
+		Hosts []models.Host `json:"hosts"`
+	}
+	body := map[string]interface{}{"inventory_id": inv, "hosts": []map[string]interface{}{{"name": "web1"}, {"name": "web2", "variables": "ansible_port: 2222"}}}
+	if status := doJSON(t, http.MethodPost, ts.URL+"/api/v1/bulk/host_create", body, &created); status != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", status)
+	}
+	if len(created.Hosts) != 2 || created.Hosts[1].Name != "web2" {
+		t.Fatalf("unexpected hosts created: %+v", created.Hosts)
+	}
+
+	// One valid host among invalid ones is not created either
+	var resp bulkErrorResponse
+	body = map[string]interface{}{"inventory_id": inv, "hosts": []map[string]interface{}{
+		{"name": "web3"}, {"name": "web1"}, {"name": " "}, {"name": "web3"}, {"name": "web4", "variables": "[not, a, mapping]"},
+	}}
+	if status := doJSON(t, http.MethodPost, ts.URL+"/api/v1/bulk/host_create", body, &resp); status != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", status)
+	}
+	if got := fmt.Sprint(resp.indexes()); got != "[1 2 3 4]" {
+		t.Errorf("got errors for items %s, want [1 2 3 4]: %+v", got, resp.Details)
+	}
+	var count int
+	if err := db.Get(&count, "SELECT count(*) FROM hosts WHERE inventory_id = $1", inv); err != nil || count != 2 {
+		t.Errorf("got %d hosts (%v), want the 2 created first", count, err)
+	}
+
+	smart := testInventory(t, db, models.InventoryKindSmart)
+	body = map[string]interface{}{"inventory_id": smart, "hosts": []map[string]interface{}{{"name": "web1"}}}
+	if status := doJSON(t, http.MethodPost, ts.URL+"/api/v1/bulk/host_create", body, &resp); status != http.StatusBadRequest {
+		t.Errorf("smart inventory: expected status 400, got %d", status)
+	}
+}
+
+func TestBulkHostDeleteRejectsHostsNotHeldByHand(t *testing.T) {
+	db := testDB(t)
+	ts := httptest.NewServer(api.NewRouter(db, nil))
+	defer ts.Close()
+
+	static := testInventory(t, db, models.InventoryKindStatic)
+	source := mustExec(t, db, "INSERT INTO inventory_sources (inventory_id, name, source) VALUES ($1, 'cloud', 'plugin') RETURNING id", static)
+	manual := mustExec(t, db, "INSERT INTO hosts (inventory_id, name) VALUES ($1, 'manual') RETURNING id", static)
+	reported := mustExec(t, db, "INSERT INTO hosts (inventory_id, name, inventory_source_id) VALUES ($1, 'reported', $2) RETURNING id", static, source)
+	smart := mustExec(t, db, "INSERT INTO hosts (inventory_id, name) VALUES ($1, 'smart') RETURNING id", testInventory(t, db, models.InventoryKindSmart))
+	constructed := mustExec(t, db, "INSERT INTO hosts (inventory_id, name) VALUES ($1, 'constructed') RETURNING id", testInventory(t, db, models.InventoryKindConstructed))
+
+	var resp bulkErrorResponse
+	body := map[string]interface{}{"host_ids": []int64{manual, reported, smart, constructed, 999999, manual}}
+	if status := doJSON(t, http.MethodPost, ts.URL+"/api/v1/bulk/host_delete", body, &resp); status != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", status)
+	}
+	if got := fmt.Sprint(resp.indexes()); got != "[1 2 3 4 5]" {
+		t.Errorf("got errors for items %s, want [1 2 3 4 5]: %+v", got, resp.Details)
+	}
+	var count int
+	if err := db.Get(&count, "SELECT count(*) FROM hosts"); err != nil || count != 4 {
+		t.Errorf("got %d hosts (%v), want all 4 kept", count, err)
+	}
+
+	// The single host DELETE applies the same rules
+	for id, want := range map[int64]int{reported: http.StatusBadRequest, smart: http.StatusBadRequest, constructed: http.StatusBadRequest, 999999: http.StatusNotFound} {
+		req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/api/v1/hosts/%d", ts.URL, id), nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("DELETE host %d: expected status %d, got %d", id, want, resp.StatusCode)
+		}
+	}
+
+	var deleted map[string]int64
+	if status := doJSON(t, http.MethodPost, ts.URL+"/api/v1/bulk/host_delete", map[string]interface{}{"host_ids": []int64{manual}}, &deleted); status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+	if deleted["deleted"] != 1 {
+		t.Errorf("got %v, want 1 host deleted", deleted)
+	}
+}
+
+// waitForOperation polls the bulk operation until it has one of statuses.
+func waitForOperation(t *testing.T, url string, id int64, statuses ...string) models.BulkOperation {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var op models.BulkOperation
+		doJSON(t, http.MethodGet, fmt.Sprintf("%s/api/v1/bulk/operations/%d", url, id), nil, &op)
+		for _, s := range statuses {
+			if op.Status == s {
+				return op
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bulk operation %d is %s, want one of %v", id, op.Status, statuses)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestBulkAsyncOperationIsNotFailedWhileApplied(t *testing.T) {
+	db := testDB(t)
+	ts := httptest.NewServer(api.NewRouter(db, nil))
+	defer ts.Close()
+	inv := testInventory(t, db, models.InventoryKindStatic)
+
+	// Holding the inventory keeps the operation from finishing
+	tx := db.MustBegin()
+	defer tx.Rollback()
+	if _, err := tx.Exec("SELECT id FROM inventories WHERE id = $1 FOR UPDATE", inv); err != nil {
+		t.Fatal(err)
+	}
+
+	var queued models.BulkOperation
+	body := map[string]interface{}{"inventory_id": inv, "hosts": []map[string]interface{}{{"name": "web1"}}, "async": true}
+	if status := doJSON(t, http.MethodPost, ts.URL+"/api/v1/bulk/host_create", body, &queued); status != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", status)
+	}
+	waitForOperation(t, ts.URL, queued.ID, handlers.BulkStatusRunning)
+
+	// Another API instance starting up leaves it alone
+	if n, err := handlers.NewBulkResource(db).FailInterrupted(context.Background()); err != nil || n != 0 {
+		t.Fatalf("FailInterrupted failed %d operations (%v), want none", n, err)
+	}
+	tx.Rollback()
+
+	op := waitForOperation(t, ts.URL, queued.ID, handlers.BulkStatusSuccessful, handlers.BulkStatusFailed)
+	if op.Status != handlers.BulkStatusSuccessful || !strings.Contains(string(op.Result), `"web1"`) {
+		t.Errorf("got operation %s with result %s errors %s", op.Status, op.Result, op.Errors)
+	}
+}
+
+func TestBulkFailInterrupted(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	insert := func(status string) int64 {
+		return mustExec(t, db, "INSERT INTO bulk_operations (kind, status, item_count) VALUES ('host_delete', $1, 1) RETURNING id", status)
+	}
+	pending, running, applied, done := insert(handlers.BulkStatusPending), insert(handlers.BulkStatusRunning), insert(handlers.BulkStatusRunning), insert(handlers.BulkStatusSuccessful)
+
+	// An instance still applying an operation holds its advisory lock
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", applied); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := handlers.NewBulkResource(db).FailInterrupted(ctx)
+	if err != nil || n != 2 {
+		t.Fatalf("FailInterrupted failed %d operations (%v), want 2", n, err)
+	}
+	for id, want := range map[int64]string{pending: handlers.BulkStatusFailed, running: handlers.BulkStatusFailed, applied: handlers.BulkStatusRunning, done: handlers.BulkStatusSuccessful} {
+		var op models.BulkOperation
+		if err := db.Get(&op, "SELECT * FROM bulk_operations WHERE id = $1", id); err != nil {
+			t.Fatal(err)
+		}
+		if op.Status != want {
+			t.Errorf("operation %d is %s, want %s", id, op.Status, want)
+		}
+		if want == handlers.BulkStatusFailed && (op.FinishedAt == nil || !strings.Contains(string(op.Errors), "interrupted")) {
+			t.Errorf("operation %d failed without finish time or error: %s", id, op.Errors)
+		}
+	}
+}
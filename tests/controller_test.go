@@ -1,53 +0,0 @@
-package tests
-
-import (
-	"context"
-	"testing"
-	"time"
-
-	"github.com/praetordev/praetor/services/controller/reconciler"
-
-	batchv1 "k8s.io/api/batch/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes/fake"
-)
-
-func TestReconcilerLogic(t *testing.T) {
-	// Setup Fake K8s Client
-	k8sClient := fake.NewSimpleClientset()
-
-	// Issue: Reconciler needs a real *sqlx.DB to run processRun because it updates DB.
-	// But we can't easily fake sqlx.DB without sqlmock.
-	// However, we can test just the K8s creation part if we mock the logic or if we construct
-	// the Reconciler?
-	// We can't really test the *full* flow without mocking DB interactions.
-	// But let's verification test the K8s client usage?
-
-	// Actually, `NewSimpleClientset` is great.
-	// If I modify `Reconciler` to take an interface for DB ops? Too much refactor for now.
-	// I'll create a quick sanity check that K8s client works as expected in this env.
-
-	ctx := context.Background()
-	_, err := k8sClient.BatchV1().Jobs("default").Create(ctx, &batchv1.Job{
-		ObjectMeta: metav1.ObjectMeta{Name: "test-job"},
-	}, metav1.CreateOptions{})
-
-	if err != nil {
-		t.Fatalf("Failed to create job in fake client: %v", err)
-	}
-
-	job, err := k8sClient.BatchV1().Jobs("default").Get(ctx, "test-job", metav1.GetOptions{})
-	if err != nil {
-		t.Fatalf("Failed to get job: %v", err)
-	}
-
-	if job.Name != "test-job" {
-		t.Errorf("Expected test-job, got %s", job.Name)
-	}
-
-	// For actual Reconciler instantiation test:
-	rec := reconciler.NewReconciler(nil, k8sClient, 1*time.Second)
-	if rec == nil {
-		t.Fatal("Reconciler failed to instantiate")
-	}
-}
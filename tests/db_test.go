@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// testDB connects to the Postgres server at PRAETOR_TEST_DATABASE_URL, in a
+// schema of the test's own with every migration applied, and drops the
+// schema when the test ends. Tests needing a database are skipped without one.
+func testDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	dsn := os.Getenv("PRAETOR_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("PRAETOR_TEST_DATABASE_URL not set")
+	}
+
+	admin, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("praetor_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("PRAETOR_TEST_DATABASE_URL must be a postgres:// URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema+",public")
+	u.RawQuery = q.Encode()
+	db, err := sqlx.Connect("postgres", u.String())
+	if err != nil {
+		t.Fatalf("Failed to connect to schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// Applied in order as cmd/migrator does
+	ups, err := filepath.Glob("../db/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ups)
+	for _, f := range ups {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(content)); err != nil {
+			t.Fatalf("Failed to apply %s: %v", f, err)
+		}
+	}
+	return db
+}
+
+// mustExec runs a statement setting up a test, returning the id it reports
+// if it has a RETURNING id clause.
+func mustExec(t *testing.T, db *sqlx.DB, query string, args ...interface{}) int64 {
+	t.Helper()
+	var id int64
+	if err := db.QueryRowx(query, args...).Scan(&id); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("Failed to run %q: %v", query, err)
+	}
+	return id
+}
+
+// testInventory creates an organization and an inventory of kind in it.
+func testInventory(t *testing.T, db *sqlx.DB, kind string) int64 {
+	t.Helper()
+	org := mustExec(t, db, "INSERT INTO organizations (name) VALUES ($1) ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING id", "Default")
+	return mustExec(t, db, "INSERT INTO inventories (organization_id, name, kind) VALUES ($1, $2, $3) RETURNING id", org, fmt.Sprintf("%s %d", kind, time.Now().UnixNano()), kind)
+}
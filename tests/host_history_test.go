@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/praetordev/praetor/pkg/events"
+	"github.com/praetordev/praetor/pkg/models"
+	"github.com/praetordev/praetor/services/api"
+	consumer "github.com/praetordev/praetor/services/consumer/core"
+)
+
+// testRun is a job with one execution run, writing its events through the
+// consumer's DBWriter.
+type testRun struct {
+	t      *testing.T
+	writer *consumer.DBWriter
+	jobID  int64
+	runID  uuid.UUID
+	seq    int64
+}
+
+// startTestRun creates a job that runs against hosts, keyed by name.
+func startTestRun(t *testing.T, db *sqlx.DB, hosts map[string]int64) *testRun {
+	t.Helper()
+	run := &testRun{t: t, writer: consumer.NewDBWriter(db)}
+	run.jobID = mustExec(t, db, "INSERT INTO unified_jobs (name, status) VALUES ('deploy', 'running') RETURNING id")
+	if err := db.Get(&run.runID, "INSERT INTO execution_runs (unified_job_id) VALUES ($1) RETURNING id", run.jobID); err != nil {
+		t.Fatal(err)
+	}
+	for name, id := range hosts {
+		mustExec(t, db, "INSERT INTO job_hosts (unified_job_id, host_id, host_name) VALUES ($1, $2, $3)", run.jobID, id, name)
+	}
+	return run
+}
+
+// write writes the run's next event, about host unless it is empty.
+func (r *testRun) write(eventType, host string, data interface{}) {
+	r.t.Helper()
+	r.seq++
+	evt := events.JobEvent{ExecutionRunID: r.runID, UnifiedJobID: r.jobID, Seq: r.seq, EventType: eventType, Timestamp: time.Now()}
+	if host != "" {
+		evt.Host = &host
+	}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			r.t.Fatal(err)
+		}
+		evt.EventData = raw
+	}
+	if err := r.writer.WriteEvent(context.Background(), evt); err != nil {
+		r.t.Fatalf("Failed to write %s event: %v", eventType, err)
+	}
+}
+
+// complete writes the run's play recap in a JOB_COMPLETED event, as the
+// executor reports playbook_on_stats.
+func (r *testRun) complete(stats map[string]map[string]int) {
+	r.t.Helper()
+	r.write("JOB_COMPLETED", "", map[string]interface{}{"event": "playbook_on_stats", "event_data": stats})
+}
+
+type testHost struct {
+	LastJobID         *int64 `db:"last_job_id"`
+	HasActiveFailures bool   `db:"has_active_failures"`
+}
+
+func checkHost(t *testing.T, db *sqlx.DB, id, lastJob int64, failures bool) {
+	t.Helper()
+	var h testHost
+	if err := db.Get(&h, "SELECT last_job_id, has_active_failures FROM hosts WHERE id = $1", id); err != nil {
+		t.Fatal(err)
+	}
+	if h.LastJobID == nil || *h.LastJobID != lastJob || h.HasActiveFailures != failures {
+		t.Errorf("host %d has last job %v and active failures %v, want %d and %v", id, h.LastJobID, h.HasActiveFailures, lastJob, failures)
+	}
+}
+
+func checkSummary(t *testing.T, db *sqlx.DB, jobID, hostID int64, ok, changed, failed int) {
+	t.Helper()
+	var summaries []models.JobHostSummary
+	if err := db.Select(&summaries, "SELECT * FROM job_host_summaries WHERE unified_job_id = $1 AND host_id = $2", jobID, hostID); err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("got %d summaries of host %d in job %d, want 1", len(summaries), hostID, jobID)
+	}
+	if s := summaries[0]; s.Ok != ok || s.Changed != changed || s.Failed != failed {
+		t.Errorf("summary of host %d in job %d is ok=%d changed=%d failed=%d, want %d, %d, %d", hostID, jobID, s.Ok, s.Changed, s.Failed, ok, changed, failed)
+	}
+}
+
+type summaryPage struct {
+	Items []models.JobHostSummary `json:"items"`
+	Total int64                   `json:"total"`
+}
+
+type eventPage struct {
+	Items []models.JobEvent `json:"items"`
+	Total int64             `json:"total"`
+}
+
+func TestHostJobHistory(t *testing.T) {
+	db := testDB(t)
+	ts := httptest.NewServer(api.NewRouter(db, nil))
+	defer ts.Close()
+
+	inv := testInventory(t, db, models.InventoryKindStatic)
+	web1 := mustExec(t, db, "INSERT INTO hosts (inventory_id, name) VALUES ($1, 'web1') RETURNING id", inv)
+	web2 := mustExec(t, db, "INSERT INTO hosts (inventory_id, name) VALUES ($1, 'web2') RETURNING id", inv)
+	db1 := mustExec(t, db, "INSERT INTO hosts (inventory_id, name) VALUES ($1, 'db1') RETURNING id", inv)
+
+	first := startTestRun(t, db, map[string]int64{"web1": web1, "web2": web2})
+	first.write("JOB_STARTED", "", nil)
+	first.write("runner_on_ok", "web1", nil)
+	first.write("runner_on_failed", "web2", nil)
+	first.complete(map[string]map[string]int{"ok": {"web1": 1, "web2": 1}, "failures": {"web2": 1}})
+	// A recap delivered again replaces the summaries
+	first.complete(map[string]map[string]int{"ok": {"web1": 2, "web2": 1}, "changed": {"web1": 1}, "failures": {"web2": 1}})
+
+	checkSummary(t, db, first.jobID, web1, 2, 1, 0)
+	checkSummary(t, db, first.jobID, web2, 1, 0, 1)
+	checkHost(t, db, web1, first.jobID, false)
+	checkHost(t, db, web2, first.jobID, true)
+
+	hostNames := func(query string) []string {
+		var hosts []models.Host
+		if status := doJSON(t, http.MethodGet, fmt.Sprintf("%s/api/v1/inventories/%d/hosts%s", ts.URL, inv, query), nil, &hosts); status != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", query, status)
+		}
+		var names []string
+		for _, h := range hosts {
+			names = append(names, h.Name)
+		}
+		return names
+	}
+	if got := fmt.Sprint(hostNames("?has_active_failures=true")); got != "[web2]" {
+		t.Errorf("got hosts with active failures %s, want [web2]", got)
+	}
+	if got := fmt.Sprint(hostNames("?has_active_failures=false")); got != "[db1 web1]" {
+		t.Errorf("got hosts without active failures %s, want [db1 web1]", got)
+	}
+	if got := fmt.Sprint(hostNames("")); got != "[db1 web1 web2]" {
+		t.Errorf("got hosts %s, want [db1 web1 web2]", got)
+	}
+
+	// A later job succeeding clears the failure; the first job's recap
+	// arriving late does not bring it back
+	second := startTestRun(t, db, map[string]int64{"web2": web2})
+	second.write("runner_on_ok", "web2", nil)
+	second.complete(map[string]map[string]int{"ok": {"web2": 3}})
+	first.complete(map[string]map[string]int{"ok": {"web1": 2, "web2": 1}, "changed": {"web1": 1}, "failures": {"web2": 1}})
+	checkHost(t, db, web2, second.jobID, false)
+	checkHost(t, db, web1, first.jobID, false)
+
+	var summaries summaryPage
+	doJSON(t, http.MethodGet, fmt.Sprintf("%s/api/v1/hosts/%d/job_host_summaries", ts.URL, web2), nil, &summaries)
+	if summaries.Total != 2 || len(summaries.Items) != 2 || summaries.Items[0].UnifiedJobID != second.jobID || summaries.Items[1].UnifiedJobID != first.jobID {
+		t.Errorf("got summaries %+v of web2, want those of the second and first job", summaries)
+	}
+	doJSON(t, http.MethodGet, fmt.Sprintf("%s/api/v1/hosts/%d/job_host_summaries?limit=1&offset=1", ts.URL, web2), nil, &summaries)
+	if summaries.Total != 2 || len(summaries.Items) != 1 || summaries.Items[0].UnifiedJobID != first.jobID {
+		t.Errorf("got page %+v of web2's summaries, want the first job's", summaries)
+	}
+	doJSON(t, http.MethodGet, fmt.Sprintf("%s/api/v1/hosts/%d/job_host_summaries", ts.URL, db1), nil, &summaries)
+	if summaries.Total != 0 || len(summaries.Items) != 0 {
+		t.Errorf("got summaries %+v of db1, want none", summaries)
+	}
+
+	var jobEvents eventPage
+	doJSON(t, http.MethodGet, fmt.Sprintf("%s/api/v1/hosts/%d/job_events", ts.URL, web2), nil, &jobEvents)
+	if jobEvents.Total != 2 || len(jobEvents.Items) != 2 || jobEvents.Items[0].EventType != "runner_on_ok" || jobEvents.Items[1].EventType != "runner_on_failed" {
+		t.Errorf("got events %+v of web2, want its event in each job", jobEvents)
+	}
+	doJSON(t, http.MethodGet, fmt.Sprintf("%s/api/v1/hosts/%d/job_events?job_id=%d", ts.URL, web2, first.jobID), nil, &jobEvents)
+	if jobEvents.Total != 1 || len(jobEvents.Items) != 1 || jobEvents.Items[0].UnifiedJobID != first.jobID {
+		t.Errorf("got events %+v of web2 in the first job, want one", jobEvents)
+	}
+	doJSON(t, http.MethodGet, fmt.Sprintf("%s/api/v1/hosts/%d/job_events?limit=1", ts.URL, web2), nil, &jobEvents)
+	if jobEvents.Total != 2 || len(jobEvents.Items) != 1 || jobEvents.Items[0].UnifiedJobID != second.jobID {
+		t.Errorf("got page %+v of web2's events, want the second job's", jobEvents)
+	}
+	doJSON(t, http.MethodGet, fmt.Sprintf("%s/api/v1/hosts/%d/job_events", ts.URL, web1), nil, &jobEvents)
+	if jobEvents.Total != 1 || len(jobEvents.Items) != 1 || jobEvents.Items[0].EventType != "runner_on_ok" {
+		t.Errorf("got events %+v of web1, want its one event", jobEvents)
+	}
+}
+
+func TestListHostsRejectsInvalidFailureFilter(t *testing.T) {
+	ts := httptest.NewServer(api.NewRouter(nil, nil))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/inventories/1/hosts?has_active_failures=maybe")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", resp.StatusCode)
+	}
+}
@@ -146,13 +146,11 @@ function App() {
 
   const handleSyncProject = (id: number) => {
     return fetch(`/api/v1/projects/${id}/sync`, { method: 'POST' })
-      .then(res => res.json())
-      .then(data => {
-        if (data.success) {
+      .then(res => res.json().then(data => ({ ok: res.ok, data })))
+      .then(({ ok, data }) => {
+        if (ok) {
           fetchProjects() // Refresh
-          const cleanRev = data.revision ? data.revision.trim() : 'N/A'
-          const cleanMsg = data.commit_msg ? data.commit_msg.trim() : 'N/A'
-          alert(`✅ Project Synced Successfully!\n\nVerified Commit: ${cleanRev}\nSubject: ${cleanMsg}`)
+          alert(`Project update queued (job #${data.id}, status: ${data.status}).\nThe synced revision is recorded when the update finishes.`)
           return true
         } else {
           alert('Sync Failed: ' + data.error)
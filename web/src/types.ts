@@ -20,6 +20,14 @@ export interface Project {
     name: string;
     scm_url: string;
     scm_type: string;
+    scm_branch?: string;
+    scm_submodules?: boolean;
+    scm_lfs?: boolean;
+    scm_checksum?: string;
+    credential_id?: number;
+    default_environment_id?: number;
+    scm_revision?: string;
+    last_synced_at?: string;
     modified_at?: string;
 }
 
@@ -30,12 +38,40 @@ export interface JobTemplate {
     inventory_id?: number;
     playbook: string;
     organization_id: number;
+    use_fact_cache?: boolean;
+    execution_environment_id?: number;
+    instance_group_id?: number;
+    resource_class?: string;
+}
+
+export interface InstanceGroup {
+    id: number;
+    name: string;
+    backend: '' | 'process' | 'docker' | 'podman' | 'kubernetes';
+    is_container_group: boolean;
+    pod_spec_override?: object;
+    resource_classes: Record<string, object>;
+}
+
+export interface ExecutionEnvironment {
+    id: number;
+    organization_id?: number;
+    name: string;
+    image: string;
+    description?: string;
+    credential_id?: number;
+    pull: '' | 'always' | 'missing' | 'never';
+    is_default: boolean;
 }
 
 export interface Inventory {
     id: number;
     name: string;
     organization_id: number;
+    kind?: 'static' | 'smart' | 'constructed';
+    host_filter?: string;
+    constructed_rules?: object;
+    variables?: object;
 }
 
 export interface Host {
@@ -44,6 +80,10 @@ export interface Host {
     name: string;
     variables?: object;
     enabled: boolean;
+    inventory_source_id?: number;
+    last_job_id?: number;
+    last_job_host_summary_id?: number;
+    has_active_failures: boolean;
 }
 
 export interface Group {
@@ -51,4 +91,15 @@ export interface Group {
     inventory_id: number;
     name: string;
     variables?: object;
+    inventory_source_id?: number;
+}
+
+export interface JobArtifacts {
+    unified_job_id: number;
+    execution_run_id: string;
+    artifact_data: Record<string, unknown>;
+    rc?: number;
+    status: string;
+    archive?: string;
+    created_at: string;
 }